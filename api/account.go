@@ -1,13 +1,12 @@
 package api
 
 import (
-	"database/sql"
-	"fmt"
+	"lesson/simple-bank/apierror"
 	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/token"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
 )
 
 type createAccountRequest struct {
@@ -19,7 +18,7 @@ func (server *Server) CreateAccount(ctx *gin.Context) {
 	var req createAccountRequest
 	err := ctx.ShouldBindJSON(&req)
 	if err!= nil {
-		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		abortWithError(ctx, apierror.FromBinding(err))
 		return
 	}
 
@@ -27,17 +26,9 @@ func (server *Server) CreateAccount(ctx *gin.Context) {
 		Owner:    req.Owner,
         Currency: req.Currency,
 	}
-	account, err := server.store.CreateAccount(ctx, arg)
+	account, err := server.store.CreateAccountTx(ctx, arg)
     if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			fmt.Println(pqErr.Code.Name())
-			switch pqErr.Code.Name() {
-				case "unique_violation", "foreign_key_violation":
-					ctx.JSON(http.StatusForbidden, errResponse(err))
-					return
-			}
-		}
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		abortWithError(ctx, apierror.FromDB(err, apierror.DuplicateAccount, apierror.OwnerNotFound))
 		return
 	}
 
@@ -51,17 +42,13 @@ type getAccountRequest struct {
 func (server *Server) GetAccount(ctx *gin.Context) {
 	var req getAccountRequest
 	if err := ctx.ShouldBindUri(&req); err!= nil {
-		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		abortWithError(ctx, apierror.FromBinding(err))
         return
 	}
 
 	account, err := server.store.GetAccount(ctx, req.ID)
 	if err!= nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errResponse(err))
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		abortWithError(ctx, apierror.FromDB(err, apierror.AccountNotFound))
         return
 	}
 	ctx.JSON(http.StatusOK, account)
@@ -75,17 +62,20 @@ type listAccountRequest struct {
 func (server *Server) ListAccount(ctx *gin.Context) {
 	var req listAccountRequest
 	if err := ctx.ShouldBindJSON(&req); err!= nil {
-		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		abortWithError(ctx, apierror.FromBinding(err))
         return
 	}
 
-	arg := db.ListAccountParams {
+	// only the accounts of the authenticated user, like the ListAccounts RPC
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	arg := db.ListOwnerAccountsParams {
+		Owner: payload.Username,
 		Limit: req.PageSize,
 		Offset: (req.PageId-1) * req.PageSize, 
 	}
-	accounts, err := server.store.ListAccount(ctx, arg)
+	accounts, err := server.store.ListOwnerAccounts(ctx, arg)
 	if err!= nil {
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		abortWithError(ctx, apierror.Internal(err))
         return
 	}
 	ctx.JSON(http.StatusOK, accounts)
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	mockdb "lesson/simple-bank/db/mock"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func randomAccount(owner string, currency string) db.Account {
+	return db.Account{
+		ID:        utils.RandomInt(1, 1000),
+		Owner:     owner,
+		Balance:   utils.RandomMoney(),
+		Currency:  currency,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// serveJSON sends body as the JSON body of the request and records the response
+func serveJSON(t *testing.T, server *Server, method string, url string, body interface{}) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(method, url, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// serveAuthorizedJSON is serveJSON with a bearer token of username
+func serveAuthorizedJSON(t *testing.T, server *Server, method string, url string, body interface{}, username string) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	accessToken, _, err := server.tokenMaker.CreateToken(username, time.Minute)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(method, url, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func requireBodyMatch(t *testing.T, recorder *httptest.ResponseRecorder, expected interface{}) {
+	require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+	want, err := json.Marshal(expected)
+	require.NoError(t, err)
+	require.JSONEq(t, string(want), recorder.Body.String())
+}
+
+func TestCreateAccountAPI(t *testing.T) {
+	account := randomAccount(utils.RandomOwner(), "USD")
+	account.Balance = 0
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"owner": account.Owner, "currency": account.Currency},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateAccountParams{Owner: account.Owner, Currency: account.Currency}
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, account)
+			},
+		},
+		{
+			name: "InvalidCurrency",
+			body: gin.H{"owner": account.Owner, "currency": "YEN"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "currency", Message: "must be one of TWD, USD, EUR"}}, problem.Errors)
+			},
+		},
+		{
+			name: "MissingOwner",
+			body: gin.H{"currency": account.Currency},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "owner", Message: "is required"}}, problem.Errors)
+			},
+		},
+		{
+			name: "DuplicateAccount",
+			body: gin.H{"owner": account.Owner, "currency": account.Currency},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.Account{}, &pq.Error{Code: "23505", Constraint: "owner_currency_key"})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireProblem(t, recorder, apierror.DuplicateAccount)
+			},
+		},
+		{
+			name: "OwnerNotFound",
+			body: gin.H{"owner": account.Owner, "currency": account.Currency},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.Account{}, &pq.Error{Code: "23503", Constraint: "accounts_owner_fkey"})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireProblem(t, recorder, apierror.OwnerNotFound)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"owner": account.Owner, "currency": account.Currency},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccountTx(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, sql.ErrConnDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InternalError)
+				require.Empty(t, problem.Detail)
+				require.NotContains(t, recorder.Body.String(), sql.ErrConnDone.Error())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := serveJSON(t, server, http.MethodPost, "/accounts", tc.body)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetAccountAPI(t *testing.T) {
+	account := randomAccount(utils.RandomOwner(), "USD")
+
+	testCases := []struct {
+		name          string
+		accountID     int64
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "OK",
+			accountID: account.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, account)
+			},
+		},
+		{
+			name:      "NotFound",
+			accountID: account.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireProblem(t, recorder, apierror.AccountNotFound)
+			},
+		},
+		{
+			name:      "InternalError",
+			accountID: account.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, sql.ErrConnDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, apierror.InternalError)
+			},
+		},
+		{
+			name:      "InvalidID",
+			accountID: 0,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "id", Message: "is required"}}, problem.Errors)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", tc.accountID), nil)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestListAccountAPI(t *testing.T) {
+	n := 5
+	owner := utils.RandomOwner()
+	accounts := make([]db.Account, n)
+	for i := range accounts {
+		accounts[i] = randomAccount(owner, "TWD")
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"page_id": 2, "page_size": n},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListOwnerAccountsParams{Owner: owner, Limit: int32(n), Offset: int32(n)}
+				store.EXPECT().ListOwnerAccounts(gomock.Any(), gomock.Eq(arg)).Times(1).Return(accounts, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, accounts)
+			},
+		},
+		{
+			name: "PageSizeTooLarge",
+			body: gin.H{"page_id": 1, "page_size": 11},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListOwnerAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "page_size", Message: "must be at most 10"}}, problem.Errors)
+			},
+		},
+		{
+			name: "InvalidPageID",
+			body: gin.H{"page_id": "first", "page_size": n},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListOwnerAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "page_id", Message: "must be an integer"}}, problem.Errors)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"page_id": 1, "page_size": n},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListOwnerAccounts(gomock.Any(), gomock.Any()).Times(1).Return(nil, sql.ErrConnDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, apierror.InternalError)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := serveAuthorizedJSON(t, server, http.MethodGet, "/accounts", tc.body, owner)
+			tc.checkResponse(recorder)
+		})
+	}
+
+	server := newTestServer(t, mockdb.NewMockStore(gomock.NewController(t)))
+	recorder := serveJSON(t, server, http.MethodGet, "/accounts", gin.H{"page_id": 1, "page_size": n})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	requireProblem(t, recorder, apierror.Unauthenticated)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"database/sql"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type listAuditEventsRequest struct {
+	Actor        string    `form:"actor"`
+	Action       string    `form:"action"`
+	ResourceType string    `form:"resource_type"`
+	ResourceID   string    `form:"resource_id"`
+	RequestID    string    `form:"request_id"`
+	From         time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To           time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	PageId       int32     `form:"page_id" binding:"required,min=1"`
+	PageSize     int32     `form:"page_size" binding:"required,min=1,max=100"`
+}
+
+// ListAuditEvents searches the audit log, every filter is optional
+func (server *Server) ListAuditEvents(ctx *gin.Context) {
+	var req listAuditEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	arg := db.ListAuditEventsParams{
+		Actor:        nullString(req.Actor),
+		Action:       nullString(req.Action),
+		ResourceType: nullString(req.ResourceType),
+		ResourceID:   nullString(req.ResourceID),
+		RequestID:    nullString(req.RequestID),
+		CreatedFrom:  nullTime(req.From),
+		CreatedTo:    nullTime(req.To),
+		Size:         req.PageSize,
+		Skip:         (req.PageId - 1) * req.PageSize,
+	}
+	events, err := server.store.ListAuditEvents(ctx, arg)
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, events)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// abortWithError writes err as problem details and stops the handler chain
+func abortWithError(ctx *gin.Context, err *apierror.Error) {
+	ctx.Set(problemCodeKey, err.Code)
+	ctx.Header("Content-Type", apierror.ContentType)
+	ctx.AbortWithStatusJSON(err.Status(), problem(ctx, err))
+}
+
+// problem returns the problem details of err for the request, the cause of internal errors is only logged
+// by requestLogMiddleware
+func problem(ctx *gin.Context, err *apierror.Error) apierror.Problem {
+	requestID := db.AuditMetaFrom(ctx).RequestID
+	if err.Code == apierror.InternalError {
+		ctx.Error(err)
+	}
+	return err.Problem(ctx.Request.URL.Path, requestID)
+}
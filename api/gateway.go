@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gatewayHandler passes the request id of the gin request on to the gRPC call. The gateway forwards
+// RemoteAddr as the client address, it becomes the client IP gin resolved with the trusted proxies.
+func gatewayHandler(gateway http.Handler) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		request := ctx.Request.Clone(ctx.Request.Context())
+		request.Header.Set(requestIDHeaderKey, ctx.Writer.Header().Get(requestIDHeaderKey))
+		request.Header.Del("X-Forwarded-For")
+		request.RemoteAddr = net.JoinHostPort(ctx.ClientIP(), "0")
+		gateway.ServeHTTP(ctx.Writer, request)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"lesson/simple-bank/buildinfo"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds every readiness check, so a hanging dependency fails the probe instead of blocking it
+const readinessTimeout = 2 * time.Second
+
+const (
+	statusOK           = "ok"
+	statusFailing      = "failing"
+	statusShuttingDown = "shutting_down"
+)
+
+// ReadinessCheck fails when the server can't serve requests, such as when the db is unreachable
+type ReadinessCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// AddReadinessCheck adds a check to /readyz, it must be called before the server starts
+func (server *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	server.readinessChecks = append(server.readinessChecks, namedCheck{name: name, check: check})
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+// Healthz tells that the process is alive and serving
+func (server *Server) Healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, healthResponse{Status: statusOK})
+}
+
+type readinessResponse struct {
+	Status string           `json:"status"`
+	Checks []readinessCheck `json:"checks"`
+}
+
+type readinessCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Readyz runs the readiness checks, it fails once the server is shutting down so the
+// load balancer stops routing requests to it
+func (server *Server) Readyz(ctx *gin.Context) {
+	if server.shuttingDown.Load() {
+		ctx.JSON(http.StatusServiceUnavailable, readinessResponse{Status: statusShuttingDown, Checks: []readinessCheck{}})
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	rsp := readinessResponse{Status: statusOK, Checks: make([]readinessCheck, len(server.readinessChecks))}
+	var wg sync.WaitGroup
+	for i, check := range server.readinessChecks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			result := readinessCheck{Name: check.name, Status: statusOK}
+			if err := check.check(checkCtx); err != nil {
+				result.Status, result.Error = statusFailing, err.Error()
+			}
+			rsp.Checks[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, check := range rsp.Checks {
+		if check.Status != statusOK {
+			rsp.Status, status = statusFailing, http.StatusServiceUnavailable
+		}
+	}
+	ctx.JSON(status, rsp)
+}
+
+type versionResponse struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Version returns the build of the running binary
+func (server *Server) Version(ctx *gin.Context) {
+	info := buildinfo.Get()
+	ctx.JSON(http.StatusOK, versionResponse{
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		GoVersion: info.GoVersion,
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lesson/simple-bank/db/memstore"
+	"lesson/simple-bank/metrics"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func serveGet(server *Server, url string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+	return recorder
+}
+
+func TestHealthz(t *testing.T) {
+	server := newTestServer(t, memstore.New())
+
+	recorder := serveGet(server, "/healthz")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"status":"ok"}`, recorder.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	server := newTestServer(t, memstore.New())
+	var dbErr error
+	server.AddReadinessCheck("database", func(ctx context.Context) error { return dbErr })
+	server.AddReadinessCheck("workers", func(ctx context.Context) error { return nil })
+
+	readiness := func(status int) readinessResponse {
+		recorder := serveGet(server, "/readyz")
+		require.Equal(t, status, recorder.Code)
+		var rsp readinessResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+		return rsp
+	}
+
+	rsp := readiness(http.StatusOK)
+	require.Equal(t, readinessResponse{Status: statusOK, Checks: []readinessCheck{
+		{Name: "database", Status: statusOK},
+		{Name: "workers", Status: statusOK},
+	}}, rsp)
+
+	dbErr = errors.New("connection refused")
+	rsp = readiness(http.StatusServiceUnavailable)
+	require.Equal(t, readinessResponse{Status: statusFailing, Checks: []readinessCheck{
+		{Name: "database", Status: statusFailing, Error: "connection refused"},
+		{Name: "workers", Status: statusOK},
+	}}, rsp)
+
+	dbErr = nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+	rsp = readiness(http.StatusServiceUnavailable)
+	require.Equal(t, statusShuttingDown, rsp.Status)
+}
+
+func TestReadyzTimeout(t *testing.T) {
+	server := newTestServer(t, memstore.New())
+	server.AddReadinessCheck("database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	recorder := serveGet(server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Contains(t, recorder.Body.String(), context.DeadlineExceeded.Error())
+	require.Less(t, time.Since(start), readinessTimeout+time.Second)
+}
+
+func TestVersion(t *testing.T) {
+	server := newTestServer(t, memstore.New())
+
+	recorder := serveGet(server, "/version")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp versionResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+	require.Equal(t, runtime.Version(), rsp.GoVersion)
+	require.NotEmpty(t, rsp.Commit)
+	require.NotEmpty(t, rsp.BuildTime)
+}
+
+func TestMetrics(t *testing.T) {
+	store := memstore.New()
+	server := newTestServer(t, store)
+	account1 := createAccount(t, store, 100)
+	account2 := createAccount(t, store, 100)
+
+	recorder := serveGet(server, fmt.Sprintf("/accounts/%d", account1.ID+1000))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/transfers", transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: "USD"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = serveJSON(t, server, http.MethodPost, "/transfers", transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: "EUR"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// the metrics aren't public, serve serves them on METRICSADDRESS
+	recorder = serveGet(server, "/metrics")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	// the route template is the label, not the path with the account id
+	require.Contains(t, body, `simple_bank_http_requests_total{method="GET",route="/accounts/:id",status="404"}`)
+	require.NotContains(t, body, strconv.FormatInt(account1.ID+1000, 10)+`"`)
+	require.Contains(t, body, `simple_bank_transfers_created_total{currency="USD"}`)
+	require.Contains(t, body, `simple_bank_transfer_volume_total{currency="USD"}`)
+	require.Contains(t, body, `simple_bank_transfers_failed_total{reason="currency_mismatch"}`)
+}
@@ -0,0 +1,433 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/iso20022"
+	"lesson/simple-bank/logging"
+	"lesson/simple-bank/metrics"
+	"lesson/simple-bank/token"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// the largest pain.001 upload accepted
+	maxImportFileSize = 10 << 20
+	// a running import job is claimed for this long, the claim is renewed before each transaction
+	// and another instance resumes the job once it expired
+	importJobLease = time.Minute
+	// the number of stale import jobs claimed at once
+	importResumeBatchSize = 10
+)
+
+type importTransactionResponse struct {
+	ID            int64  `json:"id"`
+	PaymentInfoID string `json:"payment_info_id"`
+	EndToEndID    string `json:"end_to_end_id"`
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	ReasonCode    string `json:"reason_code,omitempty"`
+	TransferID    *int64 `json:"transfer_id,omitempty"`
+}
+
+type importJobResponse struct {
+	ID              int64                       `json:"id"`
+	MessageID       string                      `json:"message_id"`
+	InitiatingParty string                      `json:"initiating_party"`
+	TxCount         int64                       `json:"tx_count"`
+	Status          string                      `json:"status"`
+	CreatedAt       time.Time                   `json:"created_at"`
+	FinishedAt      *time.Time                  `json:"finished_at,omitempty"`
+	Transactions    []importTransactionResponse `json:"transactions"`
+}
+
+func newImportJobResponse(job db.ImportJob, txs []db.ImportTransaction) importJobResponse {
+	rsp := importJobResponse{
+		ID:              job.ID,
+		MessageID:       job.MessageID,
+		InitiatingParty: job.InitiatingParty,
+		TxCount:         job.TxCount,
+		Status:          job.Status,
+		CreatedAt:       job.CreatedAt,
+		Transactions:    make([]importTransactionResponse, 0, len(txs)),
+	}
+	if job.FinishedAt.Valid {
+		rsp.FinishedAt = &job.FinishedAt.Time
+	}
+
+	for _, tx := range txs {
+		txRsp := importTransactionResponse{
+			ID:            tx.ID,
+			PaymentInfoID: tx.PaymentInfoID,
+			EndToEndID:    tx.EndToEndID,
+			FromAccountID: tx.FromAccountID,
+			ToAccountID:   tx.ToAccountID,
+			Amount:        tx.Amount,
+			Currency:      tx.Currency,
+			Status:        tx.Status,
+			ReasonCode:    tx.ReasonCode,
+		}
+		if tx.TransferID.Valid {
+			txRsp.TransferID = &tx.TransferID.Int64
+		}
+		rsp.Transactions = append(rsp.Transactions, txRsp)
+	}
+	return rsp
+}
+
+// CreateImportJob accepts a pain.001 file upload and books its transactions in the background
+func (server *Server) CreateImportJob(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportFileSize)
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(ctx, apierror.Newf(apierror.InvalidRequest, "the upload is larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+	defer file.Close()
+
+	doc, err := iso20022.ParsePain001(file)
+	if err != nil {
+		abortWithError(ctx, apierror.Newf(apierror.InvalidRequest, "the file is not a valid pain.001 document: %v", err))
+		return
+	}
+	if !server.ownsDebtorAccounts(ctx, doc.Transactions()) {
+		return
+	}
+
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	arg := db.CreateImportJobTxParams{
+		Owner:           payload.Username,
+		MessageID:       doc.GrpHdr.MsgId,
+		MessageName:     doc.Version(),
+		InitiatingParty: doc.GrpHdr.InitgPty,
+		LeaseUntil:      time.Now().Add(importJobLease),
+	}
+	for _, tx := range doc.Transactions() {
+		arg.Transactions = append(arg.Transactions, db.CreateImportTransactionParams{
+			PaymentInfoID: tx.PaymentInfoID,
+			EndToEndID:    tx.EndToEndID,
+			FromAccountID: tx.FromAccountID,
+			ToAccountID:   tx.ToAccountID,
+			Amount:        tx.Amount,
+			Currency:      tx.Currency,
+		})
+	}
+
+	result, err := server.store.CreateImportJobTx(ctx, arg)
+	if err != nil {
+		abortWithError(ctx, apierror.FromDB(err, apierror.DuplicateImport))
+		return
+	}
+
+	// the job outlives the request, keep its audit metadata for the transfers it books and its id for the logs
+	jobCtx := db.WithAuditMeta(context.Background(), db.AuditMetaFrom(ctx))
+	jobCtx = logging.WithRequestID(jobCtx, logging.RequestIDFrom(ctx))
+	server.jobs.Add(1)
+	go func() {
+		defer server.jobs.Done()
+		server.runImportJob(jobCtx, result.Job, result.Transactions)
+	}()
+
+	ctx.JSON(http.StatusAccepted, newImportJobResponse(result.Job, result.Transactions))
+}
+
+// ownsDebtorAccounts checks that the authenticated user owns the account every transaction debits,
+// like CreateTransfer does for its from account
+func (server *Server) ownsDebtorAccounts(ctx *gin.Context, txs []iso20022.Transaction) bool {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	checked := make(map[int64]bool)
+	for _, tx := range txs {
+		if checked[tx.FromAccountID] {
+			continue
+		}
+		checked[tx.FromAccountID] = true
+
+		account, err := server.store.GetAccount(ctx, tx.FromAccountID)
+		if err != nil {
+			abortWithError(ctx, apierror.FromDB(err, apierror.AccountNotFound))
+			return false
+		}
+		if account.Owner != payload.Username {
+			abortWithError(ctx, apierror.Newf(apierror.PermissionDenied, "account %d doesn't belong to the authenticated user", account.ID))
+			return false
+		}
+	}
+	return true
+}
+
+type getImportJobRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) GetImportJob(ctx *gin.Context) {
+	var req getImportJobRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	job, txs, ok := server.getImportJob(ctx, req.ID)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, newImportJobResponse(job, txs))
+}
+
+// GetImportReport returns the pain.002 status report of an import job
+func (server *Server) GetImportReport(ctx *gin.Context) {
+	var req getImportJobRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	job, txs, ok := server.getImportJob(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	report, err := iso20022.NewPain002(job.MessageID, job.MessageName, importTxStatuses(txs), time.Now()).Marshal()
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+	ctx.Data(http.StatusOK, "application/xml", report)
+}
+
+// getImportJob loads an import job of the authenticated user with its transactions,
+// it responds with 404 for the jobs of other users
+func (server *Server) getImportJob(ctx *gin.Context, id int64) (db.ImportJob, []db.ImportTransaction, bool) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	job, err := server.store.GetImportJob(ctx, id)
+	if err != nil {
+		abortWithError(ctx, apierror.FromDB(err, apierror.ImportNotFound))
+		return job, nil, false
+	}
+
+	if job.Owner != payload.Username {
+		abortWithError(ctx, apierror.New(apierror.ImportNotFound, "the import job doesn't belong to the authenticated user"))
+		return job, nil, false
+	}
+
+	txs, err := server.store.ListImportTransactions(ctx, job.ID)
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return job, nil, false
+	}
+	return job, txs, true
+}
+
+// runImportJob books every pending transaction of the job one by one and records its outcome,
+// a rejected transaction does not stop the rest of the file.
+// It stops once the claim on the job can't be renewed, the instance that took it over goes on
+func (server *Server) runImportJob(ctx context.Context, job db.ImportJob, txs []db.ImportTransaction) {
+	for i, tx := range txs {
+		if tx.Status != iso20022.StatusPending {
+			continue
+		}
+
+		renewed, err := server.store.RenewImportJobClaim(ctx, db.RenewImportJobClaimParams{
+			ID:           job.ID,
+			ClaimedUntil: job.ClaimedUntil,
+			LeaseUntil:   time.Now().Add(importJobLease),
+		})
+		if err != nil {
+			server.logger.ErrorContext(ctx, "can't renew import job claim", "job_id", job.ID, "error", err)
+			return
+		}
+		job = renewed
+
+		arg := db.UpdateImportTransactionParams{ID: tx.ID}
+		arg.Status, arg.ReasonCode, arg.TransferID = server.bookImportTransaction(ctx, tx)
+		recordImportTransfer(tx, arg.Status, arg.ReasonCode)
+
+		updated, err := server.store.UpdateImportTransaction(ctx, arg)
+		if err != nil {
+			server.logger.ErrorContext(ctx, "can't update import transaction", "job_id", job.ID, "transaction_id", tx.ID, "error", err)
+			server.failImportJob(ctx, job, txs)
+			return
+		}
+		txs[i] = updated
+	}
+
+	server.finishImportJob(ctx, job, txs)
+}
+
+// failImportJob rejects the transactions the job didn't record and finishes it,
+// so a job whose progress can't be saved isn't left pending.
+// When the job can't be finished either it is resumed once its claim expired
+func (server *Server) failImportJob(ctx context.Context, job db.ImportJob, txs []db.ImportTransaction) {
+	for i, tx := range txs {
+		if tx.Status != iso20022.StatusPending {
+			continue
+		}
+
+		txs[i].Status, txs[i].ReasonCode = iso20022.StatusRejected, iso20022.ReasonNarrative
+		_, err := server.store.UpdateImportTransaction(ctx, db.UpdateImportTransactionParams{
+			ID:         tx.ID,
+			Status:     iso20022.StatusRejected,
+			ReasonCode: iso20022.ReasonNarrative,
+		})
+		if err != nil {
+			server.logger.ErrorContext(ctx, "can't reject import transaction", "job_id", job.ID, "transaction_id", tx.ID, "error", err)
+		}
+	}
+
+	server.finishImportJob(ctx, job, txs)
+}
+
+func (server *Server) finishImportJob(ctx context.Context, job db.ImportJob, txs []db.ImportTransaction) {
+	_, err := server.store.UpdateImportJobStatus(ctx, db.UpdateImportJobStatusParams{
+		ID:         job.ID,
+		Status:     iso20022.GroupStatus(importTxStatuses(txs)),
+		FinishedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		server.logger.ErrorContext(ctx, "can't update import job status", "job_id", job.ID, "error", err)
+	}
+}
+
+// ResumeImportJobs runs the pending import jobs whose claim expired, like those of an instance
+// that stopped in the middle of a job, every importJobLease until ctx is canceled
+func (server *Server) ResumeImportJobs(ctx context.Context) {
+	ticker := time.NewTicker(importJobLease)
+	defer ticker.Stop()
+
+	for {
+		n, err := server.resumeImportJobs(ctx)
+		if err != nil {
+			server.logger.ErrorContext(ctx, "can't claim import jobs", "error", err)
+		}
+
+		// drain a backlog without waiting for the next tick
+		if err == nil && n == importResumeBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resumeImportJobs claims a batch of stale import jobs and runs them,
+// each job runs to its end even if ctx is canceled meanwhile
+func (server *Server) resumeImportJobs(ctx context.Context) (int, error) {
+	jobs, err := server.store.ClaimStaleImportJobs(ctx, db.ClaimStaleImportJobsParams{
+		LeaseUntil: time.Now().Add(importJobLease),
+		Size:       importResumeBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, job := range jobs {
+		// the transfers the job books are audited as its owner's
+		jobCtx := db.WithAuditMeta(context.WithoutCancel(ctx), db.AuditMeta{Actor: job.Owner})
+
+		txs, err := server.store.ListImportTransactions(jobCtx, job.ID)
+		if err != nil {
+			server.logger.ErrorContext(ctx, "can't list import transactions", "job_id", job.ID, "error", err)
+			continue
+		}
+
+		server.logger.InfoContext(ctx, "resuming import job", "job_id", job.ID)
+		server.runImportJob(jobCtx, job, txs)
+	}
+	return len(jobs), nil
+}
+
+// recordImportTransfer counts a booked import transaction like the transfers of CreateTransfer
+func recordImportTransfer(tx db.ImportTransaction, status string, reasonCode string) {
+	if status == iso20022.StatusAccepted {
+		metrics.TransferCreated(tx.Currency, tx.Amount)
+		return
+	}
+
+	reason := apierror.InternalError
+	switch reasonCode {
+	case iso20022.ReasonIncorrectAccountNumber:
+		reason = apierror.AccountNotFound
+	case iso20022.ReasonNotAllowedCurrency:
+		reason = apierror.CurrencyMismatch
+	case iso20022.ReasonBlockedAccount:
+		reason = apierror.AccountFrozen
+	case iso20022.ReasonInsufficientFunds:
+		reason = apierror.InsufficientFunds
+	case iso20022.ReasonNotAllowedAmount:
+		reason = apierror.TransferLimit
+	}
+	metrics.TransferFailed(string(reason))
+}
+
+func (server *Server) bookImportTransaction(ctx context.Context, tx db.ImportTransaction) (string, string, sql.NullInt64) {
+	// read for each transaction, so a reload applies to the rest of a running job
+	if !server.config.Load().TransferAllowed(tx.Amount) {
+		return iso20022.StatusRejected, iso20022.ReasonNotAllowedAmount, sql.NullInt64{}
+	}
+	for _, accountID := range []int64{tx.FromAccountID, tx.ToAccountID} {
+		account, err := server.store.GetAccount(ctx, accountID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return iso20022.StatusRejected, iso20022.ReasonIncorrectAccountNumber, sql.NullInt64{}
+			}
+			return iso20022.StatusRejected, iso20022.ReasonNarrative, sql.NullInt64{}
+		}
+		if account.Currency != tx.Currency {
+			return iso20022.StatusRejected, iso20022.ReasonNotAllowedCurrency, sql.NullInt64{}
+		}
+	}
+
+	result, err := server.store.TranserTx(ctx, db.TransferTxParams{
+		FromAccountID: tx.FromAccountID,
+		ToAccountID:   tx.ToAccountID,
+		Amount:        tx.Amount,
+	})
+	// the transaction refuses frozen accounts and a balance that is too low, like for /transfers
+	var frozen *db.AccountFrozenError
+	var insufficient *db.InsufficientFundsError
+	switch {
+	case errors.As(err, &frozen):
+		return iso20022.StatusRejected, iso20022.ReasonBlockedAccount, sql.NullInt64{}
+	case errors.As(err, &insufficient):
+		return iso20022.StatusRejected, iso20022.ReasonInsufficientFunds, sql.NullInt64{}
+	case err != nil:
+		return iso20022.StatusRejected, iso20022.ReasonNarrative, sql.NullInt64{}
+	}
+	return iso20022.StatusAccepted, "", sql.NullInt64{Int64: result.Transfer.ID, Valid: true}
+}
+
+func importTxStatuses(txs []db.ImportTransaction) []iso20022.TxStatus {
+	statuses := make([]iso20022.TxStatus, 0, len(txs))
+	for _, tx := range txs {
+		statuses = append(statuses, iso20022.TxStatus{
+			PaymentInfoID: tx.PaymentInfoID,
+			EndToEndID:    tx.EndToEndID,
+			Status:        tx.Status,
+			ReasonCode:    tx.ReasonCode,
+		})
+	}
+	return statuses
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	mockdb "lesson/simple-bank/db/mock"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/iso20022"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// pain001File debits 10 USD from debtorAccountID to account 2
+func pain001File(debtorAccountID int64) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr>
+      <MsgId>MSG-0001</MsgId>
+      <CreDtTm>2023-02-01T10:00:00</CreDtTm>
+      <NbOfTxs>1</NbOfTxs>
+      <InitgPty><Nm>ACME Finance</Nm></InitgPty>
+    </GrpHdr>
+    <PmtInf>
+      <PmtInfId>PMT-1</PmtInfId>
+      <PmtMtd>TRF</PmtMtd>
+      <DbtrAcct><Id><Othr><Id>%d</Id></Othr></Id></DbtrAcct>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>E2E-1</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="USD">10</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>2</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`, debtorAccountID)
+}
+
+// serveImport uploads file as the user username
+func serveImport(t *testing.T, server *Server, file string, username string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "payments.xml")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(file))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	accessToken, _, err := server.tokenMaker.CreateToken(username, time.Minute)
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/imports", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCreateImportJobDebtorAccount(t *testing.T) {
+	account := randomAccount(utils.RandomOwner(), "USD")
+	account.ID = 1
+
+	testCases := []struct {
+		name       string
+		username   string
+		buildStubs func(store *mockdb.MockStore)
+		code       apierror.Code
+	}{
+		{
+			name:     "NotOwner",
+			username: utils.RandomOwner(),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			code: apierror.PermissionDenied,
+		},
+		{
+			name:     "NotFound",
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, sql.ErrNoRows)
+			},
+			code: apierror.AccountNotFound,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			// the file is refused before the job is created
+			store.EXPECT().CreateImportJobTx(gomock.Any(), gomock.Any()).Times(0)
+
+			server := newTestServer(t, store)
+			recorder := serveImport(t, server, pain001File(account.ID), tc.username)
+			require.Equal(t, tc.code.Status(), recorder.Code)
+			requireProblem(t, recorder, tc.code)
+		})
+	}
+}
+
+func TestBookImportTransactionRejected(t *testing.T) {
+	tx := db.ImportTransaction{ID: 1, FromAccountID: 1, ToAccountID: 2, Amount: 10, Currency: "USD"}
+
+	testCases := []struct {
+		name       string
+		err        error
+		reasonCode string
+	}{
+		{
+			name:       "Frozen",
+			err:        &db.AccountFrozenError{AccountID: tx.ToAccountID},
+			reasonCode: iso20022.ReasonBlockedAccount,
+		},
+		{
+			name:       "InsufficientFunds",
+			err:        &db.InsufficientFundsError{AccountID: tx.FromAccountID, Balance: 5, Currency: "USD"},
+			reasonCode: iso20022.ReasonInsufficientFunds,
+		},
+		{
+			name:       "InternalError",
+			err:        sql.ErrConnDone,
+			reasonCode: iso20022.ReasonNarrative,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			for _, id := range []int64{tx.FromAccountID, tx.ToAccountID} {
+				account := randomAccount(utils.RandomOwner(), "USD")
+				account.ID = id
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(id)).Times(1).Return(account, nil)
+			}
+			store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, tc.err)
+
+			server := newTestServer(t, store)
+			status, reasonCode, transferID := server.bookImportTransaction(context.Background(), tx)
+			require.Equal(t, iso20022.StatusRejected, status)
+			require.Equal(t, tc.reasonCode, reasonCode)
+			require.False(t, transferID.Valid)
+		})
+	}
+}
+
+func TestBookImportTransactionLimit(t *testing.T) {
+	store := mockdb.NewMockStore(gomock.NewController(t))
+	store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+	server, err := NewServer(config.NewSnapshot(config.Config{
+		SecreteKey:          utils.RandomString(32),
+		AccessTokenDuration: time.Minute,
+		GRPCServerAddress:   "127.0.0.1:9090",
+		MaxTransferAmount:   5,
+	}), store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	tx := db.ImportTransaction{ID: 1, FromAccountID: 1, ToAccountID: 2, Amount: 10, Currency: "USD"}
+	status, reasonCode, transferID := server.bookImportTransaction(context.Background(), tx)
+	require.Equal(t, iso20022.StatusRejected, status)
+	require.Equal(t, iso20022.ReasonNotAllowedAmount, reasonCode)
+	require.False(t, transferID.Valid)
+}
+
+func TestGetImportJobOwner(t *testing.T) {
+	job := db.ImportJob{ID: 1, Owner: utils.RandomOwner(), MessageID: "MSG-0001", Status: iso20022.StatusPending}
+
+	testCases := []struct {
+		name     string
+		url      string
+		username string
+		code     int
+	}{
+		{name: "Owner", url: "/imports/1", username: job.Owner, code: http.StatusOK},
+		{name: "OwnerReport", url: "/imports/1/report", username: job.Owner, code: http.StatusOK},
+		{name: "OtherUser", url: "/imports/1", username: utils.RandomOwner(), code: http.StatusNotFound},
+		{name: "OtherUserReport", url: "/imports/1/report", username: utils.RandomOwner(), code: http.StatusNotFound},
+		{name: "NoAuthorization", url: "/imports/1", code: http.StatusUnauthorized},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			if tc.username != "" {
+				store.EXPECT().GetImportJob(gomock.Any(), gomock.Eq(job.ID)).Times(1).Return(job, nil)
+			}
+			if tc.username == job.Owner {
+				store.EXPECT().ListImportTransactions(gomock.Any(), gomock.Eq(job.ID)).Times(1).Return([]db.ImportTransaction{}, nil)
+			}
+
+			server := newTestServer(t, store)
+			request := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.username != "" {
+				accessToken, _, err := server.tokenMaker.CreateToken(tc.username, time.Minute)
+				require.NoError(t, err)
+				request.Header.Set("Authorization", "Bearer "+accessToken)
+			}
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.code, recorder.Code)
+			if tc.code == http.StatusNotFound {
+				requireProblem(t, recorder, apierror.ImportNotFound)
+			}
+		})
+	}
+}
+
+func TestCreateImportJobTooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().CreateImportJobTx(gomock.Any(), gomock.Any()).Times(0)
+
+	server := newTestServer(t, store)
+	recorder := serveImport(t, server, strings.Repeat(" ", maxImportFileSize)+pain001File(1), utils.RandomOwner())
+	requireProblem(t, recorder, apierror.InvalidRequest)
+}
+
+func TestRunImportJobUpdateFailed(t *testing.T) {
+	job := db.ImportJob{ID: 1, Owner: utils.RandomOwner(), Status: iso20022.StatusPending, ClaimedUntil: time.Now()}
+	txs := []db.ImportTransaction{
+		{ID: 1, JobID: job.ID, FromAccountID: 1, ToAccountID: 2, Amount: 10, Currency: "USD", Status: iso20022.StatusPending},
+		{ID: 2, JobID: job.ID, FromAccountID: 1, ToAccountID: 2, Amount: 10, Currency: "USD", Status: iso20022.StatusPending},
+	}
+
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().RenewImportJobClaim(gomock.Any(), gomock.Any()).Times(1).Return(job, nil)
+	for _, id := range []int64{1, 2} {
+		account := randomAccount(job.Owner, "USD")
+		account.ID = id
+		store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(id)).Times(1).Return(account, nil)
+	}
+	store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{Transfer: db.Transfer{ID: 1}}, nil)
+	gomock.InOrder(
+		store.EXPECT().UpdateImportTransaction(gomock.Any(), gomock.Any()).Times(1).Return(db.ImportTransaction{}, sql.ErrConnDone),
+		// the transactions that aren't recorded are rejected instead of being left pending
+		store.EXPECT().UpdateImportTransaction(gomock.Any(), gomock.Eq(db.UpdateImportTransactionParams{
+			ID: 1, Status: iso20022.StatusRejected, ReasonCode: iso20022.ReasonNarrative,
+		})).Times(1),
+		store.EXPECT().UpdateImportTransaction(gomock.Any(), gomock.Eq(db.UpdateImportTransactionParams{
+			ID: 2, Status: iso20022.StatusRejected, ReasonCode: iso20022.ReasonNarrative,
+		})).Times(1),
+	)
+	store.EXPECT().
+		UpdateImportJobStatus(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.UpdateImportJobStatusParams) (db.ImportJob, error) {
+			require.Equal(t, job.ID, arg.ID)
+			require.Equal(t, iso20022.StatusRejected, arg.Status)
+			require.True(t, arg.FinishedAt.Valid)
+			return job, nil
+		})
+
+	server := newTestServer(t, store)
+	server.runImportJob(context.Background(), job, txs)
+}
+
+func TestResumeImportJobs(t *testing.T) {
+	store := memstore.New()
+	server := newTestServer(t, store)
+	account1 := createAccount(t, store, 100)
+	account2 := createAccount(t, store, 100)
+
+	createJob := func(messageID string, leaseUntil time.Time) db.ImportJob {
+		result, err := store.CreateImportJobTx(context.Background(), db.CreateImportJobTxParams{
+			Owner:       account1.Owner,
+			MessageID:   messageID,
+			MessageName: "pain.001.001.03",
+			LeaseUntil:  leaseUntil,
+			Transactions: []db.CreateImportTransactionParams{
+				{PaymentInfoID: "PMT-1", EndToEndID: "E2E-1", FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: "USD"},
+			},
+		})
+		require.NoError(t, err)
+		return result.Job
+	}
+	// the claim of the first job expired with the instance that ran it, the second one is still running
+	stale := createJob("MSG-0001", time.Now().Add(-time.Second))
+	running := createJob("MSG-0002", time.Now().Add(time.Minute))
+
+	n, err := server.resumeImportJobs(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	job, err := store.GetImportJob(context.Background(), stale.ID)
+	require.NoError(t, err)
+	require.Equal(t, iso20022.StatusAccepted, job.Status)
+	require.True(t, job.FinishedAt.Valid)
+
+	job, err = store.GetImportJob(context.Background(), running.ID)
+	require.NoError(t, err)
+	require.Equal(t, iso20022.StatusPending, job.Status)
+
+	account, err := store.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(90), account.Balance)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type verifyLedgerRequest struct {
+	AccountID int64 `form:"account_id" binding:"omitempty,min=1"`
+}
+
+// VerifyLedger recomputes the entry hash chains, of one account when account_id is given
+func (server *Server) VerifyLedger(ctx *gin.Context) {
+	var req verifyLedgerRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	var result db.VerifyLedgerResult
+	var err error
+	if req.AccountID != 0 {
+		result, err = server.store.VerifyAccountLedger(ctx, req.AccountID)
+	} else {
+		result, err = server.store.VerifyLedger(ctx)
+	}
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
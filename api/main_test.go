@@ -0,0 +1,42 @@
+package api
+
+import (
+	"io"
+	"lesson/simple-bank/config"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"lesson/simple-bank/webhook"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	config := config.NewSnapshot(config.Config{
+		SecreteKey:          utils.RandomString(32),
+		AccessTokenDuration: time.Minute,
+		GRPCServerAddress:   "127.0.0.1:9090",
+	})
+	server, err := NewServer(config, store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+	return server
+}
+
+func newTestWebhookWorker(store db.Store) *webhook.Worker {
+	return webhook.NewWorker(store, time.Second, time.Second, discardLogger())
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/logging"
+	"lesson/simple-bank/metrics"
+	"lesson/simple-bank/token"
+	"lesson/simple-bank/utils"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationPayloadKey = "authorization_payload"
+	requestIDHeaderKey      = "X-Request-ID"
+	maxRequestIDLength      = 128
+	accessTokenQueryKey     = "access_token"
+	// problemCodeKey holds the apierror code of an aborted request
+	problemCodeKey = "problem_code"
+)
+
+// verifyAuthorizationHeader parses a "Bearer <token>" header and verifies the token
+func verifyAuthorizationHeader(tokenMaker token.Maker, authorizationHeader string) (*token.Payload, error) {
+	if len(authorizationHeader) == 0 {
+		return nil, errors.New("authorization header is not provided")
+	}
+
+	fields := strings.Fields(authorizationHeader)
+	if len(fields) < 2 {
+		return nil, errors.New("invalid authorization header format")
+	}
+
+	authorizationType := strings.ToLower(fields[0])
+	if authorizationType != authorizationTypeBearer {
+		return nil, fmt.Errorf("unsupported authorization type %s", authorizationType)
+	}
+
+	return tokenMaker.VerifyToken(fields[1])
+}
+
+// authMiddleware verifies the bearer token and stores its payload in the context
+func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload, err := verifyAuthorizationHeader(tokenMaker, ctx.GetHeader(authorizationHeaderKey))
+		if err != nil {
+			abortWithError(ctx, apierror.New(apierror.Unauthenticated, err.Error()))
+			return
+		}
+
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
+
+// streamAuthMiddleware is authMiddleware that also accepts the token in the access_token query,
+// browsers can't set headers on EventSource and WebSocket connections
+func streamAuthMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		accessToken := ctx.Query(accessTokenQueryKey)
+		redactAccessToken(ctx.Request)
+
+		var payload *token.Payload
+		var err error
+		if accessToken != "" && ctx.GetHeader(authorizationHeaderKey) == "" {
+			payload, err = tokenMaker.VerifyToken(accessToken)
+		} else {
+			payload, err = verifyAuthorizationHeader(tokenMaker, ctx.GetHeader(authorizationHeaderKey))
+		}
+		if err != nil {
+			abortWithError(ctx, apierror.New(apierror.Unauthenticated, err.Error()))
+			return
+		}
+
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
+
+// redactAccessToken removes the access_token query from the request URL once it is read,
+// so the logs, traces and panic dumps that include the URL don't leak the token
+func redactAccessToken(req *http.Request) {
+	query := req.URL.Query()
+	if !query.Has(accessTokenQueryKey) {
+		return
+	}
+	query.Del(accessTokenQueryKey)
+	req.URL.RawQuery = query.Encode()
+	req.RequestURI = req.URL.RequestURI()
+}
+
+// tracerName names the tracer of the request spans
+const tracerName = "lesson/simple-bank/api"
+
+// tracingMiddleware starts the span of the request as a child of the W3C trace context of its headers,
+// the store spans are its children as the handlers pass the request context down
+func tracingMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		parent := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		route := ctx.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+
+		spanCtx, span := otel.Tracer(tracerName).Start(parent, ctx.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", ctx.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.target", ctx.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		ctx.Request = ctx.Request.WithContext(spanCtx)
+		ctx.Next()
+
+		setSpanStatus(span, ctx.Writer.Status())
+	}
+}
+
+// setSpanStatus records the status of the response, a 5xx status marks the span as failed
+func setSpanStatus(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// metricsMiddleware records the requests by route template, so the ids in the paths don't make new series
+func metricsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		metrics.ObserveHTTPRequest(ctx.Request.Method, ctx.FullPath(), ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+// requestLogMiddleware propagates the X-Request-ID of the request, or assigns a new one, to the response
+// and the log records of the request context, then logs one line per request
+func requestLogMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		requestID := ctx.GetHeader(requestIDHeaderKey)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		ctx.Header(requestIDHeaderKey, requestID)
+		ctx.Request = ctx.Request.WithContext(logging.WithRequestID(ctx.Request.Context(), requestID))
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+		attrs := []slog.Attr{
+			slog.String("method", ctx.Request.Method),
+			slog.String("route", route),
+			slog.Int("status", ctx.Writer.Status()),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("user", db.AuditMetaFrom(ctx.Request.Context()).Actor),
+			slog.String("client_ip", ctx.ClientIP()),
+		}
+		if err := ctx.Errors.Last(); err != nil {
+			attrs = append(attrs, slog.Any("error", err.Err))
+		}
+		logger.LogAttrs(ctx.Request.Context(), requestLogLevel(ctx.Writer.Status()), "request", attrs...)
+	}
+}
+
+// validRequestID accepts the ids a client can pick without breaking the logs: up to 128 letters, digits, '.', '_', ':' and '-'
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', strings.ContainsRune("._:-", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestLogLevel logs the failed requests above the others
+func requestLogLevel(status int) slog.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// auditMiddleware attaches the request metadata used by the store to write audit events,
+// the actor is taken from the bearer token when one is sent but the request is not rejected without it.
+// It runs after requestLogMiddleware, which assigns the request id.
+func auditMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		meta := db.AuditMeta{
+			RequestID: logging.RequestIDFrom(ctx.Request.Context()),
+			ClientIP:  ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+		}
+		if payload, err := verifyAuthorizationHeader(tokenMaker, ctx.GetHeader(authorizationHeaderKey)); err == nil {
+			meta.Actor = payload.Username
+		}
+
+		ctx.Request = ctx.Request.WithContext(db.WithAuditMeta(ctx.Request.Context(), meta))
+		ctx.Next()
+	}
+}
+
+// adminMiddleware only lets users with the admin role through, it must run after authMiddleware
+func (server *Server) adminMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+		user, err := server.store.GetUser(ctx, payload.Username)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				abortWithError(ctx, apierror.New(apierror.Unauthenticated, "the user of the access token doesn't exist"))
+				return
+			}
+			abortWithError(ctx, apierror.Internal(err))
+			return
+		}
+
+		if user.Role != utils.AdminRole {
+			abortWithError(ctx, apierror.New(apierror.PermissionDenied, "admin role is required"))
+			return
+		}
+		ctx.Next()
+	}
+}
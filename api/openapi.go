@@ -0,0 +1,18 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec documents the gin routes, it is written by hand and checked against the router by openapi_test.go
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// ServeOpenAPI serves the OpenAPI 3.1 document of the gin routes
+func (server *Server) ServeOpenAPI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", openAPISpec)
+}
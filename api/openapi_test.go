@@ -0,0 +1,941 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// openAPIDocument is the part of openapi.json checked against the code
+type openAPIDocument struct {
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]map[string]interface{} `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	OperationID string                `json:"operationId"`
+	Security    []map[string][]string `json:"security"`
+	// GoParams names the structs bound from the path and the query
+	GoParams    []string           `json:"x-go-params"`
+	Parameters  []openAPIParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema map[string]interface{} `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	// ErrorCodes lists the apierror codes of an error response
+	ErrorCodes []string `json:"x-error-codes"`
+}
+
+type openAPIParameter struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+// specGoTypes resolves the x-go-type and x-go-params names of the document
+var specGoTypes = map[string]reflect.Type{
+	"createUserRequest":            reflect.TypeOf(createUserRequest{}),
+	"createUserResponse":           reflect.TypeOf(createUserResponse{}),
+	"getUserRequest":               reflect.TypeOf(getUserRequest{}),
+	"loginUserRequest":             reflect.TypeOf(loginUserRequest{}),
+	"loginUserResponse":            reflect.TypeOf(loginUserResponse{}),
+	"createAccountRequest":         reflect.TypeOf(createAccountRequest{}),
+	"getAccountRequest":            reflect.TypeOf(getAccountRequest{}),
+	"listAccountRequest":           reflect.TypeOf(listAccountRequest{}),
+	"transferRequest":              reflect.TypeOf(transferRequest{}),
+	"getImportJobRequest":          reflect.TypeOf(getImportJobRequest{}),
+	"importJobResponse":            reflect.TypeOf(importJobResponse{}),
+	"importTransactionResponse":    reflect.TypeOf(importTransactionResponse{}),
+	"createWebhookRequest":         reflect.TypeOf(createWebhookRequest{}),
+	"webhookResponse":              reflect.TypeOf(webhookResponse{}),
+	"createWebhookResponse":        reflect.TypeOf(createWebhookResponse{}),
+	"webhookUriRequest":            reflect.TypeOf(webhookUriRequest{}),
+	"listWebhookDeliveriesRequest": reflect.TypeOf(listWebhookDeliveriesRequest{}),
+	"streamAccountRequest":         reflect.TypeOf(streamAccountRequest{}),
+	"verifyLedgerRequest":          reflect.TypeOf(verifyLedgerRequest{}),
+	"listAuditEventsRequest":       reflect.TypeOf(listAuditEventsRequest{}),
+	"listDeadOutboxEventsRequest":  reflect.TypeOf(listDeadOutboxEventsRequest{}),
+	"unlockUserLoginRequest":       reflect.TypeOf(unlockUserLoginRequest{}),
+	"unlockLoginResponse":          reflect.TypeOf(unlockLoginResponse{}),
+	"healthResponse":               reflect.TypeOf(healthResponse{}),
+	"readinessResponse":            reflect.TypeOf(readinessResponse{}),
+	"readinessCheck":               reflect.TypeOf(readinessCheck{}),
+	"versionResponse":              reflect.TypeOf(versionResponse{}),
+	"db.Account":                   reflect.TypeOf(db.Account{}),
+	"db.Transfer":                  reflect.TypeOf(db.Transfer{}),
+	"db.Entry":                     reflect.TypeOf(db.Entry{}),
+	"db.TransferTxResult":          reflect.TypeOf(db.TransferTxResult{}),
+	"db.WebhookDelivery":           reflect.TypeOf(db.WebhookDelivery{}),
+	"db.VerifyLedgerResult":        reflect.TypeOf(db.VerifyLedgerResult{}),
+	"db.BrokenLink":                reflect.TypeOf(db.BrokenLink{}),
+	"db.AuditEvent":                reflect.TypeOf(db.AuditEvent{}),
+	"db.Outbox":                    reflect.TypeOf(db.Outbox{}),
+	"sql.NullInt64":                reflect.TypeOf(sql.NullInt64{}),
+	"sql.NullTime":                 reflect.TypeOf(sql.NullTime{}),
+	"stream.AccountEvent":          reflect.TypeOf(stream.AccountEvent{}),
+	"apierror.Problem":             reflect.TypeOf(apierror.Problem{}),
+	"apierror.FieldError":          reflect.TypeOf(apierror.FieldError{}),
+}
+
+// impliedCodes are the codes an apierror function can return besides the codes passed to it
+var impliedCodes = map[string]apierror.Code{
+	"FromDB":      apierror.InternalError,
+	"FromBinding": apierror.InvalidRequest,
+	"Internal":    apierror.InternalError,
+}
+
+// undocumentedRoutes are described by the swagger document of the gRPC gateway
+var undocumentedRoutes = map[string]bool{
+	"/v1/*path":          true,
+	"/swagger/*filepath": true,
+}
+
+// implicitStatuses are written by libraries rather than by the handler
+var implicitStatuses = map[string][]int{
+	// the WebSocket upgrader
+	"StreamAccountWebSocket": {http.StatusSwitchingProtocols},
+}
+
+// unboundParameters are read with ctx.GetHeader and ctx.Query instead of a bound struct
+var unboundParameters = map[string][]string{
+	"StreamAccount":          {"header Last-Event-ID", "query last_event_id", "query access_token"},
+	"StreamAccountWebSocket": {"header Last-Event-ID", "query last_event_id", "query access_token"},
+}
+
+// authMiddlewares reject the requests without a valid access token
+var authMiddlewares = map[string]bool{
+	"authMiddleware":       true,
+	"streamAuthMiddleware": true,
+}
+
+var httpStatuses = map[string]int{
+	"StatusSwitchingProtocols":  http.StatusSwitchingProtocols,
+	"StatusOK":                  http.StatusOK,
+	"StatusCreated":             http.StatusCreated,
+	"StatusAccepted":            http.StatusAccepted,
+	"StatusNoContent":           http.StatusNoContent,
+	"StatusBadRequest":          http.StatusBadRequest,
+	"StatusUnauthorized":        http.StatusUnauthorized,
+	"StatusForbidden":           http.StatusForbidden,
+	"StatusNotFound":            http.StatusNotFound,
+	"StatusConflict":            http.StatusConflict,
+	"StatusUnprocessableEntity": http.StatusUnprocessableEntity,
+	"StatusTooManyRequests":     http.StatusTooManyRequests,
+	"StatusInternalServerError": http.StatusInternalServerError,
+	"StatusServiceUnavailable":  http.StatusServiceUnavailable,
+}
+
+func loadOpenAPIDocument(t *testing.T) openAPIDocument {
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+	return doc
+}
+
+// schemaName returns the component schema documenting a Go type
+func (doc openAPIDocument) schemaName(goType string) (string, bool) {
+	for name, schema := range doc.Components.Schemas {
+		if schema["x-go-type"] == goType {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// refGoType returns the Go type of the component schema referenced by schema
+func (doc openAPIDocument) refGoType(schema map[string]interface{}) string {
+	ref, _ := schema["$ref"].(string)
+	component := doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+	goType, _ := component["x-go-type"].(string)
+	return goType
+}
+
+func goTypeName(t reflect.Type) string {
+	return strings.TrimPrefix(t.String(), "api.")
+}
+
+// boundField is a struct field under the name it is bound or encoded with
+type boundField struct {
+	name    string
+	typ     reflect.Type
+	binding string
+}
+
+// structFields lists the fields of t named by tag, with the fields of embedded structs promoted like encoding/json does
+func structFields(t reflect.Type, tag string) []boundField {
+	var fields []boundField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" || !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		if name == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				fields = append(fields, structFields(field.Type, tag)...)
+				continue
+			}
+			if tag != "json" {
+				continue
+			}
+			name = field.Name
+		}
+		fields = append(fields, boundField{name: name, typ: field.Type, binding: field.Tag.Get("binding")})
+	}
+	return fields
+}
+
+func isRequired(binding string) bool {
+	for _, rule := range strings.Split(binding, ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaOf returns the schema a field of type t must have in the document, validation rules aside
+func (doc openAPIDocument) schemaOf(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	case reflect.TypeOf([]byte{}):
+		return map[string]interface{}{"type": []interface{}{"string", "null"}, "contentEncoding": "base64"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return doc.schemaOf(t.Elem())
+	case reflect.Struct:
+		name, ok := doc.schemaName(goTypeName(t))
+		if !ok {
+			return map[string]interface{}{"x-go-type": goTypeName(t)}
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": doc.schemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	}
+	return map[string]interface{}{"x-go-kind": t.Kind().String()}
+}
+
+// fieldSchema is schemaOf with the binding rules of the field turned into schema keywords
+func (doc openAPIDocument) fieldSchema(t *testing.T, field boundField) map[string]interface{} {
+	schema := doc.schemaOf(field.typ)
+	target, kind := schema, field.typ.Kind()
+	for _, rule := range strings.Split(field.binding, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "", "required", "omitempty":
+		case "dive":
+			target, kind = schema["items"].(map[string]interface{}), field.typ.Elem().Kind()
+		case "oneof":
+			var enum []interface{}
+			for _, value := range strings.Fields(param) {
+				enum = append(enum, value)
+			}
+			target["enum"] = enum
+		case "min", "max", "gt":
+			value, err := strconv.ParseFloat(param, 64)
+			require.NoError(t, err)
+			keyword := map[string]string{"min": "minimum", "max": "maximum", "gt": "exclusiveMinimum"}[name]
+			if kind == reflect.String {
+				keyword = map[string]string{"min": "minLength", "max": "maxLength"}[name]
+			}
+			require.NotEmpty(t, keyword, "binding rule %s of %s", rule, field.name)
+			target[keyword] = value
+		case "email":
+			target["format"] = "email"
+		case "url":
+			target["format"] = "uri"
+		case "alphanum":
+			target["pattern"] = "^[a-zA-Z0-9]+$"
+		default:
+			t.Errorf("binding rule %s of %s has no OpenAPI equivalent in this test", rule, field.name)
+		}
+	}
+	return schema
+}
+
+// withoutDocs drops the keywords that only document a schema
+func withoutDocs(schema map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		switch key {
+		case "description", "contentMediaType":
+			continue
+		case "items":
+			value = withoutDocs(value.(map[string]interface{}))
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func stringSlice(value interface{}) []string {
+	var result []string
+	values, _ := value.([]interface{})
+	for _, value := range values {
+		result = append(result, value.(string))
+	}
+	return result
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	used := make(map[string]bool)
+
+	for name, schema := range doc.Components.Schemas {
+		goType, ok := schema["x-go-type"].(string)
+		if !ok {
+			continue
+		}
+		used[goType] = true
+
+		t.Run(name, func(t *testing.T) {
+			typ, ok := specGoTypes[goType]
+			require.True(t, ok, "unknown x-go-type %s", goType)
+
+			properties, _ := schema["properties"].(map[string]interface{})
+			var names, required []string
+			for _, field := range structFields(typ, "json") {
+				names = append(names, field.name)
+				if isRequired(field.binding) {
+					required = append(required, field.name)
+				}
+
+				property, ok := properties[field.name].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				require.Equal(t, doc.fieldSchema(t, field), withoutDocs(property), "property %s", field.name)
+			}
+			require.ElementsMatch(t, names, keys(properties), "properties")
+			require.ElementsMatch(t, required, stringSlice(schema["required"]), "required properties")
+		})
+	}
+
+	for _, path := range doc.Paths {
+		for _, op := range path {
+			for _, goType := range op.GoParams {
+				used[goType] = true
+			}
+		}
+	}
+	for goType := range specGoTypes {
+		require.True(t, used[goType], "%s is not documented", goType)
+	}
+}
+
+func keys(m map[string]interface{}) []string {
+	var result []string
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
+
+// routeSource is a route as registered by setRouterGroup
+type routeSource struct {
+	method      string
+	path        string
+	handler     string
+	middlewares []string
+}
+
+type routeGroup struct {
+	prefix      string
+	middlewares []string
+}
+
+// handlerSource is what a handler does according to its source, including the server methods it calls
+type handlerSource struct {
+	statuses  map[int]bool
+	codes     map[apierror.Code]bool
+	binds     map[string]string
+	formFiles []string
+}
+
+// apiSource is the parsed source of the api package
+type apiSource struct {
+	funcs map[string]*ast.FuncDecl
+	// codes are the apierror code constants by name
+	codes map[string]apierror.Code
+}
+
+func parseAPISource(t *testing.T) apiSource {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	require.NoError(t, err)
+
+	source := apiSource{
+		funcs: make(map[string]*ast.FuncDecl),
+		codes: parseErrorCodes(t, fset),
+	}
+	for _, file := range pkgs["api"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := fn.Name.Name
+			if fn.Recv != nil {
+				recv := fn.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				name = recv.(*ast.Ident).Name + "." + name
+			}
+			source.funcs[name] = fn
+		}
+	}
+	return source
+}
+
+// parseErrorCodes reads the code constants of the apierror package
+func parseErrorCodes(t *testing.T, fset *token.FileSet) map[string]apierror.Code {
+	pkgs, err := parser.ParseDir(fset, "../apierror", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	require.NoError(t, err)
+
+	codes := make(map[string]apierror.Code)
+	for _, file := range pkgs["apierror"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.ValueSpec)
+				if ident, ok := spec.Type.(*ast.Ident); !ok || ident.Name != "Code" {
+					continue
+				}
+				for i, name := range spec.Names {
+					codes[name.Name] = apierror.Code(unquote(t, spec.Values[i]))
+				}
+			}
+		}
+	}
+	require.NotEmpty(t, codes)
+	return codes
+}
+
+// funcName names the handler or middleware built by expr
+func funcName(expr ast.Expr) string {
+	if call, ok := expr.(*ast.CallExpr); ok {
+		expr = call.Fun
+	}
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name
+	case *ast.SelectorExpr:
+		if x, ok := expr.X.(*ast.Ident); ok && x.Name == "server" {
+			return "Server." + expr.Sel.Name
+		} else if ok {
+			return x.Name + "." + expr.Sel.Name
+		}
+		return expr.Sel.Name
+	}
+	return ""
+}
+
+// libraryFunc tells whether name, as returned by funcName, is a function of another package like gin.Recovery
+func libraryFunc(name string) bool {
+	return strings.Contains(name, ".") && !strings.HasPrefix(name, "Server.")
+}
+
+func unquote(t *testing.T, expr ast.Expr) string {
+	lit, ok := expr.(*ast.BasicLit)
+	require.True(t, ok, "expected a string literal")
+	value, err := strconv.Unquote(lit.Value)
+	require.NoError(t, err)
+	return value
+}
+
+// routes walks setRouterGroup and returns its routes with the middlewares of their groups
+func (source apiSource) routes(t *testing.T) []routeSource {
+	fn := source.funcs["Server.setRouterGroup"]
+	require.NotNil(t, fn)
+
+	groups := make(map[string]routeGroup)
+	var group func(expr ast.Expr) routeGroup
+	group = func(expr ast.Expr) routeGroup {
+		switch expr := expr.(type) {
+		case *ast.Ident:
+			g, ok := groups[expr.Name]
+			require.True(t, ok, "unknown router group %s", expr.Name)
+			return routeGroup{prefix: g.prefix, middlewares: append([]string(nil), g.middlewares...)}
+		case *ast.CallExpr:
+			sel := expr.Fun.(*ast.SelectorExpr)
+			switch sel.Sel.Name {
+			case "Default", "New":
+				return routeGroup{prefix: "/"}
+			case "Group":
+				g := group(sel.X)
+				g.prefix = path.Join(g.prefix, unquote(t, expr.Args[0]))
+				return g
+			case "Use":
+				g := group(sel.X)
+				for _, arg := range expr.Args {
+					g.middlewares = append(g.middlewares, funcName(arg))
+				}
+				return g
+			}
+		}
+		t.Fatalf("unsupported router expression in setRouterGroup")
+		return routeGroup{}
+	}
+
+	var routes []routeSource
+	for _, stmt := range fn.Body.List {
+		switch stmt := stmt.(type) {
+		case *ast.AssignStmt:
+			if ident, ok := stmt.Lhs[0].(*ast.Ident); ok {
+				groups[ident.Name] = group(stmt.Rhs[0])
+			}
+		case *ast.ExprStmt:
+			call, ok := stmt.X.(*ast.CallExpr)
+			if !ok {
+				continue
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				continue
+			}
+			name := sel.X.(*ast.Ident).Name
+			if sel.Sel.Name == "Use" {
+				groups[name] = group(call)
+				continue
+			}
+			g := group(sel.X)
+			routes = append(routes, routeSource{
+				method:      sel.Sel.Name,
+				path:        path.Join(g.prefix, unquote(t, call.Args[0])),
+				handler:     funcName(call.Args[len(call.Args)-1]),
+				middlewares: g.middlewares,
+			})
+		}
+	}
+	return routes
+}
+
+// analyze collects the statuses, bound structs and uploaded files of a function and of the server methods it calls
+func (source apiSource) analyze(t *testing.T, name string, into *handlerSource) {
+	fn, ok := source.funcs[name]
+	require.True(t, ok, "unknown function %s", name)
+
+	vars := make(map[string]string)
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.ValueSpec:
+			if ident, ok := node.Type.(*ast.Ident); ok {
+				for _, name := range node.Names {
+					vars[name.Name] = ident.Name
+				}
+			}
+		case *ast.SelectorExpr:
+			if x, ok := node.X.(*ast.Ident); ok && x.Name == "http" && strings.HasPrefix(node.Sel.Name, "Status") {
+				status, ok := httpStatuses[node.Sel.Name]
+				require.True(t, ok, "add http.%s to httpStatuses", node.Sel.Name)
+				into.statuses[status] = true
+			}
+			if x, ok := node.X.(*ast.Ident); ok && x.Name == "apierror" {
+				if code, ok := source.codes[node.Sel.Name]; ok {
+					into.codes[code] = true
+				}
+				if code, ok := impliedCodes[node.Sel.Name]; ok {
+					into.codes[code] = true
+				}
+			}
+		case *ast.CallExpr:
+			// the codes of the helpers mapping store errors, like transferError
+			if ident, ok := node.Fun.(*ast.Ident); ok {
+				if fn, ok := source.funcs[ident.Name]; ok && returnsAPIError(fn) {
+					source.analyze(t, ident.Name, into)
+				}
+			}
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok {
+				break
+			}
+			switch sel.Sel.Name {
+			case "ShouldBindJSON", "ShouldBindUri", "ShouldBindQuery":
+				arg := node.Args[0].(*ast.UnaryExpr).X.(*ast.Ident)
+				into.binds[vars[arg.Name]] = strings.TrimPrefix(sel.Sel.Name, "ShouldBind")
+			case "FormFile":
+				into.formFiles = append(into.formFiles, unquote(t, node.Args[0]))
+			}
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == "server" {
+				if _, ok := source.funcs["Server."+sel.Sel.Name]; ok {
+					source.analyze(t, "Server."+sel.Sel.Name, into)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// returnsAPIError tells whether fn returns a single *apierror.Error
+func returnsAPIError(fn *ast.FuncDecl) bool {
+	results := fn.Type.Results
+	if results == nil || len(results.List) != 1 {
+		return false
+	}
+	star, ok := results.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == "apierror" && sel.Sel.Name == "Error"
+}
+
+// specPath converts a gin path to an OpenAPI path template
+func specPath(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func newContractServer(t *testing.T) *Server {
+	return newTestServer(t, contractStore{})
+}
+
+// contractStore only answers the admin check, the probed requests are rejected before any other store call
+type contractStore struct {
+	db.Store
+}
+
+func (contractStore) GetUser(ctx context.Context, username string) (db.User, error) {
+	return db.User{Username: username, Role: utils.AdminRole}, nil
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	source := parseAPISource(t)
+	server := newContractServer(t)
+
+	// the routes of the source are the routes of the router
+	documented := make(map[string]bool)
+	var sourceRoutes, liveRoutes []string
+	for _, route := range source.routes(t) {
+		if !undocumentedRoutes[route.path] {
+			sourceRoutes = append(sourceRoutes, route.method+" "+route.path)
+		}
+	}
+	for _, route := range server.router.Routes() {
+		if !undocumentedRoutes[route.Path] {
+			liveRoutes = append(liveRoutes, route.Method+" "+route.Path)
+		}
+	}
+	require.ElementsMatch(t, sourceRoutes, liveRoutes)
+
+	for _, route := range source.routes(t) {
+		if undocumentedRoutes[route.path] {
+			continue
+		}
+		route := route
+		key := strings.ToLower(route.method) + " " + specPath(route.path)
+		documented[key] = true
+
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			op := doc.Paths[specPath(route.path)][strings.ToLower(route.method)]
+			require.NotNil(t, op, "route is not documented")
+			handler := strings.TrimPrefix(route.handler, "Server.")
+			require.Equal(t, handler, op.OperationID)
+
+			code := handlerSource{
+				statuses: make(map[int]bool),
+				codes:    make(map[apierror.Code]bool),
+				binds:    make(map[string]string),
+			}
+			source.analyze(t, route.handler, &code)
+			secured := false
+			for _, middleware := range route.middlewares {
+				if libraryFunc(middleware) {
+					continue
+				}
+				source.analyze(t, middleware, &code)
+				secured = secured || authMiddlewares[middleware]
+			}
+			for _, status := range implicitStatuses[handler] {
+				code.statuses[status] = true
+			}
+
+			errorCodes := make(map[string][]string)
+			for errorCode := range code.codes {
+				status := strconv.Itoa(errorCode.Status())
+				errorCodes[status] = append(errorCodes[status], string(errorCode))
+			}
+			statuses := make(map[string]interface{})
+			for status := range code.statuses {
+				statuses[strconv.Itoa(status)] = true
+			}
+			for status := range errorCodes {
+				statuses[status] = true
+			}
+			var responses []string
+			for status, rsp := range op.Responses {
+				responses = append(responses, status)
+				require.ElementsMatch(t, errorCodes[status], rsp.ErrorCodes, "error codes of %s", status)
+			}
+			require.ElementsMatch(t, keys(statuses), responses, "response statuses")
+			require.Equal(t, secured, len(op.Security) > 0, "security")
+
+			checkRequestBody(t, doc, op, code)
+			checkParameters(t, doc, route, op, code)
+		})
+	}
+
+	for path, methods := range doc.Paths {
+		for method := range methods {
+			require.True(t, documented[method+" "+path], "%s %s is not a route", method, path)
+		}
+	}
+}
+
+func checkRequestBody(t *testing.T, doc openAPIDocument, op *openAPIOperation, code handlerSource) {
+	var jsonType string
+	for typ, kind := range code.binds {
+		if kind == "JSON" {
+			jsonType = typ
+		}
+	}
+
+	switch {
+	case jsonType != "":
+		require.NotNil(t, op.RequestBody, "request body")
+		content, ok := op.RequestBody.Content["application/json"]
+		require.True(t, ok, "application/json request body")
+		require.Equal(t, jsonType, doc.refGoType(content.Schema), "request body type")
+		typ := specGoTypes[jsonType]
+		required := false
+		for _, field := range structFields(typ, "json") {
+			required = required || isRequired(field.binding)
+		}
+		require.Equal(t, required, op.RequestBody.Required, "request body required")
+	case len(code.formFiles) > 0:
+		require.NotNil(t, op.RequestBody, "request body")
+		content, ok := op.RequestBody.Content["multipart/form-data"]
+		require.True(t, ok, "multipart/form-data request body")
+		properties, _ := content.Schema["properties"].(map[string]interface{})
+		require.ElementsMatch(t, code.formFiles, keys(properties), "uploaded files")
+		require.ElementsMatch(t, code.formFiles, stringSlice(content.Schema["required"]), "required files")
+	default:
+		require.Nil(t, op.RequestBody, "request body")
+	}
+}
+
+func checkParameters(t *testing.T, doc openAPIDocument, route routeSource, op *openAPIOperation, code handlerSource) {
+	var paramTypes []string
+	for typ, kind := range code.binds {
+		if kind != "JSON" {
+			paramTypes = append(paramTypes, typ)
+		}
+	}
+	require.ElementsMatch(t, paramTypes, op.GoParams, "x-go-params")
+
+	documented := make(map[string]openAPIParameter)
+	for _, param := range op.Parameters {
+		documented[param.In+" "+param.Name] = param
+	}
+
+	var expected []string
+	for _, typ := range paramTypes {
+		tag, in := "form", "query"
+		if code.binds[typ] == "Uri" {
+			tag, in = "uri", "path"
+		}
+		for _, field := range structFields(specGoTypes[typ], tag) {
+			key := in + " " + field.name
+			expected = append(expected, key)
+			if in == "path" {
+				require.Contains(t, route.path, ":"+field.name, "path parameter")
+			}
+
+			param, ok := documented[key]
+			if !ok {
+				continue
+			}
+			require.Equal(t, isRequired(field.binding) || in == "path", param.Required, "%s required", key)
+			require.Equal(t, doc.fieldSchema(t, field), withoutDocs(param.Schema), "%s schema", key)
+		}
+	}
+	expected = append(expected, unboundParameters[op.OperationID]...)
+
+	var actual []string
+	for key := range documented {
+		actual = append(actual, key)
+	}
+	require.ElementsMatch(t, expected, actual, "parameters")
+}
+
+// requiresInput tells whether an empty request to the operation must fail validation
+func requiresInput(op *openAPIOperation) bool {
+	if op.RequestBody != nil && op.RequestBody.Required {
+		return true
+	}
+	for _, param := range op.Parameters {
+		if param.Required {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOpenAPIProbes(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	server := newContractServer(t)
+	accessToken, _, err := server.tokenMaker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	var paths []string
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		for method, op := range doc.Paths[path] {
+			url := strings.ReplaceAll(path, "{id}", "0")
+			method := strings.ToUpper(method)
+			secured := len(op.Security) > 0
+
+			serve := func(accessToken string) *httptest.ResponseRecorder {
+				request := httptest.NewRequest(method, url, strings.NewReader("{}"))
+				request.Header.Set("Content-Type", "application/json")
+				if accessToken != "" {
+					request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+				}
+				recorder := httptest.NewRecorder()
+				server.router.ServeHTTP(recorder, request)
+				return recorder
+			}
+
+			t.Run(method+" "+path, func(t *testing.T) {
+				if secured {
+					recorder := serve("")
+					require.Equal(t, http.StatusUnauthorized, recorder.Code, "without an access token")
+					requireProblem(t, recorder, apierror.Unauthenticated)
+				}
+				if requiresInput(op) {
+					token := ""
+					if secured {
+						token = accessToken
+					}
+					recorder := serve(token)
+					require.Equal(t, http.StatusBadRequest, recorder.Code, "with an empty request")
+					requireProblem(t, recorder, apierror.InvalidRequest)
+				}
+			})
+		}
+	}
+}
+
+// requireProblem checks that the response is problem details with code
+func requireProblem(t *testing.T, recorder *httptest.ResponseRecorder, code apierror.Code) apierror.Problem {
+	require.Equal(t, apierror.ContentType, recorder.Header().Get("Content-Type"))
+
+	var problem apierror.Problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	require.Equal(t, code, problem.Code)
+	require.Equal(t, recorder.Code, problem.Status)
+	require.Equal(t, code.Type(), problem.Type)
+	require.Equal(t, recorder.Header().Get(requestIDHeaderKey), problem.RequestID)
+	require.NotEmpty(t, problem.RequestID)
+	return problem
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	server := newContractServer(t)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(openAPISpec, body))
+	require.True(t, json.Valid(body))
+}
+
+// TestOpenAPIUserName pins the user name key of the /users routes, which is user_name
+// while the audit events and the webhook payloads use the username of db.User
+func TestOpenAPIUserName(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	for _, name := range []string{"createUserRequest", "createUserResponse", "getUserRequest", "loginUserRequest"} {
+		properties := doc.Components.Schemas[name]["properties"].(map[string]interface{})
+		require.Contains(t, properties, "user_name", name)
+		require.NotContains(t, properties, "username", name)
+	}
+
+	server := newContractServer(t)
+	body, err := json.Marshal(gin.H{
+		"username":  utils.RandomOwner(),
+		"password":  "secret",
+		"full_name": "Jane Doe",
+		"email":     utils.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	problem := requireProblem(t, recorder, apierror.InvalidRequest)
+	require.Equal(t, []apierror.FieldError{{Field: "user_name", Message: "is required"}}, problem.Errors)
+}
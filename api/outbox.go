@@ -0,0 +1,33 @@
+package api
+
+import (
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type listDeadOutboxEventsRequest struct {
+	PageId   int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=1,max=100"`
+}
+
+// ListDeadOutboxEvents lists the events the outbox relay gave up on, with the error of their last attempt
+func (server *Server) ListDeadOutboxEvents(ctx *gin.Context) {
+	var req listDeadOutboxEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	events, err := server.store.ListDeadOutboxEvents(ctx, db.ListDeadOutboxEventsParams{
+		Limit:  req.PageSize,
+		Offset: (req.PageId - 1) * req.PageSize,
+	})
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, events)
+}
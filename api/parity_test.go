@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/gapi"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// newParityServer returns a server whose /v1 gateway calls a gRPC server of the same store and token key
+func newParityServer(t *testing.T, store db.Store) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	config := config.NewSnapshot(config.Config{
+		SecreteKey:          utils.RandomString(32),
+		AccessTokenDuration: time.Minute,
+		GRPCServerAddress:   listener.Addr().String(),
+	})
+	grpcServer, err := gapi.NewServer(config, store, discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+	server := grpcServer.NewGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	httpServer, err := NewServer(config, store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+	return httpServer
+}
+
+// TestTransportParity checks that the gin routes and the /v1 gateway of the gRPC service agree
+func TestTransportParity(t *testing.T) {
+	store := memstore.New()
+	server := newParityServer(t, store)
+
+	account1 := createAccount(t, store, 100)
+	account2, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    account1.Owner,
+		Balance:  100,
+		Currency: "EUR",
+	})
+	require.NoError(t, err)
+	other := createAccount(t, store, 100)
+
+	t.Run("ListAccounts", func(t *testing.T) {
+		recorder := serveAuthorizedJSON(t, server, http.MethodGet, "/accounts", gin.H{"page_id": 1, "page_size": 10}, account1.Owner)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var accounts []db.Account
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accounts))
+		var ginIDs []int64
+		for _, account := range accounts {
+			ginIDs = append(ginIDs, account.ID)
+		}
+
+		recorder = serveAuthorizedJSON(t, server, http.MethodGet, "/v1/accounts?page_id=1&page_size=10", nil, account1.Owner)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		// protojson encodes the int64 ids as strings
+		var gatewayAccounts []struct {
+			ID string `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &gatewayAccounts))
+		var gatewayIDs []int64
+		for _, account := range gatewayAccounts {
+			id, err := strconv.ParseInt(account.ID, 10, 64)
+			require.NoError(t, err)
+			gatewayIDs = append(gatewayIDs, id)
+		}
+
+		// only the accounts of the caller
+		require.ElementsMatch(t, []int64{account1.ID, account2.ID}, ginIDs)
+		require.ElementsMatch(t, ginIDs, gatewayIDs)
+		require.NotContains(t, ginIDs, other.ID)
+	})
+
+	t.Run("TransferToSameAccount", func(t *testing.T) {
+		body := gin.H{"from_account_id": account1.ID, "to_account_id": account1.ID, "amount": 10, "currency": "USD"}
+		for _, url := range []string{"/transfers", "/v1/transfers"} {
+			recorder := serveAuthorizedJSON(t, server, http.MethodPost, url, body, account1.Owner)
+			require.Equal(t, http.StatusBadRequest, recorder.Code, url)
+			problem := requireProblem(t, recorder, apierror.InvalidRequest)
+			require.Contains(t, problem.Errors, apierror.FieldError{Field: "to_account_id", Message: "must differ from from_account_id"}, url)
+		}
+
+		got, err := store.GetAccount(context.Background(), account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, got.Balance)
+	})
+}
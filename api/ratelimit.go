@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/ratelimit"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitMiddleware takes a token from the bucket of the request in the policy of group and rejects
+// the request when none is left. It runs after auditMiddleware, which names the user of the bearer token.
+func (server *Server) rateLimitMiddleware(group string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policy := server.config.Load().RateLimitPolicy(group)
+		if !policy.Enabled() {
+			ctx.Next()
+			return
+		}
+
+		result, err := server.rateLimiter.Take(ctx, rateLimitKey(ctx, group, policy), policy)
+		if err != nil {
+			// an outage of the bucket store must not take the routes down with it
+			server.logger.ErrorContext(ctx, "can't take rate limit token", "group", group, "error", err)
+			ctx.Next()
+			return
+		}
+
+		setRateLimitHeaders(ctx, policy, result)
+		if !result.Allowed {
+			abortWithError(ctx, apierror.Newf(apierror.RateLimited, "the %s rate limit is exceeded, retry in %ds", group, ceilSeconds(result.RetryAfter)))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// rateLimitKey names the bucket of the request, the client IP is the one resolved with the trusted proxies
+func rateLimitKey(ctx *gin.Context, group string, policy ratelimit.Policy) string {
+	return policy.BucketKey(group, db.AuditMetaFrom(ctx).Actor, ctx.ClientIP(), ctx.Request.Method+" "+ctx.FullPath())
+}
+
+// setRateLimitHeaders writes the RateLimit header fields of the IETF draft and Retry-After on rejected requests
+func setRateLimitHeaders(ctx *gin.Context, policy ratelimit.Policy, result ratelimit.Result) {
+	ctx.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period)))
+	ctx.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	ctx.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	}
+}
+
+// ceilSeconds rounds up to a whole number of seconds, so a client waiting that long finds a token
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
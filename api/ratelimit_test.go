@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	snapshot := config.NewSnapshot(config.Config{
+		SecreteKey:          utils.RandomString(32),
+		AccessTokenDuration: time.Minute,
+		GRPCServerAddress:   "127.0.0.1:9090",
+		RateLimitAuth:       "ip:2/1m",
+	})
+	store := memstore.New()
+	server, err := NewServer(snapshot, store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	login := func(remoteAddr string, forwardedFor ...string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(loginUserRequest{Username: "nobody", Password: "secret"})
+		require.NoError(t, err)
+		request := httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(body))
+		request.RemoteAddr = remoteAddr
+		for _, ip := range forwardedFor {
+			request.Header.Add("X-Forwarded-For", ip)
+		}
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		recorder := login("192.0.2.1:1234")
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		require.Equal(t, "2", recorder.Header().Get("RateLimit-Limit"))
+		require.Equal(t, "2;w=60", recorder.Header().Get("RateLimit-Policy"))
+		require.Equal(t, fmt.Sprint(remaining), recorder.Header().Get("RateLimit-Remaining"))
+		require.Empty(t, recorder.Header().Get("Retry-After"))
+	}
+
+	recorder := login("192.0.2.1:1234")
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "30", recorder.Header().Get("Retry-After"))
+	require.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "60", recorder.Header().Get("RateLimit-Reset"))
+	var problem apierror.Problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	require.Equal(t, apierror.RateLimited, problem.Code)
+
+	// no proxy is trusted, so a client can't get a fresh bucket by forging X-Forwarded-For
+	require.Equal(t, http.StatusTooManyRequests, login("192.0.2.1:1234", "198.51.100.1").Code)
+
+	// the other clients have their own bucket
+	require.Equal(t, http.StatusUnauthorized, login("192.0.2.2:1234").Code)
+
+	// the routes of other groups are not limited by the policy
+	request := httptest.NewRequest(http.MethodGet, "/users?username=nobody", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	recorder = httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Empty(t, recorder.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitTrustedProxies(t *testing.T) {
+	snapshot := config.NewSnapshot(config.Config{
+		SecreteKey:          utils.RandomString(32),
+		AccessTokenDuration: time.Minute,
+		GRPCServerAddress:   "127.0.0.1:9090",
+		TrustedProxies:      []string{"192.0.2.0/24"},
+		RateLimitAuth:       "ip:1/1m",
+	})
+	store := memstore.New()
+	server, err := NewServer(snapshot, store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	login := func(forwardedFor string) int {
+		body, err := json.Marshal(loginUserRequest{Username: "nobody", Password: "secret"})
+		require.NoError(t, err)
+		request := httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(body))
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set("X-Forwarded-For", forwardedFor)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// behind a trusted proxy each client has its own bucket
+	require.Equal(t, http.StatusUnauthorized, login("198.51.100.1"))
+	require.Equal(t, http.StatusUnauthorized, login("198.51.100.2"))
+	require.Equal(t, http.StatusTooManyRequests, login("198.51.100.1"))
+	// the hops before the first untrusted one can be forged and are ignored
+	require.Equal(t, http.StatusTooManyRequests, login("203.0.113.1, 198.51.100.1"))
+}
@@ -1,57 +1,188 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"lesson/simple-bank/apierror"
 	"lesson/simple-bank/config"
 	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/gapi"
+	"lesson/simple-bank/initial"
+	"lesson/simple-bank/lockout"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
 	"lesson/simple-bank/token"
-	"log"
+	"lesson/simple-bank/webhook"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 )
 
 type Server struct {
-	config     config.Config
-	tokenMaker token.Maker
-	store      db.Store
-	router     *gin.Engine
+	config        *config.Snapshot
+	tokenMaker    token.Maker
+	store         db.Store
+	webhookWorker *webhook.Worker
+	broker        *stream.Broker
+	logger        *slog.Logger
+	rateLimiter   ratelimit.Store
+	loginGuard    *lockout.Guard
+	router        *gin.Engine
+	httpServer    *http.Server
+	// the import jobs running in the background
+	jobs            sync.WaitGroup
+	readinessChecks []namedCheck
+	shuttingDown    atomic.Bool
 }
 
-func NewServer(config config.Config, store db.Store) (*Server, error) {
-	maker, err := token.NewJWTMaker(config.SecreteKey)
+// NewServer returns the HTTP server, the fields of config tagged reload are read anew by each request.
+// The test events of the webhooks are delivered by webhookWorker, the one that delivers the other events.
+// The rate limit buckets of the route groups are kept in rateLimiter.
+func NewServer(config *config.Snapshot, store db.Store, broker *stream.Broker, webhookWorker *webhook.Worker, logger *slog.Logger, rateLimiter ratelimit.Store) (*Server, error) {
+	current := config.Load()
+	maker, err := initial.NewTokenMaker(current, logger)
 	if err != nil {
-		log.Fatal("Can't make token maker ", err)
+		return nil, fmt.Errorf("can't make token maker: %w", err)
 	}
 
 	server := &Server{
-		store:      store,
-		config:     config,
-		tokenMaker: maker,
+		store:         store,
+		config:        config,
+		tokenMaker:    maker,
+		webhookWorker: webhookWorker,
+		broker:        broker,
+		logger:        logger,
+		rateLimiter:   rateLimiter,
+		loginGuard:    lockout.NewGuard(store),
 	}
 
-	server.setRouterGroup()
+	// name the fields of validation errors like the request does
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(apierror.FieldName)
+	}
+
+	// the /v1 routes are the REST facade of the gRPC service
+	gateway, err := gapi.NewGateway(context.Background(), current.GRPCServerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := server.setRouterGroup(gateway, current.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	server.httpServer = &http.Server{
+		Handler:      server.router,
+		ReadTimeout:  current.ServerReadTimeout,
+		WriteTimeout: current.ServerWriteTimeout,
+		IdleTimeout:  current.ServerIdleTimeout,
+	}
+	// the account event streams never go idle, end them so their clients resume from another instance
+	server.httpServer.RegisterOnShutdown(server.broker.Reset)
 
 	return server, nil
 }
 
-func (server *Server) setRouterGroup() {
-	router := gin.Default()
+func (server *Server) setRouterGroup(gateway http.Handler, trustedProxies []string) error {
+	// requestLogMiddleware replaces the logger of gin.Default
+	router := gin.New()
+	// gin trusts the X-Forwarded-For of any peer by default, which lets a client pick its IP
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return fmt.Errorf("can't set trusted proxies: %w", err)
+	}
+	// let the store read the request context values, such as the audit metadata, through *gin.Context
+	router.ContextWithFallback = true
+	router.Use(gin.Recovery(), tracingMiddleware(), metricsMiddleware(), requestLogMiddleware(server.logger), auditMiddleware(server.tokenMaker))
+
+	router.GET("healthz", server.Healthz)
+	router.GET("readyz", server.Readyz)
+	router.GET("version", server.Version)
 
-	router.POST("users", server.CreateUser)
 	router.GET("users", server.GetUser)
+	loginRoutes := router.Group("/").Use(server.rateLimitMiddleware(ratelimit.GroupAuth))
+	loginRoutes.POST("users", server.CreateUser)
+	loginRoutes.POST("users/login", server.LoginUser)
 
 	router.POST("accounts", server.CreateAccount)
 	router.GET("accounts/:id", server.GetAccount)
-	router.GET("accounts", server.ListAccount)
 
-	router.POST("transfers", server.CreateTransfer)
+	transferRoutes := router.Group("/").Use(server.rateLimitMiddleware(ratelimit.GroupTransfers))
+	transferRoutes.POST("transfers", server.CreateTransfer)
+	// import jobs belong to the user who uploads them
+	importRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker), server.rateLimitMiddleware(ratelimit.GroupTransfers))
+	importRoutes.POST("imports", server.CreateImportJob)
+
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	authRoutes.GET("accounts", server.ListAccount)
+	authRoutes.GET("imports/:id", server.GetImportJob)
+	authRoutes.GET("imports/:id/report", server.GetImportReport)
+	authRoutes.POST("webhooks", server.CreateWebhook)
+	authRoutes.GET("webhooks", server.ListWebhooks)
+	authRoutes.DELETE("webhooks/:id", server.DeleteWebhook)
+	authRoutes.GET("webhooks/:id/deliveries", server.ListWebhookDeliveries)
+	authRoutes.POST("webhooks/:id/test", server.SendWebhookTestEvent)
+
+	streamRoutes := router.Group("/").Use(streamAuthMiddleware(server.tokenMaker))
+	streamRoutes.GET("accounts/:id/stream", server.StreamAccount)
+	streamRoutes.GET("accounts/:id/ws", server.StreamAccountWebSocket)
+
+	adminRoutes := router.Group("admin").Use(authMiddleware(server.tokenMaker), server.adminMiddleware())
+	adminRoutes.GET("ledger/verify", server.VerifyLedger)
+	adminRoutes.GET("audit-events", server.ListAuditEvents)
+	adminRoutes.GET("outbox/dead", server.ListDeadOutboxEvents)
+	adminRoutes.POST("users/:username/unlock", server.UnlockUserLogin)
+
+	router.Any("v1/*path", gatewayHandler(gateway))
+	router.GET("swagger/*filepath", server.ServeSwagger)
+	router.GET("openapi.json", server.ServeOpenAPI)
 
 	server.router = router
+	return nil
 }
 
+// Start serves the HTTP API on address until Shutdown is called
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
 }
 
-func errResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
+// Serve serves the HTTP API on listener until Shutdown is called, which makes it return nil
+func (server *Server) Serve(listener net.Listener) error {
+	server.logger.Info("HTTP server listening", "address", listener.Addr().String())
+	err := server.httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown fails the readiness probe, stops accepting connections and waits for the in-flight requests
+// and the running import jobs until ctx is done
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.shuttingDown.Store(true)
+	if err := server.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		server.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("import jobs still running: %w", ctx.Err())
+	}
 }
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/logging"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// blockingStore holds TranserTx until release is closed
+type blockingStore struct {
+	db.Store
+	started chan struct{}
+	release chan struct{}
+}
+
+func (store *blockingStore) TranserTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	close(store.started)
+	<-store.release
+	return store.Store.TranserTx(ctx, arg)
+}
+
+func createAccount(t *testing.T, store db.Store, balance int64) db.Account {
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username: utils.RandomOwner(),
+		FullName: utils.RandomOwner(),
+		Email:    utils.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  balance,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func TestShutdownDrainsTransfer(t *testing.T) {
+	store := &blockingStore{Store: memstore.New(), started: make(chan struct{}), release: make(chan struct{})}
+	account1 := createAccount(t, store, 100)
+	account2 := createAccount(t, store, 100)
+	server := newTestServer(t, store)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	type response struct {
+		status int
+		err    error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		body, _ := json.Marshal(transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: "USD"})
+		resp, err := http.Post(fmt.Sprintf("http://%s/transfers", address), "application/json", bytes.NewReader(body))
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		resp.Body.Close()
+		responses <- response{status: resp.StatusCode}
+	}()
+	<-store.started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	// new connections are refused while the transfer is in flight
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned before the transfer completed: %v", err)
+	default:
+	}
+
+	close(store.release)
+	got := <-responses
+	require.NoError(t, got.err)
+	require.Equal(t, http.StatusOK, got.status)
+	require.NoError(t, <-shutdown)
+	require.NoError(t, <-served)
+
+	account, err := store.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(90), account.Balance)
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	store := memstore.New()
+	account := createAccount(t, store, 100)
+	server := newTestServer(t, store)
+
+	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID+1000), nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server.router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	require.Equal(t, "GET /accounts/:id", span.Name())
+	require.Equal(t, trace.SpanKindServer, span.SpanKind())
+	// the span continues the trace of the caller
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	require.Contains(t, span.Attributes(), attribute.Int("http.status_code", http.StatusNotFound))
+	require.Contains(t, span.Attributes(), attribute.String("http.route", "/accounts/:id"))
+}
+
+func TestRequestLogMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, logging.FormatJSON, slog.LevelInfo)
+	require.NoError(t, err)
+
+	store := memstore.New()
+	account := createAccount(t, store, 100)
+	server, err := NewServer(config.NewSnapshot(config.Config{
+		SecreteKey:          utils.RandomString(32),
+		AccessTokenDuration: time.Minute,
+		GRPCServerAddress:   "127.0.0.1:9090",
+	}), store, stream.NewBroker(), newTestWebhookWorker(store), logger, ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		requestID string
+		propagate bool
+	}{
+		{"Propagated", "client-request.42", true},
+		{"Missing", "", false},
+		{"TooLong", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"InvalidCharacters", "id\nforged log line", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs.Reset()
+			request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID+1000), nil)
+			if tc.requestID != "" {
+				request.Header.Set(requestIDHeaderKey, tc.requestID)
+			}
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+
+			requestID := recorder.Header().Get(requestIDHeaderKey)
+			if tc.propagate {
+				require.Equal(t, tc.requestID, requestID)
+			} else {
+				require.NotEqual(t, tc.requestID, requestID)
+				require.True(t, validRequestID(requestID))
+			}
+
+			var record map[string]interface{}
+			require.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+			require.Equal(t, "WARN", record["level"])
+			require.Equal(t, "request", record["msg"])
+			require.Equal(t, requestID, record["request_id"])
+			require.Equal(t, http.MethodGet, record["method"])
+			require.Equal(t, "/accounts/:id", record["route"])
+			require.Equal(t, float64(http.StatusNotFound), record["status"])
+			require.Contains(t, record, "latency")
+			require.Contains(t, record, "user")
+			require.Equal(t, "192.0.2.1", record["client_ip"])
+		})
+	}
+}
+
+func TestStreamAuthMiddlewareRedactsAccessToken(t *testing.T) {
+	server := newTestServer(t, memstore.New())
+	accessToken, _, err := server.tokenMaker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	var requestURI, rawQuery string
+	router := gin.New()
+	router.GET("/stream", streamAuthMiddleware(server.tokenMaker), func(ctx *gin.Context) {
+		requestURI = ctx.Request.RequestURI
+		rawQuery = ctx.Request.URL.RawQuery
+		ctx.Status(http.StatusNoContent)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/stream?last_event_id=7&access_token="+accessToken, nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, "/stream?last_event_id=7", requestURI)
+	require.Equal(t, "last_event_id=7", rawQuery)
+}
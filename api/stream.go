@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/token"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	lastEventIDHeaderKey = "Last-Event-ID"
+	lastEventIDQueryKey  = "last_event_id"
+	streamReplayPageSize = 100
+	balanceEventType     = "balance"
+	entryEventType       = "entry"
+	wsWriteTimeout       = 10 * time.Second
+)
+
+var errTokenExpired = errors.New("access token expired, reconnect with a new one")
+
+// streamSink writes account events to one client connection
+type streamSink interface {
+	send(eventType string, event stream.AccountEvent) error
+	heartbeat() error
+}
+
+type streamAccountRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// authorizeStream loads the account of the request and checks that it belongs to the token owner
+func (server *Server) authorizeStream(ctx *gin.Context) (db.Account, *token.Payload, int64, bool) {
+	var req streamAccountRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return db.Account{}, nil, 0, false
+	}
+
+	lastEventID := ctx.GetHeader(lastEventIDHeaderKey)
+	if lastEventID == "" {
+		lastEventID = ctx.Query(lastEventIDQueryKey)
+	}
+	var lastID int64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			abortWithError(ctx, &apierror.Error{
+				Code:   apierror.InvalidRequest,
+				Detail: "some fields are invalid",
+				Fields: []apierror.FieldError{{Field: lastEventIDQueryKey, Message: fmt.Sprintf("must be a non-negative integer, not %q", lastEventID)}},
+			})
+			return db.Account{}, nil, 0, false
+		}
+	}
+
+	account, err := server.store.GetAccount(ctx, req.ID)
+	if err != nil {
+		abortWithError(ctx, apierror.FromDB(err, apierror.AccountNotFound))
+		return db.Account{}, nil, 0, false
+	}
+
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if account.Owner != payload.Username {
+		abortWithError(ctx, apierror.New(apierror.PermissionDenied, "the account doesn't belong to the authenticated user"))
+		return db.Account{}, nil, 0, false
+	}
+	return account, payload, lastID, true
+}
+
+// StreamAccount pushes the balance and entries of an account as Server-Sent Events
+func (server *Server) StreamAccount(ctx *gin.Context) {
+	account, payload, lastID, ok := server.authorizeStream(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Content-Type", sse.ContentType)
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	err := server.streamAccount(ctx.Request.Context(), account, payload, lastID, sseSink{ctx})
+	if errors.Is(err, errTokenExpired) {
+		sse.Encode(ctx.Writer, sse.Event{Event: "error", Data: problem(ctx, apierror.New(apierror.Unauthenticated, err.Error()))})
+		ctx.Writer.Flush()
+	}
+}
+
+type sseSink struct {
+	ctx *gin.Context
+}
+
+func (sink sseSink) send(eventType string, event stream.AccountEvent) error {
+	err := sse.Encode(sink.ctx.Writer, sse.Event{
+		Id:    strconv.FormatInt(event.EntryID, 10),
+		Event: eventType,
+		Data:  event,
+	})
+	if err != nil {
+		return err
+	}
+	sink.ctx.Writer.Flush()
+	return nil
+}
+
+func (sink sseSink) heartbeat() error {
+	if _, err := fmt.Fprint(sink.ctx.Writer, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	sink.ctx.Writer.Flush()
+	return nil
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsMessage is the WebSocket framing of an SSE event
+type wsMessage struct {
+	Type string              `json:"type"`
+	ID   int64               `json:"id"`
+	Data stream.AccountEvent `json:"data"`
+}
+
+// StreamAccountWebSocket is the WebSocket equivalent of StreamAccount, clients resume with the last_event_id query
+func (server *Server) StreamAccountWebSocket(ctx *gin.Context) {
+	account, payload, lastID, ok := server.authorizeStream(ctx)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// the upgrader already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// the client doesn't send anything but reading is needed to process pongs and the close handshake
+	streamCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = server.streamAccount(streamCtx, account, payload, lastID, wsSink{conn})
+	closeCode, reason := websocket.CloseNormalClosure, ""
+	switch {
+	case errors.Is(err, errTokenExpired):
+		closeCode, reason = websocket.ClosePolicyViolation, err.Error()
+	case err != nil:
+		closeCode, reason = websocket.CloseTryAgainLater, "resume from the last event id"
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(wsWriteTimeout))
+}
+
+type wsSink struct {
+	conn *websocket.Conn
+}
+
+func (sink wsSink) send(eventType string, event stream.AccountEvent) error {
+	sink.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return sink.conn.WriteJSON(wsMessage{Type: eventType, ID: event.EntryID, Data: event})
+}
+
+func (sink wsSink) heartbeat() error {
+	return sink.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+}
+
+var errSubscriptionClosed = errors.New("subscription closed")
+
+// streamAccount sends the current balance or replays the entries after lastID, then the live events
+// until the client goes away, the token expires or the subscription is dropped
+func (server *Server) streamAccount(ctx context.Context, account db.Account, payload *token.Payload, lastID int64, sink streamSink) error {
+	// subscribe before reading the database so no entry committed in between is missed
+	sub := server.broker.Subscribe(account.ID)
+	defer server.broker.Unsubscribe(sub)
+
+	lastID, err := server.replayAccount(ctx, account, lastID, sink)
+	if err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(server.config.Load().StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+	expired := time.NewTimer(time.Until(payload.ExpiresAt))
+	defer expired.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-expired.C:
+			return errTokenExpired
+		case <-heartbeat.C:
+			if err := sink.heartbeat(); err != nil {
+				return err
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				return errSubscriptionClosed
+			}
+			// entries of one account are committed in id order as they lock the account row
+			if event.EntryID <= lastID {
+				continue
+			}
+			if err := sink.send(entryEventType, event); err != nil {
+				return err
+			}
+			lastID = event.EntryID
+		}
+	}
+}
+
+// replayAccount sends the entries after lastID, or the balance as of the latest entry for a new client,
+// and returns the id of the last event sent
+func (server *Server) replayAccount(ctx context.Context, account db.Account, lastID int64, sink streamSink) (int64, error) {
+	eventType := entryEventType
+	if lastID == 0 {
+		eventType = balanceEventType
+		last, err := server.store.GetLastAccountEntry(ctx, account.ID)
+		if err == sql.ErrNoRows {
+			return 0, sink.send(balanceEventType, stream.AccountEvent{
+				AccountID: account.ID,
+				Balance:   account.Balance,
+				CreatedAt: account.CreatedAt,
+			})
+		}
+		if err != nil {
+			return 0, err
+		}
+		lastID = last.ID - 1
+	}
+
+	for {
+		rows, err := server.store.ListAccountEntriesAfter(ctx, db.ListAccountEntriesAfterParams{
+			AccountID: account.ID,
+			AfterID:   lastID,
+			Size:      streamReplayPageSize,
+		})
+		if err != nil {
+			return lastID, err
+		}
+
+		for _, row := range rows {
+			if err := sink.send(eventType, stream.NewAccountEvent(row)); err != nil {
+				return lastID, err
+			}
+			eventType = entryEventType
+			lastID = row.ID
+		}
+		if len(rows) < streamReplayPageSize {
+			return lastID, nil
+		}
+	}
+}
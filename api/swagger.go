@@ -0,0 +1,51 @@
+package api
+
+import (
+	"io/fs"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/doc"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+const swaggerSpecFile = "/simple_bank.swagger.json"
+
+// swaggerInitializer points the embedded Swagger UI at the spec of the /v1 gateway routes
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/swagger` + swaggerSpecFile + `",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// ServeSwagger serves Swagger UI and the OpenAPI v2 spec from the binary
+func (server *Server) ServeSwagger(ctx *gin.Context) {
+	switch file := ctx.Param("filepath"); file {
+	case "/", "/index.html":
+		// http.FileServer redirects index.html to the directory, so it is served directly
+		index, err := fs.ReadFile(swaggerFiles.FS, "index.html")
+		if err != nil {
+			abortWithError(ctx, apierror.Internal(err))
+			return
+		}
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	case swaggerSpecFile:
+		ctx.Data(http.StatusOK, "application/json", doc.SwaggerJSON)
+	case "/swagger-initializer.js":
+		ctx.Data(http.StatusOK, "application/javascript", []byte(swaggerInitializer))
+	default:
+		ctx.FileFromFS(file, http.FS(swaggerFiles.FS))
+	}
+}
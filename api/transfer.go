@@ -1,8 +1,10 @@
 package api
 
 import (
-	"database/sql"
+	"errors"
+	"lesson/simple-bank/apierror"
 	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/metrics"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -16,17 +18,36 @@ type transferRequest struct {
 }
 
 func (server *Server) CreateTransfer(ctx *gin.Context) {
+	defer func() {
+		if code, ok := ctx.Get(problemCodeKey); ok {
+			metrics.TransferFailed(string(code.(apierror.Code)))
+		}
+	}()
+
 	var req transferRequest
 	err := ctx.ShouldBindJSON(&req)
 	if err!= nil {
-		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+	if req.FromAccountID == req.ToAccountID {
+		abortWithError(ctx, &apierror.Error{
+			Code:   apierror.InvalidRequest,
+			Detail: "some fields are invalid",
+			Fields: []apierror.FieldError{{Field: "to_account_id", Message: "must differ from from_account_id"}},
+		})
+		return
+	}
+
+	if current := server.config.Load(); !current.TransferAllowed(req.Amount) {
+		abortWithError(ctx, apierror.Newf(apierror.TransferLimit, "amount %d is above the limit of %d per transfer", req.Amount, current.MaxTransferAmount))
 		return
 	}
 
-	if !server.vaildAccount(ctx, req.FromAccountID, req.Currency) {
+	if _, ok := server.vaildAccount(ctx, req.FromAccountID, req.Currency); !ok {
 		return
 	}
-	if !server.vaildAccount(ctx, req.ToAccountID, req.Currency) {
+	if _, ok := server.vaildAccount(ctx, req.ToAccountID, req.Currency); !ok {
 		return
 	}
 
@@ -37,28 +58,44 @@ func (server *Server) CreateTransfer(ctx *gin.Context) {
 	}
 	result, err := server.store.TranserTx(ctx, arg)
     if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		abortWithError(ctx, transferError(err))
         return
 	}
+	metrics.TransferCreated(result.FromAccount.Currency, result.Transfer.Amount)
 
 	ctx.JSON(http.StatusOK, result)
 }
 
-func (server *Server) vaildAccount(ctx *gin.Context, accountId int64, currency string ) bool { 
+// transferError maps a TranserTx error, the transaction checks the balance and checks again
+// that the accounts aren't frozen once their rows are locked
+func transferError(err error) *apierror.Error {
+	var frozen *db.AccountFrozenError
+	var insufficient *db.InsufficientFundsError
+	switch {
+	case errors.As(err, &frozen):
+		return apierror.Newf(apierror.AccountFrozen, "account %d is frozen", frozen.AccountID)
+	case errors.As(err, &insufficient):
+		return apierror.Newf(apierror.InsufficientFunds, "account %d has a balance of %d %s", insufficient.AccountID, insufficient.Balance, insufficient.Currency)
+	}
+	return apierror.Internal(err)
+}
+
+func (server *Server) vaildAccount(ctx *gin.Context, accountId int64, currency string ) (db.Account, bool) { 
 	account, err := server.store.GetAccount(ctx, accountId)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errResponse(err))
-			return false
-		}
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
-        return false
+		abortWithError(ctx, apierror.FromDB(err, apierror.AccountNotFound))
+        return account, false
 	}
 
 	if account.Currency != currency { 
-		ctx.JSON(http.StatusBadRequest, errResponse(err))
-        return false
+		abortWithError(ctx, apierror.Newf(apierror.CurrencyMismatch, "account %d currency is %s, not %s", account.ID, account.Currency, currency))
+        return account, false
+	}
+
+	if account.Frozen {
+		abortWithError(ctx, apierror.Newf(apierror.AccountFrozen, "account %d is frozen", account.ID))
+		return account, false
 	}
 
-	return true
+	return account, true
 }
\ No newline at end of file
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"database/sql"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	mockdb "lesson/simple-bank/db/mock"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/initial"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTransferAPI(t *testing.T) {
+	amount := int64(10)
+	account1 := randomAccount(utils.RandomOwner(), "USD")
+	account2 := randomAccount(utils.RandomOwner(), "USD")
+	account3 := randomAccount(utils.RandomOwner(), "EUR")
+	account1.ID, account2.ID, account3.ID = 1, 2, 3
+	account1.Balance = 100
+
+	result := db.TransferTxResult{
+		Transfer:    db.Transfer{ID: 1, FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount},
+		FromAccount: account1,
+		ToAccount:   account2,
+		FromEntry:   db.Entry{ID: 1, AccountID: account1.ID, Amount: -amount},
+		ToEntry:     db.Entry{ID: 2, AccountID: account2.ID, Amount: amount},
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				arg := db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount}
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(result, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, result)
+			},
+		},
+		{
+			name: "FrozenDuringTransfer",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.TransferTxResult{}, &db.AccountFrozenError{AccountID: account2.ID})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireProblem(t, recorder, apierror.AccountFrozen)
+			},
+		},
+		{
+			name: "SameAccount",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account1.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "to_account_id", Message: "must differ from from_account_id"}}, problem.Errors)
+			},
+		},
+		{
+			name: "FromAccountNotFound",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(db.Account{}, sql.ErrNoRows)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(0)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireProblem(t, recorder, apierror.AccountNotFound)
+			},
+		},
+		{
+			name: "ToAccountNotFound",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(db.Account{}, sql.ErrNoRows)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireProblem(t, recorder, apierror.AccountNotFound)
+			},
+		},
+		{
+			name: "FromAccountCurrencyMismatch",
+			body: gin.H{"from_account_id": account3.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(0)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.CurrencyMismatch)
+				require.Equal(t, "account 3 currency is EUR, not USD", problem.Detail)
+			},
+		},
+		{
+			name: "ToAccountCurrencyMismatch",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account3.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireProblem(t, recorder, apierror.CurrencyMismatch)
+			},
+		},
+		{
+			name: "ToAccountFrozen",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozen := account2
+				frozen.Frozen = true
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(frozen, nil)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireProblem(t, recorder, apierror.AccountFrozen)
+			},
+		},
+		{
+			name: "InsufficientFunds",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": account1.Balance + 1, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				// the balance is checked on the locked row, by the transaction
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.TransferTxResult{}, &db.InsufficientFundsError{AccountID: account1.ID, Balance: account1.Balance, Currency: "USD"})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InsufficientFunds)
+				require.Equal(t, "account 1 has a balance of 100 USD", problem.Detail)
+			},
+		},
+		{
+			name: "NegativeAmount",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": -amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "amount", Message: "must be greater than 0"}}, problem.Errors)
+			},
+		},
+		{
+			name: "GetAccountError",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, sql.ErrConnDone)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, apierror.InternalError)
+			},
+		},
+		{
+			name: "TransferTxError",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": "USD"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TranserTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, sql.ErrTxDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, apierror.InternalError)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := serveJSON(t, server, http.MethodPost, "/transfers", tc.body)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestCreateTransferLimit(t *testing.T) {
+	t.Setenv(initial.EnvName, "")
+	current, err := initial.LoadingConfig("..")
+	require.NoError(t, err)
+	current.MaxTransferAmount = 50
+	snapshot := config.NewSnapshot(current)
+
+	store := memstore.New()
+	server, err := NewServer(snapshot, store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+	account1 := createAccount(t, store, 100)
+	account2 := createAccount(t, store, 100)
+	body := transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 60, Currency: "USD"}
+
+	recorder := serveJSON(t, server, http.MethodPost, "/transfers", body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireProblem(t, recorder, apierror.TransferLimit)
+
+	// a reload raises the limit of the next request
+	next := current
+	next.MaxTransferAmount = 100
+	changed, _, err := snapshot.Reload(next)
+	require.NoError(t, err)
+	require.Equal(t, []string{"MAXTRANSFERAMOUNT"}, changed)
+
+	recorder = serveJSON(t, server, http.MethodPost, "/transfers", body)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
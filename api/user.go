@@ -2,15 +2,17 @@ package api
 
 import (
 	"database/sql"
-	"fmt"
+	"errors"
+	"lesson/simple-bank/apierror"
 	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/lockout"
 	"lesson/simple-bank/utils"
+	"strconv"
 	"time"
 
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
 )
 
 type createUserRequest struct {
@@ -32,13 +34,13 @@ func (server *Server) CreateUser(ctx *gin.Context) {
 	var req createUserRequest
 	err := ctx.ShouldBindJSON(&req)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		abortWithError(ctx, apierror.FromBinding(err))
 		return
 	}
 
 	hashedPd, err := utils.HashedPassword(req.Password)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		abortWithError(ctx, apierror.Internal(err))
 		return
 	}
 	arg := db.CreateUserParams{
@@ -47,17 +49,9 @@ func (server *Server) CreateUser(ctx *gin.Context) {
 		FullName:       req.FullName,
 		Email:          req.Email,
 	}
-	user, err := server.store.CreateUser(ctx, arg)
+	user, err := server.store.CreateUserTx(ctx, arg)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			fmt.Println(pqErr.Code.Name())
-			switch pqErr.Code.Name() {
-			case "unique_violation":
-				ctx.JSON(http.StatusForbidden, errResponse(err))
-				return
-			}
-		}
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		abortWithError(ctx, apierror.FromDB(err, apierror.DuplicateUsername, apierror.DuplicateEmail))
 		return
 	}
 	rsp := createUserResponse{
@@ -77,17 +71,13 @@ type getUserRequest struct {
 func (server *Server) GetUser(ctx *gin.Context) {
 	var req getUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errResponse(err))
+		abortWithError(ctx, apierror.FromBinding(err))
 		return
 	}
 
 	user, err := server.store.GetUser(ctx, req.Username)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errResponse(err))
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, errResponse(err))
+		abortWithError(ctx, apierror.FromDB(err, apierror.UserNotFound))
 		return
 	}
 
@@ -100,3 +90,107 @@ func (server *Server) GetUser(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, rsp)
 }
+
+type loginUserRequest struct {
+	Username string `json:"user_name" binding:"required,alphanum"`
+	Password string `json:"password" binding:"required,min=5"`
+}
+
+type loginUserResponse struct {
+	AccessToken          string             `json:"access_token"`
+	AccessTokenExpiresAt time.Time          `json:"access_token_expires_at"`
+	User                 createUserResponse `json:"user"`
+}
+
+// LoginUser issues an access token. The failed logins of a username and of a client IP delay and then
+// lock their next ones, an unknown username fails like a wrong password so usernames can't be probed.
+func (server *Server) LoginUser(ctx *gin.Context) {
+	var req loginUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	// the attempt counts before the password is compared, so parallel guesses can't outrun the lockout
+	attempt, wait, err := server.loginGuard.Begin(ctx, lockout.NewPolicy(server.config.Load()), req.Username, ctx.ClientIP())
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+	if wait > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+		abortWithError(ctx, apierror.Newf(apierror.LoginLocked, "too many failed logins, retry in %ds", ceilSeconds(wait)))
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, req.Username)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// take as long as a wrong password
+		utils.CompareDummyPassword(req.Password)
+	case err != nil:
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	default:
+		err = utils.ComparePassword(user.HashedPassword, req.Password)
+	}
+	if err != nil {
+		if err := attempt.Fail(ctx); err != nil {
+			abortWithError(ctx, apierror.Internal(err))
+			return
+		}
+		abortWithError(ctx, apierror.New(apierror.InvalidCredentials, "the username or password doesn't match"))
+		return
+	}
+
+	if err := attempt.Succeed(ctx); err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	accessToken, payload, err := server.tokenMaker.CreateToken(user.Username, server.config.Load().AccessTokenDuration)
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	rsp := loginUserResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: payload.ExpiresAt,
+		User: createUserResponse{
+			Username:         user.Username,
+			FullName:         user.FullName,
+			Email:            user.Email,
+			CreatedAt:        user.CreatedAt,
+			PasswordChangeAt: user.PasswordChangeAt,
+		},
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type unlockUserLoginRequest struct {
+	Username string `uri:"username" binding:"required,alphanum"`
+}
+
+type unlockLoginResponse struct {
+	Username string `json:"user_name"`
+	Unlocked bool   `json:"unlocked"`
+}
+
+// UnlockUserLogin forgets the failed logins of a username, which lifts its delay or lockout.
+// The failures of the client IPs are kept.
+func (server *Server) UnlockUserLogin(ctx *gin.Context) {
+	var req unlockUserLoginRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	unlocked, err := server.loginGuard.Unlock(ctx, req.Username)
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, unlockLoginResponse{Username: req.Username, Unlocked: unlocked})
+}
@@ -0,0 +1,501 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	mockdb "lesson/simple-bank/db/mock"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/utils"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// eqCreateUserParamsMatcher matches CreateUserParams whose hashed password is a hash of password
+type eqCreateUserParamsMatcher struct {
+	arg      db.CreateUserParams
+	password string
+}
+
+func (e eqCreateUserParamsMatcher) Matches(x interface{}) bool {
+	arg, ok := x.(db.CreateUserParams)
+	if !ok {
+		return false
+	}
+
+	if err := utils.ComparePassword(arg.HashedPassword, e.password); err != nil {
+		return false
+	}
+
+	e.arg.HashedPassword = arg.HashedPassword
+	return reflect.DeepEqual(e.arg, arg)
+}
+
+func (e eqCreateUserParamsMatcher) String() string {
+	return fmt.Sprintf("matches arg %v and password %v", e.arg, e.password)
+}
+
+func EqCreateUserParams(arg db.CreateUserParams, password string) gomock.Matcher {
+	return eqCreateUserParamsMatcher{arg, password}
+}
+
+func randomUser(t *testing.T) (db.User, string) {
+	password := utils.RandomString(6)
+	hashedPassword, err := utils.HashedPassword(password)
+	require.NoError(t, err)
+
+	user := db.User{
+		Username:         utils.RandomOwner(),
+		HashedPassword:   hashedPassword,
+		FullName:         utils.RandomOwner(),
+		Email:            utils.RandomEmail(),
+		PasswordChangeAt: time.Now().UTC().Truncate(time.Second),
+		CreatedAt:        time.Now().UTC().Truncate(time.Second),
+		Role:             utils.DepositorRole,
+	}
+	return user, password
+}
+
+func newUserResponse(user db.User) createUserResponse {
+	return createUserResponse{
+		Username:         user.Username,
+		FullName:         user.FullName,
+		Email:            user.Email,
+		CreatedAt:        user.CreatedAt,
+		PasswordChangeAt: user.PasswordChangeAt,
+	}
+}
+
+func TestCreateUserAPI(t *testing.T) {
+	user, password := randomUser(t)
+	body := func(changes gin.H) gin.H {
+		body := gin.H{
+			"user_name": user.Username,
+			"password":  password,
+			"full_name": user.FullName,
+			"email":     user.Email,
+		}
+		for key, value := range changes {
+			body[key] = value
+		}
+		return body
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: body(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateUserParams{
+					Username: user.Username,
+					FullName: user.FullName,
+					Email:    user.Email,
+				}
+				store.EXPECT().CreateUserTx(gomock.Any(), EqCreateUserParams(arg, password)).Times(1).Return(user, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, newUserResponse(user))
+				require.NotContains(t, recorder.Body.String(), "hashed_password")
+			},
+		},
+		{
+			name: "DuplicateUsername",
+			body: body(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.User{}, &pq.Error{Code: "23505", Constraint: "users_pkey"})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireProblem(t, recorder, apierror.DuplicateUsername)
+			},
+		},
+		{
+			name: "DuplicateEmail",
+			body: body(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.User{}, &pq.Error{Code: "23505", Constraint: "users_email_key"})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireProblem(t, recorder, apierror.DuplicateEmail)
+			},
+		},
+		{
+			name: "InternalError",
+			body: body(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, apierror.InternalError)
+			},
+		},
+		{
+			name: "InvalidUsername",
+			body: body(gin.H{"user_name": "invalid-user#1"}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "user_name", Message: "must only contain letters and digits"}}, problem.Errors)
+			},
+		},
+		{
+			name: "InvalidEmail",
+			body: body(gin.H{"email": "invalid-email"}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "email", Message: "must be an email address"}}, problem.Errors)
+			},
+		},
+		{
+			name: "TooShortPassword",
+			body: body(gin.H{"password": "123"}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, apierror.InvalidRequest)
+				require.Equal(t, []apierror.FieldError{{Field: "password", Message: "must be at least 5 characters long"}}, problem.Errors)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := serveJSON(t, server, http.MethodPost, "/users", tc.body)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetUserAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"user_name": user.Username},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, newUserResponse(user))
+			},
+		},
+		{
+			name: "NotFound",
+			body: gin.H{"user_name": user.Username},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireProblem(t, recorder, apierror.UserNotFound)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"user_name": user.Username},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, apierror.InternalError)
+			},
+		},
+		{
+			name: "MissingUsername",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireProblem(t, recorder, apierror.InvalidRequest)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := serveJSON(t, server, http.MethodGet, "/users", tc.body)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestLoginUserAPI(t *testing.T) {
+	user, password := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"user_name": user.Username, "password": password},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectLoginAttempt(store)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().DeleteLoginFailure(gomock.Any(), gomock.Eq("user:"+user.Username)).Times(1).Return(int64(1), nil)
+				store.EXPECT().ForgiveLoginFailure(gomock.Any(), gomock.Eq(db.ForgiveLoginFailureParams{Key: "ip:192.0.2.1"})).Times(1).
+					Return(db.LoginFailure{Key: "ip:192.0.2.1"}, nil)
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp loginUserResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Equal(t, newUserResponse(user), rsp.User)
+
+				payload, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+				require.NoError(t, err)
+				require.Equal(t, user.Username, payload.Username)
+				require.WithinDuration(t, payload.ExpiresAt, rsp.AccessTokenExpiresAt, time.Second)
+			},
+		},
+		{
+			name: "UserNotFound",
+			body: gin.H{"user_name": user.Username, "password": password},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectLoginAttempt(store)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				// like a wrong password, so the usernames can't be probed
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireProblem(t, recorder, apierror.InvalidCredentials)
+			},
+		},
+		{
+			name: "IncorrectPassword",
+			body: gin.H{"user_name": user.Username, "password": "incorrect"},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectLoginAttempt(store)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().DeleteLoginFailure(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireProblem(t, recorder, apierror.InvalidCredentials)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"user_name": user.Username, "password": password},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectLoginAttempt(store)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, apierror.InternalError)
+			},
+		},
+		{
+			name: "Locked",
+			body: gin.H{"user_name": user.Username, "password": password},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().LoginAttemptTx(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginAttemptTxResult{Wait: time.Minute}, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+				require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+				requireProblem(t, recorder, apierror.LoginLocked)
+			},
+		},
+		{
+			name: "InvalidUsername",
+			body: gin.H{"user_name": "invalid-user#1", "password": password},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireProblem(t, recorder, apierror.InvalidRequest)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := serveJSON(t, server, http.MethodPost, "/users/login", tc.body)
+			tc.checkResponse(server, recorder)
+		})
+	}
+}
+
+// expectLoginAttempt expects the login guard to count an attempt of the username and of the client IP of httptest
+func expectLoginAttempt(store *mockdb.MockStore) {
+	store.EXPECT().LoginAttemptTx(gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(_ context.Context, arg db.LoginAttemptTxParams) (db.LoginAttemptTxResult, error) {
+			var result db.LoginAttemptTxResult
+			for _, key := range arg.Keys {
+				result.Failures = append(result.Failures, db.LoginFailure{Key: key.Key, Failures: 1})
+			}
+			return result, nil
+		})
+}
+
+func TestLoginLockout(t *testing.T) {
+	store := memstore.New()
+	snapshot := config.NewSnapshot(config.Config{
+		SecreteKey:           utils.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		GRPCServerAddress:    "127.0.0.1:9090",
+		LoginFailureWindow:   time.Minute,
+		LoginMaxFailures:     3,
+		LoginLockoutDuration: time.Minute,
+	})
+	server, err := NewServer(snapshot, store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	hashed, err := utils.HashedPassword("secret")
+	require.NoError(t, err)
+	user, err := store.CreateUser(ctx, db.CreateUserParams{Username: utils.RandomOwner(), HashedPassword: hashed, Email: utils.RandomEmail()})
+	require.NoError(t, err)
+	admin, err := store.CreateUser(ctx, db.CreateUserParams{Username: utils.RandomOwner(), Email: utils.RandomEmail()})
+	require.NoError(t, err)
+	_, err = store.UpdateUserRole(ctx, db.UpdateUserRoleParams{Role: utils.AdminRole, Username: admin.Username})
+	require.NoError(t, err)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		return serveJSON(t, server, http.MethodPost, "/users/login", gin.H{"user_name": user.Username, "password": password})
+	}
+
+	for i := 0; i < 3; i++ {
+		recorder := login("wrong")
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+	// even the right password is refused while locked
+	recorder := login("secret")
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+	requireProblem(t, recorder, apierror.LoginLocked)
+
+	accessToken, _, err := server.tokenMaker.CreateToken(admin.Username, time.Minute)
+	require.NoError(t, err)
+	unlock := func() unlockLoginResponse {
+		request := httptest.NewRequest(http.MethodPost, "/admin/users/"+user.Username+"/unlock", nil)
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var rsp unlockLoginResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+		return rsp
+	}
+	require.Equal(t, unlockLoginResponse{Username: user.Username, Unlocked: true}, unlock())
+
+	require.Equal(t, http.StatusOK, login("secret").Code)
+	require.False(t, unlock().Unlocked)
+
+	for action, actor := range map[string]string{db.AuditActionLockLogin: "", db.AuditActionUnlockLogin: admin.Username} {
+		events, err := store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+			Action:     sql.NullString{String: action, Valid: true},
+			ResourceID: sql.NullString{String: user.Username, Valid: true},
+			Size:       10,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1, action)
+		require.Equal(t, actor, events[0].Actor)
+	}
+}
+
+func TestLoginLockoutParallel(t *testing.T) {
+	store := memstore.New()
+	snapshot := config.NewSnapshot(config.Config{
+		SecreteKey:           utils.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		GRPCServerAddress:    "127.0.0.1:9090",
+		LoginFailureWindow:   time.Minute,
+		LoginMaxFailures:     3,
+		LoginLockoutDuration: time.Minute,
+	})
+	server, err := NewServer(snapshot, store, stream.NewBroker(), newTestWebhookWorker(store), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	hashed, err := utils.HashedPassword("secret")
+	require.NoError(t, err)
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{Username: utils.RandomOwner(), HashedPassword: hashed, Email: utils.RandomEmail()})
+	require.NoError(t, err)
+
+	// the guesses sent at once get no more tries than the ones sent one after the other
+	n := 10
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serveJSON(t, server, http.MethodPost, "/users/login", gin.H{"user_name": user.Username, "password": "wrong"}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	require.Equal(t, map[int]int{http.StatusUnauthorized: 3, http.StatusTooManyRequests: n - 3}, counts)
+}
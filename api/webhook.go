@@ -0,0 +1,213 @@
+package api
+
+import (
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/token"
+	"lesson/simple-bank/webhook"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type webhookResponse struct {
+	ID         int64     `json:"id"`
+	Owner      string    `json:"owner"`
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newWebhookResponse(hook db.Webhook) webhookResponse {
+	return webhookResponse{
+		ID:         hook.ID,
+		Owner:      hook.Owner,
+		Url:        hook.Url,
+		EventTypes: hook.EventTypes,
+		CreatedAt:  hook.CreatedAt,
+	}
+}
+
+type createWebhookRequest struct {
+	Url        string   `json:"url" binding:"required,url"`
+	EventTypes []string `json:"event_types" binding:"dive,oneof=UserCreated AccountOpened TransferCreated"`
+}
+
+type createWebhookResponse struct {
+	webhookResponse
+	// Secret is only returned once, when the endpoint is registered
+	Secret string `json:"secret"`
+}
+
+func (server *Server) CreateWebhook(ctx *gin.Context) {
+	var req createWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+	if err := webhook.CheckURL(req.Url); err != nil {
+		abortWithError(ctx, &apierror.Error{
+			Code:   apierror.InvalidRequest,
+			Detail: "some fields are invalid",
+			Fields: []apierror.FieldError{{Field: "url", Message: err.Error()}},
+		})
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	arg := db.CreateWebhookParams{
+		Owner:      payload.Username,
+		Url:        req.Url,
+		EventTypes: req.EventTypes,
+		Secret:     secret,
+	}
+	if arg.EventTypes == nil {
+		arg.EventTypes = []string{}
+	}
+
+	hook, err := server.store.CreateWebhookTx(ctx, arg)
+	if err != nil {
+		abortWithError(ctx, apierror.FromDB(err, apierror.OwnerNotFound))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, createWebhookResponse{
+		webhookResponse: newWebhookResponse(hook),
+		Secret:          hook.Secret,
+	})
+}
+
+func (server *Server) ListWebhooks(ctx *gin.Context) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	hooks, err := server.store.ListWebhooks(ctx, payload.Username)
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	rsp := make([]webhookResponse, 0, len(hooks))
+	for _, hook := range hooks {
+		rsp = append(rsp, newWebhookResponse(hook))
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type webhookUriRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) DeleteWebhook(ctx *gin.Context) {
+	var req webhookUriRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	hook, ok := server.ownedWebhook(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	if err := server.store.DeleteWebhookTx(ctx, hook.ID); err != nil {
+		abortWithError(ctx, apierror.FromDB(err, apierror.WebhookNotFound))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+type listWebhookDeliveriesRequest struct {
+	PageId   int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=1,max=50"`
+}
+
+func (server *Server) ListWebhookDeliveries(ctx *gin.Context) {
+	var uriReq webhookUriRequest
+	if err := ctx.ShouldBindUri(&uriReq); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+	var req listWebhookDeliveriesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	hook, ok := server.ownedWebhook(ctx, uriReq.ID)
+	if !ok {
+		return
+	}
+
+	deliveries, err := server.store.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{
+		WebhookID: hook.ID,
+		Limit:     req.PageSize,
+		Offset:    (req.PageId - 1) * req.PageSize,
+	})
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+// SendWebhookTestEvent delivers a test event to the endpoint right away and returns the outcome,
+// a failed test event is retried like any other delivery
+func (server *Server) SendWebhookTestEvent(ctx *gin.Context) {
+	var req webhookUriRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	hook, ok := server.ownedWebhook(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	body, err := webhook.NewTestPayload(hook.ID, time.Now())
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	delivery, err := server.store.CreateWebhookDelivery(ctx, db.CreateWebhookDeliveryParams{
+		WebhookID: hook.ID,
+		EventType: webhook.TestEventType,
+		Payload:   body,
+	})
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+
+	delivery, err = server.webhookWorker.Deliver(ctx, delivery)
+	if err != nil {
+		abortWithError(ctx, apierror.Internal(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, delivery)
+}
+
+// ownedWebhook loads a webhook of the authenticated user, it responds with 404 for webhooks of other users
+func (server *Server) ownedWebhook(ctx *gin.Context, id int64) (db.Webhook, bool) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	hook, err := server.store.GetWebhook(ctx, id)
+	if err != nil {
+		abortWithError(ctx, apierror.FromDB(err, apierror.WebhookNotFound))
+		return hook, false
+	}
+
+	if hook.Owner != payload.Username {
+		abortWithError(ctx, apierror.New(apierror.WebhookNotFound, "the webhook doesn't belong to the authenticated user"))
+		return hook, false
+	}
+	return hook, true
+}
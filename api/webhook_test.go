@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/db/memstore"
+	mockdb "lesson/simple-bank/db/mock"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/utils"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWebhookURL(t *testing.T) {
+	owner := utils.RandomOwner()
+
+	testCases := []struct {
+		name    string
+		url     string
+		created bool
+	}{
+		{name: "Https", url: "https://merchant.example.com/hooks", created: true},
+		{name: "PlainHttp", url: "http://merchant.example.com/hooks"},
+		{name: "Loopback", url: "https://127.0.0.1:8080/hooks"},
+		{name: "Private", url: "https://10.1.2.3/hooks"},
+		{name: "Metadata", url: "https://169.254.169.254/latest/meta-data"},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			if tc.created {
+				store.EXPECT().CreateWebhookTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.Webhook{ID: 1, Owner: owner, Url: tc.url, EventTypes: []string{}}, nil)
+			} else {
+				store.EXPECT().CreateWebhookTx(gomock.Any(), gomock.Any()).Times(0)
+			}
+
+			server := newTestServer(t, store)
+			body, err := json.Marshal(gin.H{"url": tc.url})
+			require.NoError(t, err)
+			accessToken, _, err := server.tokenMaker.CreateToken(owner, time.Minute)
+			require.NoError(t, err)
+			request := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+			request.Header.Set("Authorization", "Bearer "+accessToken)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+
+			if tc.created {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				return
+			}
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+			problem := requireProblem(t, recorder, apierror.InvalidRequest)
+			require.Len(t, problem.Errors, 1)
+			require.Equal(t, "url", problem.Errors[0].Field)
+		})
+	}
+}
+
+func TestWebhookAuditEvents(t *testing.T) {
+	store := memstore.New()
+	server := newTestServer(t, store)
+	owner := createAccount(t, store, 0).Owner
+
+	recorder := serveAuthorizedJSON(t, server, http.MethodPost, "/webhooks", createWebhookRequest{Url: "https://merchant.example.com/hooks"}, owner)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var created createWebhookResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	recorder = serveAuthorizedJSON(t, server, http.MethodDelete, fmt.Sprintf("/webhooks/%d", created.ID), nil, owner)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	for _, action := range []string{db.AuditActionCreateWebhook, db.AuditActionDeleteWebhook} {
+		events, err := store.ListAuditEvents(context.Background(), db.ListAuditEventsParams{
+			Action:       sql.NullString{String: action, Valid: true},
+			ResourceType: sql.NullString{String: "webhook", Valid: true},
+			ResourceID:   sql.NullString{String: strconv.FormatInt(created.ID, 10), Valid: true},
+			Size:         10,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1, action)
+		require.Equal(t, owner, events[0].Actor)
+		require.NotContains(t, string(events[0].Before)+string(events[0].After), created.Secret)
+	}
+}
@@ -0,0 +1,80 @@
+package apierror
+
+import "net/http"
+
+// Code identifies the kind of an error, clients can rely on codes never changing meaning
+type Code string
+
+const (
+	InvalidRequest     Code = "invalid_request"
+	CurrencyMismatch   Code = "currency_mismatch"
+	InsufficientFunds  Code = "insufficient_funds"
+	TransferLimit      Code = "transfer_limit"
+	AccountFrozen      Code = "account_frozen"
+	Unauthenticated    Code = "unauthenticated"
+	InvalidCredentials Code = "invalid_credentials"
+	PermissionDenied   Code = "permission_denied"
+	UserNotFound       Code = "user_not_found"
+	AccountNotFound    Code = "account_not_found"
+	ImportNotFound     Code = "import_not_found"
+	WebhookNotFound    Code = "webhook_not_found"
+	OwnerNotFound      Code = "owner_not_found"
+	DuplicateUsername  Code = "duplicate_username"
+	DuplicateEmail     Code = "duplicate_email"
+	DuplicateAccount   Code = "duplicate_account"
+	DuplicateImport    Code = "duplicate_import"
+	RateLimited        Code = "rate_limited"
+	LoginLocked        Code = "login_locked"
+	InternalError      Code = "internal_error"
+)
+
+type codeInfo struct {
+	status int
+	title  string
+}
+
+// codes keeps the statuses of the gin routes from before problem details,
+// a duplicate or a missing owner is a 403 rather than a 409 or a 422
+var codes = map[Code]codeInfo{
+	InvalidRequest:     {http.StatusBadRequest, "The request is invalid"},
+	CurrencyMismatch:   {http.StatusBadRequest, "The account currency doesn't match"},
+	InsufficientFunds:  {http.StatusBadRequest, "The account balance is too low"},
+	TransferLimit:      {http.StatusBadRequest, "The amount is above the transfer limit"},
+	AccountFrozen:      {http.StatusForbidden, "The account is frozen"},
+	Unauthenticated:    {http.StatusUnauthorized, "Authentication is required"},
+	InvalidCredentials: {http.StatusUnauthorized, "The username or password is incorrect"},
+	PermissionDenied:   {http.StatusForbidden, "The operation is not allowed"},
+	UserNotFound:       {http.StatusNotFound, "The user doesn't exist"},
+	AccountNotFound:    {http.StatusNotFound, "The account doesn't exist"},
+	ImportNotFound:     {http.StatusNotFound, "The import job doesn't exist"},
+	WebhookNotFound:    {http.StatusNotFound, "The webhook doesn't exist"},
+	OwnerNotFound:      {http.StatusForbidden, "The owner doesn't exist"},
+	DuplicateUsername:  {http.StatusForbidden, "The username is taken"},
+	DuplicateEmail:     {http.StatusForbidden, "The email is taken"},
+	DuplicateAccount:   {http.StatusForbidden, "The owner already has an account in this currency"},
+	DuplicateImport:    {http.StatusForbidden, "The file was already imported"},
+	RateLimited:        {http.StatusTooManyRequests, "Too many requests"},
+	LoginLocked:        {http.StatusTooManyRequests, "Too many failed logins"},
+	InternalError:      {http.StatusInternalServerError, "Internal error"},
+}
+
+// Status returns the HTTP status of the code, unknown codes are internal errors
+func (code Code) Status() int {
+	if info, ok := codes[code]; ok {
+		return info.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Title returns the short summary of the code, which is the same for every occurrence
+func (code Code) Title() string {
+	if info, ok := codes[code]; ok {
+		return info.title
+	}
+	return codes[InternalError].title
+}
+
+// Type returns the problem type URI of the code
+func (code Code) Type() string {
+	return typePrefix + string(code)
+}
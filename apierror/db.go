@@ -0,0 +1,56 @@
+package apierror
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// dbConditions tells which store errors stand for a code
+var dbConditions = map[Code]func(err error) bool{
+	UserNotFound:      noRows,
+	AccountNotFound:   noRows,
+	ImportNotFound:    noRows,
+	WebhookNotFound:   noRows,
+	DuplicateUsername: violates("unique_violation", "users_pkey"),
+	DuplicateEmail:    violates("unique_violation", "users_email_key"),
+	DuplicateAccount:  violates("unique_violation", "owner_currency_key"),
+	DuplicateImport:   violates("unique_violation", "import_jobs_owner_message_id_key"),
+	OwnerNotFound:     violates("foreign_key_violation", "accounts_owner_fkey", "webhooks_owner_fkey"),
+}
+
+// FromDB maps a store error to the first of the expected codes it stands for,
+// errors that match none of them are internal
+func FromDB(err error, expected ...Code) *Error {
+	for _, code := range expected {
+		if condition, ok := dbConditions[code]; ok && condition(err) {
+			return &Error{Code: code, cause: err}
+		}
+	}
+	return Internal(err)
+}
+
+func noRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// violates matches the errors of a constraint class on one of the constraints,
+// any constraint matches when the server doesn't name it
+func violates(class string, constraints ...string) func(err error) bool {
+	return func(err error) bool {
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || pqErr.Code.Name() != class {
+			return false
+		}
+		if pqErr.Constraint == "" {
+			return true
+		}
+		for _, constraint := range constraints {
+			if pqErr.Constraint == constraint {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,119 @@
+package apierror
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromDB(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected []Code
+		code     Code
+	}{
+		{
+			name:     "NoRows",
+			err:      sql.ErrNoRows,
+			expected: []Code{AccountNotFound},
+			code:     AccountNotFound,
+		},
+		{
+			name:     "WrappedNoRows",
+			err:      fmt.Errorf("get account: %w", sql.ErrNoRows),
+			expected: []Code{AccountNotFound},
+			code:     AccountNotFound,
+		},
+		{
+			name:     "UnexpectedNoRows",
+			err:      sql.ErrNoRows,
+			expected: []Code{DuplicateUsername},
+			code:     InternalError,
+		},
+		{
+			name:     "DuplicateUsername",
+			err:      &pq.Error{Code: "23505", Constraint: "users_pkey"},
+			expected: []Code{DuplicateUsername, DuplicateEmail},
+			code:     DuplicateUsername,
+		},
+		{
+			name:     "DuplicateEmail",
+			err:      &pq.Error{Code: "23505", Constraint: "users_email_key"},
+			expected: []Code{DuplicateUsername, DuplicateEmail},
+			code:     DuplicateEmail,
+		},
+		{
+			name:     "UnnamedConstraint",
+			err:      &pq.Error{Code: "23505"},
+			expected: []Code{DuplicateUsername, DuplicateEmail},
+			code:     DuplicateUsername,
+		},
+		{
+			name:     "OtherConstraint",
+			err:      &pq.Error{Code: "23505", Constraint: "owner_currency_key"},
+			expected: []Code{DuplicateUsername},
+			code:     InternalError,
+		},
+		{
+			name:     "OwnerNotFound",
+			err:      &pq.Error{Code: "23503", Constraint: "accounts_owner_fkey"},
+			expected: []Code{DuplicateAccount, OwnerNotFound},
+			code:     OwnerNotFound,
+		},
+		{
+			name:     "SerializationFailure",
+			err:      &pq.Error{Code: "40001"},
+			expected: []Code{AccountNotFound},
+			code:     InternalError,
+		},
+		{
+			name:     "Other",
+			err:      errors.New("connection refused"),
+			expected: []Code{AccountNotFound},
+			code:     InternalError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := FromDB(tc.err, tc.expected...)
+			require.Equal(t, tc.code, err.Code)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestProblem(t *testing.T) {
+	cause := &pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "users_pkey"`}
+	err := FromDB(cause, DuplicateUsername)
+
+	problem := err.Problem("/users", "request-id")
+	require.Equal(t, Problem{
+		Type:      "urn:simple-bank:problem:duplicate_username",
+		Title:     DuplicateUsername.Title(),
+		Status:    http.StatusForbidden,
+		Instance:  "/users",
+		Code:      DuplicateUsername,
+		RequestID: "request-id",
+	}, problem)
+
+	// the message of the cause stays out of the problem
+	problem = Internal(cause).Problem("/users", "request-id")
+	require.Equal(t, http.StatusInternalServerError, problem.Status)
+	require.Empty(t, problem.Detail)
+	require.Contains(t, Internal(cause).Error(), "users_pkey")
+}
+
+func TestCodes(t *testing.T) {
+	for code, info := range codes {
+		require.Equal(t, info.status, code.Status())
+		require.NotEmpty(t, code.Title())
+	}
+	require.Equal(t, http.StatusInternalServerError, Code("unknown").Status())
+}
@@ -0,0 +1,101 @@
+// Package apierror is the error model of the HTTP API, errors are written as RFC 7807 problem details
+// with a stable code and never expose the message of the underlying error
+package apierror
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ContentType is the media type of problem details
+	ContentType = "application/problem+json"
+
+	typePrefix = "urn:simple-bank:problem:"
+)
+
+// Error is an error that can be shown to clients
+type Error struct {
+	Code Code
+	// Detail explains this occurrence, it must not contain internal details
+	Detail string
+	Fields []FieldError
+	cause  error
+}
+
+// FieldError is a request field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New returns an error with a detail that is safe to show to clients
+func New(code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Newf is New with a formatted detail
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Internal hides err behind an internal_error, err is only kept for the logs
+func Internal(err error) *Error {
+	return &Error{Code: InternalError, cause: err}
+}
+
+// From returns err if it is an *Error, other errors are internal
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal(err)
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code)
+	if e.Detail != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Detail)
+	}
+	if e.cause != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.cause)
+	}
+	return msg
+}
+
+// Unwrap returns the error the client error was made from
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Status returns the HTTP status of the error
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+// Problem is the RFC 7807 body of an error, code, request_id and errors are extension members
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Problem returns the problem details of the error for the request of the instance path
+func (e *Error) Problem(instance string, requestID string) Problem {
+	return Problem{
+		Type:      e.Code.Type(),
+		Title:     e.Code.Title(),
+		Status:    e.Status(),
+		Detail:    e.Detail,
+		Instance:  instance,
+		Code:      e.Code,
+		RequestID: requestID,
+		Errors:    e.Fields,
+	}
+}
@@ -0,0 +1,101 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FromBinding turns the error of binding a request into an invalid_request error,
+// validation failures get a message per field
+func FromBinding(err error) *Error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(fieldErr.Namespace()),
+				Message: fieldMessage(fieldErr),
+			})
+		}
+		return &Error{Code: InvalidRequest, Detail: "some fields are invalid", Fields: fields, cause: err}
+	case errors.As(err, &typeErr):
+		fields := []FieldError{{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)}}
+		return &Error{Code: InvalidRequest, Detail: "some fields are invalid", Fields: fields, cause: err}
+	}
+	return &Error{Code: InvalidRequest, Detail: fmt.Sprintf("the request is malformed: %v", err), cause: err}
+}
+
+// FieldName names struct fields after their json, form or uri tag in validation errors,
+// register it with the RegisterTagNameFunc of the validator
+func FieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "uri"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// fieldPath drops the struct name from a validator namespace, createUserRequest.user_name is user_name
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", param)
+		}
+		return fmt.Sprintf("must be at least %s", param)
+	case "max":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", param)
+		}
+		return fmt.Sprintf("must be at most %s", param)
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", param)
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+	case "email":
+		return "must be an email address"
+	case "url":
+		return "must be a URL"
+	case "alphanum":
+		return "must only contain letters and digits"
+	}
+	return fmt.Sprintf("doesn't pass the %s rule", fieldErr.Tag())
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a " + t.String()
+}
@@ -0,0 +1,71 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+)
+
+type testRequest struct {
+	Username   string   `json:"user_name" binding:"required,alphanum"`
+	Password   string   `json:"password" binding:"required,min=5"`
+	Amount     int64    `json:"amount" binding:"gt=0"`
+	Currency   string   `json:"currency" binding:"oneof=TWD USD EUR"`
+	EventTypes []string `json:"event_types" binding:"dive,oneof=UserCreated AccountOpened"`
+	PageSize   int32    `form:"page_size" binding:"max=10"`
+}
+
+func newTestValidator() *validator.Validate {
+	validate := validator.New()
+	validate.SetTagName("binding")
+	validate.RegisterTagNameFunc(FieldName)
+	return validate
+}
+
+func TestFromBindingValidation(t *testing.T) {
+	err := newTestValidator().Struct(testRequest{
+		Username:   "jane doe",
+		Password:   "1234",
+		Currency:   "YEN",
+		EventTypes: []string{"UserCreated", "Unknown"},
+		PageSize:   11,
+	})
+	require.Error(t, err)
+
+	apiErr := FromBinding(err)
+	require.Equal(t, InvalidRequest, apiErr.Code)
+	require.Equal(t, []FieldError{
+		{Field: "user_name", Message: "must only contain letters and digits"},
+		{Field: "password", Message: "must be at least 5 characters long"},
+		{Field: "amount", Message: "must be greater than 0"},
+		{Field: "currency", Message: "must be one of TWD, USD, EUR"},
+		{Field: "event_types[1]", Message: "must be one of UserCreated, AccountOpened"},
+		{Field: "page_size", Message: "must be at most 10"},
+	}, apiErr.Fields)
+
+	err = newTestValidator().Struct(testRequest{Amount: 1, Currency: "USD"})
+	require.Equal(t, []FieldError{
+		{Field: "user_name", Message: "is required"},
+		{Field: "password", Message: "is required"},
+	}, FromBinding(err).Fields)
+}
+
+func TestFromBindingMalformed(t *testing.T) {
+	var req testRequest
+	err := json.Unmarshal([]byte(`{"amount": "ten"}`), &req)
+	apiErr := FromBinding(err)
+	require.Equal(t, InvalidRequest, apiErr.Code)
+	require.Equal(t, []FieldError{{Field: "amount", Message: "must be an integer"}}, apiErr.Fields)
+
+	err = json.Unmarshal([]byte(`{"amount":`), &req)
+	apiErr = FromBinding(err)
+	require.Equal(t, InvalidRequest, apiErr.Code)
+	require.Empty(t, apiErr.Fields)
+	require.Contains(t, apiErr.Detail, "the request is malformed")
+
+	apiErr = FromBinding(errors.New("EOF"))
+	require.Equal(t, InvalidRequest, apiErr.Code)
+}
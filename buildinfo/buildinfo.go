@@ -0,0 +1,54 @@
+// Package buildinfo describes the build of the running binary. Commit and BuildTime are set by
+// the linker, see the build target of the Makefile:
+//
+//	go build -ldflags "-X lesson/simple-bank/buildinfo.Commit=$(git rev-parse HEAD) -X lesson/simple-bank/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// Commit is the git sha the binary was built from
+	Commit = ""
+	// BuildTime is when the binary was built, in RFC 3339
+	BuildTime = ""
+)
+
+const unknown = "unknown"
+
+// Info is the build of the running binary
+type Info struct {
+	Commit    string
+	BuildTime string
+	GoVersion string
+}
+
+// Get returns the build info set by the linker, falling back to the VCS stamp of the go command
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = unknown
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = unknown
+	}
+	return info
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	db "lesson/simple-bank/db/sqlc"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// notFound names the missing row of a sql.ErrNoRows
+func notFound(err error, format string, args ...interface{}) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf(format+" doesn't exist", args...)
+	}
+	return err
+}
+
+func newAccountCommand(app *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "account",
+		Short: "Manage accounts",
+	}
+	cmd.AddCommand(
+		newAccountFreezeCommand(app, "freeze", "Freeze an account, it can neither send nor receive transfers", true),
+		newAccountFreezeCommand(app, "unfreeze", "Unfreeze an account", false),
+	)
+	return cmd
+}
+
+func newAccountFreezeCommand(app *app, use string, short string, frozen bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " ID",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid account id %q", args[0])
+			}
+
+			return app.withStore(func(store db.Store) error {
+				account, err := store.SetAccountFrozenTx(commandContext(cmd), db.SetAccountFrozenParams{ID: id, Frozen: frozen})
+				if err != nil {
+					return notFound(err, "account %d", id)
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "account %d of %s frozen: %t\n", account.ID, account.Owner, account.Frozen)
+				return nil
+			})
+		},
+	}
+}
@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	"lesson/simple-bank/db/migration"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/initial"
+	"lesson/simple-bank/secret"
+	"lesson/simple-bank/token"
+	"lesson/simple-bank/utils"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// run executes the command line against store with the config.env of the repo
+func run(t *testing.T, store db.Store, args ...string) (string, error) {
+	app := &app{
+		openStore: func(config.Config) (db.Store, func() error, error) {
+			return store, func() error { return nil }, nil
+		},
+	}
+
+	var stdout bytes.Buffer
+	root := newRootCommand(app)
+	root.SetArgs(append([]string{"--config", ".."}, args...))
+	root.SetOut(&stdout)
+	root.SetErr(&bytes.Buffer{})
+	err := root.ExecuteContext(context.Background())
+	return stdout.String(), err
+}
+
+func TestUserCommands(t *testing.T) {
+	store := memstore.New()
+	username := utils.RandomOwner()
+
+	out, err := run(t, store, "user", "create", username, "--password", "secret", "--full-name", "Jane Doe", "--email", utils.RandomEmail(), "--role", utils.AdminRole)
+	require.NoError(t, err)
+	require.Contains(t, out, username)
+
+	user, err := store.GetUser(context.Background(), username)
+	require.NoError(t, err)
+	require.Equal(t, utils.AdminRole, user.Role)
+	require.NoError(t, utils.ComparePassword(user.HashedPassword, "secret"))
+
+	_, err = run(t, store, "user", "set-role", username, utils.DepositorRole)
+	require.NoError(t, err)
+	user, err = store.GetUser(context.Background(), username)
+	require.NoError(t, err)
+	require.Equal(t, utils.DepositorRole, user.Role)
+	// both role changes are in the audit log, made by the command line
+	require.Equal(t, []string{"simple-bank user set-role", "simple-bank user create"}, auditUserAgents(t, store, db.AuditActionUpdateUserRole, username))
+	require.Equal(t, utils.DepositorRole, user.Role)
+
+	_, err = run(t, store, "user", "set-role", username, "root")
+	require.ErrorContains(t, err, "unknown role")
+
+	_, err = run(t, store, "user", "set-role", utils.RandomOwner(), utils.AdminRole)
+	require.ErrorContains(t, err, "doesn't exist")
+
+	_, err = run(t, store, "user", "create", utils.RandomOwner(), "--password", "pw", "--full-name", "Jane Doe", "--email", utils.RandomEmail())
+	require.Error(t, err)
+
+	_, err = run(t, store, "user", "create", utils.RandomOwner(), "--full-name", "Jane Doe")
+	require.ErrorContains(t, err, "required flag")
+
+	_, err = store.LoginAttemptTx(context.Background(), db.LoginAttemptTxParams{
+		Keys:        []db.LoginAttemptKey{{Key: "user:" + username, Wait: func(int32) time.Duration { return time.Minute }}},
+		WindowStart: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	out, err = run(t, store, "user", "unlock", username)
+	require.NoError(t, err)
+	require.Contains(t, out, "is unlocked")
+	out, err = run(t, store, "user", "unlock", username)
+	require.NoError(t, err)
+	require.Contains(t, out, "has no failed logins")
+}
+
+func TestAccountFreezeCommands(t *testing.T) {
+	store := memstore.New()
+	ctx := context.Background()
+	user, err := store.CreateUser(ctx, db.CreateUserParams{Username: utils.RandomOwner(), Email: utils.RandomEmail()})
+	require.NoError(t, err)
+	account, err := store.CreateAccount(ctx, db.CreateAccountParams{Owner: user.Username, Currency: "USD"})
+	require.NoError(t, err)
+	id := strconv.FormatInt(account.ID, 10)
+
+	_, err = run(t, store, "account", "freeze", id)
+	require.NoError(t, err)
+	account, err = store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.True(t, account.Frozen)
+
+	_, err = run(t, store, "account", "unfreeze", id)
+	require.NoError(t, err)
+	account, err = store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.False(t, account.Frozen)
+
+	require.Len(t, auditUserAgents(t, store, db.AuditActionFreezeAccount, id), 1)
+	require.Len(t, auditUserAgents(t, store, db.AuditActionUnfreezeAccount, id), 1)
+
+	_, err = run(t, store, "account", "freeze", "99")
+	require.ErrorContains(t, err, "doesn't exist")
+
+	_, err = run(t, store, "account", "freeze", "abc")
+	require.ErrorContains(t, err, "invalid account id")
+}
+
+// auditUserAgents returns the user agents of the audit events of action on resourceID, newest first
+func auditUserAgents(t *testing.T, store db.Store, action string, resourceID string) []string {
+	events, err := store.ListAuditEvents(context.Background(), db.ListAuditEventsParams{
+		Action:     sql.NullString{String: action, Valid: true},
+		ResourceID: sql.NullString{String: resourceID, Valid: true},
+		Size:       10,
+	})
+	require.NoError(t, err)
+
+	var userAgents []string
+	for _, e := range events {
+		userAgents = append(userAgents, e.UserAgent)
+	}
+	return userAgents
+}
+
+func TestTokenIssueCommand(t *testing.T) {
+	store := memstore.New()
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{Username: utils.RandomOwner(), Email: utils.RandomEmail()})
+	require.NoError(t, err)
+
+	out, err := run(t, store, "token", "issue", user.Username, "--duration", "1m")
+	require.NoError(t, err)
+
+	config, err := initial.LoadingConfig("..")
+	require.NoError(t, err)
+	maker, err := token.NewJWTMaker(config.SecreteKey)
+	require.NoError(t, err)
+	payload, err := maker.VerifyToken(strings.TrimSpace(out))
+	require.NoError(t, err)
+	require.Equal(t, user.Username, payload.Username)
+
+	_, err = run(t, store, "token", "issue", utils.RandomOwner())
+	require.ErrorContains(t, err, "doesn't exist")
+}
+
+func TestSeedCommand(t *testing.T) {
+	store := memstore.New()
+	ctx := context.Background()
+
+	out, err := run(t, store, "seed", "--users", "5", "--transfers", "20")
+	require.NoError(t, err)
+	require.Contains(t, out, "seeded 5 users")
+
+	accounts, err := store.ListAccount(ctx, db.ListAccountParams{Limit: 100})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(accounts), 5)
+	for _, account := range accounts {
+		require.GreaterOrEqual(t, account.Balance, int64(0))
+	}
+
+	ledger, err := store.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.True(t, ledger.Valid)
+}
+
+func TestVerifyLedgerCommand(t *testing.T) {
+	store := memstore.New()
+	store.SetLedgerKey([]byte("0123456789abcdef0123456789abcdef"))
+	ctx := context.Background()
+
+	var accounts []db.Account
+	for i := 0; i < 2; i++ {
+		user, err := store.CreateUser(ctx, db.CreateUserParams{Username: utils.RandomOwner(), Email: utils.RandomEmail()})
+		require.NoError(t, err)
+		account, err := store.CreateAccount(ctx, db.CreateAccountParams{Owner: user.Username, Balance: 100, Currency: "USD"})
+		require.NoError(t, err)
+		accounts = append(accounts, account)
+	}
+	_, err := store.TranserTx(ctx, db.TransferTxParams{FromAccountID: accounts[0].ID, ToAccountID: accounts[1].ID, Amount: 10})
+	require.NoError(t, err)
+
+	out, err := run(t, store, "verify-ledger")
+	require.NoError(t, err)
+	require.Contains(t, out, "ledger is valid, 2 entries checked")
+
+	out, err = run(t, store, "verify-ledger", "--account", strconv.FormatInt(accounts[0].ID, 10))
+	require.NoError(t, err)
+	require.Contains(t, out, "ledger is valid, 1 entries checked")
+
+	// the chains were hashed with another key
+	store.SetLedgerKey([]byte("fedcba9876543210fedcba9876543210"))
+	_, err = run(t, store, "verify-ledger")
+	require.ErrorContains(t, err, "hash does not match the entry content")
+}
+
+func TestParseMigrateArg(t *testing.T) {
+	n, err := parseMigrateArg("-1", migration.NilVersion)
+	require.NoError(t, err)
+	require.Equal(t, migration.NilVersion, n)
+
+	n, err = parseMigrateArg("3", 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	for _, arg := range []string{"-2", "x", ""} {
+		_, err = parseMigrateArg(arg, migration.NilVersion)
+		require.Error(t, err, arg)
+	}
+	_, err = parseMigrateArg("-1", 0)
+	require.Error(t, err)
+}
+
+func TestMigrateCommandArgs(t *testing.T) {
+	// the argument is checked before the database is opened
+	for _, args := range [][]string{
+		{"migrate", "up", "--", "-1"},
+		{"migrate", "down", "--", "-1"},
+		{"migrate", "goto", "--", "-1"},
+		{"migrate", "force", "--", "-2"},
+		{"migrate", "force", "x"},
+	} {
+		_, err := run(t, memstore.New(), args...)
+		require.ErrorContains(t, err, "invalid number", args)
+	}
+}
+
+func TestSecretCommands(t *testing.T) {
+	masterKey, err := run(t, nil, "secret", "keygen")
+	require.NoError(t, err)
+	t.Setenv(secret.MasterKeyName, strings.TrimSpace(masterKey))
+
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	root := newRootCommand(&app{})
+	root.SetArgs([]string{"secret", "seal", path})
+	root.SetIn(strings.NewReader("# token key\nSECRETEKEY=0123456789abcdef0123456789abcdef\n\nDBPASSWORD=p=w\n"))
+	root.SetOut(&bytes.Buffer{})
+	require.NoError(t, root.Execute())
+
+	provider, err := secret.NewProvider(path)
+	require.NoError(t, err)
+	value, err := provider.Secret("DBPASSWORD")
+	require.NoError(t, err)
+	require.Equal(t, "p=w", value)
+
+	root.SetArgs([]string{"secret", "seal", path})
+	root.SetIn(strings.NewReader("SECRETEKEY\n"))
+	require.ErrorContains(t, root.Execute(), "want KEY=VALUE")
+}
+
+func TestRecordReload(t *testing.T) {
+	store := memstore.New()
+	record := recordReload(store, discardLogger())
+
+	record(initial.ReloadEvent{
+		Changed: []string{"ACCESSTOKENDURATION"},
+		Before:  map[string]string{"ACCESSTOKENDURATION": "15m0s"},
+		After:   map[string]string{"ACCESSTOKENDURATION": "30m0s"},
+	})
+	record(initial.ReloadEvent{Err: errors.New("invalid config: ACCESSTOKENDURATION must be positive")})
+
+	events, err := store.ListAuditEvents(context.Background(), db.ListAuditEventsParams{
+		ResourceType: sql.NullString{String: "config", Valid: true},
+		Size:         10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	actions := map[string]db.AuditEvent{}
+	for _, event := range events {
+		actions[event.Action] = event
+	}
+	require.JSONEq(t, `{"values":{"ACCESSTOKENDURATION":"15m0s"}}`, string(actions[db.AuditActionReloadConfig].Before))
+	require.JSONEq(t, `{"values":{"ACCESSTOKENDURATION":"30m0s"}}`, string(actions[db.AuditActionReloadConfig].After))
+	require.Contains(t, string(actions[db.AuditActionRejectConfig].After), "must be positive")
+}
+
+func TestReloadLogLevel(t *testing.T) {
+	level := new(slog.LevelVar)
+	var recorded []initial.ReloadEvent
+	record := reloadLogLevel(level, func(event initial.ReloadEvent) {
+		recorded = append(recorded, event)
+	})
+
+	record(initial.ReloadEvent{
+		Changed: []string{"LOGLEVEL"},
+		Before:  map[string]string{"LOGLEVEL": "info"},
+		After:   map[string]string{"LOGLEVEL": "debug"},
+	})
+	require.Equal(t, slog.LevelDebug, level.Level())
+
+	record(initial.ReloadEvent{Err: errors.New("invalid config")})
+	require.Equal(t, slog.LevelDebug, level.Level())
+	require.Len(t, recorded, 2)
+}
+
+func TestWorkers(t *testing.T) {
+	workers := newWorkers(discardLogger())
+	failed := make(chan struct{})
+	workers.run("failing", func(ctx context.Context) { <-failed })
+	workers.run("looping", func(ctx context.Context) { <-ctx.Done() })
+	require.NoError(t, workers.check(context.Background()))
+
+	close(failed)
+	require.Eventually(t, func() bool {
+		return workers.check(context.Background()) != nil
+	}, time.Second, 10*time.Millisecond)
+	require.EqualError(t, workers.check(context.Background()), "stopped: failing")
+
+	workers.stop()
+	// the workers stopped by stop are not failures
+	require.EqualError(t, workers.check(context.Background()), "stopped: failing")
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+	db "lesson/simple-bank/db/sqlc"
+
+	"github.com/spf13/cobra"
+)
+
+func newVerifyLedgerCommand(app *app) *cobra.Command {
+	var accountID int64
+
+	cmd := &cobra.Command{
+		Use:   "verify-ledger",
+		Short: "Recompute the hash chains of the account entries and fail on a broken link",
+		Long: "Recompute the hash chains of the account entries with LEDGERKEY and fail on a broken link.\n" +
+			"The anchors of the chains live in the same db, so entries removed from the end of a chain\n" +
+			"together with its anchor are not detected.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.withStore(func(store db.Store) error {
+				var result db.VerifyLedgerResult
+				var err error
+				if accountID != 0 {
+					result, err = store.VerifyAccountLedger(cmd.Context(), accountID)
+				} else {
+					result, err = store.VerifyLedger(cmd.Context())
+				}
+				if err != nil {
+					return fmt.Errorf("can't verify ledger: %w", err)
+				}
+
+				if !result.Valid {
+					link := result.BrokenLink
+					return fmt.Errorf("ledger is broken after %d entries: account %d, entry %d: %s",
+						result.EntriesChecked, link.AccountID, link.EntryID, link.Reason)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "ledger is valid, %d entries checked\n", result.EntriesChecked)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().Int64Var(&accountID, "account", 0, "only verify the entries of this account")
+	return cmd
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/initial"
+	"lesson/simple-bank/logging"
+	"log/slog"
+	"os"
+)
+
+// newLogger returns the logger of LOGFORMAT and LOGLEVEL writing to stderr and makes it the default,
+// so the log package writes through it too. The level can be set again while the logger is used.
+func newLogger(config config.Config) (*slog.Logger, *slog.LevelVar, error) {
+	level := new(slog.LevelVar)
+	if err := setLogLevel(level, config.LogLevel); err != nil {
+		return nil, nil, err
+	}
+	logger, err := logging.New(os.Stderr, config.LogFormat, level)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.SetDefault(logger)
+	return logger, level, nil
+}
+
+func setLogLevel(level *slog.LevelVar, name string) error {
+	if name == "" {
+		level.Set(slog.LevelInfo)
+		return nil
+	}
+	parsed, err := logging.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(parsed)
+	return nil
+}
+
+// reloadLogLevel returns a record func of initial.Reloader applying a reloaded LOGLEVEL, then calling next
+func reloadLogLevel(level *slog.LevelVar, next func(initial.ReloadEvent)) func(initial.ReloadEvent) {
+	return func(event initial.ReloadEvent) {
+		for _, key := range event.Changed {
+			if key == "LOGLEVEL" {
+				if err := setLogLevel(level, event.After[key]); err != nil {
+					slog.Error("can't set log level", "error", err)
+				}
+			}
+		}
+		next(event)
+	}
+}
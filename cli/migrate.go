@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/migration"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func newMigrator(config config.Config) (*migration.Migrator, error) {
+	conn, err := sql.Open(config.DbDriver, config.DbSource)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migration.NewMigrator(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return migrator, nil
+}
+
+// checkSchema refuses to serve a schema that is dirty or newer than the binary,
+// with MigrateOnStartup the pending migrations are applied first
+func checkSchema(config config.Config) error {
+	migrator, err := newMigrator(config)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	return migrator.Startup(context.Background(), config.MigrateOnStartup)
+}
+
+// parseMigrateArg parses the N or V argument of a migrate command, refusing numbers below min
+func parseMigrateArg(arg string, min int) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < min {
+		return 0, fmt.Errorf("invalid number %q", arg)
+	}
+	return n, nil
+}
+
+func newMigrateCommand(app *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the db schema with the migrations embedded in the binary",
+	}
+
+	// migrateCommand runs fn and prints the resulting schema version, the argument must be at least min
+	migrateCommand := func(use string, short string, args cobra.PositionalArgs, min int, fn func(migrator *migration.Migrator, n int) error) *cobra.Command {
+		return &cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  args,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				n := 0
+				if len(args) == 1 {
+					var err error
+					if n, err = parseMigrateArg(args[0], min); err != nil {
+						return err
+					}
+				}
+
+				migrator, err := newMigrator(app.config)
+				if err != nil {
+					return err
+				}
+				defer migrator.Close()
+
+				if err := fn(migrator, n); err != nil {
+					return err
+				}
+
+				version, dirty, err := migrator.Version()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "schema version %d of %d, dirty: %t\n", version, migrator.Latest(), dirty)
+				return nil
+			},
+		}
+	}
+
+	cmd.AddCommand(
+		migrateCommand("up [N]", "Apply all pending migrations, or the next N", cobra.MaximumNArgs(1), 0,
+			func(migrator *migration.Migrator, n int) error { return migrator.Up(n) }),
+		migrateCommand("down [N]", "Revert all applied migrations, or the last N", cobra.MaximumNArgs(1), 0,
+			func(migrator *migration.Migrator, n int) error { return migrator.Down(n) }),
+		migrateCommand("goto V", "Migrate up or down to version V", cobra.ExactArgs(1), 0,
+			func(migrator *migration.Migrator, v int) error { return migrator.Goto(uint(v)) }),
+		migrateCommand("version", "Print the current version of the schema", cobra.NoArgs, 0,
+			func(migrator *migration.Migrator, _ int) error { return nil }),
+		migrateCommand("force V", "Set the version to V and clear the dirty flag without migrating, V -1 marks no migration applied (pass it after --)", cobra.ExactArgs(1), migration.NilVersion,
+			func(migrator *migration.Migrator, v int) error { return migrator.Force(v) }),
+	)
+	return cmd
+}
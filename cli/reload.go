@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/initial"
+	"log/slog"
+)
+
+// reloadAudit is the state of a reload kept in the audit log
+type reloadAudit struct {
+	Values  map[string]string `json:"values"`
+	Ignored []string          `json:"ignored,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// recordReload returns a record func of initial.Reloader writing the reloads to the audit log,
+// the reloads it can't record are logged to logger
+func recordReload(store db.Store, logger *slog.Logger) func(initial.ReloadEvent) {
+	return func(event initial.ReloadEvent) {
+		action := db.AuditActionReloadConfig
+		after := reloadAudit{Values: event.After, Ignored: event.Ignored}
+		if event.Err != nil {
+			action = db.AuditActionRejectConfig
+			after.Error = event.Err.Error()
+		}
+
+		beforeJSON, err := json.Marshal(reloadAudit{Values: event.Before})
+		if err != nil {
+			logger.Error("can't record config reload", "error", err)
+			return
+		}
+		afterJSON, err := json.Marshal(after)
+		if err != nil {
+			logger.Error("can't record config reload", "error", err)
+			return
+		}
+
+		_, err = store.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+			Actor:        "system",
+			Action:       action,
+			ResourceType: "config",
+			Before:       beforeJSON,
+			After:        afterJSON,
+			UserAgent:    "config-reloader",
+		})
+		if err != nil {
+			logger.Error("can't record config reload", "error", err)
+		}
+	}
+}
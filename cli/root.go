@@ -0,0 +1,105 @@
+// Package cli is the command line of the simple bank server, every command loads
+// config.env through initial.LoadingConfig before it runs
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"lesson/simple-bank/buildinfo"
+	"lesson/simple-bank/config"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/initial"
+
+	_ "github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+// app is the state shared by the commands
+type app struct {
+	configPath string
+	config     config.Config
+	// openStore connects to the database of the config, tests replace it with memstore
+	openStore func(config config.Config) (db.Store, func() error, error)
+}
+
+// openDB opens the database of the config with its pool settings
+func openDB(config config.Config) (*sql.DB, error) {
+	conn, err := sql.Open(config.DbDriver, config.DbSource)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetMaxOpenConns(config.DbMaxOpenConns)
+	conn.SetMaxIdleConns(config.DbMaxIdleConns)
+	conn.SetConnMaxLifetime(config.DbConnMaxLifetime)
+	conn.SetConnMaxIdleTime(config.DbConnMaxIdleTime)
+	return conn, nil
+}
+
+func openSQLStore(config config.Config) (db.Store, func() error, error) {
+	conn, err := openDB(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	store := db.NewStore(conn)
+	store.SetLedgerKey([]byte(config.LedgerKey))
+	return store, conn.Close, nil
+}
+
+// NewRootCommand returns the simple-bank command, without a subcommand it serves the API
+func NewRootCommand() *cobra.Command {
+	return newRootCommand(&app{openStore: openSQLStore})
+}
+
+func newRootCommand(app *app) *cobra.Command {
+	serve := newServeCommand(app)
+
+	root := &cobra.Command{
+		Use:          "simple-bank",
+		Short:        "Simple bank API server and admin tools",
+		Version:      buildVersion(),
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			app.config, err = initial.LoadingConfig(app.configPath)
+			return
+		},
+		RunE: serve.RunE,
+	}
+	root.PersistentFlags().StringVar(&app.configPath, "config", ".", "directory of config.env")
+
+	root.AddCommand(
+		serve,
+		newMigrateCommand(app),
+		newUserCommand(app),
+		newAccountCommand(app),
+		newTokenCommand(app),
+		newSeedCommand(app),
+		newVerifyLedgerCommand(app),
+		newSecretCommand(),
+	)
+	return root
+}
+
+// withStore runs fn with a store of the configured database
+func (app *app) withStore(fn func(store db.Store) error) error {
+	store, closeStore, err := app.openStore(app.config)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	return fn(store)
+}
+
+// commandContext marks the changes made by the command line in the audit log
+func commandContext(cmd *cobra.Command) context.Context {
+	return db.WithAuditMeta(cmd.Context(), db.AuditMeta{UserAgent: cmd.CommandPath()})
+}
+
+// buildVersion is printed by --version
+func buildVersion() string {
+	info := buildinfo.Get()
+	return fmt.Sprintf("%s, built %s with %s", info.Commit, info.BuildTime, info.GoVersion)
+}
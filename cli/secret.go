@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"lesson/simple-bank/secret"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newSecretCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage the encrypted secrets file",
+		// the secrets file can be created before there is a valid config
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+	cmd.AddCommand(newSecretKeygenCommand(), newSecretSealCommand())
+	return cmd
+}
+
+func newSecretKeygenCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "keygen",
+		Short: "Print a new random master key for " + secret.MasterKeyName,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := secret.NewMasterKey()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), key)
+			return nil
+		},
+	}
+}
+
+func newSecretSealCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "seal FILE",
+		Short: "Encrypt the KEY=VALUE lines of stdin into FILE with " + secret.MasterKeyName,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			masterKey, err := secret.Chain{secret.File{}, secret.Env{}}.Secret(secret.MasterKeyName)
+			if err != nil {
+				return fmt.Errorf("%s: %w", secret.MasterKeyName, err)
+			}
+			key, err := secret.ParseMasterKey(masterKey)
+			if err != nil {
+				return err
+			}
+
+			secrets := make(map[string]string)
+			scanner := bufio.NewScanner(cmd.InOrStdin())
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				name, value, ok := strings.Cut(line, "=")
+				if !ok {
+					return fmt.Errorf("invalid line %q, want KEY=VALUE", line)
+				}
+				secrets[strings.TrimSpace(name)] = value
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+
+			data, err := secret.Seal(key, secrets)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(args[0], data, 0o600); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "sealed %d secrets into %s\n", len(secrets), args[0])
+			return nil
+		},
+	}
+}
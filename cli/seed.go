@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// seedCurrencies are the currencies of utils.RandomCurrency, an owner has one account per currency
+var seedCurrencies = []string{"TWD", "USD", "YEN"}
+
+type seedParams struct {
+	Users     int
+	Transfers int
+	Password  string
+}
+
+type seedResult struct {
+	Users     []db.User
+	Accounts  []db.Account
+	Transfers []db.Transfer
+}
+
+func newSeedCommand(app *app) *cobra.Command {
+	var arg seedParams
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Fill the db with random users, accounts and transfers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.withStore(func(store db.Store) error {
+				result, err := seed(commandContext(cmd), store, arg)
+				fmt.Fprintf(cmd.OutOrStdout(), "seeded %d users, %d accounts and %d transfers\n",
+					len(result.Users), len(result.Accounts), len(result.Transfers))
+				return err
+			})
+		},
+	}
+
+	cmd.Flags().IntVar(&arg.Users, "users", 10, "number of users")
+	cmd.Flags().IntVar(&arg.Transfers, "transfers", 50, "number of transfers")
+	cmd.Flags().StringVar(&arg.Password, "password", "secret", "password of every seeded user")
+	return cmd
+}
+
+// seed creates the users with one to three accounts each, then transfers random amounts
+// between accounts of the same currency without overdrawing any of them
+func seed(ctx context.Context, store db.Store, arg seedParams) (result seedResult, err error) {
+	hashed, err := utils.HashedPassword(arg.Password)
+	if err != nil {
+		return
+	}
+
+	byCurrency := make(map[string][]int)
+	for i := 0; i < arg.Users; i++ {
+		user, err := store.CreateUserTx(ctx, db.CreateUserParams{
+			Username:       utils.RandomOwner(),
+			HashedPassword: hashed,
+			FullName:       utils.RandomOwner() + " " + utils.RandomOwner(),
+			Email:          utils.RandomEmail(),
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Users = append(result.Users, user)
+
+		first := utils.RandomInt(0, int64(len(seedCurrencies)-1))
+		count := utils.RandomInt(1, int64(len(seedCurrencies)))
+		for j := first; j < first+count; j++ {
+			currency := seedCurrencies[j%int64(len(seedCurrencies))]
+			account, err := store.CreateAccountTx(ctx, db.CreateAccountParams{
+				Owner:    user.Username,
+				Balance:  utils.RandomMoney(),
+				Currency: currency,
+			})
+			if err != nil {
+				return result, err
+			}
+			byCurrency[currency] = append(byCurrency[currency], len(result.Accounts))
+			result.Accounts = append(result.Accounts, account)
+		}
+	}
+
+	var candidates [][]int
+	for _, currency := range seedCurrencies {
+		if len(byCurrency[currency]) > 1 {
+			candidates = append(candidates, byCurrency[currency])
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	for len(result.Transfers) < arg.Transfers {
+		accounts := candidates[utils.RandomInt(0, int64(len(candidates)-1))]
+		from := accounts[utils.RandomInt(0, int64(len(accounts)-1))]
+		to := accounts[utils.RandomInt(0, int64(len(accounts)-1))]
+		balance := result.Accounts[from].Balance
+		if from == to || balance == 0 {
+			if !anyBalance(result.Accounts, candidates) {
+				return
+			}
+			continue
+		}
+
+		transfer, err := store.TranserTx(ctx, db.TransferTxParams{
+			FromAccountID: result.Accounts[from].ID,
+			ToAccountID:   result.Accounts[to].ID,
+			Amount:        utils.RandomInt(1, balance),
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Accounts[from] = transfer.FromAccount
+		result.Accounts[to] = transfer.ToAccount
+		result.Transfers = append(result.Transfers, transfer.Transfer)
+	}
+	return
+}
+
+// anyBalance reports whether money is left to transfer between the candidate accounts
+func anyBalance(accounts []db.Account, candidates [][]int) bool {
+	for _, group := range candidates {
+		for _, i := range group {
+			if accounts[i].Balance > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
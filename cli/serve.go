@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"lesson/simple-bank/api"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/migration"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/gapi"
+	"lesson/simple-bank/initial"
+	"lesson/simple-bank/lockout"
+	"lesson/simple-bank/metrics"
+	"lesson/simple-bank/outbox"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/stream"
+	"lesson/simple-bank/tracing"
+	"lesson/simple-bank/webhook"
+	"log/slog"
+	"net"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+func newServeCommand(app *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the HTTP and gRPC APIs and run the background workers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(app.configPath, config.NewSnapshot(app.config))
+		},
+	}
+}
+
+// serve runs the servers on the snapshot, which is reloaded from the config files of path.
+// On SIGINT or SIGTERM it stops accepting requests, drains the in-flight ones within SHUTDOWNTIMEOUT,
+// then stops the background workers and finally closes the DB pool.
+func serve(path string, snapshot *config.Snapshot) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	config := snapshot.Load()
+	logger, logLevel, err := newLogger(config)
+	if err != nil {
+		return fmt.Errorf("can't set up logging: %w", err)
+	}
+	logger.Info("config loaded", "config", config.RedactedValues())
+
+	shutdownTracing, err := tracing.Setup(ctx, config)
+	if err != nil {
+		return fmt.Errorf("can't set up tracing: %w", err)
+	}
+	// deferred before the pool is closed, so it runs last and flushes the spans of the shutdown
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.Error("can't flush spans", "error", err)
+		}
+	}()
+
+	if err := checkSchema(config); err != nil {
+		return fmt.Errorf("can't use db schema: %w", err)
+	}
+
+	conn, err := openDB(config)
+	if err != nil {
+		return err
+	}
+	// deferred first, so the pool is closed once everything else has stopped
+	defer func() {
+		logger.Info("closing db pool")
+		conn.Close()
+	}()
+
+	if err := metrics.RegisterDBStats(conn); err != nil {
+		return fmt.Errorf("can't export db pool stats: %w", err)
+	}
+
+	store := db.NewStoreWithLogger(conn, logger)
+	store.SetLedgerKey([]byte(config.LedgerKey))
+
+	publisher, err := newOutboxPublisher(config, logger)
+	if err != nil {
+		return fmt.Errorf("can't create outbox publisher: %w", err)
+	}
+	publisher = outbox.MultiPublisher{publisher, webhook.NewDispatcher(store)}
+
+	rateLimiter := initial.NewRateLimitStore(config, store)
+	broker := stream.NewBroker()
+	webhookWorker := webhook.NewWorker(store, config.WebhookTimeout, config.WebhookWorkerInterval, logger)
+	server, err := api.NewServer(snapshot, store, broker, webhookWorker, logger, rateLimiter)
+	if err != nil {
+		return fmt.Errorf("can't create server: %w", err)
+	}
+	grpcServer, err := gapi.NewServer(snapshot, store, logger, rateLimiter)
+	if err != nil {
+		return fmt.Errorf("can't create gRPC server: %w", err)
+	}
+	grpcListener, err := net.Listen("tcp", config.GRPCServerAddress)
+	if err != nil {
+		return fmt.Errorf("can't listen for gRPC: %w", err)
+	}
+	var metricsListener net.Listener
+	if config.MetricsAddress != "" {
+		metricsListener, err = net.Listen("tcp", config.MetricsAddress)
+		if err != nil {
+			return fmt.Errorf("can't listen for metrics: %w", err)
+		}
+	}
+
+	workers := newWorkers(logger)
+	defer workers.stop()
+	workers.run("outbox relay", outbox.NewRelay(store, publisher, config.OutboxRelayInterval, logger).Run)
+	workers.run("import job resumer", server.ResumeImportJobs)
+	workers.run("webhook worker", webhookWorker.Run)
+	workers.run("stream listener", func(ctx context.Context) {
+		if err := stream.NewListener(config.DbSource, broker, logger).Run(ctx); err != nil {
+			logger.Error("can't listen for account events", "error", err)
+			stop()
+		}
+	})
+	if metricsListener != nil {
+		logger.Info("metrics server listening", "address", metricsListener.Addr().String())
+		workers.run("metrics server", func(ctx context.Context) {
+			if err := metrics.Serve(ctx, metricsListener); err != nil {
+				logger.Error("can't serve metrics", "error", err)
+				stop()
+			}
+		})
+	}
+	workers.run("rate limit pruner", ratelimit.NewPruner(rateLimiter, time.Minute, logger).Run)
+	workers.run("login failure pruner", lockout.NewPruner(lockout.NewGuard(store), snapshot, time.Minute, logger).Run)
+	workers.run("config reloader", initial.NewReloader(path, snapshot, reloadLogLevel(logLevel, recordReload(store, logger)), logger).Watch)
+
+	server.AddReadinessCheck("database", conn.PingContext)
+	server.AddReadinessCheck("migrations", func(ctx context.Context) error {
+		return migration.CheckLatest(ctx, conn)
+	})
+	server.AddReadinessCheck("workers", workers.check)
+
+	failed := make(chan error, 2)
+	grpcService := grpcServer.NewGRPCServer()
+	go func() {
+		logger.Info("gRPC server listening", "address", grpcListener.Addr().String())
+		if err := grpcService.Serve(grpcListener); err != nil {
+			failed <- fmt.Errorf("can't serve gRPC: %w", err)
+		}
+	}()
+	go func() {
+		if err := server.Start(config.ServerAddress); err != nil {
+			failed <- fmt.Errorf("can't serve HTTP: %w", err)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-failed:
+	}
+	logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), snapshot.Load().ShutdownTimeout)
+	defer cancel()
+	if shutdownErr := shutdownServers(shutdownCtx, server, grpcService); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// shutdownServers drains the HTTP and gRPC servers together until ctx is done
+func shutdownServers(ctx context.Context, server *api.Server, grpcService *grpc.Server) error {
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcService.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		err = fmt.Errorf("can't drain HTTP requests: %w", err)
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcService.Stop()
+		if err == nil {
+			err = fmt.Errorf("can't drain gRPC calls: %w", ctx.Err())
+		}
+	}
+	return err
+}
+
+func newOutboxPublisher(config config.Config, logger *slog.Logger) (outbox.Publisher, error) {
+	switch config.OutboxPublisher {
+	case "", "log":
+		return outbox.NewLogPublisher(logger), nil
+	case "webhook":
+		return outbox.NewWebhookPublisher(config.OutboxWebhookUrl, 10*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", config.OutboxPublisher)
+	}
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/initial"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newTokenCommand(app *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Debug access tokens",
+	}
+	cmd.AddCommand(newTokenIssueCommand(app))
+	return cmd
+}
+
+func newTokenIssueCommand(app *app) *cobra.Command {
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "issue USERNAME",
+		Short: "Mint an access token of a user without its password",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration <= 0 {
+				duration = app.config.AccessTokenDuration
+			}
+
+			maker, err := initial.NewTokenMaker(app.config, slog.Default())
+			if err != nil {
+				return err
+			}
+
+			return app.withStore(func(store db.Store) error {
+				user, err := store.GetUser(cmd.Context(), args[0])
+				if err != nil {
+					return notFound(err, "user %s", args[0])
+				}
+
+				accessToken, payload, err := maker.CreateToken(user.Username, duration)
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintln(cmd.OutOrStdout(), accessToken)
+				fmt.Fprintf(cmd.ErrOrStderr(), "token of %s %s expires at %s\n", user.Role, user.Username, payload.ExpiresAt.Format(time.RFC3339))
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "duration", 0, "lifetime of the token, ACCESSTOKENDURATION by default")
+	return cmd
+}
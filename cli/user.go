@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/lockout"
+	"lesson/simple-bank/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func validRole(role string) error {
+	switch role {
+	case utils.DepositorRole, utils.AdminRole:
+		return nil
+	default:
+		return fmt.Errorf("unknown role %q, want %s or %s", role, utils.DepositorRole, utils.AdminRole)
+	}
+}
+
+func newUserCommand(app *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage users",
+	}
+	cmd.AddCommand(newUserCreateCommand(app), newUserSetRoleCommand(app), newUserUnlockCommand(app))
+	return cmd
+}
+
+func newUserCreateCommand(app *app) *cobra.Command {
+	var arg db.CreateUserParams
+	var password, role string
+
+	cmd := &cobra.Command{
+		Use:   "create USERNAME",
+		Short: "Create a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validRole(role); err != nil {
+				return err
+			}
+			if len(password) < 5 {
+				return fmt.Errorf("the password needs at least 5 characters")
+			}
+
+			hashed, err := utils.HashedPassword(password)
+			if err != nil {
+				return err
+			}
+			arg.Username = args[0]
+			arg.HashedPassword = hashed
+
+			return app.withStore(func(store db.Store) error {
+				ctx := commandContext(cmd)
+				user, err := store.CreateUserTx(ctx, arg)
+				if err != nil {
+					return err
+				}
+				if role != user.Role {
+					user, err = store.UpdateUserRoleTx(ctx, db.UpdateUserRoleParams{Role: role, Username: user.Username})
+					if err != nil {
+						return err
+					}
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "created %s %s <%s>\n", user.Role, user.Username, user.Email)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&password, "password", "", "password of the user")
+	cmd.Flags().StringVar(&arg.FullName, "full-name", "", "full name of the user")
+	cmd.Flags().StringVar(&arg.Email, "email", "", "email of the user")
+	cmd.Flags().StringVar(&role, "role", utils.DepositorRole, "role of the user, depositor or admin")
+	cmd.MarkFlagRequired("password")
+	cmd.MarkFlagRequired("full-name")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func newUserSetRoleCommand(app *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set-role USERNAME ROLE",
+		Short: "Change the role of a user",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validRole(args[1]); err != nil {
+				return err
+			}
+
+			return app.withStore(func(store db.Store) error {
+				user, err := store.UpdateUserRoleTx(commandContext(cmd), db.UpdateUserRoleParams{Role: args[1], Username: args[0]})
+				if err != nil {
+					return notFound(err, "user %s", args[0])
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is now %s\n", user.Username, user.Role)
+				return nil
+			})
+		},
+	}
+}
+
+func newUserUnlockCommand(app *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unlock USERNAME",
+		Short: "Forget the failed logins of a user, which lifts its delay or lockout",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.withStore(func(store db.Store) error {
+				unlocked, err := lockout.NewGuard(store).Unlock(commandContext(cmd), args[0])
+				if err != nil {
+					return err
+				}
+
+				if !unlocked {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s has no failed logins\n", args[0])
+					return nil
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is unlocked\n", args[0])
+				return nil
+			})
+		},
+	}
+}
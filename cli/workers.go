@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// workers runs the background loops of the server until stop is called
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	logger *slog.Logger
+
+	mu sync.Mutex
+	// the workers that returned before stop
+	stopped []string
+}
+
+func newWorkers(logger *slog.Logger) *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel, logger: logger}
+}
+
+// run starts fn in a goroutine, fn must return once its context is canceled
+func (workers *workers) run(name string, fn func(ctx context.Context)) {
+	workers.wg.Add(1)
+	go func() {
+		defer workers.wg.Done()
+		fn(workers.ctx)
+		workers.logger.Info("worker stopped", "worker", name)
+
+		if workers.ctx.Err() == nil {
+			workers.mu.Lock()
+			workers.stopped = append(workers.stopped, name)
+			workers.mu.Unlock()
+		}
+	}()
+}
+
+// check is the readiness check of the workers, it fails when one of them stopped on its own
+func (workers *workers) check(ctx context.Context) error {
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+
+	if len(workers.stopped) > 0 {
+		stopped := append([]string(nil), workers.stopped...)
+		sort.Strings(stopped)
+		return fmt.Errorf("stopped: %s", strings.Join(stopped, ", "))
+	}
+	return nil
+}
+
+// stop cancels the workers and waits for them to return
+func (workers *workers) stop() {
+	workers.cancel()
+	workers.wg.Wait()
+}
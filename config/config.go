@@ -1,8 +1,233 @@
 package config
 
+import (
+	"fmt"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/token"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// MinSecreteKeyLength is the shortest key accepted for signing tokens
+const MinSecreteKeyLength = token.MinSecreteKeySize
+
+// MinLedgerKeyLength is the shortest key accepted for hashing the entry chains
+const MinLedgerKeyLength = 32
+
+// Config is read from config.env, the mapstructure tags are the env variable names.
+// The fields tagged reload can change while the server runs, see Snapshot.
 type Config struct {
-	DbDriver      string `mapstrucutre:"DBDRIVER"`
-	DbSource      string `mapstrucutre:"DBSOURCE"`
-	ServerAddress string `mapstrucutre:"SERVERADDRESS"`
-	SecreteKey    string `mapstrucutre:"SECRETEKEY"`
+	DbDriver                string        `mapstructure:"DBDRIVER"`
+	DbSource                string        `mapstructure:"DBSOURCE"`
+	DbPassword              string        `mapstructure:"DBPASSWORD"`
+	DbMaxOpenConns          int           `mapstructure:"DBMAXOPENCONNS"`
+	DbMaxIdleConns          int           `mapstructure:"DBMAXIDLECONNS"`
+	DbConnMaxLifetime       time.Duration `mapstructure:"DBCONNMAXLIFETIME"`
+	DbConnMaxIdleTime       time.Duration `mapstructure:"DBCONNMAXIDLETIME"`
+	ServerAddress           string        `mapstructure:"SERVERADDRESS"`
+	GRPCServerAddress       string        `mapstructure:"GRPCSERVERADDRESS"`
+	MetricsAddress          string        `mapstructure:"METRICSADDRESS"`
+	ServerReadTimeout       time.Duration `mapstructure:"SERVERREADTIMEOUT"`
+	ServerWriteTimeout      time.Duration `mapstructure:"SERVERWRITETIMEOUT"`
+	ServerIdleTimeout       time.Duration `mapstructure:"SERVERIDLETIMEOUT"`
+	ShutdownTimeout         time.Duration `mapstructure:"SHUTDOWNTIMEOUT"`
+	SecreteKey              string        `mapstructure:"SECRETEKEY"`
+	LedgerKey               string        `mapstructure:"LEDGERKEY"`
+	SecretsFile             string        `mapstructure:"SECRETSFILE"`
+	SecretsRefreshInterval  time.Duration `mapstructure:"SECRETSREFRESHINTERVAL"`
+	AccessTokenDuration     time.Duration `mapstructure:"ACCESSTOKENDURATION" reload:"true"`
+	MaxTransferAmount       int64         `mapstructure:"MAXTRANSFERAMOUNT" reload:"true"`
+	OutboxPublisher         string        `mapstructure:"OUTBOXPUBLISHER"`
+	OutboxWebhookUrl        string        `mapstructure:"OUTBOXWEBHOOKURL"`
+	OutboxRelayInterval     time.Duration `mapstructure:"OUTBOXRELAYINTERVAL"`
+	WebhookTimeout          time.Duration `mapstructure:"WEBHOOKTIMEOUT"`
+	WebhookWorkerInterval   time.Duration `mapstructure:"WEBHOOKWORKERINTERVAL"`
+	StreamHeartbeatInterval time.Duration `mapstructure:"STREAMHEARTBEATINTERVAL" reload:"true"`
+	MigrateOnStartup        bool          `mapstructure:"MIGRATEONSTARTUP"`
+	TracingExporter         string        `mapstructure:"TRACINGEXPORTER"`
+	TracingOTLPEndpoint     string        `mapstructure:"TRACINGOTLPENDPOINT"`
+	TracingSampleRatio      float64       `mapstructure:"TRACINGSAMPLERATIO"`
+	LogLevel                string        `mapstructure:"LOGLEVEL" reload:"true"`
+	LogFormat               string        `mapstructure:"LOGFORMAT"`
+	TrustedProxies          []string      `mapstructure:"TRUSTEDPROXIES"`
+	RateLimitStore          string        `mapstructure:"RATELIMITSTORE"`
+	RateLimitAuth           string        `mapstructure:"RATELIMITAUTH" reload:"true"`
+	RateLimitTransfers      string        `mapstructure:"RATELIMITTRANSFERS" reload:"true"`
+	LoginFailureWindow      time.Duration `mapstructure:"LOGINFAILUREWINDOW" reload:"true"`
+	LoginMaxFailures        int           `mapstructure:"LOGINMAXFAILURES" reload:"true"`
+	LoginIPMaxFailures      int           `mapstructure:"LOGINIPMAXFAILURES" reload:"true"`
+	LoginLockoutDuration    time.Duration `mapstructure:"LOGINLOCKOUTDURATION" reload:"true"`
+	LoginDelayAfter         int           `mapstructure:"LOGINDELAYAFTER" reload:"true"`
+	LoginDelay              time.Duration `mapstructure:"LOGINDELAY" reload:"true"`
+}
+
+// Keys returns the env variable names of the config fields
+func Keys() []string {
+	typ := reflect.TypeOf(Config{})
+	keys := make([]string, typ.NumField())
+	for i := range keys {
+		keys[i] = typ.Field(i).Tag.Get("mapstructure")
+	}
+	return keys
+}
+
+// ValidationError lists every problem of a config
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e, "; ")
+}
+
+// Validate checks that the required fields are set and the others are in range
+func (config Config) Validate() error {
+	var problems ValidationError
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(config.DbDriver != "", "DBDRIVER is required")
+	check(config.DbSource != "", "DBSOURCE is required")
+	check(config.DbMaxOpenConns >= 0, "DBMAXOPENCONNS can't be negative")
+	check(config.DbMaxIdleConns >= 0, "DBMAXIDLECONNS can't be negative")
+	check(config.DbMaxOpenConns <= 0 || config.DbMaxIdleConns <= config.DbMaxOpenConns, "DBMAXIDLECONNS can't be more than DBMAXOPENCONNS")
+	check(config.DbConnMaxLifetime >= 0, "DBCONNMAXLIFETIME can't be negative")
+	check(config.DbConnMaxIdleTime >= 0, "DBCONNMAXIDLETIME can't be negative")
+	check(config.ServerAddress != "", "SERVERADDRESS is required")
+	check(config.GRPCServerAddress != "", "GRPCSERVERADDRESS is required")
+	check(config.ServerReadTimeout >= 0, "SERVERREADTIMEOUT can't be negative")
+	check(config.ServerWriteTimeout >= 0, "SERVERWRITETIMEOUT can't be negative")
+	check(config.ServerIdleTimeout >= 0, "SERVERIDLETIMEOUT can't be negative")
+	check(config.ShutdownTimeout > 0, "SHUTDOWNTIMEOUT must be positive")
+	check(len(config.SecreteKey) >= MinSecreteKeyLength, "SECRETEKEY needs at least %d characters", MinSecreteKeyLength)
+	check(len(config.LedgerKey) >= MinLedgerKeyLength, "LEDGERKEY needs at least %d characters", MinLedgerKeyLength)
+	check(config.SecretsRefreshInterval >= 0, "SECRETSREFRESHINTERVAL can't be negative")
+	check(config.AccessTokenDuration > 0, "ACCESSTOKENDURATION must be positive")
+	check(config.MaxTransferAmount >= 0, "MAXTRANSFERAMOUNT can't be negative")
+	check(config.OutboxRelayInterval > 0, "OUTBOXRELAYINTERVAL must be positive")
+	check(config.WebhookTimeout > 0, "WEBHOOKTIMEOUT must be positive")
+	check(config.WebhookWorkerInterval > 0, "WEBHOOKWORKERINTERVAL must be positive")
+	check(config.StreamHeartbeatInterval > 0, "STREAMHEARTBEATINTERVAL must be positive")
+
+	switch config.OutboxPublisher {
+	case "", "log":
+	case "webhook":
+		check(config.OutboxWebhookUrl != "", "OUTBOXWEBHOOKURL is required by the webhook publisher")
+	default:
+		check(false, "OUTBOXPUBLISHER %q is unknown, want log or webhook", config.OutboxPublisher)
+	}
+
+	switch config.TracingExporter {
+	case "", "none", "stdout", "otlp":
+	default:
+		check(false, "TRACINGEXPORTER %q is unknown, want none, stdout or otlp", config.TracingExporter)
+	}
+	check(config.TracingSampleRatio >= 0 && config.TracingSampleRatio <= 1, "TRACINGSAMPLERATIO must be between 0 and 1")
+
+	switch strings.ToLower(config.LogLevel) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		check(false, "LOGLEVEL %q is unknown, want debug, info, warn or error", config.LogLevel)
+	}
+	switch strings.ToLower(config.LogFormat) {
+	case "", "json", "text":
+	default:
+		check(false, "LOGFORMAT %q is unknown, want json or text", config.LogFormat)
+	}
+
+	for _, proxy := range config.TrustedProxies {
+		check(validProxy(proxy), "TRUSTEDPROXIES: %q is neither an IP nor a CIDR", proxy)
+	}
+	switch config.RateLimitStore {
+	case "", "memory", "postgres":
+	default:
+		check(false, "RATELIMITSTORE %q is unknown, want memory or postgres", config.RateLimitStore)
+	}
+	_, err := ratelimit.ParsePolicy(config.RateLimitAuth)
+	check(err == nil, "RATELIMITAUTH: %v", err)
+	_, err = ratelimit.ParsePolicy(config.RateLimitTransfers)
+	check(err == nil, "RATELIMITTRANSFERS: %v", err)
+
+	check(config.LoginFailureWindow > 0, "LOGINFAILUREWINDOW must be positive")
+	check(config.LoginMaxFailures >= 0, "LOGINMAXFAILURES can't be negative")
+	check(config.LoginIPMaxFailures >= 0, "LOGINIPMAXFAILURES can't be negative")
+	check(config.LoginLockoutDuration > 0, "LOGINLOCKOUTDURATION must be positive")
+	check(config.LoginDelayAfter >= 0, "LOGINDELAYAFTER can't be negative")
+	check(config.LoginDelay >= 0, "LOGINDELAY can't be negative")
+
+	if problems != nil {
+		return problems
+	}
+	return nil
+}
+
+func validProxy(proxy string) bool {
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return true
+	}
+	return net.ParseIP(proxy) != nil
+}
+
+// TransferAllowed reports whether amount is within MAXTRANSFERAMOUNT, 0 allows any amount
+func (config Config) TransferAllowed(amount int64) bool {
+	return config.MaxTransferAmount == 0 || amount <= config.MaxTransferAmount
+}
+
+// RateLimitPolicy returns the policy of a route group of ratelimit, the config was validated
+// so a policy failing to parse only leaves the group unlimited
+func (config Config) RateLimitPolicy(group string) ratelimit.Policy {
+	raw := ""
+	switch group {
+	case ratelimit.GroupAuth:
+		raw = config.RateLimitAuth
+	case ratelimit.GroupTransfers:
+		raw = config.RateLimitTransfers
+	}
+	policy, _ := ratelimit.ParsePolicy(raw)
+	return policy
+}
+
+// Redacted returns the config as KEY=value lines with the secrets masked
+func (config Config) Redacted() string {
+	values := config.RedactedValues()
+	var sb strings.Builder
+	for _, key := range Keys() {
+		fmt.Fprintf(&sb, "%s=%s\n", key, values[key])
+	}
+	return sb.String()
+}
+
+// RedactedValues returns the values of the config by key with the secrets masked
+func (config Config) RedactedValues() map[string]string {
+	value := reflect.ValueOf(config)
+	values := make(map[string]string)
+	for i, key := range Keys() {
+		v := fmt.Sprint(value.Field(i).Interface())
+		switch key {
+		case "SECRETEKEY", "LEDGERKEY", "DBPASSWORD":
+			if v != "" {
+				v = strings.Repeat("*", 8)
+			}
+		case "DBSOURCE", "OUTBOXWEBHOOKURL":
+			v = redactURL(v)
+		}
+		values[key] = v
+	}
+	return values
+}
+
+// redactURL masks the password of a URL, other values like key=value DSNs are masked entirely
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return strings.Repeat("*", 8)
+	}
+	return u.Redacted()
 }
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot holds the config of a running server. Readers load the whole config at once,
+// so they never see a reload half applied.
+type Snapshot struct {
+	current atomic.Pointer[Config]
+	// serializes the reloads
+	mu sync.Mutex
+}
+
+func NewSnapshot(config Config) *Snapshot {
+	snapshot := &Snapshot{}
+	snapshot.current.Store(&config)
+	return snapshot
+}
+
+// Load returns the current config
+func (snapshot *Snapshot) Load() Config {
+	return *snapshot.current.Load()
+}
+
+// Reload validates next and swaps in the values of its fields tagged reload. The keys of
+// those that changed are returned, changes to the other fields need a restart and are
+// returned as ignored. An invalid config is rejected as a whole.
+func (snapshot *Snapshot) Reload(next Config) (changed []string, ignored []string, err error) {
+	if err = next.Validate(); err != nil {
+		return
+	}
+
+	snapshot.mu.Lock()
+	defer snapshot.mu.Unlock()
+
+	merged := snapshot.Load()
+	mergedValue := reflect.ValueOf(&merged).Elem()
+	nextValue := reflect.ValueOf(next)
+	for i, key := range Keys() {
+		field := mergedValue.Field(i)
+		if reflect.DeepEqual(field.Interface(), nextValue.Field(i).Interface()) {
+			continue
+		}
+		if mergedValue.Type().Field(i).Tag.Get("reload") != "true" {
+			ignored = append(ignored, key)
+			continue
+		}
+		field.Set(nextValue.Field(i))
+		changed = append(changed, key)
+	}
+
+	if changed != nil {
+		snapshot.current.Store(&merged)
+	}
+	return
+}
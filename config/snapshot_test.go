@@ -0,0 +1,72 @@
+package config
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotReload(t *testing.T) {
+	snapshot := NewSnapshot(validConfig())
+
+	next := validConfig()
+	next.AccessTokenDuration = time.Hour
+	next.MaxTransferAmount = 1000
+	next.ServerAddress = "localhost:8081"
+	changed, ignored, err := snapshot.Reload(next)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ACCESSTOKENDURATION", "MAXTRANSFERAMOUNT"}, changed)
+	require.Equal(t, []string{"SERVERADDRESS"}, ignored)
+
+	got := snapshot.Load()
+	require.Equal(t, time.Hour, got.AccessTokenDuration)
+	require.Equal(t, int64(1000), got.MaxTransferAmount)
+	// changes that need a restart are not applied
+	require.Equal(t, "localhost:8080", got.ServerAddress)
+
+	changed, ignored, err = snapshot.Reload(next)
+	require.NoError(t, err)
+	require.Empty(t, changed)
+	require.Equal(t, []string{"SERVERADDRESS"}, ignored)
+}
+
+func TestSnapshotReloadInvalid(t *testing.T) {
+	snapshot := NewSnapshot(validConfig())
+
+	next := validConfig()
+	next.AccessTokenDuration = time.Hour
+	next.StreamHeartbeatInterval = 0
+	changed, _, err := snapshot.Reload(next)
+	var problems ValidationError
+	require.ErrorAs(t, err, &problems)
+	require.Empty(t, changed)
+
+	// nothing of the invalid config is applied
+	require.Equal(t, validConfig(), snapshot.Load())
+}
+
+func TestSnapshotConcurrentReload(t *testing.T) {
+	snapshot := NewSnapshot(validConfig())
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			next := validConfig()
+			next.AccessTokenDuration = time.Duration(i) * time.Minute
+			next.StreamHeartbeatInterval = time.Duration(i) * time.Second
+			_, _, err := snapshot.Reload(next)
+			require.NoError(t, err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			// both fields always come from the same reload
+			got := snapshot.Load()
+			require.Equal(t, got.AccessTokenDuration/time.Minute, got.StreamHeartbeatInterval/time.Second)
+		}()
+	}
+	wg.Wait()
+}
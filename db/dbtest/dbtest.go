@@ -0,0 +1,259 @@
+// Package dbtest starts a throwaway Postgres for the tests and hands out databases
+// that already have every migration of db/migration applied. Each database is a copy
+// of a migrated template, so tests are isolated from each other and packages can run in parallel.
+//
+// By default an embedded Postgres is started in a temporary directory on a free port.
+// It runs the binaries of TEST_POSTGRES_BINARIES, or of the pg_ctl found in PATH, and
+// otherwise downloads them once into ~/.embedded-postgres-go. Set TEST_DATABASE_URL
+// to the DSN of a role allowed to create databases to use an existing server instead.
+// When there is no server and the binaries can't be downloaded, as when offline,
+// the tests are skipped.
+package dbtest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"lesson/simple-bank/db/migration"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	_ "github.com/lib/pq"
+)
+
+// EnvDatabaseURL names the env variable holding the DSN of an existing server
+const EnvDatabaseURL = "TEST_DATABASE_URL"
+
+// EnvPostgresBinaries names the env variable holding the directory of local Postgres binaries,
+// the one containing bin/initdb and bin/pg_ctl
+const EnvPostgresBinaries = "TEST_POSTGRES_BINARIES"
+
+// ErrUnavailable is returned when no server is configured and the Postgres binaries can't be found or downloaded
+var ErrUnavailable = errors.New("no test postgres available")
+
+const driverName = "postgres"
+
+type server struct {
+	// dsn of the maintenance database, used to create and drop the test databases
+	dsn      string
+	admin    *sql.DB
+	template string
+	stop     func() error
+}
+
+var (
+	startOnce sync.Once
+	srv       *server
+	startErr  error
+
+	// CREATE DATABASE fails while another one is copied from the same template
+	createMu sync.Mutex
+	seq      int64
+)
+
+// NewDB returns a connection to a new migrated database that is dropped when the test ends
+func NewDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	conn, drop, err := CreateDB()
+	if errors.Is(err, ErrUnavailable) {
+		t.Skip("skipping database test:", err)
+	}
+	if err != nil {
+		t.Fatal("cannot create test database: ", err)
+	}
+	t.Cleanup(func() {
+		if err := drop(); err != nil {
+			t.Error("cannot drop test database: ", err)
+		}
+	})
+	return conn
+}
+
+// CreateDB creates a new migrated database, drop closes the connection and drops the database.
+// Tests use NewDB, which skips them when the error wraps ErrUnavailable because there is no server to test against.
+func CreateDB() (conn *sql.DB, drop func() error, err error) {
+	startOnce.Do(func() {
+		srv, startErr = start()
+	})
+	if startErr != nil {
+		return nil, nil, startErr
+	}
+
+	name := fmt.Sprintf("%s_%d", srv.template, atomic.AddInt64(&seq, 1))
+	createMu.Lock()
+	_, err = srv.admin.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", name, srv.template))
+	createMu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err = sql.Open(driverName, withDatabase(srv.dsn, name))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	drop = func() error {
+		conn.Close()
+		_, err := srv.admin.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", name))
+		return err
+	}
+	return conn, drop, nil
+}
+
+// Stop drops the template database and stops the embedded server if this process started one
+func Stop() error {
+	if srv == nil {
+		return nil
+	}
+
+	return srv.close()
+}
+
+func (s *server) close() error {
+	_, err := s.admin.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", s.template))
+	s.admin.Close()
+	if stopErr := s.stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+func start() (*server, error) {
+	s := &server{
+		dsn:  os.Getenv(EnvDatabaseURL),
+		stop: func() error { return nil },
+		// the pid keeps the templates of packages tested in parallel apart
+		template: fmt.Sprintf("simple_bank_test_%d", os.Getpid()),
+	}
+
+	if s.dsn == "" {
+		var err error
+		s.dsn, s.stop, err = startEmbedded()
+		if err != nil {
+			return nil, fmt.Errorf("cannot start embedded postgres (set %s to use an existing server or %s to use local binaries): %w",
+				EnvDatabaseURL, EnvPostgresBinaries, err)
+		}
+	}
+
+	admin, err := sql.Open(driverName, s.dsn)
+	if err != nil {
+		s.stop()
+		return nil, err
+	}
+	s.admin = admin
+
+	if err := s.migrateTemplate(); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func startEmbedded() (dsn string, stop func() error, err error) {
+	port, err := freePort()
+	if err != nil {
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "simple-bank-postgres-")
+	if err != nil {
+		return
+	}
+
+	config := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V15).
+		Port(port).
+		Username("root").
+		Password("secret").
+		Database("postgres").
+		RuntimePath(dir).
+		Logger(io.Discard)
+	binaries := localBinaries()
+	if binaries != "" {
+		config = config.BinariesPath(binaries)
+	}
+	pg := embeddedpostgres.NewDatabase(config)
+	if err = pg.Start(); err != nil {
+		// without local binaries they are extracted into dir, their absence means the download failed
+		if _, statErr := os.Stat(filepath.Join(dir, "bin")); binaries == "" && os.IsNotExist(statErr) {
+			err = fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		os.RemoveAll(dir)
+		return
+	}
+
+	stop = func() error {
+		defer os.RemoveAll(dir)
+		return pg.Stop()
+	}
+	return config.GetConnectionURL() + "?sslmode=disable", stop, nil
+}
+
+// localBinaries returns the directory of the Postgres binaries installed on the host, empty when there are none
+func localBinaries() string {
+	if dir := os.Getenv(EnvPostgresBinaries); dir != "" {
+		return dir
+	}
+	pgCtl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(pgCtl); err == nil {
+		pgCtl = resolved
+	}
+	return filepath.Dir(filepath.Dir(pgCtl))
+}
+
+// migrateTemplate creates the template database and applies the embedded migrations to it,
+// the connection is closed afterwards as no session may use a template while it is copied
+func (s *server) migrateTemplate() error {
+	if _, err := s.admin.Exec("CREATE DATABASE " + s.template); err != nil {
+		return err
+	}
+
+	conn, err := sql.Open(driverName, withDatabase(s.dsn, s.template))
+	if err != nil {
+		return err
+	}
+
+	migrator, err := migration.NewMigrator(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer migrator.Close()
+
+	if err := migrator.Up(0); err != nil {
+		return fmt.Errorf("cannot migrate test database: %w", err)
+	}
+	return nil
+}
+
+// withDatabase replaces the database of a postgres:// DSN
+func withDatabase(dsn string, name string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	u.Path = "/" + name
+	return u.String()
+}
+
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
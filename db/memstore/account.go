@@ -0,0 +1,172 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+func (q *queries) CreateAccount(ctx context.Context, arg db.CreateAccountParams) (db.Account, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	for _, account := range q.data.accounts.rows {
+		if account.Owner == arg.Owner && account.Currency == arg.Currency {
+			return db.Account{}, uniqueViolation("accounts", "owner_currency_key")
+		}
+	}
+	if _, ok := q.data.users[arg.Owner]; !ok {
+		return db.Account{}, foreignKeyViolation("accounts", "accounts_owner_fkey")
+	}
+
+	account := db.Account{
+		ID:        q.data.accounts.nextID(),
+		Owner:     arg.Owner,
+		Balance:   arg.Balance,
+		Currency:  arg.Currency,
+		CreatedAt: q.now(),
+	}
+	q.data.accounts.put(account.ID, account)
+	q.onRollback(func() { q.data.accounts.delete(account.ID) })
+	return account, nil
+}
+
+func (q *queries) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	account, ok := q.data.accounts.get(id)
+	if !ok {
+		return db.Account{}, sql.ErrNoRows
+	}
+	return account, nil
+}
+
+func (q *queries) GetAccountForUpdate(ctx context.Context, id int64) (db.Account, error) {
+	unlock, err := q.lockAccount(ctx, id)
+	if err != nil {
+		return db.Account{}, err
+	}
+	defer unlock()
+
+	return q.GetAccount(ctx, id)
+}
+
+func (q *queries) ListAccount(ctx context.Context, arg db.ListAccountParams) ([]db.Account, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	accounts := q.data.accounts.list()
+	from, to, err := page(len(accounts), arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return accounts[from:to], nil
+}
+
+func (q *queries) ListOwnerAccounts(ctx context.Context, arg db.ListOwnerAccountsParams) ([]db.Account, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	accounts := []db.Account{}
+	for _, account := range q.data.accounts.list() {
+		if account.Owner == arg.Owner {
+			accounts = append(accounts, account)
+		}
+	}
+	from, to, err := page(len(accounts), arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return accounts[from:to], nil
+}
+
+func (q *queries) UpdateAccount(ctx context.Context, arg db.UpdateAccountParams) (db.Account, error) {
+	return q.updateAccount(ctx, arg.ID, func(account *db.Account) {
+		account.Balance = arg.Balance
+	})
+}
+
+func (q *queries) AddAccountBalance(ctx context.Context, arg db.AddAccountBalanceParams) (db.Account, error) {
+	return q.updateAccount(ctx, arg.ID, func(account *db.Account) {
+		account.Balance += arg.Amount
+	})
+}
+
+func (q *queries) SetAccountFrozen(ctx context.Context, arg db.SetAccountFrozenParams) (db.Account, error) {
+	return q.updateAccount(ctx, arg.ID, func(account *db.Account) {
+		account.Frozen = arg.Frozen
+	})
+}
+
+// updateAccount applies update to the account while holding its row lock
+func (q *queries) updateAccount(ctx context.Context, id int64, update func(*db.Account)) (db.Account, error) {
+	unlock, err := q.lockAccount(ctx, id)
+	if err != nil {
+		return db.Account{}, err
+	}
+	defer unlock()
+
+	if err := q.begin(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.accounts.get(id)
+	if !ok {
+		return db.Account{}, sql.ErrNoRows
+	}
+
+	account := old
+	update(&account)
+	q.data.accounts.put(id, account)
+	q.onRollback(func() { q.data.accounts.put(id, old) })
+	return account, nil
+}
+
+func (q *queries) DeleteAccount(ctx context.Context, id int64) error {
+	unlock, err := q.lockAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := q.begin(ctx); err != nil {
+		return err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.accounts.get(id)
+	if !ok {
+		return nil
+	}
+
+	for _, entry := range q.data.entries.rows {
+		if entry.AccountID == id {
+			return referencedViolation("accounts", "entries_account_id_fkey", "entries")
+		}
+	}
+	for _, transfer := range q.data.transfers.rows {
+		if transfer.FromAccountID == id {
+			return referencedViolation("accounts", "transfers_from_account_id_fkey", "transfers")
+		}
+	}
+	for _, transfer := range q.data.transfers.rows {
+		if transfer.ToAccountID == id {
+			return referencedViolation("accounts", "transfers_to_account_id_fkey", "transfers")
+		}
+	}
+
+	q.data.accounts.delete(id)
+	q.onRollback(func() { q.data.accounts.put(id, old) })
+	return nil
+}
@@ -0,0 +1,81 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+func cloneAuditEvent(e db.AuditEvent) db.AuditEvent {
+	e.Before = cloneBytes(e.Before)
+	e.After = cloneBytes(e.After)
+	return e
+}
+
+// CreateAuditEvent appends to the audit log, like the table triggers nothing updates or deletes its rows
+func (q *queries) CreateAuditEvent(ctx context.Context, arg db.CreateAuditEventParams) (db.AuditEvent, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.AuditEvent{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if arg.Before == nil {
+		return db.AuditEvent{}, notNullViolation("audit_events", "before")
+	}
+	if arg.After == nil {
+		return db.AuditEvent{}, notNullViolation("audit_events", "after")
+	}
+
+	e := db.AuditEvent{
+		ID:           q.data.auditEvents.nextID(),
+		Actor:        arg.Actor,
+		Action:       arg.Action,
+		ResourceType: arg.ResourceType,
+		ResourceID:   arg.ResourceID,
+		Before:       json.RawMessage(cloneBytes(arg.Before)),
+		After:        json.RawMessage(cloneBytes(arg.After)),
+		RequestID:    arg.RequestID,
+		ClientIp:     arg.ClientIp,
+		UserAgent:    arg.UserAgent,
+		CreatedAt:    q.now(),
+	}
+	q.data.auditEvents.put(e.ID, e)
+	q.onRollback(func() { q.data.auditEvents.delete(e.ID) })
+	return cloneAuditEvent(e), nil
+}
+
+func (q *queries) ListAuditEvents(ctx context.Context, arg db.ListAuditEventsParams) ([]db.AuditEvent, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	var events []db.AuditEvent
+	all := q.data.auditEvents.list()
+	for i := len(all) - 1; i >= 0; i-- {
+		e := all[i]
+		switch {
+		case arg.Actor.Valid && e.Actor != arg.Actor.String,
+			arg.Action.Valid && e.Action != arg.Action.String,
+			arg.ResourceType.Valid && e.ResourceType != arg.ResourceType.String,
+			arg.ResourceID.Valid && e.ResourceID != arg.ResourceID.String,
+			arg.RequestID.Valid && e.RequestID != arg.RequestID.String,
+			arg.CreatedFrom.Valid && e.CreatedAt.Before(arg.CreatedFrom.Time),
+			arg.CreatedTo.Valid && !e.CreatedAt.Before(arg.CreatedTo.Time):
+			continue
+		}
+		events = append(events, e)
+	}
+
+	from, to, err := page(len(events), arg.Size, arg.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []db.AuditEvent{}
+	for _, e := range events[from:to] {
+		items = append(items, cloneAuditEvent(e))
+	}
+	return items, nil
+}
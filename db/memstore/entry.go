@@ -0,0 +1,215 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+func cloneEntry(entry db.Entry) db.Entry {
+	entry.PrevHash = cloneBytes(entry.PrevHash)
+	entry.Hash = cloneBytes(entry.Hash)
+	return entry
+}
+
+func (q *queries) CreateEntry(ctx context.Context, arg db.CreateEntryParams) (db.Entry, error) {
+	return q.insertEntry(ctx, db.Entry{
+		AccountID: arg.AccountID,
+		Amount:    arg.Amount,
+		CreatedAt: q.now(),
+	})
+}
+
+func (q *queries) CreateLedgerEntry(ctx context.Context, arg db.CreateLedgerEntryParams) (db.Entry, error) {
+	return q.insertEntry(ctx, db.Entry{
+		AccountID:  arg.AccountID,
+		Amount:     arg.Amount,
+		CreatedAt:  arg.CreatedAt.Round(time.Microsecond),
+		TransferID: arg.TransferID,
+		PrevHash:   cloneBytes(arg.PrevHash),
+		Hash:       cloneBytes(arg.Hash),
+	})
+}
+
+func (q *queries) insertEntry(ctx context.Context, entry db.Entry) (db.Entry, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Entry{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if _, ok := q.data.accounts.get(entry.AccountID); !ok {
+		return db.Entry{}, foreignKeyViolation("entries", "entries_account_id_fkey")
+	}
+	if entry.TransferID.Valid {
+		if _, ok := q.data.transfers.get(entry.TransferID.Int64); !ok {
+			return db.Entry{}, foreignKeyViolation("entries", "entries_transfer_id_fkey")
+		}
+	}
+
+	entry.ID = q.data.entries.nextID()
+	q.data.entries.put(entry.ID, entry)
+	q.onRollback(func() { q.data.entries.delete(entry.ID) })
+	return cloneEntry(entry), nil
+}
+
+func (q *queries) GetEntry(ctx context.Context, id int64) (db.Entry, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Entry{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	entry, ok := q.data.entries.get(id)
+	if !ok {
+		return db.Entry{}, sql.ErrNoRows
+	}
+	return cloneEntry(entry), nil
+}
+
+func (q *queries) GetLastAccountEntry(ctx context.Context, accountID int64) (db.Entry, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Entry{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	entries := q.data.entries.list()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].AccountID == accountID {
+			return cloneEntry(entries[i]), nil
+		}
+	}
+	return db.Entry{}, sql.ErrNoRows
+}
+
+func (q *queries) ListEntries(ctx context.Context, arg db.ListEntriesParams) ([]db.Entry, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	entries := q.data.entries.list()
+	from, to, err := page(len(entries), arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []db.Entry{}
+	for _, entry := range entries[from:to] {
+		items = append(items, cloneEntry(entry))
+	}
+	return items, nil
+}
+
+func (q *queries) ListAccountEntries(ctx context.Context, accountID int64) ([]db.Entry, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	items := []db.Entry{}
+	for _, entry := range q.data.entries.list() {
+		if entry.AccountID == accountID {
+			items = append(items, cloneEntry(entry))
+		}
+	}
+	return items, nil
+}
+
+func (q *queries) ListEntriesAfter(ctx context.Context, arg db.ListEntriesAfterParams) ([]db.Entry, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	items := []db.Entry{}
+	for _, entry := range q.data.entries.list() {
+		if entry.ID > arg.AfterID {
+			items = append(items, cloneEntry(entry))
+		}
+	}
+	from, to, err := page(len(items), arg.Size, 0)
+	if err != nil {
+		return nil, err
+	}
+	return items[from:to], nil
+}
+
+// ListAccountEntriesAfter reports the balance after every entry:
+// the current balance minus the amounts of the later entries of the account
+func (q *queries) ListAccountEntriesAfter(ctx context.Context, arg db.ListAccountEntriesAfterParams) ([]db.ListAccountEntriesAfterRow, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	items := []db.ListAccountEntriesAfterRow{}
+	account, ok := q.data.accounts.get(arg.AccountID)
+	if !ok {
+		return items, nil
+	}
+
+	var entries []db.Entry
+	for _, entry := range q.data.entries.list() {
+		if entry.AccountID == arg.AccountID && entry.ID > arg.AfterID {
+			entries = append(entries, entry)
+		}
+	}
+
+	balances := make([]int64, len(entries))
+	balance := account.Balance
+	for i := len(entries) - 1; i >= 0; i-- {
+		balances[i] = balance
+		balance -= entries[i].Amount
+	}
+
+	from, to, err := page(len(entries), arg.Size, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := from; i < to; i++ {
+		items = append(items, db.ListAccountEntriesAfterRow{
+			ID:         entries[i].ID,
+			AccountID:  entries[i].AccountID,
+			Amount:     entries[i].Amount,
+			TransferID: entries[i].TransferID,
+			CreatedAt:  entries[i].CreatedAt,
+			Balance:    balances[i],
+		})
+	}
+	return items, nil
+}
+
+func (q *queries) UpdateEntry(ctx context.Context, arg db.UpdateEntryParams) (db.Entry, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Entry{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.entries.get(arg.ID)
+	if !ok {
+		return db.Entry{}, sql.ErrNoRows
+	}
+
+	entry := old
+	entry.Amount = arg.Amount
+	q.data.entries.put(entry.ID, entry)
+	q.onRollback(func() { q.data.entries.put(old.ID, old) })
+	return cloneEntry(entry), nil
+}
+
+func (q *queries) DeleteEntry(ctx context.Context, id int64) error {
+	if err := q.begin(ctx); err != nil {
+		return err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.entries.get(id)
+	if !ok {
+		return nil
+	}
+
+	q.data.entries.delete(id)
+	q.onRollback(func() { q.data.entries.put(id, old) })
+	return nil
+}
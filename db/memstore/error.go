@@ -0,0 +1,66 @@
+package memstore
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// the errors below carry the SQLSTATE and the fields lib/pq reports for the same violation
+
+func uniqueViolation(table string, constraint string) error {
+	return &pq.Error{
+		Severity:   "ERROR",
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+func foreignKeyViolation(table string, constraint string) error {
+	return &pq.Error{
+		Severity:   "ERROR",
+		Code:       "23503",
+		Message:    fmt.Sprintf("insert or update on table %q violates foreign key constraint %q", table, constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+// referencedViolation is reported when a deleted row is still referenced by the table of constraint
+func referencedViolation(table string, constraint string, referencing string) error {
+	return &pq.Error{
+		Severity:   "ERROR",
+		Code:       "23503",
+		Message:    fmt.Sprintf("update or delete on table %q violates foreign key constraint %q on table %q", table, constraint, referencing),
+		Table:      referencing,
+		Constraint: constraint,
+	}
+}
+
+func notNullViolation(table string, column string) error {
+	return &pq.Error{
+		Severity: "ERROR",
+		Code:     "23502",
+		Message:  fmt.Sprintf("null value in column %q of relation %q violates not-null constraint", column, table),
+		Table:    table,
+		Column:   column,
+	}
+}
+
+func invalidLimit() error {
+	return &pq.Error{
+		Severity: "ERROR",
+		Code:     "2201W",
+		Message:  "LIMIT must not be negative",
+	}
+}
+
+func invalidOffset() error {
+	return &pq.Error{
+		Severity: "ERROR",
+		Code:     "2201X",
+		Message:  "OFFSET must not be negative",
+	}
+}
@@ -0,0 +1,199 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+// status of import jobs and transactions until they are processed
+const pendingImportStatus = "PDNG"
+
+func (q *queries) CreateImportJob(ctx context.Context, arg db.CreateImportJobParams) (db.ImportJob, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.ImportJob{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if _, ok := q.data.users[arg.Owner]; !ok {
+		return db.ImportJob{}, foreignKeyViolation("import_jobs", "import_jobs_owner_fkey")
+	}
+	for _, job := range q.data.importJobs.rows {
+		if job.Owner == arg.Owner && job.MessageID == arg.MessageID {
+			return db.ImportJob{}, uniqueViolation("import_jobs", "import_jobs_owner_message_id_key")
+		}
+	}
+
+	job := db.ImportJob{
+		ID:              q.data.importJobs.nextID(),
+		Owner:           arg.Owner,
+		MessageID:       arg.MessageID,
+		MessageName:     arg.MessageName,
+		InitiatingParty: arg.InitiatingParty,
+		TxCount:         arg.TxCount,
+		Status:          pendingImportStatus,
+		CreatedAt:       q.now(),
+		ClaimedUntil:    arg.ClaimedUntil.Round(time.Microsecond),
+	}
+	q.data.importJobs.put(job.ID, job)
+	q.onRollback(func() { q.data.importJobs.delete(job.ID) })
+	return job, nil
+}
+
+func (q *queries) GetImportJob(ctx context.Context, id int64) (db.ImportJob, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.ImportJob{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	job, ok := q.data.importJobs.get(id)
+	if !ok {
+		return db.ImportJob{}, sql.ErrNoRows
+	}
+	return job, nil
+}
+
+func (q *queries) GetImportJobByMessageID(ctx context.Context, arg db.GetImportJobByMessageIDParams) (db.ImportJob, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.ImportJob{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	for _, job := range q.data.importJobs.rows {
+		if job.Owner == arg.Owner && job.MessageID == arg.MessageID {
+			return job, nil
+		}
+	}
+	return db.ImportJob{}, sql.ErrNoRows
+}
+
+func (q *queries) UpdateImportJobStatus(ctx context.Context, arg db.UpdateImportJobStatusParams) (db.ImportJob, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.ImportJob{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.importJobs.get(arg.ID)
+	if !ok {
+		return db.ImportJob{}, sql.ErrNoRows
+	}
+
+	job := old
+	job.Status = arg.Status
+	job.FinishedAt = arg.FinishedAt
+	q.data.importJobs.put(job.ID, job)
+	q.onRollback(func() { q.data.importJobs.put(old.ID, old) })
+	return job, nil
+}
+
+func (q *queries) ClaimStaleImportJobs(ctx context.Context, arg db.ClaimStaleImportJobsParams) ([]db.ImportJob, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	now := q.now()
+	items := []db.ImportJob{}
+	for _, old := range q.data.importJobs.list() {
+		if int32(len(items)) >= arg.Size {
+			break
+		}
+		if old.Status != pendingImportStatus || old.ClaimedUntil.After(now) {
+			continue
+		}
+
+		job := old
+		job.ClaimedUntil = arg.LeaseUntil.Round(time.Microsecond)
+		q.data.importJobs.put(job.ID, job)
+		q.onRollback(func() { q.data.importJobs.put(old.ID, old) })
+		items = append(items, job)
+	}
+	return items, nil
+}
+
+func (q *queries) RenewImportJobClaim(ctx context.Context, arg db.RenewImportJobClaimParams) (db.ImportJob, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.ImportJob{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.importJobs.get(arg.ID)
+	if !ok || !old.ClaimedUntil.Equal(arg.ClaimedUntil) {
+		return db.ImportJob{}, sql.ErrNoRows
+	}
+
+	job := old
+	job.ClaimedUntil = arg.LeaseUntil.Round(time.Microsecond)
+	q.data.importJobs.put(job.ID, job)
+	q.onRollback(func() { q.data.importJobs.put(old.ID, old) })
+	return job, nil
+}
+
+func (q *queries) CreateImportTransaction(ctx context.Context, arg db.CreateImportTransactionParams) (db.ImportTransaction, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.ImportTransaction{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if _, ok := q.data.importJobs.get(arg.JobID); !ok {
+		return db.ImportTransaction{}, foreignKeyViolation("import_transactions", "import_transactions_job_id_fkey")
+	}
+
+	importTx := db.ImportTransaction{
+		ID:            q.data.importTxs.nextID(),
+		JobID:         arg.JobID,
+		PaymentInfoID: arg.PaymentInfoID,
+		EndToEndID:    arg.EndToEndID,
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		Currency:      arg.Currency,
+		Status:        pendingImportStatus,
+		CreatedAt:     q.now(),
+	}
+	q.data.importTxs.put(importTx.ID, importTx)
+	q.onRollback(func() { q.data.importTxs.delete(importTx.ID) })
+	return importTx, nil
+}
+
+func (q *queries) ListImportTransactions(ctx context.Context, jobID int64) ([]db.ImportTransaction, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	items := []db.ImportTransaction{}
+	for _, importTx := range q.data.importTxs.list() {
+		if importTx.JobID == jobID {
+			items = append(items, importTx)
+		}
+	}
+	return items, nil
+}
+
+func (q *queries) UpdateImportTransaction(ctx context.Context, arg db.UpdateImportTransactionParams) (db.ImportTransaction, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.ImportTransaction{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.importTxs.get(arg.ID)
+	if !ok {
+		return db.ImportTransaction{}, sql.ErrNoRows
+	}
+	if arg.TransferID.Valid {
+		if _, ok := q.data.transfers.get(arg.TransferID.Int64); !ok {
+			return db.ImportTransaction{}, foreignKeyViolation("import_transactions", "import_transactions_transfer_id_fkey")
+		}
+	}
+
+	importTx := old
+	importTx.Status = arg.Status
+	importTx.ReasonCode = arg.ReasonCode
+	importTx.TransferID = arg.TransferID
+	q.data.importTxs.put(importTx.ID, importTx)
+	q.onRollback(func() { q.data.importTxs.put(old.ID, old) })
+	return importTx, nil
+}
@@ -0,0 +1,73 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+func cloneLedgerAnchor(anchor db.LedgerAnchor) db.LedgerAnchor {
+	anchor.HeadHash = cloneBytes(anchor.HeadHash)
+	return anchor
+}
+
+func (q *queries) GetLedgerAnchor(ctx context.Context, accountID int64) (db.LedgerAnchor, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.LedgerAnchor{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	anchor, ok := q.data.ledgerAnchors[accountID]
+	if !ok {
+		return db.LedgerAnchor{}, sql.ErrNoRows
+	}
+	return cloneLedgerAnchor(anchor), nil
+}
+
+func (q *queries) ListLedgerAnchors(ctx context.Context) ([]db.LedgerAnchor, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	anchors := []db.LedgerAnchor{}
+	for _, anchor := range q.data.ledgerAnchors {
+		anchors = append(anchors, cloneLedgerAnchor(anchor))
+	}
+	sort.Slice(anchors, func(i, j int) bool { return anchors[i].AccountID < anchors[j].AccountID })
+	return anchors, nil
+}
+
+func (q *queries) AdvanceLedgerAnchor(ctx context.Context, arg db.AdvanceLedgerAnchorParams) (db.LedgerAnchor, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.LedgerAnchor{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if _, ok := q.data.accounts.get(arg.AccountID); !ok {
+		return db.LedgerAnchor{}, foreignKeyViolation("ledger_anchors", "ledger_anchors_account_id_fkey")
+	}
+
+	previous, ok := q.data.ledgerAnchors[arg.AccountID]
+	anchor := db.LedgerAnchor{
+		AccountID:    arg.AccountID,
+		FirstEntryID: arg.EntryID,
+		HeadEntryID:  arg.EntryID,
+		HeadHash:     cloneBytes(arg.Hash),
+	}
+	if ok {
+		anchor.FirstEntryID = previous.FirstEntryID
+	}
+
+	q.data.ledgerAnchors[arg.AccountID] = anchor
+	q.onRollback(func() {
+		if ok {
+			q.data.ledgerAnchors[arg.AccountID] = previous
+		} else {
+			delete(q.data.ledgerAnchors, arg.AccountID)
+		}
+	})
+	return cloneLedgerAnchor(anchor), nil
+}
@@ -0,0 +1,132 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+func (q *queries) GetLoginFailure(ctx context.Context, key string) (db.LoginFailure, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.LoginFailure{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	failure, ok := q.data.loginFailures[key]
+	if !ok {
+		return db.LoginFailure{}, sql.ErrNoRows
+	}
+	return failure, nil
+}
+
+func (q *queries) CreateLoginFailure(ctx context.Context, arg db.CreateLoginFailureParams) error {
+	if err := q.begin(ctx); err != nil {
+		return err
+	}
+	defer q.data.mu.Unlock()
+
+	if _, ok := q.data.loginFailures[arg.Key]; ok {
+		return nil
+	}
+	q.putLoginFailure(db.LoginFailure{Key: arg.Key, WindowStartedAt: arg.Now, LockedUntil: arg.Now}, db.LoginFailure{}, false)
+	return nil
+}
+
+func (q *queries) GetLoginFailureForUpdate(ctx context.Context, key string) (db.LoginFailure, error) {
+	unlock, err := q.lockLoginFailure(ctx, key)
+	if err != nil {
+		return db.LoginFailure{}, err
+	}
+	defer unlock()
+
+	return q.GetLoginFailure(ctx, key)
+}
+
+func (q *queries) UpdateLoginFailure(ctx context.Context, arg db.UpdateLoginFailureParams) (db.LoginFailure, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.LoginFailure{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	previous, ok := q.data.loginFailures[arg.Key]
+	if !ok {
+		return db.LoginFailure{}, sql.ErrNoRows
+	}
+	failure := db.LoginFailure{
+		Key:             arg.Key,
+		Failures:        arg.Failures,
+		WindowStartedAt: arg.WindowStartedAt,
+		LockedUntil:     arg.LockedUntil,
+	}
+	q.putLoginFailure(failure, previous, ok)
+	return failure, nil
+}
+
+func (q *queries) ForgiveLoginFailure(ctx context.Context, arg db.ForgiveLoginFailureParams) (db.LoginFailure, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.LoginFailure{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	previous, ok := q.data.loginFailures[arg.Key]
+	if !ok {
+		return db.LoginFailure{}, sql.ErrNoRows
+	}
+	failure := previous
+	if failure.Failures > 0 {
+		failure.Failures--
+	}
+	if now := q.now(); previous.Failures-1 < arg.MaxFailures && failure.LockedUntil.After(now) {
+		failure.LockedUntil = now
+	}
+	q.putLoginFailure(failure, previous, ok)
+	return failure, nil
+}
+
+// putLoginFailure writes failure over previous, which existed when ok, it must be called with data.mu held
+func (q *queries) putLoginFailure(failure db.LoginFailure, previous db.LoginFailure, ok bool) {
+	q.data.loginFailures[failure.Key] = failure
+	q.onRollback(func() {
+		if ok {
+			q.data.loginFailures[failure.Key] = previous
+		} else {
+			delete(q.data.loginFailures, failure.Key)
+		}
+	})
+}
+
+func (q *queries) DeleteLoginFailure(ctx context.Context, key string) (int64, error) {
+	if err := q.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer q.data.mu.Unlock()
+
+	failure, ok := q.data.loginFailures[key]
+	if !ok {
+		return 0, nil
+	}
+	delete(q.data.loginFailures, key)
+	q.onRollback(func() { q.data.loginFailures[key] = failure })
+	return 1, nil
+}
+
+func (q *queries) DeleteStaleLoginFailures(ctx context.Context, windowStart time.Time) (int64, error) {
+	if err := q.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer q.data.mu.Unlock()
+
+	now := q.now()
+	var deleted int64
+	for key, failure := range q.data.loginFailures {
+		if !failure.LockedUntil.After(now) && failure.WindowStartedAt.Before(windowStart) {
+			key, failure := key, failure
+			delete(q.data.loginFailures, key)
+			q.onRollback(func() { q.data.loginFailures[key] = failure })
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,230 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+func cloneOutbox(o db.Outbox) db.Outbox {
+	o.Payload = json.RawMessage(cloneBytes(o.Payload))
+	return o
+}
+
+func (q *queries) CreateOutboxEvent(ctx context.Context, arg db.CreateOutboxEventParams) (db.Outbox, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Outbox{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if arg.Payload == nil {
+		return db.Outbox{}, notNullViolation("outbox", "payload")
+	}
+
+	o := db.Outbox{
+		ID:            q.data.outbox.nextID(),
+		AggregateType: arg.AggregateType,
+		AggregateID:   arg.AggregateID,
+		EventType:     arg.EventType,
+		EventVersion:  arg.EventVersion,
+		Payload:       json.RawMessage(cloneBytes(arg.Payload)),
+		CreatedAt:     q.now(),
+		Status:        db.OutboxStatusPending,
+		NextAttemptAt: q.now(),
+	}
+	q.data.outbox.put(o.ID, o)
+	q.onRollback(func() { q.data.outbox.delete(o.ID) })
+	return cloneOutbox(o), nil
+}
+
+func (q *queries) GetOutboxEvent(ctx context.Context, id int64) (db.Outbox, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Outbox{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	o, ok := q.data.outbox.get(id)
+	if !ok {
+		return db.Outbox{}, sql.ErrNoRows
+	}
+	return cloneOutbox(o), nil
+}
+
+func (q *queries) ListPendingOutboxEvents(ctx context.Context, limit int32) ([]db.Outbox, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	return q.listOutboxEvents(db.OutboxStatusPending, limit, 0)
+}
+
+func (q *queries) ListDeadOutboxEvents(ctx context.Context, arg db.ListDeadOutboxEventsParams) ([]db.Outbox, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	return q.listOutboxEvents(db.OutboxStatusDead, arg.Limit, arg.Offset)
+}
+
+func (q *queries) listOutboxEvents(status string, limit int32, offset int32) ([]db.Outbox, error) {
+	var matched []db.Outbox
+	for _, o := range q.data.outbox.list() {
+		if o.Status == status {
+			matched = append(matched, o)
+		}
+	}
+
+	from, to, err := page(len(matched), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []db.Outbox{}
+	for _, o := range matched[from:to] {
+		items = append(items, cloneOutbox(o))
+	}
+	return items, nil
+}
+
+func (q *queries) HasClaimedOutboxEvents(ctx context.Context) (bool, error) {
+	if err := q.begin(ctx); err != nil {
+		return false, err
+	}
+	defer q.data.mu.Unlock()
+
+	for _, o := range q.data.outbox.list() {
+		if o.Status == db.OutboxStatusPending && o.ClaimedUntil.Valid && o.ClaimedUntil.Time.After(q.now()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (q *queries) ClaimPendingOutboxEvents(ctx context.Context, arg db.ClaimPendingOutboxEventsParams) ([]db.Outbox, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	now := q.now()
+	// the events of an aggregate wait while an earlier one backs off, so they are published in order
+	backingOff := make(map[string]bool)
+	var pending []db.Outbox
+	for _, o := range q.data.outbox.list() {
+		if o.Status != db.OutboxStatusPending {
+			continue
+		}
+		aggregate := o.AggregateType + "/" + o.AggregateID
+		if o.NextAttemptAt.After(now) {
+			backingOff[aggregate] = true
+			continue
+		}
+		if !backingOff[aggregate] {
+			pending = append(pending, o)
+		}
+	}
+
+	from, to, err := page(len(pending), arg.Size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []db.Outbox{}
+	for _, old := range pending[from:to] {
+		o := old
+		o.ClaimedUntil = sql.NullTime{Time: arg.ClaimedUntil, Valid: true}
+		q.data.outbox.put(o.ID, o)
+		q.onRollback(func() { q.data.outbox.put(old.ID, old) })
+		items = append(items, cloneOutbox(o))
+	}
+	return items, nil
+}
+
+func (q *queries) ReleaseOutboxEvents(ctx context.Context, ids []int64) error {
+	for _, id := range ids {
+		err := q.updateOutboxEvent(ctx, id, func(o *db.Outbox) {
+			o.ClaimedUntil = sql.NullTime{}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *queries) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	return q.updateOutboxEvent(ctx, id, func(o *db.Outbox) {
+		o.Status = db.OutboxStatusPublished
+		o.PublishedAt = sql.NullTime{Time: q.now(), Valid: true}
+		o.Attempts++
+		o.LastError = ""
+	})
+}
+
+func (q *queries) MarkOutboxEventFailed(ctx context.Context, arg db.MarkOutboxEventFailedParams) error {
+	return q.updateOutboxEvent(ctx, arg.ID, func(o *db.Outbox) {
+		o.Status = arg.Status
+		o.Attempts++
+		o.LastError = arg.LastError
+		o.NextAttemptAt = arg.NextAttemptAt.Round(time.Microsecond)
+	})
+}
+
+func (q *queries) updateOutboxEvent(ctx context.Context, id int64, update func(*db.Outbox)) error {
+	if err := q.begin(ctx); err != nil {
+		return err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.outbox.get(id)
+	if !ok {
+		return nil
+	}
+
+	o := old
+	update(&o)
+	q.data.outbox.put(id, o)
+	q.onRollback(func() { q.data.outbox.put(id, old) })
+	return nil
+}
+
+func (q *queries) DeletePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error) {
+	if err := q.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer q.data.mu.Unlock()
+
+	var deleted int64
+	for _, o := range q.data.outbox.list() {
+		if o.PublishedAt.Valid && o.PublishedAt.Time.Before(publishedBefore) {
+			old := o
+			q.data.outbox.delete(o.ID)
+			q.onRollback(func() { q.data.outbox.put(old.ID, old) })
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// TryAdvisoryXactLock takes the lock until the transaction ends,
+// outside of a transaction the lock is released as soon as it is taken
+func (q *queries) TryAdvisoryXactLock(ctx context.Context, lockID int64) (bool, error) {
+	if err := q.begin(ctx); err != nil {
+		return false, err
+	}
+	defer q.data.mu.Unlock()
+
+	owner, locked := q.data.advisoryLocks[lockID]
+	if locked {
+		return owner == q.tx, nil
+	}
+	if q.tx != nil {
+		q.data.advisoryLocks[lockID] = q.tx
+	}
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package memstore
+
+import (
+	"context"
+	"math"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+func (q *queries) TakeRateLimitToken(ctx context.Context, arg db.TakeRateLimitTokenParams) (db.TakeRateLimitTokenRow, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.TakeRateLimitTokenRow{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	now := q.now()
+	previous, ok := q.data.rateLimits[arg.Key]
+	bucket := db.RateLimitBucket{Key: arg.Key, Tokens: arg.Burst, UpdatedAt: now}
+	if ok {
+		elapsed := math.Max(now.Sub(previous.UpdatedAt).Seconds(), 0)
+		bucket.Tokens = math.Min(arg.Burst, previous.Tokens+elapsed*arg.Rate)
+	}
+	bucket.Allowed = bucket.Tokens >= 1
+	if bucket.Allowed {
+		bucket.Tokens--
+	}
+
+	q.data.rateLimits[arg.Key] = bucket
+	q.onRollback(func() {
+		if ok {
+			q.data.rateLimits[arg.Key] = previous
+		} else {
+			delete(q.data.rateLimits, arg.Key)
+		}
+	})
+	return db.TakeRateLimitTokenRow{Tokens: bucket.Tokens, Allowed: bucket.Allowed}, nil
+}
+
+func (q *queries) DeleteIdleRateLimitBuckets(ctx context.Context, updatedBefore time.Time) (int64, error) {
+	if err := q.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer q.data.mu.Unlock()
+
+	var deleted int64
+	for key, bucket := range q.data.rateLimits {
+		if bucket.UpdatedAt.Before(updatedBefore) {
+			key, bucket := key, bucket
+			delete(q.data.rateLimits, key)
+			q.onRollback(func() { q.data.rateLimits[key] = bucket })
+			deleted++
+		}
+	}
+	return deleted, nil
+}
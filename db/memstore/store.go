@@ -0,0 +1,278 @@
+// Package memstore keeps the simple bank tables in memory so handlers and workers
+// can be tested without a Postgres instance.
+package memstore
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+// Store is an in-memory db.Store.
+// It enforces the primary keys, unique and foreign key constraints of the migrations and reports
+// violations as *pq.Error with the code and constraint name Postgres uses, so apierror maps them the same way.
+// Transactions lock account, user and login failure rows like SELECT ... FOR UPDATE and undo their writes when they fail,
+// but other callers can read their writes before they commit.
+type Store struct {
+	*queries
+}
+
+var _ db.Store = (*Store)(nil)
+
+// New returns an empty store
+func New() *Store {
+	return &Store{
+		queries: &queries{data: newData()},
+	}
+}
+
+// SetLedgerKey sets the key of the entry hashes, call it before the store is used
+func (store *Store) SetLedgerKey(key []byte) {
+	store.data.ledgerKey = key
+}
+
+// data holds every table of the store, mu guards all of them
+type data struct {
+	mu            sync.Mutex
+	ledgerKey     []byte
+	users         map[string]db.User
+	accounts      *table[db.Account]
+	entries       *table[db.Entry]
+	transfers     *table[db.Transfer]
+	importJobs    *table[db.ImportJob]
+	importTxs     *table[db.ImportTransaction]
+	auditEvents   *table[db.AuditEvent]
+	outbox        *table[db.Outbox]
+	webhooks      *table[db.Webhook]
+	deliveries    *table[db.WebhookDelivery]
+	attempts      *table[db.WebhookAttempt]
+	ledgerAnchors map[int64]db.LedgerAnchor
+	rateLimits    map[string]db.RateLimitBucket
+	loginFailures map[string]db.LoginFailure
+	rowLocks      map[string]chan struct{}
+	advisoryLocks map[int64]*tx
+}
+
+func newData() *data {
+	return &data{
+		users:         make(map[string]db.User),
+		accounts:      newTable[db.Account](),
+		entries:       newTable[db.Entry](),
+		transfers:     newTable[db.Transfer](),
+		importJobs:    newTable[db.ImportJob](),
+		importTxs:     newTable[db.ImportTransaction](),
+		auditEvents:   newTable[db.AuditEvent](),
+		outbox:        newTable[db.Outbox](),
+		webhooks:      newTable[db.Webhook](),
+		deliveries:    newTable[db.WebhookDelivery](),
+		attempts:      newTable[db.WebhookAttempt](),
+		ledgerAnchors: make(map[int64]db.LedgerAnchor),
+		rateLimits:    make(map[string]db.RateLimitBucket),
+		loginFailures: make(map[string]db.LoginFailure),
+		rowLocks:      make(map[string]chan struct{}),
+		advisoryLocks: make(map[int64]*tx),
+	}
+}
+
+// table keeps the rows of a bigserial table in id order,
+// like a Postgres sequence the ids of rolled back rows are not reused
+type table[T any] struct {
+	seq  int64
+	ids  []int64
+	rows map[int64]T
+}
+
+func newTable[T any]() *table[T] {
+	return &table[T]{rows: make(map[int64]T)}
+}
+
+func (t *table[T]) nextID() int64 {
+	t.seq++
+	return t.seq
+}
+
+func (t *table[T]) get(id int64) (T, bool) {
+	row, ok := t.rows[id]
+	return row, ok
+}
+
+// put inserts or replaces the row with the given id
+func (t *table[T]) put(id int64, row T) {
+	if _, ok := t.rows[id]; !ok {
+		i := sort.Search(len(t.ids), func(i int) bool { return t.ids[i] >= id })
+		t.ids = append(t.ids, 0)
+		copy(t.ids[i+1:], t.ids[i:])
+		t.ids[i] = id
+	}
+	t.rows[id] = row
+}
+
+func (t *table[T]) delete(id int64) {
+	if _, ok := t.rows[id]; !ok {
+		return
+	}
+	i := sort.Search(len(t.ids), func(i int) bool { return t.ids[i] >= id })
+	t.ids = append(t.ids[:i], t.ids[i+1:]...)
+	delete(t.rows, id)
+}
+
+// list returns the rows in id order
+func (t *table[T]) list() []T {
+	rows := make([]T, 0, len(t.ids))
+	for _, id := range t.ids {
+		rows = append(rows, t.rows[id])
+	}
+	return rows
+}
+
+// tx is the state of a running transaction
+type tx struct {
+	now      time.Time
+	undo     []func()
+	rowLocks map[string]chan struct{}
+}
+
+// queries implements db.Querier, on its own every call commits immediately,
+// within a transaction the writes are undone and the locks released when it ends
+type queries struct {
+	data *data
+	tx   *tx
+}
+
+// execTX runs fn within a transaction, the writes of fn are undone when it returns an error
+func (store *Store) execTX(ctx context.Context, fn func(*queries) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t := &tx{
+		now:      now(),
+		rowLocks: make(map[string]chan struct{}),
+	}
+	err := fn(&queries{data: store.data, tx: t})
+
+	store.data.mu.Lock()
+	if err != nil {
+		for i := len(t.undo) - 1; i >= 0; i-- {
+			t.undo[i]()
+		}
+	}
+	for lockID, owner := range store.data.advisoryLocks {
+		if owner == t {
+			delete(store.data.advisoryLocks, lockID)
+		}
+	}
+	store.data.mu.Unlock()
+
+	for _, lock := range t.rowLocks {
+		<-lock
+	}
+	return err
+}
+
+// begin locks the tables for a single statement, the caller must unlock data.mu
+func (q *queries) begin(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	q.data.mu.Lock()
+	return nil
+}
+
+// onRollback registers how to undo a write, it must be called with data.mu held
+func (q *queries) onRollback(undo func()) {
+	if q.tx != nil {
+		q.tx.undo = append(q.tx.undo, undo)
+	}
+}
+
+// now is the time Postgres gives to now(): the start of the transaction or of the statement
+func (q *queries) now() time.Time {
+	if q.tx != nil {
+		return q.tx.now
+	}
+	return now()
+}
+
+// now returns the current time with the microsecond precision of timestamptz
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// lockAccount takes the row lock of an account like SELECT ... FOR UPDATE.
+// Within a transaction the lock is held until the transaction ends,
+// otherwise it is held until the returned func is called.
+// It must be called without data.mu held.
+func (q *queries) lockAccount(ctx context.Context, id int64) (unlock func(), err error) {
+	return q.lockRow(ctx, "accounts/"+strconv.FormatInt(id, 10))
+}
+
+// lockUser is lockAccount for the row of a user
+func (q *queries) lockUser(ctx context.Context, username string) (unlock func(), err error) {
+	return q.lockRow(ctx, "users/"+username)
+}
+
+// lockLoginFailure is lockAccount for the row of a login failure key
+func (q *queries) lockLoginFailure(ctx context.Context, key string) (unlock func(), err error) {
+	return q.lockRow(ctx, "login_failures/"+key)
+}
+
+// lockRow takes the lock of the row named table/key, as lockAccount says
+func (q *queries) lockRow(ctx context.Context, row string) (unlock func(), err error) {
+	if q.tx != nil {
+		if _, ok := q.tx.rowLocks[row]; ok {
+			return func() {}, nil
+		}
+	}
+
+	q.data.mu.Lock()
+	lock, ok := q.data.rowLocks[row]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		q.data.rowLocks[row] = lock
+	}
+	q.data.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if q.tx != nil {
+		q.tx.rowLocks[row] = lock
+		return func() {}, nil
+	}
+	return func() { <-lock }, nil
+}
+
+// page applies LIMIT and OFFSET to n rows and returns the bounds of the page
+func page(n int, limit int32, offset int32) (int, int, error) {
+	if limit < 0 {
+		return 0, 0, invalidLimit()
+	}
+	if offset < 0 {
+		return 0, 0, invalidOffset()
+	}
+
+	from := int(offset)
+	if from > n {
+		from = n
+	}
+	to := from + int(limit)
+	if to > n {
+		to = n
+	}
+	return from, to, nil
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,161 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/db/storetest"
+	"lesson/simple-bank/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) db.Store {
+		return New()
+	})
+}
+
+func createRandomAccount(t *testing.T, store *Store) db.Account {
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username: utils.RandomOwner(),
+		FullName: utils.RandomOwner(),
+		Email:    utils.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  100,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func TestExecTXRollback(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+	account := createRandomAccount(t, store)
+	errFailed := errors.New("failed")
+
+	var created db.Account
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		_, err = q.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: account.ID, Amount: 50})
+		require.NoError(t, err)
+		created, err = q.CreateAccount(ctx, db.CreateAccountParams{Owner: account.Owner, Currency: "EUR"})
+		require.NoError(t, err)
+		require.NoError(t, q.DeleteAccount(ctx, created.ID))
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+
+	got, err := store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance, got.Balance)
+	_, err = store.GetAccount(ctx, created.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// like a sequence, the id of the rolled back account is not reused
+	next, err := store.CreateAccount(ctx, db.CreateAccountParams{Owner: account.Owner, Currency: "EUR"})
+	require.NoError(t, err)
+	require.Greater(t, next.ID, created.ID)
+}
+
+func TestTransferTxWaitsForRowLock(t *testing.T) {
+	store := New()
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go store.execTX(context.Background(), func(q *queries) error {
+		_, err := q.GetAccountForUpdate(context.Background(), account2.ID)
+		close(locked)
+		<-release
+		return err
+	})
+	<-locked
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := store.TranserTx(ctx, db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the transfer row and the debit of account1 were undone
+	transfers, err := store.ListTransfers(context.Background(), db.ListTransfersParams{Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+	got, err := store.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, got.Balance)
+
+	close(release)
+	result, err := store.TranserTx(context.Background(), db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, account2.Balance+10, result.ToAccount.Balance)
+}
+
+func TestLedgerKey(t *testing.T) {
+	store := New()
+	store.SetLedgerKey([]byte("0123456789abcdef0123456789abcdef"))
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+
+	result, err := store.TranserTx(context.Background(), db.TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, db.EntryHash(nil, nil, account1.ID, -10, result.Transfer.ID, result.FromEntry.CreatedAt), result.FromEntry.Hash)
+
+	verified, err := store.VerifyLedger(context.Background())
+	require.NoError(t, err)
+	require.True(t, verified.Valid)
+
+	// the chains don't verify with another key
+	store.SetLedgerKey([]byte("fedcba9876543210fedcba9876543210"))
+	verified, err = store.VerifyLedger(context.Background())
+	require.NoError(t, err)
+	require.False(t, verified.Valid)
+	require.Equal(t, "hash does not match the entry content", verified.BrokenLink.Reason)
+}
+
+func TestTryAdvisoryXactLock(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	err := store.execTX(ctx, func(q *queries) error {
+		locked, err := q.TryAdvisoryXactLock(ctx, 1)
+		require.NoError(t, err)
+		require.True(t, locked)
+
+		// held by this transaction until it ends
+		locked, err = store.TryAdvisoryXactLock(ctx, 1)
+		require.NoError(t, err)
+		require.False(t, locked)
+
+		result, err := store.RelayOutboxTx(ctx, db.RelayOutboxTxParams{Limit: 10})
+		require.NoError(t, err)
+		require.True(t, result.Locked)
+		return nil
+	})
+	require.NoError(t, err)
+
+	locked, err := store.TryAdvisoryXactLock(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, locked)
+}
@@ -0,0 +1,118 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+// checkTransferAccounts enforces the foreign keys of both accounts of a transfer
+func (q *queries) checkTransferAccounts(fromAccountID int64, toAccountID int64) error {
+	if _, ok := q.data.accounts.get(fromAccountID); !ok {
+		return foreignKeyViolation("transfers", "transfers_from_account_id_fkey")
+	}
+	if _, ok := q.data.accounts.get(toAccountID); !ok {
+		return foreignKeyViolation("transfers", "transfers_to_account_id_fkey")
+	}
+	return nil
+}
+
+func (q *queries) CreateTransfer(ctx context.Context, arg db.CreateTransferParams) (db.Transfer, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Transfer{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if err := q.checkTransferAccounts(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return db.Transfer{}, err
+	}
+
+	transfer := db.Transfer{
+		ID:            q.data.transfers.nextID(),
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		CreatedAt:     q.now(),
+	}
+	q.data.transfers.put(transfer.ID, transfer)
+	q.onRollback(func() { q.data.transfers.delete(transfer.ID) })
+	return transfer, nil
+}
+
+func (q *queries) GetTransfer(ctx context.Context, id int64) (db.Transfer, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Transfer{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	transfer, ok := q.data.transfers.get(id)
+	if !ok {
+		return db.Transfer{}, sql.ErrNoRows
+	}
+	return transfer, nil
+}
+
+func (q *queries) ListTransfers(ctx context.Context, arg db.ListTransfersParams) ([]db.Transfer, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	transfers := q.data.transfers.list()
+	from, to, err := page(len(transfers), arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return transfers[from:to], nil
+}
+
+func (q *queries) UpdateTransfers(ctx context.Context, arg db.UpdateTransfersParams) (db.Transfer, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Transfer{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.transfers.get(arg.ID)
+	if !ok {
+		return db.Transfer{}, sql.ErrNoRows
+	}
+	if err := q.checkTransferAccounts(arg.FromAccountID, arg.ToAccountID); err != nil {
+		return db.Transfer{}, err
+	}
+
+	transfer := old
+	transfer.FromAccountID = arg.FromAccountID
+	transfer.ToAccountID = arg.ToAccountID
+	transfer.Amount = arg.Amount
+	q.data.transfers.put(transfer.ID, transfer)
+	q.onRollback(func() { q.data.transfers.put(old.ID, old) })
+	return transfer, nil
+}
+
+func (q *queries) DeleteTransfer(ctx context.Context, id int64) error {
+	if err := q.begin(ctx); err != nil {
+		return err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.transfers.get(id)
+	if !ok {
+		return nil
+	}
+
+	for _, importTx := range q.data.importTxs.rows {
+		if importTx.TransferID.Valid && importTx.TransferID.Int64 == id {
+			return referencedViolation("transfers", "import_transactions_transfer_id_fkey", "import_transactions")
+		}
+	}
+	for _, entry := range q.data.entries.rows {
+		if entry.TransferID.Valid && entry.TransferID.Int64 == id {
+			return referencedViolation("transfers", "entries_transfer_id_fkey", "entries")
+		}
+	}
+
+	q.data.transfers.delete(id)
+	q.onRollback(func() { q.data.transfers.put(id, old) })
+	return nil
+}
@@ -0,0 +1,508 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/event"
+)
+
+// the transactions below follow the ones of db.SQLStore step by step,
+// the conformance suite in db/storetest checks that both stores behave the same
+
+// CreateUserTx creates a user, records it in the audit log and publishes UserCreated
+func (store *Store) CreateUserTx(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	var user db.User
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		user, err = q.CreateUser(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		err = recordAuditEvent(ctx, q, db.AuditActionCreateUser, "user", user.Username, nil, db.NewAuditUser(user))
+		if err != nil {
+			return
+		}
+
+		return enqueueEvent(ctx, q, event.AggregateUser, user.Username, event.UserCreatedV1{
+			Username: user.Username,
+			FullName: user.FullName,
+			Email:    user.Email,
+		})
+	})
+
+	return user, err
+}
+
+// CreateAccountTx creates an account, records it in the audit log and publishes AccountOpened
+func (store *Store) CreateAccountTx(ctx context.Context, arg db.CreateAccountParams) (db.Account, error) {
+	var account db.Account
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		account, err = q.CreateAccount(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		accountID := strconv.FormatInt(account.ID, 10)
+		err = recordAuditEvent(ctx, q, db.AuditActionCreateAccount, "account", accountID, nil, account)
+		if err != nil {
+			return
+		}
+
+		return enqueueEvent(ctx, q, event.AggregateAccount, accountID, event.AccountOpenedV1{
+			AccountID: account.ID,
+			Owner:     account.Owner,
+			Currency:  account.Currency,
+			Balance:   account.Balance,
+		})
+	})
+
+	return account, err
+}
+
+// UpdateUserRoleTx changes the role of a user and records it in the audit log
+func (store *Store) UpdateUserRoleTx(ctx context.Context, arg db.UpdateUserRoleParams) (db.User, error) {
+	var user db.User
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		before, err := q.GetUserForUpdate(ctx, arg.Username)
+		if err != nil {
+			return
+		}
+
+		user, err = q.UpdateUserRole(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		return recordAuditEvent(ctx, q, db.AuditActionUpdateUserRole, "user", user.Username, db.NewAuditUser(before), db.NewAuditUser(user))
+	})
+
+	return user, err
+}
+
+// SetAccountFrozenTx freezes or unfreezes an account and records it in the audit log
+func (store *Store) SetAccountFrozenTx(ctx context.Context, arg db.SetAccountFrozenParams) (db.Account, error) {
+	var account db.Account
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		before, err := q.GetAccountForUpdate(ctx, arg.ID)
+		if err != nil {
+			return
+		}
+
+		account, err = q.SetAccountFrozen(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		action := db.AuditActionUnfreezeAccount
+		if arg.Frozen {
+			action = db.AuditActionFreezeAccount
+		}
+		return recordAuditEvent(ctx, q, action, "account", strconv.FormatInt(account.ID, 10), before, account)
+	})
+
+	return account, err
+}
+
+// CreateWebhookTx registers a webhook and records it in the audit log, its secret is left out of the log
+func (store *Store) CreateWebhookTx(ctx context.Context, arg db.CreateWebhookParams) (db.Webhook, error) {
+	var webhook db.Webhook
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		webhook, err = q.CreateWebhook(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		return recordAuditEvent(ctx, q, db.AuditActionCreateWebhook, "webhook", strconv.FormatInt(webhook.ID, 10), nil, db.NewAuditWebhook(webhook))
+	})
+
+	return webhook, err
+}
+
+// DeleteWebhookTx deletes a webhook with its deliveries and records it in the audit log,
+// it fails with sql.ErrNoRows when the webhook doesn't exist anymore
+func (store *Store) DeleteWebhookTx(ctx context.Context, id int64) error {
+	return store.execTX(ctx, func(q *queries) error {
+		before, err := q.GetWebhook(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := q.DeleteWebhook(ctx, id)
+		if err != nil {
+			return err
+		}
+		// a concurrent request deleted it first
+		if deleted == 0 {
+			return sql.ErrNoRows
+		}
+
+		return recordAuditEvent(ctx, q, db.AuditActionDeleteWebhook, "webhook", strconv.FormatInt(id, 10), db.NewAuditWebhook(before), nil)
+	})
+}
+
+// TranserTx performs a money transfer from one account to another account.
+// The account rows are locked in id order until the transaction ends, so concurrent transfers
+// between the same accounts in both directions are serialized instead of deadlocking.
+func (store *Store) TranserTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	var result db.TransferTxResult
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		result.Transfer, err = q.CreateTransfer(ctx, db.CreateTransferParams(arg))
+		if err != nil {
+			return
+		}
+
+		if arg.FromAccountID < arg.ToAccountID {
+			result.FromAccount, result.ToAccount, err = addMoney(ctx, q, arg.FromAccountID, -arg.Amount, arg.ToAccountID, arg.Amount)
+		} else {
+			result.ToAccount, result.FromAccount, err = addMoney(ctx, q, arg.ToAccountID, arg.Amount, arg.FromAccountID, -arg.Amount)
+		}
+		if err != nil {
+			return
+		}
+
+		for _, account := range []db.Account{result.FromAccount, result.ToAccount} {
+			if account.Frozen {
+				return &db.AccountFrozenError{AccountID: account.ID}
+			}
+		}
+		if result.FromAccount.Balance < 0 {
+			return &db.InsufficientFundsError{
+				AccountID: result.FromAccount.ID,
+				Balance:   result.FromAccount.Balance + arg.Amount,
+				Currency:  result.FromAccount.Currency,
+			}
+		}
+
+		result.FromEntry, err = appendLedgerEntry(ctx, q, arg.FromAccountID, -arg.Amount, result.Transfer.ID)
+		if err != nil {
+			return
+		}
+
+		result.ToEntry, err = appendLedgerEntry(ctx, q, arg.ToAccountID, arg.Amount, result.Transfer.ID)
+		if err != nil {
+			return
+		}
+
+		transferID := strconv.FormatInt(result.Transfer.ID, 10)
+		err = recordAuditEvent(ctx, q, db.AuditActionCreateTransfer, "transfer", transferID, nil, result)
+		if err != nil {
+			return
+		}
+
+		return enqueueEvent(ctx, q, event.AggregateTransfer, transferID, event.TransferCreatedV1{
+			TransferID:    result.Transfer.ID,
+			FromAccountID: result.Transfer.FromAccountID,
+			ToAccountID:   result.Transfer.ToAccountID,
+			Amount:        result.Transfer.Amount,
+			Currency:      result.FromAccount.Currency,
+		})
+	})
+
+	return result, err
+}
+
+func addMoney(ctx context.Context, q *queries, account1ID int64, amount1 int64, account2ID int64, amount2 int64) (account1 db.Account, account2 db.Account, err error) {
+	account1, err = q.AddAccountBalance(ctx, db.AddAccountBalanceParams{
+		ID:     account1ID,
+		Amount: amount1,
+	})
+	if err != nil {
+		return
+	}
+	account2, err = q.AddAccountBalance(ctx, db.AddAccountBalanceParams{
+		ID:     account2ID,
+		Amount: amount2,
+	})
+	return
+}
+
+// appendLedgerEntry appends an entry to the hash chain of its account and moves the anchor of the account to it,
+// the caller must already hold the row lock of the account so the chain can't fork
+func appendLedgerEntry(ctx context.Context, q *queries, accountID int64, amount int64, transferID int64) (db.Entry, error) {
+	var prevHash []byte
+	last, err := q.GetLastAccountEntry(ctx, accountID)
+	if err != nil && err != sql.ErrNoRows {
+		return db.Entry{}, err
+	}
+	if err == nil {
+		prevHash = last.Hash
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	entry, err := q.CreateLedgerEntry(ctx, db.CreateLedgerEntryParams{
+		AccountID:  accountID,
+		Amount:     amount,
+		TransferID: sql.NullInt64{Int64: transferID, Valid: true},
+		PrevHash:   prevHash,
+		Hash:       db.EntryHash(q.data.ledgerKey, prevHash, accountID, amount, transferID, createdAt),
+		CreatedAt:  createdAt,
+	})
+	if err != nil {
+		return entry, err
+	}
+
+	_, err = q.AdvanceLedgerAnchor(ctx, db.AdvanceLedgerAnchorParams{
+		AccountID: accountID,
+		EntryID:   entry.ID,
+		Hash:      entry.Hash,
+	})
+	return entry, err
+}
+
+// recordAuditEvent appends an audit event with the state before and after the change
+func recordAuditEvent(ctx context.Context, q *queries, action string, resourceType string, resourceID string, before interface{}, after interface{}) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	meta := db.AuditMetaFrom(ctx)
+	_, err = q.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		Actor:        meta.Actor,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Before:       beforeJSON,
+		After:        afterJSON,
+		RequestID:    meta.RequestID,
+		ClientIp:     meta.ClientIP,
+		UserAgent:    meta.UserAgent,
+	})
+	return err
+}
+
+// enqueueEvent writes a domain event to the outbox
+func enqueueEvent(ctx context.Context, q *queries, aggregateType string, aggregateID string, payload event.Payload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     payload.EventType(),
+		EventVersion:  payload.EventVersion(),
+		Payload:       data,
+	})
+	return err
+}
+
+// CreateImportJobTx registers an import job and all of its pending transactions in a single transaction,
+// a file whose message id the owner already imported fails on the unique owner and message_id constraint
+func (store *Store) CreateImportJobTx(ctx context.Context, arg db.CreateImportJobTxParams) (db.CreateImportJobTxResult, error) {
+	var result db.CreateImportJobTxResult
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		result.Job, err = q.CreateImportJob(ctx, db.CreateImportJobParams{
+			Owner:           arg.Owner,
+			MessageID:       arg.MessageID,
+			MessageName:     arg.MessageName,
+			InitiatingParty: arg.InitiatingParty,
+			TxCount:         int64(len(arg.Transactions)),
+			ClaimedUntil:    arg.LeaseUntil,
+		})
+		if err != nil {
+			return
+		}
+
+		result.Transactions = make([]db.ImportTransaction, 0, len(arg.Transactions))
+		for _, txArg := range arg.Transactions {
+			txArg.JobID = result.Job.ID
+			importTx, err := q.CreateImportTransaction(ctx, txArg)
+			if err != nil {
+				return err
+			}
+			result.Transactions = append(result.Transactions, importTx)
+		}
+
+		return recordAuditEvent(ctx, q, db.AuditActionCreateImportJob, "import_job", strconv.FormatInt(result.Job.ID, 10), nil, result.Job)
+	})
+
+	return result, err
+}
+
+// outboxRelayLockID is the advisory lock key held by the active outbox relay
+const outboxRelayLockID = 0x6f7574626f78
+
+// RelayOutboxTx claims a batch of pending events, publishes them in id order outside of a transaction
+// and marks them in a second one, once an event of an aggregate fails the following events
+// of the same aggregate wait until it is published or dead-lettered
+func (store *Store) RelayOutboxTx(ctx context.Context, arg db.RelayOutboxTxParams) (db.RelayOutboxTxResult, error) {
+	var result db.RelayOutboxTxResult
+	var events []db.Outbox
+
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		result.Locked, err = q.TryAdvisoryXactLock(ctx, outboxRelayLockID)
+		if err != nil || !result.Locked {
+			return
+		}
+
+		claimed, err := q.HasClaimedOutboxEvents(ctx)
+		if err != nil || claimed {
+			result.Locked = false
+			return
+		}
+
+		events, err = q.ClaimPendingOutboxEvents(ctx, db.ClaimPendingOutboxEventsParams{
+			ClaimedUntil: arg.LeaseUntil,
+			Size:         arg.Limit,
+		})
+		return
+	})
+	if err != nil || len(events) == 0 {
+		return result, err
+	}
+
+	// the events not published before the claim expires are left for the next run
+	publishCtx, cancel := context.WithDeadline(ctx, arg.LeaseUntil)
+	defer cancel()
+
+	var published []int64
+	var failed []db.MarkOutboxEventFailedParams
+	blocked := make(map[string]bool)
+	for _, o := range events {
+		if publishCtx.Err() != nil {
+			break
+		}
+		aggregate := o.AggregateType + "/" + o.AggregateID
+		if blocked[aggregate] {
+			continue
+		}
+
+		if pubErr := arg.Publish(publishCtx, o.Envelope()); pubErr != nil {
+			if publishCtx.Err() != nil {
+				break
+			}
+			blocked[aggregate] = true
+			failed = append(failed, arg.FailedEvent(o, pubErr))
+			continue
+		}
+		published = append(published, o.ID)
+	}
+
+	ids := make([]int64, len(events))
+	for i, o := range events {
+		ids[i] = o.ID
+	}
+	err = store.execTX(ctx, func(q *queries) (err error) {
+		for _, id := range published {
+			if err = q.MarkOutboxEventPublished(ctx, id); err != nil {
+				return
+			}
+		}
+		for _, arg := range failed {
+			if err = q.MarkOutboxEventFailed(ctx, arg); err != nil {
+				return
+			}
+		}
+		return q.ReleaseOutboxEvents(ctx, ids)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Published = len(published)
+	result.Failed = len(failed)
+	return result, nil
+}
+
+// LoginAttemptTx counts a login as a failure of each key before its password is compared
+func (store *Store) LoginAttemptTx(ctx context.Context, arg db.LoginAttemptTxParams) (db.LoginAttemptTxResult, error) {
+	var result db.LoginAttemptTxResult
+
+	order := arg.LockOrder()
+	err := store.execTX(ctx, func(q *queries) (err error) {
+		now := time.Now()
+		failures := make([]db.LoginFailure, len(arg.Keys))
+		for _, i := range order {
+			err = q.CreateLoginFailure(ctx, db.CreateLoginFailureParams{Key: arg.Keys[i].Key, Now: now})
+			if err != nil {
+				return
+			}
+			failures[i], err = q.GetLoginFailureForUpdate(ctx, arg.Keys[i].Key)
+			if err != nil {
+				return
+			}
+			if wait := failures[i].LockedUntil.Sub(now); wait > result.Wait {
+				result.Wait = wait
+			}
+		}
+		if result.Wait > 0 {
+			return nil
+		}
+
+		for _, i := range order {
+			failures[i], err = q.UpdateLoginFailure(ctx, arg.CountFailure(i, failures[i], now))
+			if err != nil {
+				return
+			}
+		}
+		result.Failures = failures
+		return nil
+	})
+
+	return result, err
+}
+
+// VerifyLedger recomputes the hash chain of every account and reports the first broken link
+func (store *Store) VerifyLedger(ctx context.Context) (db.VerifyLedgerResult, error) {
+	anchors, err := store.ListLedgerAnchors(ctx)
+	if err != nil {
+		return db.VerifyLedgerResult{}, err
+	}
+	v := db.NewLedgerVerifier(store.data.ledgerKey, anchors)
+
+	entries, err := store.ListEntriesAfter(ctx, db.ListEntriesAfterParams{Size: math.MaxInt32})
+	if err != nil {
+		return v.Result(), err
+	}
+	return verifyEntries(v, entries), nil
+}
+
+// VerifyAccountLedger recomputes the hash chain of a single account
+func (store *Store) VerifyAccountLedger(ctx context.Context, accountID int64) (db.VerifyLedgerResult, error) {
+	var anchors []db.LedgerAnchor
+	anchor, err := store.GetLedgerAnchor(ctx, accountID)
+	switch {
+	case err == nil:
+		anchors = append(anchors, anchor)
+	case !errors.Is(err, sql.ErrNoRows):
+		return db.VerifyLedgerResult{}, err
+	}
+	v := db.NewLedgerVerifier(store.data.ledgerKey, anchors)
+
+	entries, err := store.ListAccountEntries(ctx, accountID)
+	if err != nil {
+		return v.Result(), err
+	}
+	return verifyEntries(v, entries), nil
+}
+
+// verifyEntries checks the entries up to the first broken link, then the heads of the chains
+func verifyEntries(v *db.LedgerVerifier, entries []db.Entry) db.VerifyLedgerResult {
+	for _, entry := range entries {
+		if !v.Check(entry) {
+			return v.Result()
+		}
+	}
+	v.Finish()
+	return v.Result()
+}
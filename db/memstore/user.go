@@ -0,0 +1,85 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/utils"
+)
+
+func (q *queries) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if _, ok := q.data.users[arg.Username]; ok {
+		return db.User{}, uniqueViolation("users", "users_pkey")
+	}
+	for _, user := range q.data.users {
+		if user.Email == arg.Email {
+			return db.User{}, uniqueViolation("users", "users_email_key")
+		}
+	}
+
+	user := db.User{
+		Username:         arg.Username,
+		HashedPassword:   arg.HashedPassword,
+		FullName:         arg.FullName,
+		Email:            arg.Email,
+		PasswordChangeAt: q.now(),
+		CreatedAt:        q.now(),
+		Role:             utils.DepositorRole,
+	}
+	q.data.users[user.Username] = user
+	q.onRollback(func() { delete(q.data.users, user.Username) })
+	return user, nil
+}
+
+func (q *queries) GetUser(ctx context.Context, username string) (db.User, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	user, ok := q.data.users[username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (q *queries) GetUserForUpdate(ctx context.Context, username string) (db.User, error) {
+	unlock, err := q.lockUser(ctx, username)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer unlock()
+
+	return q.GetUser(ctx, username)
+}
+
+func (q *queries) UpdateUserRole(ctx context.Context, arg db.UpdateUserRoleParams) (db.User, error) {
+	unlock, err := q.lockUser(ctx, arg.Username)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer unlock()
+
+	if err := q.begin(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.users[arg.Username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+
+	user := old
+	user.Role = arg.Role
+	q.data.users[user.Username] = user
+	q.onRollback(func() { q.data.users[old.Username] = old })
+	return user, nil
+}
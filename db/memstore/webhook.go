@@ -0,0 +1,308 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+// status of a webhook delivery until it succeeds or is given up
+const pendingDeliveryStatus = "pending"
+
+func cloneWebhook(webhook db.Webhook) db.Webhook {
+	webhook.EventTypes = append([]string{}, webhook.EventTypes...)
+	return webhook
+}
+
+func cloneDelivery(delivery db.WebhookDelivery) db.WebhookDelivery {
+	delivery.Payload = json.RawMessage(cloneBytes(delivery.Payload))
+	return delivery
+}
+
+func (q *queries) CreateWebhook(ctx context.Context, arg db.CreateWebhookParams) (db.Webhook, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Webhook{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if arg.EventTypes == nil {
+		return db.Webhook{}, notNullViolation("webhooks", "event_types")
+	}
+	if _, ok := q.data.users[arg.Owner]; !ok {
+		return db.Webhook{}, foreignKeyViolation("webhooks", "webhooks_owner_fkey")
+	}
+
+	webhook := db.Webhook{
+		ID:         q.data.webhooks.nextID(),
+		Owner:      arg.Owner,
+		Url:        arg.Url,
+		EventTypes: append([]string{}, arg.EventTypes...),
+		Secret:     arg.Secret,
+		CreatedAt:  q.now(),
+	}
+	q.data.webhooks.put(webhook.ID, webhook)
+	q.onRollback(func() { q.data.webhooks.delete(webhook.ID) })
+	return cloneWebhook(webhook), nil
+}
+
+func (q *queries) GetWebhook(ctx context.Context, id int64) (db.Webhook, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.Webhook{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	webhook, ok := q.data.webhooks.get(id)
+	if !ok {
+		return db.Webhook{}, sql.ErrNoRows
+	}
+	return cloneWebhook(webhook), nil
+}
+
+func (q *queries) ListWebhooks(ctx context.Context, owner string) ([]db.Webhook, error) {
+	return q.listWebhooks(ctx, func(webhook db.Webhook) bool {
+		return webhook.Owner == owner
+	})
+}
+
+// ListSubscribedWebhooks lists the webhooks of the owner subscribed to the event type,
+// a webhook without event types is subscribed to all of them
+func (q *queries) ListSubscribedWebhooks(ctx context.Context, arg db.ListSubscribedWebhooksParams) ([]db.Webhook, error) {
+	return q.listWebhooks(ctx, func(webhook db.Webhook) bool {
+		if webhook.Owner != arg.Owner {
+			return false
+		}
+		if len(webhook.EventTypes) == 0 {
+			return true
+		}
+		for _, eventType := range webhook.EventTypes {
+			if eventType == arg.EventType {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (q *queries) listWebhooks(ctx context.Context, match func(db.Webhook) bool) ([]db.Webhook, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	items := []db.Webhook{}
+	for _, webhook := range q.data.webhooks.list() {
+		if match(webhook) {
+			items = append(items, cloneWebhook(webhook))
+		}
+	}
+	return items, nil
+}
+
+// DeleteWebhook also deletes the deliveries of the webhook and their attempts
+func (q *queries) DeleteWebhook(ctx context.Context, id int64) (int64, error) {
+	if err := q.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer q.data.mu.Unlock()
+
+	webhook, ok := q.data.webhooks.get(id)
+	if !ok {
+		return 0, nil
+	}
+
+	q.data.webhooks.delete(id)
+	q.onRollback(func() { q.data.webhooks.put(id, webhook) })
+
+	for _, delivery := range q.data.deliveries.list() {
+		if delivery.WebhookID != id {
+			continue
+		}
+		for _, attempt := range q.data.attempts.list() {
+			if attempt.DeliveryID == delivery.ID {
+				attempt := attempt
+				q.data.attempts.delete(attempt.ID)
+				q.onRollback(func() { q.data.attempts.put(attempt.ID, attempt) })
+			}
+		}
+		delivery := delivery
+		q.data.deliveries.delete(delivery.ID)
+		q.onRollback(func() { q.data.deliveries.put(delivery.ID, delivery) })
+	}
+	return 1, nil
+}
+
+// CreateWebhookDelivery returns the existing delivery when the event was already queued for the webhook
+func (q *queries) CreateWebhookDelivery(ctx context.Context, arg db.CreateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.WebhookDelivery{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if arg.Payload == nil {
+		return db.WebhookDelivery{}, notNullViolation("webhook_deliveries", "payload")
+	}
+	if arg.EventID.Valid {
+		for _, delivery := range q.data.deliveries.list() {
+			if delivery.WebhookID == arg.WebhookID && delivery.EventID == arg.EventID {
+				return cloneDelivery(delivery), nil
+			}
+		}
+	}
+	if _, ok := q.data.webhooks.get(arg.WebhookID); !ok {
+		return db.WebhookDelivery{}, foreignKeyViolation("webhook_deliveries", "webhook_deliveries_webhook_id_fkey")
+	}
+
+	delivery := db.WebhookDelivery{
+		ID:            q.data.deliveries.nextID(),
+		WebhookID:     arg.WebhookID,
+		EventID:       arg.EventID,
+		EventType:     arg.EventType,
+		Payload:       json.RawMessage(cloneBytes(arg.Payload)),
+		Status:        pendingDeliveryStatus,
+		NextAttemptAt: q.now(),
+		CreatedAt:     q.now(),
+	}
+	q.data.deliveries.put(delivery.ID, delivery)
+	q.onRollback(func() { q.data.deliveries.delete(delivery.ID) })
+	return cloneDelivery(delivery), nil
+}
+
+func (q *queries) GetWebhookDelivery(ctx context.Context, id int64) (db.WebhookDelivery, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.WebhookDelivery{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	delivery, ok := q.data.deliveries.get(id)
+	if !ok {
+		return db.WebhookDelivery{}, sql.ErrNoRows
+	}
+	return cloneDelivery(delivery), nil
+}
+
+func (q *queries) ListWebhookDeliveries(ctx context.Context, arg db.ListWebhookDeliveriesParams) ([]db.WebhookDelivery, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	var deliveries []db.WebhookDelivery
+	all := q.data.deliveries.list()
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].WebhookID == arg.WebhookID {
+			deliveries = append(deliveries, all[i])
+		}
+	}
+
+	from, to, err := page(len(deliveries), arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []db.WebhookDelivery{}
+	for _, delivery := range deliveries[from:to] {
+		items = append(items, cloneDelivery(delivery))
+	}
+	return items, nil
+}
+
+// ClaimDueWebhookDeliveries leases the pending deliveries that are due until leaseUntil,
+// the earliest due first
+func (q *queries) ClaimDueWebhookDeliveries(ctx context.Context, arg db.ClaimDueWebhookDeliveriesParams) ([]db.WebhookDelivery, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	now := q.now()
+	var due []db.WebhookDelivery
+	for _, delivery := range q.data.deliveries.list() {
+		if delivery.Status == pendingDeliveryStatus && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+
+	from, to, err := page(len(due), arg.Size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []db.WebhookDelivery{}
+	for _, old := range due[from:to] {
+		old := old
+		delivery := old
+		delivery.NextAttemptAt = arg.LeaseUntil.Round(time.Microsecond)
+		q.data.deliveries.put(delivery.ID, delivery)
+		q.onRollback(func() { q.data.deliveries.put(old.ID, old) })
+		items = append(items, cloneDelivery(delivery))
+	}
+	return items, nil
+}
+
+func (q *queries) UpdateWebhookDelivery(ctx context.Context, arg db.UpdateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.WebhookDelivery{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	old, ok := q.data.deliveries.get(arg.ID)
+	if !ok {
+		return db.WebhookDelivery{}, sql.ErrNoRows
+	}
+
+	delivery := old
+	delivery.Status = arg.Status
+	delivery.Attempts = arg.Attempts
+	delivery.NextAttemptAt = arg.NextAttemptAt.Round(time.Microsecond)
+	delivery.LastStatusCode = arg.LastStatusCode
+	delivery.LastError = arg.LastError
+	delivery.DeliveredAt = arg.DeliveredAt
+	q.data.deliveries.put(delivery.ID, delivery)
+	q.onRollback(func() { q.data.deliveries.put(old.ID, old) })
+	return cloneDelivery(delivery), nil
+}
+
+func (q *queries) CreateWebhookAttempt(ctx context.Context, arg db.CreateWebhookAttemptParams) (db.WebhookAttempt, error) {
+	if err := q.begin(ctx); err != nil {
+		return db.WebhookAttempt{}, err
+	}
+	defer q.data.mu.Unlock()
+
+	if _, ok := q.data.deliveries.get(arg.DeliveryID); !ok {
+		return db.WebhookAttempt{}, foreignKeyViolation("webhook_attempts", "webhook_attempts_delivery_id_fkey")
+	}
+
+	attempt := db.WebhookAttempt{
+		ID:         q.data.attempts.nextID(),
+		DeliveryID: arg.DeliveryID,
+		StatusCode: arg.StatusCode,
+		Error:      arg.Error,
+		DurationMs: arg.DurationMs,
+		CreatedAt:  q.now(),
+	}
+	q.data.attempts.put(attempt.ID, attempt)
+	q.onRollback(func() { q.data.attempts.delete(attempt.ID) })
+	return attempt, nil
+}
+
+func (q *queries) ListWebhookAttempts(ctx context.Context, deliveryID int64) ([]db.WebhookAttempt, error) {
+	if err := q.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer q.data.mu.Unlock()
+
+	items := []db.WebhookAttempt{}
+	for _, attempt := range q.data.attempts.list() {
+		if attempt.DeliveryID == deliveryID {
+			items = append(items, attempt)
+		}
+	}
+	return items, nil
+}
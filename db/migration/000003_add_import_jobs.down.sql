@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "import_transactions";
+
+DROP TABLE IF EXISTS "import_jobs";
@@ -0,0 +1,35 @@
+CREATE TABLE "import_jobs" (
+  "id" bigserial PRIMARY KEY,
+  "message_id" varchar UNIQUE NOT NULL,
+  "message_name" varchar NOT NULL,
+  "initiating_party" varchar NOT NULL,
+  "tx_count" bigint NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'PDNG',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "finished_at" timestamptz
+);
+
+CREATE TABLE "import_transactions" (
+  "id" bigserial PRIMARY KEY,
+  "job_id" bigint NOT NULL,
+  "payment_info_id" varchar NOT NULL,
+  "end_to_end_id" varchar NOT NULL,
+  "from_account_id" bigint NOT NULL,
+  "to_account_id" bigint NOT NULL,
+  "amount" bigint NOT NULL,
+  "currency" varchar NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'PDNG',
+  "reason_code" varchar NOT NULL DEFAULT '',
+  "transfer_id" bigint,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "import_transactions" ("job_id");
+
+COMMENT ON COLUMN "import_jobs"."message_id" IS 'GrpHdr/MsgId of the uploaded pain.001 file';
+
+COMMENT ON COLUMN "import_transactions"."reason_code" IS 'ISO 20022 status reason code, empty when accepted';
+
+ALTER TABLE "import_transactions" ADD FOREIGN KEY ("job_id") REFERENCES "import_jobs" ("id");
+
+ALTER TABLE "import_transactions" ADD FOREIGN KEY ("transfer_id") REFERENCES "transfers" ("id");
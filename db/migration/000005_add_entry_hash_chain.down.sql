@@ -0,0 +1,5 @@
+ALTER TABLE IF EXISTS "entries" DROP COLUMN IF EXISTS "hash";
+
+ALTER TABLE IF EXISTS "entries" DROP COLUMN IF EXISTS "prev_hash";
+
+ALTER TABLE IF EXISTS "entries" DROP COLUMN IF EXISTS "transfer_id";
@@ -0,0 +1,11 @@
+ALTER TABLE "entries" ADD COLUMN "transfer_id" bigint;
+
+ALTER TABLE "entries" ADD COLUMN "prev_hash" bytea;
+
+ALTER TABLE "entries" ADD COLUMN "hash" bytea;
+
+COMMENT ON COLUMN "entries"."prev_hash" IS 'hash of the previous entry of the same account, null for the first chained entry';
+
+COMMENT ON COLUMN "entries"."hash" IS 'sha256 of (prev_hash, account_id, amount, transfer_id, created_at), null for entries posted before the chain existed';
+
+ALTER TABLE "entries" ADD FOREIGN KEY ("transfer_id") REFERENCES "transfers" ("id");
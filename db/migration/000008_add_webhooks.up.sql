@@ -0,0 +1,54 @@
+CREATE TABLE "webhooks" (
+  "id" bigserial PRIMARY KEY,
+  "owner" varchar NOT NULL,
+  "url" varchar NOT NULL,
+  "event_types" varchar[] NOT NULL DEFAULT '{}',
+  "secret" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webhook_deliveries" (
+  "id" bigserial PRIMARY KEY,
+  "webhook_id" bigint NOT NULL,
+  "event_id" bigint,
+  "event_type" varchar NOT NULL,
+  "payload" jsonb NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "attempts" int NOT NULL DEFAULT 0,
+  "next_attempt_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_status_code" int NOT NULL DEFAULT 0,
+  "last_error" varchar NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "delivered_at" timestamptz
+);
+
+CREATE TABLE "webhook_attempts" (
+  "id" bigserial PRIMARY KEY,
+  "delivery_id" bigint NOT NULL,
+  "status_code" int NOT NULL,
+  "error" varchar NOT NULL,
+  "duration_ms" bigint NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "webhooks" ("owner");
+
+CREATE UNIQUE INDEX ON "webhook_deliveries" ("webhook_id", "event_id");
+
+CREATE INDEX ON "webhook_deliveries" ("next_attempt_at") WHERE "status" = 'pending';
+
+CREATE INDEX ON "webhook_attempts" ("delivery_id");
+
+COMMENT ON COLUMN "webhooks"."event_types" IS 'event types delivered to the endpoint, empty for every type';
+
+COMMENT ON COLUMN "webhook_deliveries"."event_id" IS 'outbox id of the event, null for test events';
+
+COMMENT ON COLUMN "webhook_deliveries"."status" IS 'pending, succeeded or dead';
+
+COMMENT ON COLUMN "webhook_attempts"."status_code" IS '0 when no response was received';
+
+ALTER TABLE "webhooks" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+ALTER TABLE "webhook_deliveries" ADD FOREIGN KEY ("webhook_id") REFERENCES "webhooks" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "webhook_attempts" ADD FOREIGN KEY ("delivery_id") REFERENCES "webhook_deliveries" ("id") ON DELETE CASCADE;
@@ -0,0 +1,19 @@
+CREATE FUNCTION notify_account_entry() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('account_entries', json_build_object(
+    'entry_id', NEW.id,
+    'account_id', NEW.account_id,
+    'amount', NEW.amount,
+    'balance', (SELECT balance FROM accounts WHERE id = NEW.account_id),
+    'transfer_id', NEW.transfer_id,
+    'created_at', NEW.created_at
+  )::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON FUNCTION notify_account_entry() IS 'notifications are only delivered once the inserting transaction commits';
+
+CREATE TRIGGER entries_notify
+AFTER INSERT ON "entries"
+FOR EACH ROW EXECUTE FUNCTION notify_account_entry();
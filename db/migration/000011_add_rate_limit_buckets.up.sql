@@ -0,0 +1,13 @@
+-- unlogged: a crash only refills the buckets
+CREATE UNLOGGED TABLE "rate_limit_buckets" (
+  "key" varchar PRIMARY KEY,
+  "tokens" double precision NOT NULL,
+  "allowed" boolean NOT NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "rate_limit_buckets" ("updated_at");
+
+COMMENT ON TABLE "rate_limit_buckets" IS 'token buckets of the rate limiter shared by the server instances';
+
+COMMENT ON COLUMN "rate_limit_buckets"."allowed" IS 'whether the last request took a token';
@@ -0,0 +1,14 @@
+CREATE TABLE "login_failures" (
+  "key" varchar PRIMARY KEY,
+  "failures" int NOT NULL,
+  "window_started_at" timestamptz NOT NULL DEFAULT (now()),
+  "locked_until" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON TABLE "login_failures" IS 'failed logins by username and by client IP';
+
+COMMENT ON COLUMN "login_failures"."key" IS 'user: or ip: followed by the username or the client IP';
+
+COMMENT ON COLUMN "login_failures"."window_started_at" IS 'time of the first failure counted, the count starts over once the window ends';
+
+COMMENT ON COLUMN "login_failures"."locked_until" IS 'the logins of the key are refused until then';
@@ -0,0 +1,27 @@
+CREATE TABLE "ledger_anchors" (
+  "account_id" bigint PRIMARY KEY,
+  "first_entry_id" bigint NOT NULL,
+  "head_entry_id" bigint NOT NULL,
+  "head_hash" bytea NOT NULL
+);
+
+COMMENT ON TABLE "ledger_anchors" IS 'where the hash chain of an account starts and ends, so removed or unchained entries are detected';
+
+COMMENT ON COLUMN "ledger_anchors"."first_entry_id" IS 'the first chained entry of the account, every later entry must be chained';
+
+COMMENT ON COLUMN "ledger_anchors"."head_entry_id" IS 'the last chained entry of the account';
+
+COMMENT ON COLUMN "ledger_anchors"."head_hash" IS 'hash of the last chained entry of the account';
+
+ALTER TABLE "ledger_anchors" ADD FOREIGN KEY ("account_id") REFERENCES "accounts" ("id");
+
+-- anchor the chains posted before this migration
+INSERT INTO "ledger_anchors" ("account_id", "first_entry_id", "head_entry_id", "head_hash")
+SELECT DISTINCT ON ("account_id")
+  "account_id",
+  MIN("id") OVER (PARTITION BY "account_id"),
+  "id",
+  "hash"
+FROM "entries"
+WHERE "hash" IS NOT NULL
+ORDER BY "account_id", "id" DESC;
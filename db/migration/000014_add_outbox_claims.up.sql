@@ -0,0 +1,3 @@
+ALTER TABLE "outbox" ADD COLUMN "claimed_until" timestamptz;
+
+COMMENT ON COLUMN "outbox"."claimed_until" IS 'the relay publishing the event holds it until then';
@@ -0,0 +1,5 @@
+ALTER TABLE "import_jobs" DROP CONSTRAINT IF EXISTS "import_jobs_owner_message_id_key";
+
+ALTER TABLE "import_jobs" ADD CONSTRAINT "import_jobs_message_id_key" UNIQUE ("message_id");
+
+ALTER TABLE "import_jobs" DROP COLUMN IF EXISTS "owner";
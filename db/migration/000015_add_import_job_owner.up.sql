@@ -0,0 +1,26 @@
+ALTER TABLE "import_jobs" ADD COLUMN "owner" varchar;
+
+COMMENT ON COLUMN "import_jobs"."owner" IS 'the user who uploaded the file, only they can read the job';
+
+-- the jobs uploaded before this migration belong to the owner of the account their first transaction debits
+UPDATE "import_jobs" AS j
+SET "owner" = a."owner"
+FROM (
+  SELECT DISTINCT ON ("job_id") "job_id", "from_account_id"
+  FROM "import_transactions"
+  ORDER BY "job_id", "id"
+) AS t
+JOIN "accounts" AS a ON a."id" = t."from_account_id"
+WHERE j."id" = t."job_id";
+
+-- a job without transactions can't be attributed to anyone, and there is nothing to read in it
+DELETE FROM "import_jobs" WHERE "owner" IS NULL;
+
+ALTER TABLE "import_jobs" ALTER COLUMN "owner" SET NOT NULL;
+
+ALTER TABLE "import_jobs" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+-- a message id only has to be unique among the files of a user
+ALTER TABLE "import_jobs" DROP CONSTRAINT "import_jobs_message_id_key";
+
+ALTER TABLE "import_jobs" ADD CONSTRAINT "import_jobs_owner_message_id_key" UNIQUE ("owner", "message_id");
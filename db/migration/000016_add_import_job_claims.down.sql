@@ -0,0 +1 @@
+ALTER TABLE "import_jobs" DROP COLUMN IF EXISTS "claimed_until";
@@ -0,0 +1,5 @@
+ALTER TABLE "import_jobs" ADD COLUMN "claimed_until" timestamptz NOT NULL DEFAULT (now());
+
+COMMENT ON COLUMN "import_jobs"."claimed_until" IS 'the instance booking a pending job holds it until then, another one resumes it afterwards';
+
+CREATE INDEX ON "import_jobs" ("claimed_until") WHERE "status" = 'PDNG';
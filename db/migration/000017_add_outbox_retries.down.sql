@@ -0,0 +1,3 @@
+ALTER TABLE "outbox" DROP COLUMN IF EXISTS "next_attempt_at";
+
+ALTER TABLE "outbox" DROP COLUMN IF EXISTS "status";
@@ -0,0 +1,13 @@
+ALTER TABLE "outbox" ADD COLUMN "status" varchar NOT NULL DEFAULT 'pending';
+
+ALTER TABLE "outbox" ADD COLUMN "next_attempt_at" timestamptz NOT NULL DEFAULT (now());
+
+UPDATE "outbox" SET "status" = 'published' WHERE "published_at" IS NOT NULL;
+
+COMMENT ON COLUMN "outbox"."status" IS 'pending, published, or dead once the relay gave up after too many attempts';
+
+COMMENT ON COLUMN "outbox"."next_attempt_at" IS 'a failed event is not published again before then';
+
+CREATE INDEX ON "outbox" ("next_attempt_at") WHERE "status" = 'pending';
+
+CREATE INDEX ON "outbox" ("aggregate_type", "aggregate_id") WHERE "status" = 'pending';
@@ -0,0 +1 @@
+COMMENT ON COLUMN "entries"."hash" IS 'sha256 of (prev_hash, account_id, amount, transfer_id, created_at), null for entries posted before the chain existed';
@@ -0,0 +1 @@
+COMMENT ON COLUMN "entries"."hash" IS 'hmac-sha256 keyed with LEDGERKEY of (prev_hash, account_id, amount, transfer_id, created_at), null for entries posted before the chain existed';
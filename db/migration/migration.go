@@ -0,0 +1,206 @@
+// Package migration embeds the schema migrations so they ship with the binaries that apply them
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// FS holds the golang-migrate up and down files of the schema
+//
+//go:embed *.sql
+var FS embed.FS
+
+// startupLockID is the advisory lock key held while a replica checks and migrates the schema on startup
+const startupLockID = 0x6d696772617465
+
+// NilVersion is the version of a schema without any applied migration, Force takes it to start over
+const NilVersion = database.NilVersion
+
+// ErrSchemaAhead is returned when the database was migrated by a newer binary
+var ErrSchemaAhead = errors.New("schema version is ahead of the migrations of this binary")
+
+// ErrNotLatest is returned when the schema is not at the version of the newest embedded migration
+var ErrNotLatest = errors.New("schema is not at the latest version")
+
+// ErrDirty is returned when a migration failed halfway, the schema has to be fixed by hand and forced to a version
+var ErrDirty = errors.New("schema is dirty")
+
+// Migrator applies the embedded migrations to a database
+type Migrator struct {
+	conn   *sql.DB
+	m      *migrate.Migrate
+	latest uint
+}
+
+// NewMigrator returns a migrator of the database, closing the migrator also closes conn
+func NewMigrator(conn *sql.DB) (*Migrator, error) {
+	src, err := iofs.New(FS, ".")
+	if err != nil {
+		return nil, err
+	}
+	latest, err := latestVersion(src)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := postgres.WithInstance(conn, &postgres.Config{})
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{conn: conn, m: m, latest: latest}, nil
+}
+
+func latestVersion(src source.Driver) (uint, error) {
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// Latest returns the version of the newest embedded migration
+func (migrator *Migrator) Latest() uint {
+	return migrator.latest
+}
+
+// Version returns the current version of the schema, 0 when no migration was applied
+func (migrator *Migrator) Version() (version uint, dirty bool, err error) {
+	version, dirty, err = migrator.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return
+}
+
+// Up applies all pending migrations, or only the next n when n > 0
+func (migrator *Migrator) Up(n int) error {
+	if n > 0 {
+		return ignoreNoChange(migrator.m.Steps(n))
+	}
+	return ignoreNoChange(migrator.m.Up())
+}
+
+// Down reverts all applied migrations, or only the last n when n > 0
+func (migrator *Migrator) Down(n int) error {
+	if n > 0 {
+		return ignoreNoChange(migrator.m.Steps(-n))
+	}
+	return ignoreNoChange(migrator.m.Down())
+}
+
+// Goto migrates up or down to the version
+func (migrator *Migrator) Goto(version uint) error {
+	return ignoreNoChange(migrator.m.Migrate(version))
+}
+
+// Force sets the version and clears the dirty flag without running any migration
+func (migrator *Migrator) Force(version int) error {
+	return migrator.m.Force(version)
+}
+
+// Check fails when the schema is dirty or ahead of the embedded migrations
+func (migrator *Migrator) Check() error {
+	version, dirty, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirty, version)
+	}
+	if version > migrator.latest {
+		return fmt.Errorf("%w: database is at %d, binary knows up to %d", ErrSchemaAhead, version, migrator.latest)
+	}
+	return nil
+}
+
+// Startup checks the schema and applies the pending migrations when apply is set.
+// It holds an advisory lock meanwhile so replicas starting together check and migrate one after the other.
+func (migrator *Migrator) Startup(ctx context.Context, apply bool) error {
+	conn, err := migrator.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", startupLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", startupLockID)
+
+	if err := migrator.Check(); err != nil {
+		return err
+	}
+	if apply {
+		return migrator.Up(0)
+	}
+	return nil
+}
+
+// Close releases the database connection of the migrator
+func (migrator *Migrator) Close() error {
+	srcErr, dbErr := migrator.m.Close()
+	if srcErr != nil {
+		return srcErr
+	}
+	return dbErr
+}
+
+// CheckLatest fails unless the schema of conn is clean and at the version of the newest embedded migration.
+// It only reads the version table, so unlike a Migrator it can share the connection pool of the server.
+func CheckLatest(ctx context.Context, conn *sql.DB) error {
+	src, err := iofs.New(FS, ".")
+	if err != nil {
+		return err
+	}
+	latest, err := latestVersion(src)
+	if err != nil {
+		return err
+	}
+
+	var version int64
+	var dirty bool
+	err = conn.QueryRowContext(ctx, "SELECT version, dirty FROM "+postgres.DefaultMigrationsTable+" LIMIT 1").Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirty, version)
+	}
+	if version != int64(latest) {
+		return fmt.Errorf("%w: database is at %d, binary expects %d", ErrNotLatest, version, latest)
+	}
+	return nil
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package migration_test
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+
+	"lesson/simple-bank/db/dbtest"
+	"lesson/simple-bank/db/migration"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator(t *testing.T) {
+	migrator, err := migration.NewMigrator(dbtest.NewDB(t))
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	files, err := fs.Glob(migration.FS, "*.up.sql")
+	require.NoError(t, err)
+	latest := migrator.Latest()
+	require.Equal(t, uint(len(files)), latest)
+
+	// the test database is fully migrated
+	version, dirty, err := migrator.Version()
+	require.NoError(t, err)
+	require.False(t, dirty)
+	require.Equal(t, latest, version)
+	require.NoError(t, migrator.Up(0))
+
+	require.NoError(t, migrator.Down(1))
+	version, _, err = migrator.Version()
+	require.NoError(t, err)
+	require.Equal(t, latest-1, version)
+
+	require.NoError(t, migrator.Goto(1))
+	version, _, err = migrator.Version()
+	require.NoError(t, err)
+	require.Equal(t, uint(1), version)
+
+	require.NoError(t, migrator.Startup(context.Background(), true))
+	version, _, err = migrator.Version()
+	require.NoError(t, err)
+	require.Equal(t, latest, version)
+}
+
+func TestMigratorSchemaAhead(t *testing.T) {
+	migrator, err := migration.NewMigrator(dbtest.NewDB(t))
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	require.NoError(t, migrator.Force(int(migrator.Latest())+1))
+	require.ErrorIs(t, migrator.Check(), migration.ErrSchemaAhead)
+	require.ErrorIs(t, migrator.Startup(context.Background(), true), migration.ErrSchemaAhead)
+}
+
+func TestMigratorForceNilVersion(t *testing.T) {
+	migrator, err := migration.NewMigrator(dbtest.NewDB(t))
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	require.NoError(t, migrator.Force(migration.NilVersion))
+	version, dirty, err := migrator.Version()
+	require.NoError(t, err)
+	require.False(t, dirty)
+	require.Equal(t, uint(0), version)
+}
+
+func TestCheckLatest(t *testing.T) {
+	conn := dbtest.NewDB(t)
+	require.NoError(t, migration.CheckLatest(context.Background(), conn))
+
+	migrator, err := migration.NewMigrator(conn)
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	require.NoError(t, migrator.Down(1))
+	require.ErrorIs(t, migration.CheckLatest(context.Background(), conn), migration.ErrNotLatest)
+
+	require.NoError(t, migrator.Force(int(migrator.Latest())))
+	require.NoError(t, migration.CheckLatest(context.Background(), conn))
+}
@@ -23,6 +23,13 @@ ORDER BY id
 LIMIT $1
 OFFSET $2;
 
+-- name: ListOwnerAccounts :many
+SELECT * FROM accounts
+WHERE owner = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3;
+
 -- name: UpdateAccount :one
 UPDATE accounts 
 SET balance = $1
@@ -37,4 +44,10 @@ RETURNING *;
 
 -- name: DeleteAccount :exec
 DELETE FROM accounts 
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: SetAccountFrozen :one
+UPDATE accounts
+SET frozen = sqlc.arg(frozen)
+WHERE id = sqlc.arg(id)
+RETURNING *;
@@ -0,0 +1,28 @@
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (
+  actor,
+  action,
+  resource_type,
+  resource_id,
+  before,
+  after,
+  request_id,
+  client_ip,
+  user_agent
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg(actor)::varchar IS NULL OR actor = sqlc.narg(actor))
+AND (sqlc.narg(action)::varchar IS NULL OR action = sqlc.narg(action))
+AND (sqlc.narg(resource_type)::varchar IS NULL OR resource_type = sqlc.narg(resource_type))
+AND (sqlc.narg(resource_id)::varchar IS NULL OR resource_id = sqlc.narg(resource_id))
+AND (sqlc.narg(request_id)::varchar IS NULL OR request_id = sqlc.narg(request_id))
+AND (sqlc.narg(created_from)::timestamptz IS NULL OR created_at >= sqlc.narg(created_from))
+AND (sqlc.narg(created_to)::timestamptz IS NULL OR created_at < sqlc.narg(created_to))
+ORDER BY id DESC
+LIMIT sqlc.arg(size)
+OFFSET sqlc.arg(skip);
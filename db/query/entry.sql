@@ -25,4 +25,45 @@ RETURNING *;
 
 -- name: DeleteEntry :exec
 DELETE FROM entries 
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: CreateLedgerEntry :one
+INSERT INTO entries (
+    account_id,
+    amount,
+    transfer_id,
+    prev_hash,
+    hash,
+    created_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetLastAccountEntry :one
+SELECT * FROM entries
+WHERE account_id = $1
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListAccountEntries :many
+SELECT * FROM entries
+WHERE account_id = $1
+ORDER BY id;
+
+-- name: ListEntriesAfter :many
+SELECT * FROM entries
+WHERE id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(size);
+
+-- name: ListAccountEntriesAfter :many
+SELECT e.id, e.account_id, e.amount, e.transfer_id, e.created_at,
+  (a.balance - COALESCE(SUM(e.amount) OVER (
+    ORDER BY e.id DESC ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+  ), 0))::bigint AS balance
+FROM entries e
+JOIN accounts a ON a.id = e.account_id
+WHERE e.account_id = sqlc.arg(account_id) AND e.id > sqlc.arg(after_id)
+ORDER BY e.id
+LIMIT sqlc.arg(size);
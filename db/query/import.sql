@@ -0,0 +1,69 @@
+-- name: CreateImportJob :one
+INSERT INTO import_jobs (
+  owner,
+  message_id,
+  message_name,
+  initiating_party,
+  tx_count,
+  claimed_until
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetImportJob :one
+SELECT * FROM import_jobs
+WHERE id = $1 LIMIT 1;
+
+-- name: GetImportJobByMessageID :one
+SELECT * FROM import_jobs
+WHERE owner = $1 AND message_id = $2 LIMIT 1;
+
+-- name: UpdateImportJobStatus :one
+UPDATE import_jobs
+SET status = $1, finished_at = $2
+WHERE id = $3
+RETURNING *;
+
+-- name: ClaimStaleImportJobs :many
+UPDATE import_jobs
+SET claimed_until = sqlc.arg(lease_until)::timestamptz
+WHERE id IN (
+  SELECT id FROM import_jobs
+  WHERE status = 'PDNG' AND claimed_until <= now()
+  ORDER BY id
+  LIMIT sqlc.arg(size)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RenewImportJobClaim :one
+UPDATE import_jobs
+SET claimed_until = sqlc.arg(lease_until)::timestamptz
+WHERE id = sqlc.arg(id) AND claimed_until = sqlc.arg(claimed_until)::timestamptz
+RETURNING *;
+
+-- name: CreateImportTransaction :one
+INSERT INTO import_transactions (
+  job_id,
+  payment_info_id,
+  end_to_end_id,
+  from_account_id,
+  to_account_id,
+  amount,
+  currency
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: ListImportTransactions :many
+SELECT * FROM import_transactions
+WHERE job_id = $1
+ORDER BY id;
+
+-- name: UpdateImportTransaction :one
+UPDATE import_transactions
+SET status = $1, reason_code = $2, transfer_id = $3
+WHERE id = $4
+RETURNING *;
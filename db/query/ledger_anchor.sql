@@ -0,0 +1,21 @@
+-- name: GetLedgerAnchor :one
+SELECT * FROM ledger_anchors
+WHERE account_id = $1 LIMIT 1;
+
+-- name: ListLedgerAnchors :many
+SELECT * FROM ledger_anchors
+ORDER BY account_id;
+
+-- name: AdvanceLedgerAnchor :one
+INSERT INTO ledger_anchors (
+    account_id,
+    first_entry_id,
+    head_entry_id,
+    head_hash
+) VALUES (
+  sqlc.arg(account_id), sqlc.arg(entry_id), sqlc.arg(entry_id), sqlc.arg(hash)
+)
+ON CONFLICT (account_id) DO UPDATE
+SET head_entry_id = EXCLUDED.head_entry_id,
+    head_hash = EXCLUDED.head_hash
+RETURNING *;
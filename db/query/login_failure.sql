@@ -0,0 +1,46 @@
+-- name: GetLoginFailure :one
+SELECT * FROM login_failures
+WHERE key = $1 LIMIT 1;
+
+-- name: CreateLoginFailure :exec
+-- adds key without failures unless it has a row already
+INSERT INTO login_failures (
+  key,
+  failures,
+  window_started_at,
+  locked_until
+) VALUES (
+  sqlc.arg(key), 0, sqlc.arg(now), sqlc.arg(now)
+)
+ON CONFLICT (key) DO NOTHING;
+
+-- name: GetLoginFailureForUpdate :one
+SELECT * FROM login_failures
+WHERE key = $1 LIMIT 1
+FOR NO KEY UPDATE;
+
+-- name: UpdateLoginFailure :one
+UPDATE login_failures
+SET
+  failures = sqlc.arg(failures),
+  window_started_at = sqlc.arg(window_started_at),
+  locked_until = sqlc.arg(locked_until)
+WHERE key = sqlc.arg(key)
+RETURNING *;
+
+-- name: ForgiveLoginFailure :one
+-- takes back a failure counted for key, which unlocks it once it has less than max_failures
+UPDATE login_failures
+SET
+  failures = GREATEST(failures - 1, 0),
+  locked_until = CASE WHEN failures - 1 < sqlc.arg(max_failures)::int THEN LEAST(locked_until, now()) ELSE locked_until END
+WHERE key = sqlc.arg(key)
+RETURNING *;
+
+-- name: DeleteLoginFailure :execrows
+DELETE FROM login_failures
+WHERE key = $1;
+
+-- name: DeleteStaleLoginFailures :execrows
+DELETE FROM login_failures
+WHERE locked_until <= now() AND window_started_at < sqlc.arg(window_start)::timestamptz;
@@ -0,0 +1,80 @@
+-- name: CreateOutboxEvent :one
+INSERT INTO outbox (
+  aggregate_type,
+  aggregate_id,
+  event_type,
+  event_version,
+  payload
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetOutboxEvent :one
+SELECT * FROM outbox
+WHERE id = $1 LIMIT 1;
+
+-- name: ListPendingOutboxEvents :many
+SELECT * FROM outbox
+WHERE status = 'pending'
+ORDER BY id
+LIMIT $1;
+
+-- name: ListDeadOutboxEvents :many
+SELECT * FROM outbox
+WHERE status = 'dead'
+ORDER BY id
+LIMIT $1
+OFFSET $2;
+
+-- name: HasClaimedOutboxEvents :one
+SELECT EXISTS (
+  SELECT 1 FROM outbox
+  WHERE status = 'pending' AND claimed_until > now()
+);
+
+-- name: ClaimPendingOutboxEvents :many
+UPDATE outbox
+SET claimed_until = sqlc.arg(claimed_until)::timestamptz
+WHERE id IN (
+  SELECT o.id FROM outbox o
+  WHERE o.status = 'pending' AND o.next_attempt_at <= now()
+  -- the events of an aggregate wait while an earlier one backs off, so they are published in order
+  AND NOT EXISTS (
+    SELECT 1 FROM outbox earlier
+    WHERE earlier.aggregate_type = o.aggregate_type
+    AND earlier.aggregate_id = o.aggregate_id
+    AND earlier.status = 'pending'
+    AND earlier.id < o.id
+    AND earlier.next_attempt_at > now()
+  )
+  ORDER BY o.id
+  LIMIT sqlc.arg(size)
+)
+RETURNING *;
+
+-- name: ReleaseOutboxEvents :exec
+UPDATE outbox
+SET claimed_until = NULL
+WHERE id = ANY(sqlc.arg(ids)::bigint[]);
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET status = 'published', published_at = now(), attempts = attempts + 1, last_error = ''
+WHERE id = $1;
+
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox
+SET
+  status = $1,
+  attempts = attempts + 1,
+  last_error = $2,
+  next_attempt_at = $3
+WHERE id = $4;
+
+-- name: DeletePublishedOutboxEvents :execrows
+DELETE FROM outbox
+WHERE published_at < sqlc.arg(published_before)::timestamptz;
+
+-- name: TryAdvisoryXactLock :one
+SELECT pg_try_advisory_xact_lock(sqlc.arg(lock_id)::bigint);
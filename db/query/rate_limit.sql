@@ -0,0 +1,19 @@
+-- name: TakeRateLimitToken :one
+-- refills the bucket of key at rate tokens per second up to burst, then takes a token if one is left
+INSERT INTO rate_limit_buckets AS bucket (
+  key,
+  tokens,
+  allowed
+) VALUES (
+  sqlc.arg(key), sqlc.arg(burst)::float8 - 1, true
+)
+ON CONFLICT (key) DO UPDATE SET
+  tokens = LEAST(sqlc.arg(burst)::float8, bucket.tokens + GREATEST(EXTRACT(EPOCH FROM now() - bucket.updated_at), 0) * sqlc.arg(rate)::float8)
+    - CASE WHEN LEAST(sqlc.arg(burst)::float8, bucket.tokens + GREATEST(EXTRACT(EPOCH FROM now() - bucket.updated_at), 0) * sqlc.arg(rate)::float8) >= 1 THEN 1 ELSE 0 END,
+  allowed = LEAST(sqlc.arg(burst)::float8, bucket.tokens + GREATEST(EXTRACT(EPOCH FROM now() - bucket.updated_at), 0) * sqlc.arg(rate)::float8) >= 1,
+  updated_at = now()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < sqlc.arg(updated_before)::timestamptz;
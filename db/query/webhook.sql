@@ -0,0 +1,92 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (
+  owner,
+  url,
+  event_types,
+  secret
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1 LIMIT 1;
+
+-- name: ListWebhooks :many
+SELECT * FROM webhooks
+WHERE owner = $1
+ORDER BY id;
+
+-- name: ListSubscribedWebhooks :many
+SELECT * FROM webhooks
+WHERE owner = sqlc.arg(owner)
+AND (cardinality(event_types) = 0 OR sqlc.arg(event_type)::varchar = ANY(event_types))
+ORDER BY id;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (
+  webhook_id,
+  event_id,
+  event_type,
+  payload
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (webhook_id, event_id) DO UPDATE SET webhook_id = EXCLUDED.webhook_id
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 LIMIT 1;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY id DESC
+LIMIT $2
+OFFSET $3;
+
+-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until)::timestamptz
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = 'pending' AND next_attempt_at <= now()
+  ORDER BY next_attempt_at
+  LIMIT sqlc.arg(size)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateWebhookDelivery :one
+UPDATE webhook_deliveries
+SET
+  status = $1,
+  attempts = $2,
+  next_attempt_at = $3,
+  last_status_code = $4,
+  last_error = $5,
+  delivered_at = $6
+WHERE id = $7
+RETURNING *;
+
+-- name: CreateWebhookAttempt :one
+INSERT INTO webhook_attempts (
+  delivery_id,
+  status_code,
+  error,
+  duration_ms
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListWebhookAttempts :many
+SELECT * FROM webhook_attempts
+WHERE delivery_id = $1
+ORDER BY id;
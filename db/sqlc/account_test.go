@@ -2,18 +2,22 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 
+	"lesson/simple-bank/db/dbtest"
 	"lesson/simple-bank/utils"
 
 	"github.com/stretchr/testify/require"
 )
 
-func CreateRandomAccount(t *testing.T) Account {
-	user := CreateRandomUser(t)
+func CreateRandomAccount(t *testing.T, testDB *sql.DB) Account {
+	testQueries := New(testDB)
+	user := CreateRandomUser(t, testDB)
 	arg := CreateAccountParams {
 		Owner: user.Username,
-		Balance: utils.RandomMoney(),
+		// enough for the transfers of the store tests, TranserTx refuses to overdraw
+		Balance: utils.RandomInt(200, 1000),
 		Currency: utils.RandomCurrency(),	
 	}
 	account, err := testQueries.CreateAccount(context.Background(), arg)
@@ -28,11 +32,14 @@ func CreateRandomAccount(t *testing.T) Account {
 }
 
 func TestCreateAccount(t *testing.T) {
-	CreateRandomAccount(t)
+	testDB := dbtest.NewDB(t)
+	CreateRandomAccount(t, testDB)
 }
 
 func TestGetAccount(t *testing.T) {
-	account1 := CreateRandomAccount(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	account1 := CreateRandomAccount(t, testDB)
 	account2, err := testQueries.GetAccount(context.Background(), account1.ID)
 	require.NoError(t, err)
 	require.NotEmpty(t, account2)
@@ -46,8 +53,10 @@ func TestGetAccount(t *testing.T) {
 }
 
 func TestListAccount(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
 	for i := 0; i < 10; i++ {
-		CreateRandomAccount(t)
+		CreateRandomAccount(t, testDB)
 	}
 	arg := ListAccountParams{
 		Offset: 5,
@@ -59,7 +68,9 @@ func TestListAccount(t *testing.T) {
 }
 
 func TestUpdateAccount(t *testing.T) {
-	account1 := CreateRandomAccount(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	account1 := CreateRandomAccount(t, testDB)
 	arg := UpdateAccountParams{
 		ID: account1.ID,
 		Balance: utils.RandomMoney(),
@@ -75,7 +86,9 @@ func TestUpdateAccount(t *testing.T) {
 }
 
 func TestDeleteAccount(t *testing.T) {
-	account1 := CreateRandomAccount(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	account1 := CreateRandomAccount(t, testDB)
 	err := testQueries.DeleteAccount(context.Background(), account1.ID)
 	require.NoError(t, err)
 
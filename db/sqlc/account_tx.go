@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"lesson/simple-bank/event"
+	"strconv"
+)
+
+// CreateAccountTx creates an account, records it in the audit log and publishes AccountOpened
+func (store *SQLStore) CreateAccountTx(ctx context.Context, arg CreateAccountParams) (Account, error) {
+	var account Account
+
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		account, err = q.CreateAccount(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		accountID := strconv.FormatInt(account.ID, 10)
+		err = recordAuditEvent(ctx, q, AuditActionCreateAccount, "account", accountID, nil, account)
+		if err != nil {
+			return
+		}
+
+		return enqueueEvent(ctx, q, event.AggregateAccount, accountID, event.AccountOpenedV1{
+			AccountID: account.ID,
+			Owner:     account.Owner,
+			Currency:  account.Currency,
+			Balance:   account.Balance,
+		})
+	})
+
+	return account, err
+}
+
+// SetAccountFrozenTx freezes or unfreezes an account and records it in the audit log
+func (store *SQLStore) SetAccountFrozenTx(ctx context.Context, arg SetAccountFrozenParams) (Account, error) {
+	var account Account
+
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		before, err := q.GetAccountForUpdate(ctx, arg.ID)
+		if err != nil {
+			return
+		}
+
+		account, err = q.SetAccountFrozen(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		return recordAuditEvent(ctx, q, frozenAuditAction(arg.Frozen), "account", strconv.FormatInt(account.ID, 10), before, account)
+	})
+
+	return account, err
+}
+
+// frozenAuditAction is the audit action of freezing an account, or of unfreezing it
+func frozenAuditAction(frozen bool) string {
+	if frozen {
+		return AuditActionFreezeAccount
+	}
+	return AuditActionUnfreezeAccount
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Audit actions recorded by the store transactions
+const (
+	AuditActionCreateUser      = "user.create"
+	AuditActionCreateAccount   = "account.create"
+	AuditActionCreateTransfer  = "transfer.create"
+	AuditActionCreateImportJob = "import_job.create"
+	AuditActionUpdateUserRole  = "user.update_role"
+	AuditActionFreezeAccount   = "account.freeze"
+	AuditActionUnfreezeAccount = "account.unfreeze"
+	AuditActionCreateWebhook   = "webhook.create"
+	AuditActionDeleteWebhook   = "webhook.delete"
+)
+
+// Audit actions recorded by the server for the reloads of its config
+const (
+	AuditActionReloadConfig = "config.reload"
+	AuditActionRejectConfig = "config.reload_rejected"
+)
+
+// Audit actions recorded for the login lockouts
+const (
+	AuditActionLockLogin   = "login.lock"
+	AuditActionUnlockLogin = "login.unlock"
+)
+
+// AuditMeta describes who issued the request that changes the state
+type AuditMeta struct {
+	Actor     string
+	RequestID string
+	ClientIP  string
+	UserAgent string
+}
+
+type auditMetaKey struct{}
+
+// WithAuditMeta returns a copy of ctx carrying the audit metadata of the request
+func WithAuditMeta(ctx context.Context, meta AuditMeta) context.Context {
+	return context.WithValue(ctx, auditMetaKey{}, meta)
+}
+
+// AuditMetaFrom returns the audit metadata of ctx, empty for calls outside of a request
+func AuditMetaFrom(ctx context.Context) AuditMeta {
+	meta, _ := ctx.Value(auditMetaKey{}).(AuditMeta)
+	return meta
+}
+
+// recordAuditEvent appends an audit event with the state before and after the change,
+// it must be called with the queries of the transaction making the change
+func recordAuditEvent(ctx context.Context, q *Queries, action string, resourceType string, resourceID string, before interface{}, after interface{}) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	meta := AuditMetaFrom(ctx)
+	_, err = q.CreateAuditEvent(ctx, CreateAuditEventParams{
+		Actor:        meta.Actor,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Before:       beforeJSON,
+		After:        afterJSON,
+		RequestID:    meta.RequestID,
+		ClientIp:     meta.ClientIP,
+		UserAgent:    meta.UserAgent,
+	})
+	return err
+}
+
+// AuditUser is the state of a user kept in the audit log, without the password hash
+type AuditUser struct {
+	Username  string    `json:"username"`
+	FullName  string    `json:"full_name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewAuditUser(user User) AuditUser {
+	return AuditUser{
+		Username:  user.Username,
+		FullName:  user.FullName,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// AuditWebhook is the state of a webhook kept in the audit log, without its signing secret
+type AuditWebhook struct {
+	ID         int64     `json:"id"`
+	Owner      string    `json:"owner"`
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func NewAuditWebhook(webhook Webhook) AuditWebhook {
+	return AuditWebhook{
+		ID:         webhook.ID,
+		Owner:      webhook.Owner,
+		Url:        webhook.Url,
+		EventTypes: webhook.EventTypes,
+		CreatedAt:  webhook.CreatedAt,
+	}
+}
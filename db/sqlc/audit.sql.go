@@ -0,0 +1,141 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.17.0
+// source: audit.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+const createAuditEvent = `-- name: CreateAuditEvent :one
+INSERT INTO audit_events (
+  actor,
+  action,
+  resource_type,
+  resource_id,
+  before,
+  after,
+  request_id,
+  client_ip,
+  user_agent
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING id, actor, action, resource_type, resource_id, before, after, request_id, client_ip, user_agent, created_at
+`
+
+type CreateAuditEventParams struct {
+	Actor        string          `json:"actor"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Before       json.RawMessage `json:"before"`
+	After        json.RawMessage `json:"after"`
+	RequestID    string          `json:"request_id"`
+	ClientIp     string          `json:"client_ip"`
+	UserAgent    string          `json:"user_agent"`
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error) {
+	row := q.db.QueryRowContext(ctx, createAuditEvent,
+		arg.Actor,
+		arg.Action,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.Before,
+		arg.After,
+		arg.RequestID,
+		arg.ClientIp,
+		arg.UserAgent,
+	)
+	var i AuditEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Actor,
+		&i.Action,
+		&i.ResourceType,
+		&i.ResourceID,
+		&i.Before,
+		&i.After,
+		&i.RequestID,
+		&i.ClientIp,
+		&i.UserAgent,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAuditEvents = `-- name: ListAuditEvents :many
+SELECT id, actor, action, resource_type, resource_id, before, after, request_id, client_ip, user_agent, created_at FROM audit_events
+WHERE ($1::varchar IS NULL OR actor = $1)
+AND ($2::varchar IS NULL OR action = $2)
+AND ($3::varchar IS NULL OR resource_type = $3)
+AND ($4::varchar IS NULL OR resource_id = $4)
+AND ($5::varchar IS NULL OR request_id = $5)
+AND ($6::timestamptz IS NULL OR created_at >= $6)
+AND ($7::timestamptz IS NULL OR created_at < $7)
+ORDER BY id DESC
+LIMIT $9
+OFFSET $8
+`
+
+type ListAuditEventsParams struct {
+	Actor        sql.NullString `json:"actor"`
+	Action       sql.NullString `json:"action"`
+	ResourceType sql.NullString `json:"resource_type"`
+	ResourceID   sql.NullString `json:"resource_id"`
+	RequestID    sql.NullString `json:"request_id"`
+	CreatedFrom  sql.NullTime   `json:"created_from"`
+	CreatedTo    sql.NullTime   `json:"created_to"`
+	Skip         int32          `json:"skip"`
+	Size         int32          `json:"size"`
+}
+
+func (q *Queries) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEvents,
+		arg.Actor,
+		arg.Action,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.RequestID,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Skip,
+		arg.Size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditEvent{}
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.Actor,
+			&i.Action,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Before,
+			&i.After,
+			&i.RequestID,
+			&i.ClientIp,
+			&i.UserAgent,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"lesson/simple-bank/db/dbtest"
+	"lesson/simple-bank/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomAuditMeta() AuditMeta {
+	return AuditMeta{
+		Actor:     utils.RandomOwner(),
+		RequestID: utils.RandomString(16),
+		ClientIP:  "127.0.0.1",
+		UserAgent: "audit-test",
+	}
+}
+
+func listRequestAuditEvents(t *testing.T, testDB *sql.DB, requestID string) []AuditEvent {
+	testQueries := New(testDB)
+	events, err := testQueries.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		RequestID: sql.NullString{String: requestID, Valid: true},
+		Size:      10,
+	})
+	require.NoError(t, err)
+	return events
+}
+
+func TestCreateUserTxAudit(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+	meta := randomAuditMeta()
+	ctx := WithAuditMeta(context.Background(), meta)
+
+	hashPd, err := utils.HashedPassword(utils.RandomString(6))
+	require.NoError(t, err)
+	user, err := testStore.CreateUserTx(ctx, CreateUserParams{
+		Username:       utils.RandomOwner(),
+		HashedPassword: hashPd,
+		FullName:       utils.RandomOwner(),
+		Email:          utils.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	events := listRequestAuditEvents(t, testDB, meta.RequestID)
+	require.Len(t, events, 1)
+
+	event := events[0]
+	require.Equal(t, meta.Actor, event.Actor)
+	require.Equal(t, AuditActionCreateUser, event.Action)
+	require.Equal(t, "user", event.ResourceType)
+	require.Equal(t, user.Username, event.ResourceID)
+	require.Equal(t, meta.ClientIP, event.ClientIp)
+	require.Equal(t, meta.UserAgent, event.UserAgent)
+	require.JSONEq(t, "null", string(event.Before))
+	require.NotContains(t, string(event.After), "hashed_password")
+	require.NotContains(t, string(event.After), hashPd)
+}
+
+func TestTransferTxAudit(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+	meta := randomAuditMeta()
+	ctx := WithAuditMeta(context.Background(), meta)
+
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
+	result, err := testStore.TranserTx(ctx, TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.NoError(t, err)
+
+	events := listRequestAuditEvents(t, testDB, meta.RequestID)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditActionCreateTransfer, events[0].Action)
+	require.Equal(t, strconv.FormatInt(result.Transfer.ID, 10), events[0].ResourceID)
+
+	var after TransferTxResult
+	require.NoError(t, json.Unmarshal(events[0].After, &after))
+	require.Equal(t, result.Transfer.ID, after.Transfer.ID)
+	require.Equal(t, result.FromAccount.Balance, after.FromAccount.Balance)
+}
+
+func TestAuditEventsAppendOnly(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+	meta := randomAuditMeta()
+
+	account, err := testStore.CreateAccountTx(WithAuditMeta(context.Background(), meta), CreateAccountParams{
+		Owner:    CreateRandomUser(t, testDB).Username,
+		Balance:  utils.RandomMoney(),
+		Currency: utils.RandomCurrency(),
+	})
+	require.NoError(t, err)
+
+	events := listRequestAuditEvents(t, testDB, meta.RequestID)
+	require.Len(t, events, 1)
+	require.Equal(t, strconv.FormatInt(account.ID, 10), events[0].ResourceID)
+
+	_, err = testDB.ExecContext(context.Background(), "UPDATE audit_events SET actor = 'someone' WHERE id = $1", events[0].ID)
+	require.ErrorContains(t, err, "append-only")
+
+	_, err = testDB.ExecContext(context.Background(), "DELETE FROM audit_events WHERE id = $1", events[0].ID)
+	require.ErrorContains(t, err, "append-only")
+
+	require.Equal(t, events, listRequestAuditEvents(t, testDB, meta.RequestID))
+}
+
+func TestCreateAccountTxFailureSkipsAudit(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+	meta := randomAuditMeta()
+
+	// the owner does not exist, so neither the account nor its audit event is written
+	_, err := testStore.CreateAccountTx(WithAuditMeta(context.Background(), meta), CreateAccountParams{
+		Owner:    utils.RandomString(12),
+		Balance:  utils.RandomMoney(),
+		Currency: utils.RandomCurrency(),
+	})
+	require.Error(t, err)
+	require.Empty(t, listRequestAuditEvents(t, testDB, meta.RequestID))
+}
@@ -0,0 +1,17 @@
+package db_test
+
+import (
+	"testing"
+
+	"lesson/simple-bank/db/dbtest"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/db/storetest"
+)
+
+// TestConformance runs the store conformance suite against Postgres,
+// memstore runs the same suite so both stores behave the same
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) db.Store {
+		return db.NewStore(dbtest.NewDB(t))
+	})
+}
@@ -7,6 +7,8 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const createEntry = `-- name: CreateEntry :one
@@ -16,7 +18,7 @@ INSERT INTO entries (
 ) VALUES (
   $1, $2
 )
-RETURNING id, account_id, amount, created_at
+RETURNING id, account_id, amount, created_at, transfer_id, prev_hash, hash
 `
 
 type CreateEntryParams struct {
@@ -32,6 +34,54 @@ func (q *Queries) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
+		&i.PrevHash,
+		&i.Hash,
+	)
+	return i, err
+}
+
+const createLedgerEntry = `-- name: CreateLedgerEntry :one
+INSERT INTO entries (
+    account_id,
+    amount,
+    transfer_id,
+    prev_hash,
+    hash,
+    created_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, account_id, amount, created_at, transfer_id, prev_hash, hash
+`
+
+type CreateLedgerEntryParams struct {
+	AccountID  int64         `json:"account_id"`
+	Amount     int64         `json:"amount"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	PrevHash   []byte        `json:"prev_hash"`
+	Hash       []byte        `json:"hash"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+func (q *Queries) CreateLedgerEntry(ctx context.Context, arg CreateLedgerEntryParams) (Entry, error) {
+	row := q.db.QueryRowContext(ctx, createLedgerEntry,
+		arg.AccountID,
+		arg.Amount,
+		arg.TransferID,
+		arg.PrevHash,
+		arg.Hash,
+		arg.CreatedAt,
+	)
+	var i Entry
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.TransferID,
+		&i.PrevHash,
+		&i.Hash,
 	)
 	return i, err
 }
@@ -47,7 +97,7 @@ func (q *Queries) DeleteEntry(ctx context.Context, id int64) error {
 }
 
 const getEntry = `-- name: GetEntry :one
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, transfer_id, prev_hash, hash FROM entries
 WHERE id = $1 LIMIT 1
 `
 
@@ -59,12 +109,131 @@ func (q *Queries) GetEntry(ctx context.Context, id int64) (Entry, error) {
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
+		&i.PrevHash,
+		&i.Hash,
+	)
+	return i, err
+}
+
+const getLastAccountEntry = `-- name: GetLastAccountEntry :one
+SELECT id, account_id, amount, created_at, transfer_id, prev_hash, hash FROM entries
+WHERE account_id = $1
+ORDER BY id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLastAccountEntry(ctx context.Context, accountID int64) (Entry, error) {
+	row := q.db.QueryRowContext(ctx, getLastAccountEntry, accountID)
+	var i Entry
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.TransferID,
+		&i.PrevHash,
+		&i.Hash,
 	)
 	return i, err
 }
 
+const listAccountEntries = `-- name: ListAccountEntries :many
+SELECT id, account_id, amount, created_at, transfer_id, prev_hash, hash FROM entries
+WHERE account_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListAccountEntries(ctx context.Context, accountID int64) ([]Entry, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountEntries, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Entry{}
+	for rows.Next() {
+		var i Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.TransferID,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountEntriesAfter = `-- name: ListAccountEntriesAfter :many
+SELECT e.id, e.account_id, e.amount, e.transfer_id, e.created_at,
+  (a.balance - COALESCE(SUM(e.amount) OVER (
+    ORDER BY e.id DESC ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+  ), 0))::bigint AS balance
+FROM entries e
+JOIN accounts a ON a.id = e.account_id
+WHERE e.account_id = $1 AND e.id > $2
+ORDER BY e.id
+LIMIT $3
+`
+
+type ListAccountEntriesAfterParams struct {
+	AccountID int64 `json:"account_id"`
+	AfterID   int64 `json:"after_id"`
+	Size      int32 `json:"size"`
+}
+
+type ListAccountEntriesAfterRow struct {
+	ID         int64         `json:"id"`
+	AccountID  int64         `json:"account_id"`
+	Amount     int64         `json:"amount"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	Balance    int64         `json:"balance"`
+}
+
+func (q *Queries) ListAccountEntriesAfter(ctx context.Context, arg ListAccountEntriesAfterParams) ([]ListAccountEntriesAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountEntriesAfter, arg.AccountID, arg.AfterID, arg.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListAccountEntriesAfterRow{}
+	for rows.Next() {
+		var i ListAccountEntriesAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.TransferID,
+			&i.CreatedAt,
+			&i.Balance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listEntries = `-- name: ListEntries :many
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, transfer_id, prev_hash, hash FROM entries
 ORDER BY id
 LIMIT $1
 OFFSET $2
@@ -89,6 +258,52 @@ func (q *Queries) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Ent
 			&i.AccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.TransferID,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEntriesAfter = `-- name: ListEntriesAfter :many
+SELECT id, account_id, amount, created_at, transfer_id, prev_hash, hash FROM entries
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListEntriesAfterParams struct {
+	AfterID int64 `json:"after_id"`
+	Size    int32 `json:"size"`
+}
+
+func (q *Queries) ListEntriesAfter(ctx context.Context, arg ListEntriesAfterParams) ([]Entry, error) {
+	rows, err := q.db.QueryContext(ctx, listEntriesAfter, arg.AfterID, arg.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Entry{}
+	for rows.Next() {
+		var i Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.TransferID,
+			&i.PrevHash,
+			&i.Hash,
 		); err != nil {
 			return nil, err
 		}
@@ -107,7 +322,7 @@ const updateEntry = `-- name: UpdateEntry :one
 UPDATE entries 
 SET amount = $1
 WHERE id = $2
-RETURNING id, account_id, amount, created_at
+RETURNING id, account_id, amount, created_at, transfer_id, prev_hash, hash
 `
 
 type UpdateEntryParams struct {
@@ -123,6 +338,9 @@ func (q *Queries) UpdateEntry(ctx context.Context, arg UpdateEntryParams) (Entry
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
+		&i.PrevHash,
+		&i.Hash,
 	)
 	return i, err
 }
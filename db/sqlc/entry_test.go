@@ -2,15 +2,18 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 
+	"lesson/simple-bank/db/dbtest"
 	"lesson/simple-bank/utils"
 
 	"github.com/stretchr/testify/require"
 )
 
-func CreateRandomEntry(t *testing.T) Entry {
-	account := CreateRandomAccount(t)
+func CreateRandomEntry(t *testing.T, testDB *sql.DB) Entry {
+	testQueries := New(testDB)
+	account := CreateRandomAccount(t, testDB)
 	arg := CreateEntryParams {
 		AccountID: account.ID,
 		Amount: utils.RandomInt(0, 100),
@@ -26,11 +29,14 @@ func CreateRandomEntry(t *testing.T) Entry {
 }
 
 func TestCreateEntry(t *testing.T) {
-	CreateRandomEntry(t)
+	testDB := dbtest.NewDB(t)
+	CreateRandomEntry(t, testDB)
 }
 
 func TestGetEntry(t *testing.T) {
-	entry1 := CreateRandomEntry(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	entry1 := CreateRandomEntry(t, testDB)
 	entry2, err := testQueries.GetEntry(context.Background(), entry1.ID)
 	require.NoError(t, err)
 	require.NotEmpty(t, entry2)
@@ -43,8 +49,10 @@ func TestGetEntry(t *testing.T) {
 }
 
 func TestListEntries(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
 	for i := 0; i < 10; i++ {
-		CreateRandomEntry(t)
+		CreateRandomEntry(t, testDB)
 	}
 	arg := ListEntriesParams{
 		Offset: 5,
@@ -56,7 +64,9 @@ func TestListEntries(t *testing.T) {
 }
 
 func TestUpdateEntry(t *testing.T) {
-	entry1 := CreateRandomEntry(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	entry1 := CreateRandomEntry(t, testDB)
 	arg := UpdateEntryParams{
 		Amount: utils.RandomMoney(),
 		ID: entry1.ID,
@@ -72,11 +82,37 @@ func TestUpdateEntry(t *testing.T) {
 }
 
 func TestDeleteEntry(t *testing.T) {
-	entry1 := CreateRandomEntry(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	entry1 := CreateRandomEntry(t, testDB)
 	err := testQueries.DeleteEntry(context.Background(), entry1.ID)
 	require.NoError(t, err)
 
 	entry2, err := testQueries.GetEntry(context.Background(), entry1.ID)
 	require.Error(t, err)
 	require.Empty(t, entry2)
-}
\ No newline at end of file
+}
+
+func TestListAccountEntriesAfter(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	account1, _ := createChainedTransfers(t, testDB, 3)
+
+	entries, err := testQueries.ListAccountEntries(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	rows, err := testQueries.ListAccountEntriesAfter(context.Background(), ListAccountEntriesAfterParams{
+		AccountID: account1.ID,
+		AfterID:   entries[0].ID,
+		Size:      10,
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+
+	// the balance of each row is the account balance right after the entry
+	require.Equal(t, entries[1].ID, rows[0].ID)
+	require.Equal(t, account1.Balance-20, rows[0].Balance)
+	require.Equal(t, entries[2].ID, rows[1].ID)
+	require.Equal(t, account1.Balance-30, rows[1].Balance)
+}
@@ -0,0 +1,359 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.17.0
+// source: import.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const claimStaleImportJobs = `-- name: ClaimStaleImportJobs :many
+UPDATE import_jobs
+SET claimed_until = $1::timestamptz
+WHERE id IN (
+  SELECT id FROM import_jobs
+  WHERE status = 'PDNG' AND claimed_until <= now()
+  ORDER BY id
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, message_id, message_name, initiating_party, tx_count, status, created_at, finished_at, owner, claimed_until
+`
+
+type ClaimStaleImportJobsParams struct {
+	LeaseUntil time.Time `json:"lease_until"`
+	Size       int32     `json:"size"`
+}
+
+func (q *Queries) ClaimStaleImportJobs(ctx context.Context, arg ClaimStaleImportJobsParams) ([]ImportJob, error) {
+	rows, err := q.db.QueryContext(ctx, claimStaleImportJobs, arg.LeaseUntil, arg.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ImportJob{}
+	for rows.Next() {
+		var i ImportJob
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.MessageName,
+			&i.InitiatingParty,
+			&i.TxCount,
+			&i.Status,
+			&i.CreatedAt,
+			&i.FinishedAt,
+			&i.Owner,
+			&i.ClaimedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createImportJob = `-- name: CreateImportJob :one
+INSERT INTO import_jobs (
+  owner,
+  message_id,
+  message_name,
+  initiating_party,
+  tx_count,
+  claimed_until
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, message_id, message_name, initiating_party, tx_count, status, created_at, finished_at, owner, claimed_until
+`
+
+type CreateImportJobParams struct {
+	Owner           string    `json:"owner"`
+	MessageID       string    `json:"message_id"`
+	MessageName     string    `json:"message_name"`
+	InitiatingParty string    `json:"initiating_party"`
+	TxCount         int64     `json:"tx_count"`
+	ClaimedUntil    time.Time `json:"claimed_until"`
+}
+
+func (q *Queries) CreateImportJob(ctx context.Context, arg CreateImportJobParams) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, createImportJob,
+		arg.Owner,
+		arg.MessageID,
+		arg.MessageName,
+		arg.InitiatingParty,
+		arg.TxCount,
+		arg.ClaimedUntil,
+	)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.MessageName,
+		&i.InitiatingParty,
+		&i.TxCount,
+		&i.Status,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Owner,
+		&i.ClaimedUntil,
+	)
+	return i, err
+}
+
+const createImportTransaction = `-- name: CreateImportTransaction :one
+INSERT INTO import_transactions (
+  job_id,
+  payment_info_id,
+  end_to_end_id,
+  from_account_id,
+  to_account_id,
+  amount,
+  currency
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING id, job_id, payment_info_id, end_to_end_id, from_account_id, to_account_id, amount, currency, status, reason_code, transfer_id, created_at
+`
+
+type CreateImportTransactionParams struct {
+	JobID         int64  `json:"job_id"`
+	PaymentInfoID string `json:"payment_info_id"`
+	EndToEndID    string `json:"end_to_end_id"`
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+func (q *Queries) CreateImportTransaction(ctx context.Context, arg CreateImportTransactionParams) (ImportTransaction, error) {
+	row := q.db.QueryRowContext(ctx, createImportTransaction,
+		arg.JobID,
+		arg.PaymentInfoID,
+		arg.EndToEndID,
+		arg.FromAccountID,
+		arg.ToAccountID,
+		arg.Amount,
+		arg.Currency,
+	)
+	var i ImportTransaction
+	err := row.Scan(
+		&i.ID,
+		&i.JobID,
+		&i.PaymentInfoID,
+		&i.EndToEndID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.Currency,
+		&i.Status,
+		&i.ReasonCode,
+		&i.TransferID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getImportJob = `-- name: GetImportJob :one
+SELECT id, message_id, message_name, initiating_party, tx_count, status, created_at, finished_at, owner, claimed_until FROM import_jobs
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetImportJob(ctx context.Context, id int64) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, getImportJob, id)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.MessageName,
+		&i.InitiatingParty,
+		&i.TxCount,
+		&i.Status,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Owner,
+		&i.ClaimedUntil,
+	)
+	return i, err
+}
+
+const getImportJobByMessageID = `-- name: GetImportJobByMessageID :one
+SELECT id, message_id, message_name, initiating_party, tx_count, status, created_at, finished_at, owner, claimed_until FROM import_jobs
+WHERE owner = $1 AND message_id = $2 LIMIT 1
+`
+
+type GetImportJobByMessageIDParams struct {
+	Owner     string `json:"owner"`
+	MessageID string `json:"message_id"`
+}
+
+func (q *Queries) GetImportJobByMessageID(ctx context.Context, arg GetImportJobByMessageIDParams) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, getImportJobByMessageID, arg.Owner, arg.MessageID)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.MessageName,
+		&i.InitiatingParty,
+		&i.TxCount,
+		&i.Status,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Owner,
+		&i.ClaimedUntil,
+	)
+	return i, err
+}
+
+const listImportTransactions = `-- name: ListImportTransactions :many
+SELECT id, job_id, payment_info_id, end_to_end_id, from_account_id, to_account_id, amount, currency, status, reason_code, transfer_id, created_at FROM import_transactions
+WHERE job_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListImportTransactions(ctx context.Context, jobID int64) ([]ImportTransaction, error) {
+	rows, err := q.db.QueryContext(ctx, listImportTransactions, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ImportTransaction{}
+	for rows.Next() {
+		var i ImportTransaction
+		if err := rows.Scan(
+			&i.ID,
+			&i.JobID,
+			&i.PaymentInfoID,
+			&i.EndToEndID,
+			&i.FromAccountID,
+			&i.ToAccountID,
+			&i.Amount,
+			&i.Currency,
+			&i.Status,
+			&i.ReasonCode,
+			&i.TransferID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const renewImportJobClaim = `-- name: RenewImportJobClaim :one
+UPDATE import_jobs
+SET claimed_until = $1::timestamptz
+WHERE id = $2 AND claimed_until = $3::timestamptz
+RETURNING id, message_id, message_name, initiating_party, tx_count, status, created_at, finished_at, owner, claimed_until
+`
+
+type RenewImportJobClaimParams struct {
+	LeaseUntil   time.Time `json:"lease_until"`
+	ID           int64     `json:"id"`
+	ClaimedUntil time.Time `json:"claimed_until"`
+}
+
+func (q *Queries) RenewImportJobClaim(ctx context.Context, arg RenewImportJobClaimParams) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, renewImportJobClaim, arg.LeaseUntil, arg.ID, arg.ClaimedUntil)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.MessageName,
+		&i.InitiatingParty,
+		&i.TxCount,
+		&i.Status,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Owner,
+		&i.ClaimedUntil,
+	)
+	return i, err
+}
+
+const updateImportJobStatus = `-- name: UpdateImportJobStatus :one
+UPDATE import_jobs
+SET status = $1, finished_at = $2
+WHERE id = $3
+RETURNING id, message_id, message_name, initiating_party, tx_count, status, created_at, finished_at, owner, claimed_until
+`
+
+type UpdateImportJobStatusParams struct {
+	Status     string       `json:"status"`
+	FinishedAt sql.NullTime `json:"finished_at"`
+	ID         int64        `json:"id"`
+}
+
+func (q *Queries) UpdateImportJobStatus(ctx context.Context, arg UpdateImportJobStatusParams) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, updateImportJobStatus, arg.Status, arg.FinishedAt, arg.ID)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.MessageName,
+		&i.InitiatingParty,
+		&i.TxCount,
+		&i.Status,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Owner,
+		&i.ClaimedUntil,
+	)
+	return i, err
+}
+
+const updateImportTransaction = `-- name: UpdateImportTransaction :one
+UPDATE import_transactions
+SET status = $1, reason_code = $2, transfer_id = $3
+WHERE id = $4
+RETURNING id, job_id, payment_info_id, end_to_end_id, from_account_id, to_account_id, amount, currency, status, reason_code, transfer_id, created_at
+`
+
+type UpdateImportTransactionParams struct {
+	Status     string        `json:"status"`
+	ReasonCode string        `json:"reason_code"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	ID         int64         `json:"id"`
+}
+
+func (q *Queries) UpdateImportTransaction(ctx context.Context, arg UpdateImportTransactionParams) (ImportTransaction, error) {
+	row := q.db.QueryRowContext(ctx, updateImportTransaction,
+		arg.Status,
+		arg.ReasonCode,
+		arg.TransferID,
+		arg.ID,
+	)
+	var i ImportTransaction
+	err := row.Scan(
+		&i.ID,
+		&i.JobID,
+		&i.PaymentInfoID,
+		&i.EndToEndID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.Currency,
+		&i.Status,
+		&i.ReasonCode,
+		&i.TransferID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"lesson/simple-bank/db/dbtest"
+	"lesson/simple-bank/utils"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func CreateRandomImportJob(t *testing.T, testDB *sql.DB) CreateImportJobTxResult {
+	testStore := NewStore(testDB)
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
+
+	arg := CreateImportJobTxParams{
+		Owner:           account1.Owner,
+		MessageID:       utils.RandomString(12),
+		MessageName:     "pain.001.001.03",
+		InitiatingParty: utils.RandomOwner(),
+	}
+	for i := 0; i < 3; i++ {
+		arg.Transactions = append(arg.Transactions, CreateImportTransactionParams{
+			PaymentInfoID: "PMT-1",
+			EndToEndID:    utils.RandomString(8),
+			FromAccountID: account1.ID,
+			ToAccountID:   account2.ID,
+			Amount:        utils.RandomInt(1, 100),
+			Currency:      account1.Currency,
+		})
+	}
+
+	result, err := testStore.CreateImportJobTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.MessageID, result.Job.MessageID)
+	require.Equal(t, int64(len(arg.Transactions)), result.Job.TxCount)
+	require.Equal(t, "PDNG", result.Job.Status)
+	require.False(t, result.Job.FinishedAt.Valid)
+
+	require.Len(t, result.Transactions, len(arg.Transactions))
+	for i, tx := range result.Transactions {
+		require.Equal(t, result.Job.ID, tx.JobID)
+		require.Equal(t, arg.Transactions[i].EndToEndID, tx.EndToEndID)
+		require.Equal(t, arg.Transactions[i].Amount, tx.Amount)
+		require.Equal(t, "PDNG", tx.Status)
+		require.False(t, tx.TransferID.Valid)
+	}
+	return result
+}
+
+func TestCreateImportJobTx(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	CreateRandomImportJob(t, testDB)
+}
+
+func TestCreateImportJobTxDuplicateMessage(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+	result1 := CreateRandomImportJob(t, testDB)
+
+	result2, err := testStore.CreateImportJobTx(context.Background(), CreateImportJobTxParams{
+		Owner:           result1.Job.Owner,
+		MessageID:       result1.Job.MessageID,
+		MessageName:     result1.Job.MessageName,
+		InitiatingParty: result1.Job.InitiatingParty,
+	})
+	require.Error(t, err)
+	pqErr, ok := err.(*pq.Error)
+	require.True(t, ok)
+	require.Equal(t, "unique_violation", pqErr.Code.Name())
+	require.Empty(t, result2.Transactions)
+}
+
+func TestListImportTransactions(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	result := CreateRandomImportJob(t, testDB)
+
+	txs, err := testQueries.ListImportTransactions(context.Background(), result.Job.ID)
+	require.NoError(t, err)
+	require.Equal(t, result.Transactions, txs)
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+type CreateImportJobTxParams struct {
+	Owner           string                          `json:"owner"`
+	MessageID       string                          `json:"message_id"`
+	MessageName     string                          `json:"message_name"`
+	InitiatingParty string                          `json:"initiating_party"`
+	Transactions    []CreateImportTransactionParams `json:"transactions"`
+	// the job is claimed by the caller until then, see ClaimStaleImportJobs
+	LeaseUntil time.Time `json:"lease_until"`
+}
+
+type CreateImportJobTxResult struct {
+	Job          ImportJob           `json:"job"`
+	Transactions []ImportTransaction `json:"transactions"`
+}
+
+// CreateImportJobTx registers an import job and all of its pending transactions in a single transaction,
+// a file whose message id the owner already imported fails on the unique owner and message_id constraint
+func (store *SQLStore) CreateImportJobTx(ctx context.Context, arg CreateImportJobTxParams) (CreateImportJobTxResult, error) {
+	var result CreateImportJobTxResult
+
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		result.Job, err = q.CreateImportJob(ctx, CreateImportJobParams{
+			Owner:           arg.Owner,
+			MessageID:       arg.MessageID,
+			MessageName:     arg.MessageName,
+			InitiatingParty: arg.InitiatingParty,
+			TxCount:         int64(len(arg.Transactions)),
+			ClaimedUntil:    arg.LeaseUntil,
+		})
+		if err != nil {
+			return
+		}
+
+		result.Transactions = make([]ImportTransaction, 0, len(arg.Transactions))
+		for _, txArg := range arg.Transactions {
+			txArg.JobID = result.Job.ID
+			tx, err := q.CreateImportTransaction(ctx, txArg)
+			if err != nil {
+				return err
+			}
+			result.Transactions = append(result.Transactions, tx)
+		}
+
+		return recordAuditEvent(ctx, q, AuditActionCreateImportJob, "import_job", strconv.FormatInt(result.Job.ID, 10), nil, result.Job)
+	})
+
+	return result, err
+}
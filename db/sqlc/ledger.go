@@ -0,0 +1,257 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+)
+
+const ledgerBatchSize = 1000
+
+// EntryHash computes the chained hash of an entry:
+// hmac-sha256 with key of (prev_hash, account_id, amount, transfer_id, created_at in unix microseconds).
+// Without the key, write access to the db is not enough to forge a chain. It still is enough to cut
+// the tail off a chain and move the anchor back to the new last entry, since the anchors live in the
+// same db, so removed trailing entries are only caught against a copy of the anchors kept elsewhere.
+func EntryHash(key []byte, prevHash []byte, accountID int64, amount int64, transferID int64, createdAt time.Time) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(prevHash)
+	for _, v := range []int64{accountID, amount, transferID, createdAt.UnixMicro()} {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	}
+	return h.Sum(nil)
+}
+
+// appendLedgerEntry appends an entry to the hash chain of its account and moves the anchor of the account to it,
+// the caller must already hold the row lock of the account so the chain can't fork
+func appendLedgerEntry(ctx context.Context, q *Queries, key []byte, accountID int64, amount int64, transferID int64) (Entry, error) {
+	var prevHash []byte
+	last, err := q.GetLastAccountEntry(ctx, accountID)
+	if err != nil && err != sql.ErrNoRows {
+		return Entry{}, err
+	}
+	if err == nil {
+		prevHash = last.Hash
+	}
+
+	// postgres keeps microseconds, so truncate before hashing to read back the same value
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	entry, err := q.CreateLedgerEntry(ctx, CreateLedgerEntryParams{
+		AccountID:  accountID,
+		Amount:     amount,
+		TransferID: sql.NullInt64{Int64: transferID, Valid: true},
+		PrevHash:   prevHash,
+		Hash:       EntryHash(key, prevHash, accountID, amount, transferID, createdAt),
+		CreatedAt:  createdAt,
+	})
+	if err != nil {
+		return entry, err
+	}
+
+	_, err = q.AdvanceLedgerAnchor(ctx, AdvanceLedgerAnchorParams{
+		AccountID: accountID,
+		EntryID:   entry.ID,
+		Hash:      entry.Hash,
+	})
+	return entry, err
+}
+
+type BrokenLink struct {
+	AccountID int64  `json:"account_id"`
+	EntryID   int64  `json:"entry_id"`
+	Reason    string `json:"reason"`
+}
+
+type VerifyLedgerResult struct {
+	Valid          bool        `json:"valid"`
+	EntriesChecked int64       `json:"entries_checked"`
+	BrokenLink     *BrokenLink `json:"broken_link,omitempty"`
+}
+
+// LedgerVerifier walks entries in id order and keeps the last hash of every account chain.
+// The anchors tell where each chain starts and ends: from the first chained entry of an account
+// every entry must be chained, and the chain must end at the anchored head.
+type LedgerVerifier struct {
+	key     []byte
+	result  VerifyLedgerResult
+	anchors map[int64]LedgerAnchor
+	heads   map[int64][]byte
+}
+
+// NewLedgerVerifier returns a verifier of the chains hashed with key
+func NewLedgerVerifier(key []byte, anchors []LedgerAnchor) *LedgerVerifier {
+	v := &LedgerVerifier{
+		key:     key,
+		result:  VerifyLedgerResult{Valid: true},
+		anchors: make(map[int64]LedgerAnchor, len(anchors)),
+		heads:   make(map[int64][]byte),
+	}
+	for _, anchor := range anchors {
+		v.anchors[anchor.AccountID] = anchor
+	}
+	return v
+}
+
+// Check verifies the next entry and returns false on the first broken link
+func (v *LedgerVerifier) Check(entry Entry) bool {
+	v.result.EntriesChecked++
+
+	head := v.heads[entry.AccountID]
+	anchor, anchored := v.anchors[entry.AccountID]
+	if entry.Hash == nil {
+		if anchored && entry.ID >= anchor.FirstEntryID {
+			return v.broken(entry.AccountID, entry.ID, "entry is not chained")
+		}
+		// entries posted before the chain existed
+		return true
+	}
+	if !anchored || entry.ID < anchor.FirstEntryID {
+		return v.broken(entry.AccountID, entry.ID, "entry is chained outside of the anchored chain")
+	}
+
+	if !bytes.Equal(entry.PrevHash, head) {
+		return v.broken(entry.AccountID, entry.ID, "prev_hash does not match the previous entry")
+	}
+
+	hash := EntryHash(v.key, entry.PrevHash, entry.AccountID, entry.Amount, entry.TransferID.Int64, entry.CreatedAt)
+	if !bytes.Equal(entry.Hash, hash) {
+		return v.broken(entry.AccountID, entry.ID, "hash does not match the entry content")
+	}
+
+	v.heads[entry.AccountID] = entry.Hash
+	return true
+}
+
+// Finish checks that every chain ends at its anchored head once all the entries are checked,
+// which catches the entries removed from the end of a chain
+func (v *LedgerVerifier) Finish() bool {
+	accountIDs := make([]int64, 0, len(v.anchors))
+	for accountID := range v.anchors {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Slice(accountIDs, func(i, j int) bool { return accountIDs[i] < accountIDs[j] })
+
+	for _, accountID := range accountIDs {
+		anchor := v.anchors[accountID]
+		if !bytes.Equal(v.heads[accountID], anchor.HeadHash) {
+			return v.broken(accountID, anchor.HeadEntryID, "chain does not end at the anchored head")
+		}
+	}
+	return true
+}
+
+// Result reports the entries checked so far and the first broken link
+func (v *LedgerVerifier) Result() VerifyLedgerResult {
+	return v.result
+}
+
+func (v *LedgerVerifier) broken(accountID int64, entryID int64, reason string) bool {
+	v.result.Valid = false
+	v.result.BrokenLink = &BrokenLink{
+		AccountID: accountID,
+		EntryID:   entryID,
+		Reason:    reason,
+	}
+	return false
+}
+
+// VerifyLedger recomputes the hash chain of every account and reports the first broken link
+func (store *SQLStore) VerifyLedger(ctx context.Context) (VerifyLedgerResult, error) {
+	var v *LedgerVerifier
+	err := store.readLedger(ctx, func(q *Queries) error {
+		anchors, err := q.ListLedgerAnchors(ctx)
+		if err != nil {
+			return err
+		}
+		v = NewLedgerVerifier(store.ledgerKey, anchors)
+
+		var afterID int64
+		for {
+			entries, err := q.ListEntriesAfter(ctx, ListEntriesAfterParams{
+				AfterID: afterID,
+				Size:    ledgerBatchSize,
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				if !v.Check(entry) {
+					return nil
+				}
+				afterID = entry.ID
+			}
+
+			if len(entries) < ledgerBatchSize {
+				v.Finish()
+				return nil
+			}
+		}
+	})
+	if v == nil {
+		return VerifyLedgerResult{}, err
+	}
+	return v.result, err
+}
+
+// VerifyAccountLedger recomputes the hash chain of a single account
+func (store *SQLStore) VerifyAccountLedger(ctx context.Context, accountID int64) (VerifyLedgerResult, error) {
+	var v *LedgerVerifier
+	err := store.readLedger(ctx, func(q *Queries) error {
+		anchors, err := accountLedgerAnchors(ctx, q, accountID)
+		if err != nil {
+			return err
+		}
+		v = NewLedgerVerifier(store.ledgerKey, anchors)
+
+		entries, err := q.ListAccountEntries(ctx, accountID)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if !v.Check(entry) {
+				return nil
+			}
+		}
+		v.Finish()
+		return nil
+	})
+	if v == nil {
+		return VerifyLedgerResult{}, err
+	}
+	return v.result, err
+}
+
+// readLedger runs fn in a read-only repeatable read transaction, so the anchors and the entries
+// it reads are one snapshot even while transfers append to the chains
+func (store *SQLStore) readLedger(ctx context.Context, fn func(q *Queries) error) error {
+	tx, err := store.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return fn(New(newTracedDBTX(tx, nil)))
+}
+
+// accountLedgerAnchors returns the anchor of an account as the anchors of a LedgerVerifier,
+// none when the account has no chained entry yet
+func accountLedgerAnchors(ctx context.Context, q Querier, accountID int64) ([]LedgerAnchor, error) {
+	anchor, err := q.GetLedgerAnchor(ctx, accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []LedgerAnchor{anchor}, nil
+}
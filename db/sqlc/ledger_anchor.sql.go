@@ -0,0 +1,93 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.17.0
+// source: ledger_anchor.sql
+
+package db
+
+import (
+	"context"
+)
+
+const advanceLedgerAnchor = `-- name: AdvanceLedgerAnchor :one
+INSERT INTO ledger_anchors (
+    account_id,
+    first_entry_id,
+    head_entry_id,
+    head_hash
+) VALUES (
+  $1, $2, $2, $3
+)
+ON CONFLICT (account_id) DO UPDATE
+SET head_entry_id = EXCLUDED.head_entry_id,
+    head_hash = EXCLUDED.head_hash
+RETURNING account_id, first_entry_id, head_entry_id, head_hash
+`
+
+type AdvanceLedgerAnchorParams struct {
+	AccountID int64  `json:"account_id"`
+	EntryID   int64  `json:"entry_id"`
+	Hash      []byte `json:"hash"`
+}
+
+func (q *Queries) AdvanceLedgerAnchor(ctx context.Context, arg AdvanceLedgerAnchorParams) (LedgerAnchor, error) {
+	row := q.db.QueryRowContext(ctx, advanceLedgerAnchor, arg.AccountID, arg.EntryID, arg.Hash)
+	var i LedgerAnchor
+	err := row.Scan(
+		&i.AccountID,
+		&i.FirstEntryID,
+		&i.HeadEntryID,
+		&i.HeadHash,
+	)
+	return i, err
+}
+
+const getLedgerAnchor = `-- name: GetLedgerAnchor :one
+SELECT account_id, first_entry_id, head_entry_id, head_hash FROM ledger_anchors
+WHERE account_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetLedgerAnchor(ctx context.Context, accountID int64) (LedgerAnchor, error) {
+	row := q.db.QueryRowContext(ctx, getLedgerAnchor, accountID)
+	var i LedgerAnchor
+	err := row.Scan(
+		&i.AccountID,
+		&i.FirstEntryID,
+		&i.HeadEntryID,
+		&i.HeadHash,
+	)
+	return i, err
+}
+
+const listLedgerAnchors = `-- name: ListLedgerAnchors :many
+SELECT account_id, first_entry_id, head_entry_id, head_hash FROM ledger_anchors
+ORDER BY account_id
+`
+
+func (q *Queries) ListLedgerAnchors(ctx context.Context) ([]LedgerAnchor, error) {
+	rows, err := q.db.QueryContext(ctx, listLedgerAnchors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []LedgerAnchor{}
+	for rows.Next() {
+		var i LedgerAnchor
+		if err := rows.Scan(
+			&i.AccountID,
+			&i.FirstEntryID,
+			&i.HeadEntryID,
+			&i.HeadHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
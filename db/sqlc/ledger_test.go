@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"lesson/simple-bank/db/dbtest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryHash(t *testing.T) {
+	createdAt := time.Now()
+
+	hash1 := EntryHash(nil, nil, 1, 10, 1, createdAt)
+	require.Len(t, hash1, 32)
+	require.Equal(t, hash1, EntryHash(nil, nil, 1, 10, 1, createdAt.In(time.FixedZone("UTC+8", 8*60*60))))
+
+	require.NotEqual(t, hash1, EntryHash(nil, hash1, 1, 10, 1, createdAt))
+	require.NotEqual(t, hash1, EntryHash(nil, nil, 2, 10, 1, createdAt))
+	require.NotEqual(t, hash1, EntryHash(nil, nil, 1, 11, 1, createdAt))
+	require.NotEqual(t, hash1, EntryHash(nil, nil, 1, 10, 2, createdAt))
+	require.NotEqual(t, hash1, EntryHash(nil, nil, 1, 10, 1, createdAt.Add(time.Microsecond)))
+
+	// the same entry hashed with another key
+	key := []byte("0123456789abcdef0123456789abcdef")
+	require.Len(t, EntryHash(key, nil, 1, 10, 1, createdAt), 32)
+	require.NotEqual(t, hash1, EntryHash(key, nil, 1, 10, 1, createdAt))
+}
+
+func createChainedTransfers(t *testing.T, testDB *sql.DB, n int) (Account, Account) {
+	testStore := NewStore(testDB)
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
+
+	for i := 0; i < n; i++ {
+		_, err := testStore.TranserTx(context.Background(), TransferTxParams{
+			FromAccountID: account1.ID,
+			ToAccountID:   account2.ID,
+			Amount:        10,
+		})
+		require.NoError(t, err)
+	}
+	return account1, account2
+}
+
+func TestTransferTxChainsEntries(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	account1, _ := createChainedTransfers(t, testDB, 3)
+
+	entries, err := testQueries.ListAccountEntries(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	require.Nil(t, entries[0].PrevHash)
+	for i, entry := range entries {
+		require.True(t, entry.TransferID.Valid)
+		require.Equal(t, EntryHash(nil, entry.PrevHash, entry.AccountID, entry.Amount, entry.TransferID.Int64, entry.CreatedAt), entry.Hash)
+		if i > 0 {
+			require.Equal(t, entries[i-1].Hash, entry.PrevHash)
+		}
+	}
+}
+
+func TestVerifyAccountLedger(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+	account1, account2 := createChainedTransfers(t, testDB, 3)
+
+	for _, account := range []Account{account1, account2} {
+		result, err := testStore.VerifyAccountLedger(context.Background(), account.ID)
+		require.NoError(t, err)
+		require.True(t, result.Valid)
+		require.Equal(t, int64(3), result.EntriesChecked)
+		require.Nil(t, result.BrokenLink)
+	}
+}
+
+func TestVerifyAccountLedgerDetectsUpdatedEntry(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	testStore := NewStore(testDB)
+	account1, _ := createChainedTransfers(t, testDB, 3)
+
+	entries, err := testQueries.ListAccountEntries(context.Background(), account1.ID)
+	require.NoError(t, err)
+
+	// tamper with the middle entry the way UpdateEntry would
+	_, err = testDB.ExecContext(context.Background(), "UPDATE entries SET amount = amount - 1 WHERE id = $1", entries[1].ID)
+	require.NoError(t, err)
+
+	result, err := testStore.VerifyAccountLedger(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.Equal(t, int64(2), result.EntriesChecked)
+	require.Equal(t, entries[1].ID, result.BrokenLink.EntryID)
+	require.Equal(t, account1.ID, result.BrokenLink.AccountID)
+}
+
+func TestVerifyAccountLedgerDetectsDeletedEntry(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	testStore := NewStore(testDB)
+	account1, _ := createChainedTransfers(t, testDB, 3)
+
+	entries, err := testQueries.ListAccountEntries(context.Background(), account1.ID)
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(context.Background(), "DELETE FROM entries WHERE id = $1", entries[1].ID)
+	require.NoError(t, err)
+
+	result, err := testStore.VerifyAccountLedger(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.Equal(t, entries[2].ID, result.BrokenLink.EntryID)
+}
+
+func TestVerifyAccountLedgerDetectsUnchainedEntries(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	testStore := NewStore(testDB)
+	account1, _ := createChainedTransfers(t, testDB, 3)
+
+	entries, err := testQueries.ListAccountEntries(context.Background(), account1.ID)
+	require.NoError(t, err)
+
+	// entries without hashes would pass for entries posted before the chain existed
+	_, err = testDB.ExecContext(context.Background(), "UPDATE entries SET prev_hash = NULL, hash = NULL WHERE account_id = $1", account1.ID)
+	require.NoError(t, err)
+
+	result, err := testStore.VerifyAccountLedger(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.Equal(t, &BrokenLink{AccountID: account1.ID, EntryID: entries[0].ID, Reason: "entry is not chained"}, result.BrokenLink)
+}
+
+func TestVerifyAccountLedgerDetectsTruncatedChain(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	testStore := NewStore(testDB)
+	account1, _ := createChainedTransfers(t, testDB, 3)
+
+	entries, err := testQueries.ListAccountEntries(context.Background(), account1.ID)
+	require.NoError(t, err)
+
+	// the remaining entries form a valid chain, only the anchor knows it was longer
+	_, err = testDB.ExecContext(context.Background(), "DELETE FROM entries WHERE id = $1", entries[2].ID)
+	require.NoError(t, err)
+
+	result, err := testStore.VerifyAccountLedger(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.Equal(t, int64(2), result.EntriesChecked)
+	require.Equal(t, &BrokenLink{AccountID: account1.ID, EntryID: entries[2].ID, Reason: "chain does not end at the anchored head"}, result.BrokenLink)
+}
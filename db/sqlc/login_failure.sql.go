@@ -0,0 +1,156 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.17.0
+// source: login_failure.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const createLoginFailure = `-- name: CreateLoginFailure :exec
+INSERT INTO login_failures (
+  key,
+  failures,
+  window_started_at,
+  locked_until
+) VALUES (
+  $1, 0, $2, $2
+)
+ON CONFLICT (key) DO NOTHING
+`
+
+type CreateLoginFailureParams struct {
+	Key string    `json:"key"`
+	Now time.Time `json:"now"`
+}
+
+// adds key without failures unless it has a row already
+func (q *Queries) CreateLoginFailure(ctx context.Context, arg CreateLoginFailureParams) error {
+	_, err := q.db.ExecContext(ctx, createLoginFailure, arg.Key, arg.Now)
+	return err
+}
+
+const deleteLoginFailure = `-- name: DeleteLoginFailure :execrows
+DELETE FROM login_failures
+WHERE key = $1
+`
+
+func (q *Queries) DeleteLoginFailure(ctx context.Context, key string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteLoginFailure, key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteStaleLoginFailures = `-- name: DeleteStaleLoginFailures :execrows
+DELETE FROM login_failures
+WHERE locked_until <= now() AND window_started_at < $1::timestamptz
+`
+
+func (q *Queries) DeleteStaleLoginFailures(ctx context.Context, windowStart time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleLoginFailures, windowStart)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const forgiveLoginFailure = `-- name: ForgiveLoginFailure :one
+UPDATE login_failures
+SET
+  failures = GREATEST(failures - 1, 0),
+  locked_until = CASE WHEN failures - 1 < $1::int THEN LEAST(locked_until, now()) ELSE locked_until END
+WHERE key = $2
+RETURNING key, failures, window_started_at, locked_until
+`
+
+type ForgiveLoginFailureParams struct {
+	MaxFailures int32  `json:"max_failures"`
+	Key         string `json:"key"`
+}
+
+// takes back a failure counted for key, which unlocks it once it has less than max_failures
+func (q *Queries) ForgiveLoginFailure(ctx context.Context, arg ForgiveLoginFailureParams) (LoginFailure, error) {
+	row := q.db.QueryRowContext(ctx, forgiveLoginFailure, arg.MaxFailures, arg.Key)
+	var i LoginFailure
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.WindowStartedAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const getLoginFailure = `-- name: GetLoginFailure :one
+SELECT key, failures, window_started_at, locked_until FROM login_failures
+WHERE key = $1 LIMIT 1
+`
+
+func (q *Queries) GetLoginFailure(ctx context.Context, key string) (LoginFailure, error) {
+	row := q.db.QueryRowContext(ctx, getLoginFailure, key)
+	var i LoginFailure
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.WindowStartedAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const getLoginFailureForUpdate = `-- name: GetLoginFailureForUpdate :one
+SELECT key, failures, window_started_at, locked_until FROM login_failures
+WHERE key = $1 LIMIT 1
+FOR NO KEY UPDATE
+`
+
+func (q *Queries) GetLoginFailureForUpdate(ctx context.Context, key string) (LoginFailure, error) {
+	row := q.db.QueryRowContext(ctx, getLoginFailureForUpdate, key)
+	var i LoginFailure
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.WindowStartedAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const updateLoginFailure = `-- name: UpdateLoginFailure :one
+UPDATE login_failures
+SET
+  failures = $1,
+  window_started_at = $2,
+  locked_until = $3
+WHERE key = $4
+RETURNING key, failures, window_started_at, locked_until
+`
+
+type UpdateLoginFailureParams struct {
+	Failures        int32     `json:"failures"`
+	WindowStartedAt time.Time `json:"window_started_at"`
+	LockedUntil     time.Time `json:"locked_until"`
+	Key             string    `json:"key"`
+}
+
+func (q *Queries) UpdateLoginFailure(ctx context.Context, arg UpdateLoginFailureParams) (LoginFailure, error) {
+	row := q.db.QueryRowContext(ctx, updateLoginFailure,
+		arg.Failures,
+		arg.WindowStartedAt,
+		arg.LockedUntil,
+		arg.Key,
+	)
+	var i LoginFailure
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.WindowStartedAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
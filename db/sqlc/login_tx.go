@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// LoginAttemptKey is a username or client IP a login attempt counts for
+type LoginAttemptKey struct {
+	Key string
+	// Wait returns how long the next login of the key waits after its failures
+	Wait func(failures int32) time.Duration
+}
+
+type LoginAttemptTxParams struct {
+	Keys []LoginAttemptKey
+	// the failures of a window started before WindowStart are forgotten
+	WindowStart time.Time
+}
+
+type LoginAttemptTxResult struct {
+	// Wait is how long the login has to wait when one of its keys is locked, it isn't counted then
+	Wait time.Duration
+	// Failures are the rows of the keys counting the login, in the order of the params
+	Failures []LoginFailure
+}
+
+// LoginAttemptTx counts a login as a failure of each key before its password is compared,
+// so parallel guesses can't all pass before the first of them locks the key.
+// The rows are locked in key order so concurrent logins sharing keys don't deadlock.
+func (store *SQLStore) LoginAttemptTx(ctx context.Context, arg LoginAttemptTxParams) (LoginAttemptTxResult, error) {
+	var result LoginAttemptTxResult
+
+	order := arg.LockOrder()
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		result = LoginAttemptTxResult{}
+		now := time.Now()
+		failures := make([]LoginFailure, len(arg.Keys))
+		for _, i := range order {
+			err = q.CreateLoginFailure(ctx, CreateLoginFailureParams{Key: arg.Keys[i].Key, Now: now})
+			if err != nil {
+				return
+			}
+			failures[i], err = q.GetLoginFailureForUpdate(ctx, arg.Keys[i].Key)
+			if err != nil {
+				return
+			}
+			if wait := failures[i].LockedUntil.Sub(now); wait > result.Wait {
+				result.Wait = wait
+			}
+		}
+		if result.Wait > 0 {
+			return nil
+		}
+
+		for _, i := range order {
+			failures[i], err = q.UpdateLoginFailure(ctx, arg.CountFailure(i, failures[i], now))
+			if err != nil {
+				return
+			}
+		}
+		result.Failures = failures
+		return nil
+	})
+
+	return result, err
+}
+
+// LockOrder returns the indexes of the keys sorted by key, the order their rows are locked in
+func (arg LoginAttemptTxParams) LockOrder() []int {
+	order := make([]int, len(arg.Keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return arg.Keys[order[a]].Key < arg.Keys[order[b]].Key })
+	return order
+}
+
+// CountFailure returns the update adding a failure at now to failure, the row of the i-th key
+func (arg LoginAttemptTxParams) CountFailure(i int, failure LoginFailure, now time.Time) UpdateLoginFailureParams {
+	update := UpdateLoginFailureParams{
+		Key:             failure.Key,
+		Failures:        failure.Failures + 1,
+		WindowStartedAt: failure.WindowStartedAt,
+	}
+	if failure.WindowStartedAt.Before(arg.WindowStart) {
+		update.Failures = 1
+		update.WindowStartedAt = now
+	}
+	update.LockedUntil = now.Add(arg.Keys[i].Wait(update.Failures))
+	return update
+}
@@ -1,30 +1,19 @@
 package db
 
 import (
-	"database/sql"
-	"lesson/simple-bank/initial"
+	"lesson/simple-bank/db/dbtest"
 	"log"
 	"os"
 	"testing"
-
-	_ "github.com/lib/pq"
 )
 
-var testQueries *Queries
-var testDB *sql.DB
-
+// TestMain stops the test Postgres once every test is done, each test creates its own database
+// with dbtest.NewDB and is skipped when there is no Postgres to test against
 func TestMain(m *testing.M) {
-	path := "../../"
-	config, err := initial.LoadingConfig(path)
-	if err != nil {
-		log.Fatal("Cann't load config", err)
-	}
+	code := m.Run()
 
-	testDB, err = sql.Open(config.DbDriver, config.DbSource)	
-	if err != nil {
-		log.Fatal("Cannot connect to db ,", err)
+	if err := dbtest.Stop(); err != nil {
+		log.Println("Cannot stop test postgres ,", err)
 	}
-
-	testQueries = New(testDB)
-	os.Exit(m.Run())
-}
\ No newline at end of file
+	os.Exit(code)
+}
@@ -5,6 +5,8 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -14,14 +16,119 @@ type Account struct {
 	Balance   int64     `json:"balance"`
 	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
+	// frozen accounts can neither send nor receive transfers
+	Frozen bool `json:"frozen"`
+}
+
+type AuditEvent struct {
+	ID int64 `json:"id"`
+	// username from the token payload, empty for anonymous requests
+	Actor        string          `json:"actor"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Before       json.RawMessage `json:"before"`
+	After        json.RawMessage `json:"after"`
+	RequestID    string          `json:"request_id"`
+	ClientIp     string          `json:"client_ip"`
+	UserAgent    string          `json:"user_agent"`
+	CreatedAt    time.Time       `json:"created_at"`
 }
 
 type Entry struct {
 	ID        int64 `json:"id"`
 	AccountID int64 `json:"account_id"`
 	// can be negative or positive
-	Amount    int64     `json:"amount"`
-	CreatedAt time.Time `json:"created_at"`
+	Amount     int64         `json:"amount"`
+	CreatedAt  time.Time     `json:"created_at"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	// hash of the previous entry of the same account, null for the first chained entry
+	PrevHash []byte `json:"prev_hash"`
+	// hmac-sha256 keyed with LEDGERKEY of (prev_hash, account_id, amount, transfer_id, created_at), null for entries posted before the chain existed
+	Hash []byte `json:"hash"`
+}
+
+type ImportJob struct {
+	ID int64 `json:"id"`
+	// GrpHdr/MsgId of the uploaded pain.001 file
+	MessageID       string       `json:"message_id"`
+	MessageName     string       `json:"message_name"`
+	InitiatingParty string       `json:"initiating_party"`
+	TxCount         int64        `json:"tx_count"`
+	Status          string       `json:"status"`
+	CreatedAt       time.Time    `json:"created_at"`
+	FinishedAt      sql.NullTime `json:"finished_at"`
+	// the user who uploaded the file, only they can read the job
+	Owner string `json:"owner"`
+	// the instance booking a pending job holds it until then, another one resumes it afterwards
+	ClaimedUntil time.Time `json:"claimed_until"`
+}
+
+type ImportTransaction struct {
+	ID            int64  `json:"id"`
+	JobID         int64  `json:"job_id"`
+	PaymentInfoID string `json:"payment_info_id"`
+	EndToEndID    string `json:"end_to_end_id"`
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	// ISO 20022 status reason code, empty when accepted
+	ReasonCode string        `json:"reason_code"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// where the hash chain of an account starts and ends, so removed or unchained entries are detected
+type LedgerAnchor struct {
+	AccountID int64 `json:"account_id"`
+	// the first chained entry of the account, every later entry must be chained
+	FirstEntryID int64 `json:"first_entry_id"`
+	// the last chained entry of the account
+	HeadEntryID int64 `json:"head_entry_id"`
+	// hash of the last chained entry of the account
+	HeadHash []byte `json:"head_hash"`
+}
+
+// failed logins by username and by client IP
+type LoginFailure struct {
+	// user: or ip: followed by the username or the client IP
+	Key      string `json:"key"`
+	Failures int32  `json:"failures"`
+	// time of the first failure counted, the count starts over once the window ends
+	WindowStartedAt time.Time `json:"window_started_at"`
+	// the logins of the key are refused until then
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+type Outbox struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	EventVersion  int32           `json:"event_version"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int32           `json:"attempts"`
+	LastError     string          `json:"last_error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	// null until the relay delivered the event
+	PublishedAt sql.NullTime `json:"published_at"`
+	// the relay publishing the event holds it until then
+	ClaimedUntil sql.NullTime `json:"claimed_until"`
+	// pending, published, or dead once the relay gave up after too many attempts
+	Status string `json:"status"`
+	// a failed event is not published again before then
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+// token buckets of the rate limiter shared by the server instances
+type RateLimitBucket struct {
+	Key    string  `json:"key"`
+	Tokens float64 `json:"tokens"`
+	// whether the last request took a token
+	Allowed   bool      `json:"allowed"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Transfer struct {
@@ -40,4 +147,42 @@ type User struct {
 	Email            string    `json:"email"`
 	PasswordChangeAt time.Time `json:"password_change_at"`
 	CreatedAt        time.Time `json:"created_at"`
+	Role             string    `json:"role"`
+}
+
+type Webhook struct {
+	ID    int64  `json:"id"`
+	Owner string `json:"owner"`
+	Url   string `json:"url"`
+	// event types delivered to the endpoint, empty for every type
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookAttempt struct {
+	ID         int64 `json:"id"`
+	DeliveryID int64 `json:"delivery_id"`
+	// 0 when no response was received
+	StatusCode int32     `json:"status_code"`
+	Error      string    `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID        int64 `json:"id"`
+	WebhookID int64 `json:"webhook_id"`
+	// outbox id of the event, null for test events
+	EventID   sql.NullInt64   `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	// pending, succeeded or dead
+	Status         string       `json:"status"`
+	Attempts       int32        `json:"attempts"`
+	NextAttemptAt  time.Time    `json:"next_attempt_at"`
+	LastStatusCode int32        `json:"last_status_code"`
+	LastError      string       `json:"last_error"`
+	CreatedAt      time.Time    `json:"created_at"`
+	DeliveredAt    sql.NullTime `json:"delivered_at"`
 }
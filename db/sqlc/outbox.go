@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"lesson/simple-bank/event"
+	"sort"
+	"time"
+)
+
+// outboxRelayLockID is the advisory lock key held by the active outbox relay
+const outboxRelayLockID = 0x6f7574626f78
+
+// Outbox event statuses
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusPublished = "published"
+	OutboxStatusDead      = "dead"
+)
+
+// enqueueEvent writes a domain event to the outbox,
+// it must be called with the queries of the transaction making the change
+func enqueueEvent(ctx context.Context, q *Queries, aggregateType string, aggregateID string, payload event.Payload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateOutboxEvent(ctx, CreateOutboxEventParams{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     payload.EventType(),
+		EventVersion:  payload.EventVersion(),
+		Payload:       data,
+	})
+	return err
+}
+
+// Envelope converts an outbox row into the event delivered to publishers
+func (o Outbox) Envelope() event.Envelope {
+	return event.Envelope{
+		ID:            o.ID,
+		Type:          o.EventType,
+		Version:       o.EventVersion,
+		AggregateType: o.AggregateType,
+		AggregateID:   o.AggregateID,
+		OccurredAt:    o.CreatedAt,
+		Data:          o.Payload,
+	}
+}
+
+type RelayOutboxTxParams struct {
+	Limit int32
+	// the claimed events are hidden from other relays until then, it must outlast the publishing
+	LeaseUntil time.Time
+	Publish    func(ctx context.Context, event event.Envelope) error
+	// an event that failed MaxAttempts times is dead-lettered, 0 retries it forever
+	MaxAttempts int32
+	// Backoff returns the delay before the next attempt once attempts have failed, nil retries on the next run
+	Backoff func(attempts int32) time.Duration
+}
+
+type RelayOutboxTxResult struct {
+	// Locked is false when another relay holds the lock or a claim and nothing was read
+	Locked    bool
+	Published int
+	Failed    int
+}
+
+// RelayOutboxTx publishes pending outbox events in id order and marks the delivered ones.
+// A first transaction claims a batch until LeaseUntil, then the events are published
+// without holding a connection or row locks, and a second transaction marks them and releases the claim.
+// Only one relay runs at a time across instances: the claim takes an advisory lock and
+// nothing is claimed while another claim hasn't expired. Once an event of an aggregate fails, the following events
+// of the same aggregate wait until it is published so consumers always see them in order.
+// A failed event is retried after arg.Backoff and moves to OutboxStatusDead after arg.MaxAttempts,
+// the events of its aggregate then go on without it.
+// An event is marked after it is published, so a crash in between delivers it again once the
+// claim expires: delivery is at least once.
+func (store *SQLStore) RelayOutboxTx(ctx context.Context, arg RelayOutboxTxParams) (RelayOutboxTxResult, error) {
+	var result RelayOutboxTxResult
+	var events []Outbox
+
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		result.Locked, err = q.TryAdvisoryXactLock(ctx, outboxRelayLockID)
+		if err != nil || !result.Locked {
+			return
+		}
+
+		claimed, err := q.HasClaimedOutboxEvents(ctx)
+		if err != nil || claimed {
+			result.Locked = false
+			return
+		}
+
+		events, err = q.ClaimPendingOutboxEvents(ctx, ClaimPendingOutboxEventsParams{
+			ClaimedUntil: arg.LeaseUntil,
+			Size:         arg.Limit,
+		})
+		return
+	})
+	if err != nil || len(events) == 0 {
+		return result, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	// the events not published before the claim expires are left for the next run
+	publishCtx, cancel := context.WithDeadline(ctx, arg.LeaseUntil)
+	published, failed := publishOutboxEvents(publishCtx, events, arg)
+	cancel()
+
+	ids := make([]int64, len(events))
+	for i, o := range events {
+		ids[i] = o.ID
+	}
+	err = store.execTX(ctx, func(q *Queries) (err error) {
+		// the counts of an attempt that was retried don't add up
+		result.Published, result.Failed = 0, 0
+		for _, id := range published {
+			if err = q.MarkOutboxEventPublished(ctx, id); err != nil {
+				return
+			}
+			result.Published++
+		}
+		for _, arg := range failed {
+			if err = q.MarkOutboxEventFailed(ctx, arg); err != nil {
+				return
+			}
+			result.Failed++
+		}
+		return q.ReleaseOutboxEvents(ctx, ids)
+	})
+	return result, err
+}
+
+// publishOutboxEvents publishes the events in order, skipping the events of an aggregate after one of them fails
+func publishOutboxEvents(ctx context.Context, events []Outbox, arg RelayOutboxTxParams) (published []int64, failed []MarkOutboxEventFailedParams) {
+	blocked := make(map[string]bool)
+	for _, o := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		aggregate := o.AggregateType + "/" + o.AggregateID
+		if blocked[aggregate] {
+			continue
+		}
+		if err := arg.Publish(ctx, o.Envelope()); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			blocked[aggregate] = true
+			failed = append(failed, arg.FailedEvent(o, err))
+			continue
+		}
+		published = append(published, o.ID)
+	}
+	return
+}
+
+// FailedEvent schedules the next attempt of an event that failed to publish, or dead-letters it
+func (arg RelayOutboxTxParams) FailedEvent(o Outbox, err error) MarkOutboxEventFailedParams {
+	attempts := o.Attempts + 1
+	failed := MarkOutboxEventFailedParams{
+		ID:            o.ID,
+		Status:        OutboxStatusPending,
+		LastError:     err.Error(),
+		NextAttemptAt: time.Now(),
+	}
+	if arg.Backoff != nil {
+		failed.NextAttemptAt = failed.NextAttemptAt.Add(arg.Backoff(attempts))
+	}
+	if arg.MaxAttempts > 0 && attempts >= arg.MaxAttempts {
+		failed.Status = OutboxStatusDead
+	}
+	return failed
+}
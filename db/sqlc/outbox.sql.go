@@ -0,0 +1,332 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.17.0
+// source: outbox.sql
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const claimPendingOutboxEvents = `-- name: ClaimPendingOutboxEvents :many
+UPDATE outbox
+SET claimed_until = $1::timestamptz
+WHERE id IN (
+  SELECT o.id FROM outbox o
+  WHERE o.status = 'pending' AND o.next_attempt_at <= now()
+  -- the events of an aggregate wait while an earlier one backs off, so they are published in order
+  AND NOT EXISTS (
+    SELECT 1 FROM outbox earlier
+    WHERE earlier.aggregate_type = o.aggregate_type
+    AND earlier.aggregate_id = o.aggregate_id
+    AND earlier.status = 'pending'
+    AND earlier.id < o.id
+    AND earlier.next_attempt_at > now()
+  )
+  ORDER BY o.id
+  LIMIT $2
+)
+RETURNING id, aggregate_type, aggregate_id, event_type, event_version, payload, attempts, last_error, created_at, published_at, claimed_until, status, next_attempt_at
+`
+
+type ClaimPendingOutboxEventsParams struct {
+	ClaimedUntil time.Time `json:"claimed_until"`
+	Size         int32     `json:"size"`
+}
+
+func (q *Queries) ClaimPendingOutboxEvents(ctx context.Context, arg ClaimPendingOutboxEventsParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, claimPendingOutboxEvents, arg.ClaimedUntil, arg.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Outbox{}
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.AggregateType,
+			&i.AggregateID,
+			&i.EventType,
+			&i.EventVersion,
+			&i.Payload,
+			&i.Attempts,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.PublishedAt,
+			&i.ClaimedUntil,
+			&i.Status,
+			&i.NextAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createOutboxEvent = `-- name: CreateOutboxEvent :one
+INSERT INTO outbox (
+  aggregate_type,
+  aggregate_id,
+  event_type,
+  event_version,
+  payload
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING id, aggregate_type, aggregate_id, event_type, event_version, payload, attempts, last_error, created_at, published_at, claimed_until, status, next_attempt_at
+`
+
+type CreateOutboxEventParams struct {
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	EventVersion  int32           `json:"event_version"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+func (q *Queries) CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (Outbox, error) {
+	row := q.db.QueryRowContext(ctx, createOutboxEvent,
+		arg.AggregateType,
+		arg.AggregateID,
+		arg.EventType,
+		arg.EventVersion,
+		arg.Payload,
+	)
+	var i Outbox
+	err := row.Scan(
+		&i.ID,
+		&i.AggregateType,
+		&i.AggregateID,
+		&i.EventType,
+		&i.EventVersion,
+		&i.Payload,
+		&i.Attempts,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.PublishedAt,
+		&i.ClaimedUntil,
+		&i.Status,
+		&i.NextAttemptAt,
+	)
+	return i, err
+}
+
+const deletePublishedOutboxEvents = `-- name: DeletePublishedOutboxEvents :execrows
+DELETE FROM outbox
+WHERE published_at < $1::timestamptz
+`
+
+func (q *Queries) DeletePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePublishedOutboxEvents, publishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getOutboxEvent = `-- name: GetOutboxEvent :one
+SELECT id, aggregate_type, aggregate_id, event_type, event_version, payload, attempts, last_error, created_at, published_at, claimed_until, status, next_attempt_at FROM outbox
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetOutboxEvent(ctx context.Context, id int64) (Outbox, error) {
+	row := q.db.QueryRowContext(ctx, getOutboxEvent, id)
+	var i Outbox
+	err := row.Scan(
+		&i.ID,
+		&i.AggregateType,
+		&i.AggregateID,
+		&i.EventType,
+		&i.EventVersion,
+		&i.Payload,
+		&i.Attempts,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.PublishedAt,
+		&i.ClaimedUntil,
+		&i.Status,
+		&i.NextAttemptAt,
+	)
+	return i, err
+}
+
+const hasClaimedOutboxEvents = `-- name: HasClaimedOutboxEvents :one
+SELECT EXISTS (
+  SELECT 1 FROM outbox
+  WHERE status = 'pending' AND claimed_until > now()
+)
+`
+
+func (q *Queries) HasClaimedOutboxEvents(ctx context.Context) (bool, error) {
+	row := q.db.QueryRowContext(ctx, hasClaimedOutboxEvents)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listDeadOutboxEvents = `-- name: ListDeadOutboxEvents :many
+SELECT id, aggregate_type, aggregate_id, event_type, event_version, payload, attempts, last_error, created_at, published_at, claimed_until, status, next_attempt_at FROM outbox
+WHERE status = 'dead'
+ORDER BY id
+LIMIT $1
+OFFSET $2
+`
+
+type ListDeadOutboxEventsParams struct {
+	Limit  int32 `json:"limit"`
+	Offset int32 `json:"offset"`
+}
+
+func (q *Queries) ListDeadOutboxEvents(ctx context.Context, arg ListDeadOutboxEventsParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, listDeadOutboxEvents, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Outbox{}
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.AggregateType,
+			&i.AggregateID,
+			&i.EventType,
+			&i.EventVersion,
+			&i.Payload,
+			&i.Attempts,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.PublishedAt,
+			&i.ClaimedUntil,
+			&i.Status,
+			&i.NextAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingOutboxEvents = `-- name: ListPendingOutboxEvents :many
+SELECT id, aggregate_type, aggregate_id, event_type, event_version, payload, attempts, last_error, created_at, published_at, claimed_until, status, next_attempt_at FROM outbox
+WHERE status = 'pending'
+ORDER BY id
+LIMIT $1
+`
+
+func (q *Queries) ListPendingOutboxEvents(ctx context.Context, limit int32) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, listPendingOutboxEvents, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Outbox{}
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.AggregateType,
+			&i.AggregateID,
+			&i.EventType,
+			&i.EventVersion,
+			&i.Payload,
+			&i.Attempts,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.PublishedAt,
+			&i.ClaimedUntil,
+			&i.Status,
+			&i.NextAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markOutboxEventFailed = `-- name: MarkOutboxEventFailed :exec
+UPDATE outbox
+SET
+  status = $1,
+  attempts = attempts + 1,
+  last_error = $2,
+  next_attempt_at = $3
+WHERE id = $4
+`
+
+type MarkOutboxEventFailedParams struct {
+	Status        string    `json:"status"`
+	LastError     string    `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	ID            int64     `json:"id"`
+}
+
+func (q *Queries) MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markOutboxEventFailed,
+		arg.Status,
+		arg.LastError,
+		arg.NextAttemptAt,
+		arg.ID,
+	)
+	return err
+}
+
+const markOutboxEventPublished = `-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET status = 'published', published_at = now(), attempts = attempts + 1, last_error = ''
+WHERE id = $1
+`
+
+func (q *Queries) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, markOutboxEventPublished, id)
+	return err
+}
+
+const releaseOutboxEvents = `-- name: ReleaseOutboxEvents :exec
+UPDATE outbox
+SET claimed_until = NULL
+WHERE id = ANY($1::bigint[])
+`
+
+func (q *Queries) ReleaseOutboxEvents(ctx context.Context, ids []int64) error {
+	_, err := q.db.ExecContext(ctx, releaseOutboxEvents, pq.Array(ids))
+	return err
+}
+
+const tryAdvisoryXactLock = `-- name: TryAdvisoryXactLock :one
+SELECT pg_try_advisory_xact_lock($1::bigint)
+`
+
+func (q *Queries) TryAdvisoryXactLock(ctx context.Context, lockID int64) (bool, error) {
+	row := q.db.QueryRowContext(ctx, tryAdvisoryXactLock, lockID)
+	var pg_try_advisory_xact_lock bool
+	err := row.Scan(&pg_try_advisory_xact_lock)
+	return pg_try_advisory_xact_lock, err
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"lesson/simple-bank/db/dbtest"
+	"lesson/simple-bank/event"
+	"lesson/simple-bank/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func CreateRandomOutboxEvent(t *testing.T, testDB *sql.DB, aggregateID string) Outbox {
+	testQueries := New(testDB)
+	o, err := testQueries.CreateOutboxEvent(context.Background(), CreateOutboxEventParams{
+		AggregateType: event.AggregateAccount,
+		AggregateID:   aggregateID,
+		EventType:     event.TypeAccountOpened,
+		EventVersion:  1,
+		Payload:       json.RawMessage(`{}`),
+	})
+	require.NoError(t, err)
+	require.False(t, o.PublishedAt.Valid)
+	return o
+}
+
+// relayAll runs the relay until there is nothing left to publish and returns the published event ids
+func relayAll(t *testing.T, testDB *sql.DB, publish func(e event.Envelope) error) []int64 {
+	testStore := NewStore(testDB)
+
+	var published []int64
+	for {
+		result, err := testStore.RelayOutboxTx(context.Background(), RelayOutboxTxParams{
+			Limit:      100,
+			LeaseUntil: time.Now().Add(time.Minute),
+			Publish: func(ctx context.Context, e event.Envelope) error {
+				if err := publish(e); err != nil {
+					return err
+				}
+				published = append(published, e.ID)
+				return nil
+			},
+		})
+		require.NoError(t, err)
+		require.True(t, result.Locked)
+		if result.Published == 0 {
+			return published
+		}
+	}
+}
+
+func TestTransferTxOutbox(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
+
+	result, err := testStore.TranserTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.NoError(t, err)
+
+	var found *event.Envelope
+	relayAll(t, testDB, func(e event.Envelope) error {
+		if e.Type == event.TypeTransferCreated && e.AggregateID == strconv.FormatInt(result.Transfer.ID, 10) {
+			found = &e
+		}
+		return nil
+	})
+	require.NotNil(t, found)
+
+	payload, err := found.Decode()
+	require.NoError(t, err)
+	require.Equal(t, &event.TransferCreatedV1{
+		TransferID:    result.Transfer.ID,
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+		Currency:      account1.Currency,
+	}, payload)
+}
+
+func TestRelayOutboxTxKeepsAggregateOrder(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	aggregateID := utils.RandomString(12)
+	event1 := CreateRandomOutboxEvent(t, testDB, aggregateID)
+	event2 := CreateRandomOutboxEvent(t, testDB, aggregateID)
+
+	// the first event fails, the second must wait for it
+	published := relayAll(t, testDB, func(e event.Envelope) error {
+		if e.ID == event1.ID {
+			return errors.New("consumer is down")
+		}
+		return nil
+	})
+	require.NotContains(t, published, event1.ID)
+	require.NotContains(t, published, event2.ID)
+
+	failed, err := testQueries.GetOutboxEvent(context.Background(), event1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), failed.Attempts)
+	require.Equal(t, "consumer is down", failed.LastError)
+
+	// once the consumer is back both are delivered in order
+	published = relayAll(t, testDB, func(e event.Envelope) error { return nil })
+	index := make(map[int64]int)
+	for i, id := range published {
+		index[id] = i
+	}
+	require.Contains(t, index, event1.ID)
+	require.Contains(t, index, event2.ID)
+	require.Less(t, index[event1.ID], index[event2.ID])
+
+	delivered, err := testQueries.GetOutboxEvent(context.Background(), event2.ID)
+	require.NoError(t, err)
+	require.True(t, delivered.PublishedAt.Valid)
+}
+
+func TestDeletePublishedOutboxEvents(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	o := CreateRandomOutboxEvent(t, testDB, utils.RandomString(12))
+	relayAll(t, testDB, func(e event.Envelope) error { return nil })
+
+	_, err := testQueries.DeletePublishedOutboxEvents(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	_, err = testQueries.GetOutboxEvent(context.Background(), o.ID)
+	require.Error(t, err)
+}
@@ -6,28 +6,87 @@ package db
 
 import (
 	"context"
+	"time"
 )
 
 type Querier interface {
 	AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error)
+	AdvanceLedgerAnchor(ctx context.Context, arg AdvanceLedgerAnchorParams) (LedgerAnchor, error)
+	ClaimDueWebhookDeliveries(ctx context.Context, arg ClaimDueWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ClaimPendingOutboxEvents(ctx context.Context, arg ClaimPendingOutboxEventsParams) ([]Outbox, error)
+	ClaimStaleImportJobs(ctx context.Context, arg ClaimStaleImportJobsParams) ([]ImportJob, error)
 	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error)
 	CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error)
+	CreateImportJob(ctx context.Context, arg CreateImportJobParams) (ImportJob, error)
+	CreateImportTransaction(ctx context.Context, arg CreateImportTransactionParams) (ImportTransaction, error)
+	CreateLedgerEntry(ctx context.Context, arg CreateLedgerEntryParams) (Entry, error)
+	// adds key without failures unless it has a row already
+	CreateLoginFailure(ctx context.Context, arg CreateLoginFailureParams) error
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (Outbox, error)
 	CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error)
+	CreateWebhookAttempt(ctx context.Context, arg CreateWebhookAttemptParams) (WebhookAttempt, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error)
 	DeleteAccount(ctx context.Context, id int64) error
 	DeleteEntry(ctx context.Context, id int64) error
+	DeleteIdleRateLimitBuckets(ctx context.Context, updatedBefore time.Time) (int64, error)
+	DeleteLoginFailure(ctx context.Context, key string) (int64, error)
+	DeletePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error)
+	DeleteStaleLoginFailures(ctx context.Context, windowStart time.Time) (int64, error)
 	DeleteTransfer(ctx context.Context, id int64) error
+	DeleteWebhook(ctx context.Context, id int64) (int64, error)
+	// takes back a failure counted for key, which unlocks it once it has less than max_failures
+	ForgiveLoginFailure(ctx context.Context, arg ForgiveLoginFailureParams) (LoginFailure, error)
 	GetAccount(ctx context.Context, id int64) (Account, error)
 	GetAccountForUpdate(ctx context.Context, id int64) (Account, error)
 	GetEntry(ctx context.Context, id int64) (Entry, error)
+	GetImportJob(ctx context.Context, id int64) (ImportJob, error)
+	GetImportJobByMessageID(ctx context.Context, arg GetImportJobByMessageIDParams) (ImportJob, error)
+	GetLastAccountEntry(ctx context.Context, accountID int64) (Entry, error)
+	GetLedgerAnchor(ctx context.Context, accountID int64) (LedgerAnchor, error)
+	GetLoginFailure(ctx context.Context, key string) (LoginFailure, error)
+	GetLoginFailureForUpdate(ctx context.Context, key string) (LoginFailure, error)
+	GetOutboxEvent(ctx context.Context, id int64) (Outbox, error)
 	GetTransfer(ctx context.Context, id int64) (Transfer, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	GetUserForUpdate(ctx context.Context, username string) (User, error)
+	GetWebhook(ctx context.Context, id int64) (Webhook, error)
+	GetWebhookDelivery(ctx context.Context, id int64) (WebhookDelivery, error)
+	HasClaimedOutboxEvents(ctx context.Context) (bool, error)
 	ListAccount(ctx context.Context, arg ListAccountParams) ([]Account, error)
+	ListAccountEntries(ctx context.Context, accountID int64) ([]Entry, error)
+	ListAccountEntriesAfter(ctx context.Context, arg ListAccountEntriesAfterParams) ([]ListAccountEntriesAfterRow, error)
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error)
+	ListDeadOutboxEvents(ctx context.Context, arg ListDeadOutboxEventsParams) ([]Outbox, error)
 	ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error)
+	ListEntriesAfter(ctx context.Context, arg ListEntriesAfterParams) ([]Entry, error)
+	ListImportTransactions(ctx context.Context, jobID int64) ([]ImportTransaction, error)
+	ListLedgerAnchors(ctx context.Context) ([]LedgerAnchor, error)
+	ListOwnerAccounts(ctx context.Context, arg ListOwnerAccountsParams) ([]Account, error)
+	ListPendingOutboxEvents(ctx context.Context, limit int32) ([]Outbox, error)
+	ListSubscribedWebhooks(ctx context.Context, arg ListSubscribedWebhooksParams) ([]Webhook, error)
 	ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error)
+	ListWebhookAttempts(ctx context.Context, deliveryID int64) ([]WebhookAttempt, error)
+	ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ListWebhooks(ctx context.Context, owner string) ([]Webhook, error)
+	MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) error
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	ReleaseOutboxEvents(ctx context.Context, ids []int64) error
+	RenewImportJobClaim(ctx context.Context, arg RenewImportJobClaimParams) (ImportJob, error)
+	SetAccountFrozen(ctx context.Context, arg SetAccountFrozenParams) (Account, error)
+	// refills the bucket of key at rate tokens per second up to burst, then takes a token if one is left
+	TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error)
+	TryAdvisoryXactLock(ctx context.Context, lockID int64) (bool, error)
 	UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error)
 	UpdateEntry(ctx context.Context, arg UpdateEntryParams) (Entry, error)
+	UpdateImportJobStatus(ctx context.Context, arg UpdateImportJobStatusParams) (ImportJob, error)
+	UpdateImportTransaction(ctx context.Context, arg UpdateImportTransactionParams) (ImportTransaction, error)
+	UpdateLoginFailure(ctx context.Context, arg UpdateLoginFailureParams) (LoginFailure, error)
 	UpdateTransfers(ctx context.Context, arg UpdateTransfersParams) (Transfer, error)
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) (WebhookDelivery, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,59 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.17.0
+// source: rate_limit.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const deleteIdleRateLimitBuckets = `-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1::timestamptz
+`
+
+func (q *Queries) DeleteIdleRateLimitBuckets(ctx context.Context, updatedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteIdleRateLimitBuckets, updatedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS bucket (
+  key,
+  tokens,
+  allowed
+) VALUES (
+  $1, $2::float8 - 1, true
+)
+ON CONFLICT (key) DO UPDATE SET
+  tokens = LEAST($2::float8, bucket.tokens + GREATEST(EXTRACT(EPOCH FROM now() - bucket.updated_at), 0) * $3::float8)
+    - CASE WHEN LEAST($2::float8, bucket.tokens + GREATEST(EXTRACT(EPOCH FROM now() - bucket.updated_at), 0) * $3::float8) >= 1 THEN 1 ELSE 0 END,
+  allowed = LEAST($2::float8, bucket.tokens + GREATEST(EXTRACT(EPOCH FROM now() - bucket.updated_at), 0) * $3::float8) >= 1,
+  updated_at = now()
+RETURNING tokens, allowed
+`
+
+type TakeRateLimitTokenParams struct {
+	Key   string  `json:"key"`
+	Burst float64 `json:"burst"`
+	Rate  float64 `json:"rate"`
+}
+
+type TakeRateLimitTokenRow struct {
+	Tokens  float64 `json:"tokens"`
+	Allowed bool    `json:"allowed"`
+}
+
+// refills the bucket of key at rate tokens per second up to burst, then takes a token if one is left
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken, arg.Key, arg.Burst, arg.Rate)
+	var i TakeRateLimitTokenRow
+	err := row.Scan(&i.Tokens, &i.Allowed)
+	return i, err
+}
@@ -3,41 +3,116 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"lesson/simple-bank/event"
+	"log/slog"
+	"lesson/simple-bank/metrics"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Store structure for all functions to do queries and transactions
 type Store interface {
 	Querier
+	CreateUserTx(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateAccountTx(ctx context.Context, arg CreateAccountParams) (Account, error)
+	UpdateUserRoleTx(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	SetAccountFrozenTx(ctx context.Context, arg SetAccountFrozenParams) (Account, error)
 	TranserTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	CreateImportJobTx(ctx context.Context, arg CreateImportJobTxParams) (CreateImportJobTxResult, error)
+	CreateWebhookTx(ctx context.Context, arg CreateWebhookParams) (Webhook, error)
+	DeleteWebhookTx(ctx context.Context, id int64) error
+	VerifyLedger(ctx context.Context) (VerifyLedgerResult, error)
+	VerifyAccountLedger(ctx context.Context, accountID int64) (VerifyLedgerResult, error)
+	RelayOutboxTx(ctx context.Context, arg RelayOutboxTxParams) (RelayOutboxTxResult, error)
+	LoginAttemptTx(ctx context.Context, arg LoginAttemptTxParams) (LoginAttemptTxResult, error)
 }
 
 // Store structure for all functions to do queries and transactions
 type SQLStore struct {
 	*Queries
 	db *sql.DB  // for transction db
+	logger *slog.Logger
+	// ledgerKey keys the hashes of the entry chains, see EntryHash
+	ledgerKey []byte
 }
 
-// Create a new Store structure for queries transaction
+// Create a new Store structure for queries transaction, it logs to the default logger
 func NewStore(db *sql.DB) *SQLStore {
+	return NewStoreWithLogger(db, slog.Default())
+}
+
+// NewStoreWithLogger is NewStore logging the retried and failed transactions to logger
+func NewStoreWithLogger(db *sql.DB, logger *slog.Logger) *SQLStore {
 	return &SQLStore{
 		db: db,
-		Queries: New(db),
+		Queries: New(newTracedDBTX(db, nil)),
+		logger: logger,
 	}
 }
 
-// execTX: executes the function witn database transaction
+// SetLedgerKey sets the key of the entry hashes, call it before the store is used.
+// The entries hashed with another key fail verification, so the key must not change
+func (store *SQLStore) SetLedgerKey(key []byte) {
+	store.ledgerKey = key
+}
+
+// maxTxAttempts bounds how often execTX runs a transaction that failed on a serialization failure or a deadlock
+const maxTxAttempts = 3
+
+// txIsolation is the isolation level of the transactions, the default of postgres made explicit for the spans
+const txIsolation = sql.LevelReadCommitted
+
+// execTX: executes the function witn database transaction, fn runs again when postgres aborted the
+// transaction on a serialization failure or a deadlock so it must only change state through q
 func (store *SQLStore) execTX(ctx context.Context, fn func(*Queries) error) error {
-	tx, err := store.db.BeginTx(ctx, nil) 
+	start := time.Now()
+	ctx, span := tracer().Start(ctx, "db.tx", trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.tx.isolation_level", txIsolation.String()),
+	))
+
+	var err error
+	retries := 0
+	for attempt := 1; ; attempt++ {
+		err = store.execTXOnce(ctx, span, fn)
+		if err == nil || attempt == maxTxAttempts || !isRetryable(err) || ctx.Err() != nil {
+			break
+		}
+		retries++
+		store.logger.WarnContext(ctx, "retrying transaction", "attempt", attempt, "error", err)
+		span.AddEvent("retry", trace.WithAttributes(attribute.String("error", err.Error())))
+		metrics.TxRetried()
+	}
+
+	outcome := metrics.TxCommitted
+	if err != nil {
+		outcome = metrics.TxFailed
+	}
+	metrics.ObserveTx(outcome, time.Since(start))
+	span.SetAttributes(attribute.Int("db.tx.retries", retries), attribute.String("db.tx.outcome", outcome))
+	endSpan(span, err)
+	return err
+}
+
+func (store *SQLStore) execTXOnce(ctx context.Context, span trace.Span, fn func(*Queries) error) error {
+	tx, err := store.db.BeginTx(ctx, &sql.TxOptions{Isolation: txIsolation})
 	if err != nil {
-		return nil
+		return err
 	}
 
-	qu := New(tx)
+	qu := New(newTracedDBTX(tx, span))
 	err = fn(qu)
 	if err != nil {
+		metrics.TxRolledBack()
 		if rbErr := tx.Rollback(); rbErr != nil {
-			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+			store.logger.ErrorContext(ctx, "can't roll back transaction", "error", rbErr)
+			return fmt.Errorf("tx err: %w, rb err: %v", err, rbErr)
 		}
 		return err
 	}
@@ -45,6 +120,19 @@ func (store *SQLStore) execTX(ctx context.Context, fn func(*Queries) error) erro
 	return tx.Commit()
 }
 
+// isRetryable tells whether postgres aborted the transaction in favor of a concurrent one
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code.Name() {
+	case "serialization_failure", "deadlock_detected":
+		return true
+	}
+	return false
+}
+
 type TransferTxParams struct {
 	FromAccountID int64 `json:"from_account_id"`
 	ToAccountID int64 `json:"to_account_id"`
@@ -59,9 +147,32 @@ type TransferTxResult struct {
 	ToEntry Entry `json:"to_entry"`
 }
 
+// AccountFrozenError is the error of a transfer from or to a frozen account
+type AccountFrozenError struct {
+	AccountID int64
+}
+
+func (err *AccountFrozenError) Error() string {
+	return fmt.Sprintf("account %d is frozen", err.AccountID)
+}
+
+// InsufficientFundsError is the error of a transfer of more than the balance of the source account
+type InsufficientFundsError struct {
+	AccountID int64
+	// Balance is the balance before the transfer
+	Balance  int64
+	Currency string
+}
+
+func (err *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("account %d has a balance of %d %s", err.AccountID, err.Balance, err.Currency)
+}
+
 
 // TransferTx perform a money transfer from one account to another account
 // Creates the transfer record, account entries, and update accounts' balance in a single transaction.
+// It fails with an *AccountFrozenError when either account is frozen
+// and with an *InsufficientFundsError when the source account can't cover the amount.
 func (store *SQLStore) TranserTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
 	var result TransferTxResult
 
@@ -73,25 +184,7 @@ func (store *SQLStore) TranserTx(ctx context.Context, arg TransferTxParams) (Tra
 			return 
 		}
 
-		// 2.1 From entry
-		result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.FromAccountID,	
-			Amount: -arg.Amount,
-		})
-		if err != nil {
-			return
-		}
-
-		// 2.2 To entry
-		result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.ToAccountID,	
-			Amount: arg.Amount,
-		})
-		if err != nil {
-			return
-		}
-
-		// 3. balance two ammount 
+		// 2. balance two ammount, accounts are locked in id order to avoid deadlock
 		if arg.FromAccountID < arg.ToAccountID {
 			result.FromAccount, result.ToAccount, err = addMoney(ctx, q, arg.FromAccountID, -arg.Amount, arg.ToAccountID, arg.Amount)
 			if err != nil {
@@ -104,7 +197,46 @@ func (store *SQLStore) TranserTx(ctx context.Context, arg TransferTxParams) (Tra
 			}
 		}
 
-		return nil
+		// 2.1 the rows are locked now, so an account can't be frozen or drained between these checks and the commit
+		for _, account := range []Account{result.FromAccount, result.ToAccount} {
+			if account.Frozen {
+				return &AccountFrozenError{AccountID: account.ID}
+			}
+		}
+		if result.FromAccount.Balance < 0 {
+			return &InsufficientFundsError{
+				AccountID: result.FromAccount.ID,
+				Balance:   result.FromAccount.Balance + arg.Amount,
+				Currency:  result.FromAccount.Currency,
+			}
+		}
+
+		// 3.1 From entry, chained while the account row is still locked
+		result.FromEntry, err = appendLedgerEntry(ctx, q, store.ledgerKey, arg.FromAccountID, -arg.Amount, result.Transfer.ID)
+		if err != nil {
+			return
+		}
+
+		// 3.2 To entry
+		result.ToEntry, err = appendLedgerEntry(ctx, q, store.ledgerKey, arg.ToAccountID, arg.Amount, result.Transfer.ID)
+		if err != nil {
+			return
+		}
+
+		// 4. audit log and domain event
+		transferID := strconv.FormatInt(result.Transfer.ID, 10)
+		err = recordAuditEvent(ctx, q, AuditActionCreateTransfer, "transfer", transferID, nil, result)
+		if err != nil {
+			return
+		}
+
+		return enqueueEvent(ctx, q, event.AggregateTransfer, transferID, event.TransferCreatedV1{
+			TransferID:    result.Transfer.ID,
+			FromAccountID: result.Transfer.FromAccountID,
+			ToAccountID:   result.Transfer.ToAccountID,
+			Amount:        result.Transfer.Amount,
+			Currency:      result.FromAccount.Currency,
+		})
 	})
 
 	return result, err
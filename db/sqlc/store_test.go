@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"testing"
 
+	"lesson/simple-bank/db/dbtest"
+
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 )
 
 func TestTransferTx(t *testing.T) {
+	testDB := dbtest.NewDB(t)
 	testStore := NewStore(testDB)
 	
 	// test situation: two account make the several transfers
-	account1 := CreateRandomAccount(t)
-	account2 := CreateRandomAccount(t)
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
 
 	// run n concorrent transfer transcations
 	n := 5
@@ -115,11 +119,12 @@ func TestTransferTx(t *testing.T) {
 }
 
 func TestTransferTxDeadLock(t *testing.T) {
+	testDB := dbtest.NewDB(t)
 	testStore := NewStore(testDB)
 	
 	// test situation: two account make the several transfers
-	account1 := CreateRandomAccount(t)
-	account2 := CreateRandomAccount(t)
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
 
 	// run n concorrent transfer transcations
 	n := 20
@@ -156,4 +161,36 @@ func TestTransferTxDeadLock(t *testing.T) {
 	fmt.Println("UPDATED: ", updateAccount1.Balance, updateAccount2.Balance)
 	require.Equal(t, updateAccount1.Balance, account1.Balance)
 	require.Equal(t, updateAccount2.Balance, account2.Balance)
-}
\ No newline at end of file
+}
+func TestExecTXRetry(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testStore := NewStore(testDB)
+
+	attempts := 0
+	err := testStore.execTX(context.Background(), func(q *Queries) error {
+		attempts++
+		if attempts == 1 {
+			return &pq.Error{Code: "40P01", Message: "deadlock detected"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+
+	// other errors and the last attempt are returned as they are
+	attempts = 0
+	err = testStore.execTX(context.Background(), func(q *Queries) error {
+		attempts++
+		return &pq.Error{Code: "40001", Message: "could not serialize access"}
+	})
+	require.True(t, isRetryable(err))
+	require.Equal(t, maxTxAttempts, attempts)
+
+	attempts = 0
+	err = testStore.execTX(context.Background(), func(q *Queries) error {
+		attempts++
+		return fmt.Errorf("failed")
+	})
+	require.EqualError(t, err, "failed")
+	require.Equal(t, 1, attempts)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the tracer of the transaction and query spans
+const tracerName = "lesson/simple-bank/db"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// tracedDBTX starts a span for every query run through db. The queries of a transaction
+// are children of the transaction span, the closures of execTX use the context of the caller.
+type tracedDBTX struct {
+	db     DBTX
+	txSpan trace.Span
+}
+
+func newTracedDBTX(db DBTX, txSpan trace.Span) *tracedDBTX {
+	return &tracedDBTX{db: db, txSpan: txSpan}
+}
+
+func (t *tracedDBTX) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	if t.txSpan != nil {
+		ctx = trace.ContextWithSpan(ctx, t.txSpan)
+	}
+	name := queryName(query)
+	return tracer().Start(ctx, "db."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", name),
+			attribute.String("db.statement", query),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t *tracedDBTX) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	endSpan(span, err)
+	return stmt, err
+}
+
+func (t *tracedDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (t *tracedDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+// queryName returns the name of a sqlc query from its "-- name: GetAccount :one" header
+func queryName(query string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(query, prefix) {
+		return "query"
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(query, prefix), " ")
+	return name
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"lesson/simple-bank/db/dbtest"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+	return recorder
+}
+
+func TestTransferTxSpans(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	recorder := recordSpans(t)
+	testStore := NewStore(testDB)
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	_, err := testStore.TranserTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10})
+	require.NoError(t, err)
+	parent.End()
+
+	var tx sdktrace.ReadOnlySpan
+	names := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = span
+		if span.Name() == "db.tx" {
+			tx = span
+		}
+	}
+	require.NotNil(t, tx)
+	require.Equal(t, parent.SpanContext().SpanID(), tx.Parent().SpanID())
+	require.Contains(t, tx.Attributes(), attribute.String("db.tx.isolation_level", "Read Committed"))
+	require.Contains(t, tx.Attributes(), attribute.Int("db.tx.retries", 0))
+
+	// the queries of the transaction are children of its span
+	addBalance, ok := names["db.AddAccountBalance"]
+	require.True(t, ok)
+	require.Equal(t, tx.SpanContext().SpanID(), addBalance.Parent().SpanID())
+	require.Contains(t, addBalance.Attributes(), attribute.String("db.operation", "AddAccountBalance"))
+}
+
+func TestExecTXRetrySpan(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	recorder := recordSpans(t)
+	testStore := NewStore(testDB)
+
+	attempts := 0
+	err := testStore.execTX(context.Background(), func(q *Queries) error {
+		attempts++
+		if attempts == 1 {
+			return &pq.Error{Code: "40001", Message: "could not serialize access"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Contains(t, spans[0].Attributes(), attribute.Int("db.tx.retries", 1))
+	require.Len(t, spans[0].Events(), 1)
+}
+
+func TestQueryName(t *testing.T) {
+	require.Equal(t, "GetAccount", queryName(getAccount))
+	require.Equal(t, "query", queryName("SELECT 1"))
+}
@@ -2,16 +2,19 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 
+	"lesson/simple-bank/db/dbtest"
 	"lesson/simple-bank/utils"
 
 	"github.com/stretchr/testify/require"
 )
 
-func CreateRandomTransfer(t *testing.T) Transfer {
-	account1 := CreateRandomAccount(t)
-	account2 := CreateRandomAccount(t)
+func CreateRandomTransfer(t *testing.T, testDB *sql.DB) Transfer {
+	testQueries := New(testDB)
+	account1 := CreateRandomAccount(t, testDB)
+	account2 := CreateRandomAccount(t, testDB)
 	arg := CreateTransferParams {
 		FromAccountID: account1.ID,
 		ToAccountID: account2.ID,
@@ -29,12 +32,15 @@ func CreateRandomTransfer(t *testing.T) Transfer {
 }
 
 func TestCreateTransfer(t *testing.T) {
-	CreateRandomTransfer(t)
+	testDB := dbtest.NewDB(t)
+	CreateRandomTransfer(t, testDB)
 }
 
 
 func TestGetTransfer(t *testing.T) {
-	transfer1 := CreateRandomTransfer(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	transfer1 := CreateRandomTransfer(t, testDB)
 	transfer2, err := testQueries.GetTransfer(context.Background(), transfer1.ID)
 	require.NoError(t, err)
 	require.NotEmpty(t, transfer2)
@@ -48,8 +54,10 @@ func TestGetTransfer(t *testing.T) {
 }
 
 func TestListTransfers(t *testing.T) {
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
 	for i := 0; i < 10; i++ {
-		CreateRandomTransfer(t)
+		CreateRandomTransfer(t, testDB)
 	}
 	arg := ListTransfersParams{
 		Offset: 5,
@@ -61,7 +69,9 @@ func TestListTransfers(t *testing.T) {
 }
 
 func TestUpdateTransfer(t *testing.T) {
-	transfer1 := CreateRandomTransfer(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	transfer1 := CreateRandomTransfer(t, testDB)
 	newTo := transfer1.FromAccountID
 	newFrom := transfer1.ToAccountID
 	arg := UpdateTransfersParams{
@@ -81,7 +91,9 @@ func TestUpdateTransfer(t *testing.T) {
 }
 
 func TestDeleteTransfer(t *testing.T) {
-	transfer1 := CreateRandomTransfer(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	transfer1 := CreateRandomTransfer(t, testDB)
 	err := testQueries.DeleteTransfer(context.Background(), transfer1.ID)
 	require.NoError(t, err)
 
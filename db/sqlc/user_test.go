@@ -2,14 +2,17 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 
+	"lesson/simple-bank/db/dbtest"
 	"lesson/simple-bank/utils"
 
 	"github.com/stretchr/testify/require"
 )
 
-func CreateRandomUser(t *testing.T) User {
+func CreateRandomUser(t *testing.T, testDB *sql.DB) User {
+	testQueries := New(testDB)
 	hashPd, err := utils.HashedPassword(utils.RandomString(6))
 	require.NoError(t, err)
 
@@ -31,11 +34,14 @@ func CreateRandomUser(t *testing.T) User {
 }
 
 func TestCreateUser(t *testing.T) {
-	CreateRandomUser(t)
+	testDB := dbtest.NewDB(t)
+	CreateRandomUser(t, testDB)
 }
 
 func TestGetUser(t *testing.T) {
-	user1 := CreateRandomUser(t)
+	testDB := dbtest.NewDB(t)
+	testQueries := New(testDB)
+	user1 := CreateRandomUser(t, testDB)
 	user2, err := testQueries.GetUser(context.Background(), user1.Username)
 	require.NoError(t, err)
 	require.NotEmpty(t, user2)
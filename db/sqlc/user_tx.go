@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"lesson/simple-bank/event"
+)
+
+// CreateUserTx creates a user, records it in the audit log and publishes UserCreated
+func (store *SQLStore) CreateUserTx(ctx context.Context, arg CreateUserParams) (User, error) {
+	var user User
+
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		user, err = q.CreateUser(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		err = recordAuditEvent(ctx, q, AuditActionCreateUser, "user", user.Username, nil, NewAuditUser(user))
+		if err != nil {
+			return
+		}
+
+		return enqueueEvent(ctx, q, event.AggregateUser, user.Username, event.UserCreatedV1{
+			Username: user.Username,
+			FullName: user.FullName,
+			Email:    user.Email,
+		})
+	})
+
+	return user, err
+}
+
+// UpdateUserRoleTx changes the role of a user and records it in the audit log
+func (store *SQLStore) UpdateUserRoleTx(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	var user User
+
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		before, err := q.GetUserForUpdate(ctx, arg.Username)
+		if err != nil {
+			return
+		}
+
+		user, err = q.UpdateUserRole(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		return recordAuditEvent(ctx, q, AuditActionUpdateUserRole, "user", user.Username, NewAuditUser(before), NewAuditUser(user))
+	})
+
+	return user, err
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// CreateWebhookTx registers a webhook and records it in the audit log, its secret is left out of the log
+func (store *SQLStore) CreateWebhookTx(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	var webhook Webhook
+
+	err := store.execTX(ctx, func(q *Queries) (err error) {
+		webhook, err = q.CreateWebhook(ctx, arg)
+		if err != nil {
+			return
+		}
+
+		return recordAuditEvent(ctx, q, AuditActionCreateWebhook, "webhook", strconv.FormatInt(webhook.ID, 10), nil, NewAuditWebhook(webhook))
+	})
+
+	return webhook, err
+}
+
+// DeleteWebhookTx deletes a webhook with its deliveries and records it in the audit log,
+// it fails with sql.ErrNoRows when the webhook doesn't exist anymore
+func (store *SQLStore) DeleteWebhookTx(ctx context.Context, id int64) error {
+	return store.execTX(ctx, func(q *Queries) error {
+		before, err := q.GetWebhook(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := q.DeleteWebhook(ctx, id)
+		if err != nil {
+			return err
+		}
+		// a concurrent request deleted it first
+		if deleted == 0 {
+			return sql.ErrNoRows
+		}
+
+		return recordAuditEvent(ctx, q, AuditActionDeleteWebhook, "webhook", strconv.FormatInt(id, 10), NewAuditWebhook(before), nil)
+	})
+}
@@ -0,0 +1,1489 @@
+// Package storetest is the conformance suite of db.Store. It runs the same cases against
+// db.SQLStore and memstore.Store so the in-memory store can't drift from Postgres.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/event"
+	"lesson/simple-bank/utils"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// missingID is an id no row has
+const missingID = math.MaxInt64
+
+// Run runs the suite against the stores returned by newStore.
+// The store may share its data with other tests, so every case creates its own
+// users and accounts and only looks at the rows it created.
+func Run(t *testing.T, newStore func(t *testing.T) db.Store) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, store db.Store)
+	}{
+		{"Users", testUsers},
+		{"Accounts", testAccounts},
+		{"DeleteAccount", testDeleteAccount},
+		{"TransferTx", testTransferTx},
+		{"TransferTxConcurrent", testTransferTxConcurrent},
+		{"TransferTxDeadlock", testTransferTxDeadlock},
+		{"TransferTxRollback", testTransferTxRollback},
+		{"TransferTxFrozen", testTransferTxFrozen},
+		{"TransferTxInsufficientFunds", testTransferTxInsufficientFunds},
+		{"Entries", testEntries},
+		{"Ledger", testLedger},
+		{"LedgerAnchor", testLedgerAnchor},
+		{"ImportJobTx", testImportJobTx},
+		{"ImportJobClaim", testImportJobClaim},
+		{"AuditEvents", testAuditEvents},
+		{"AuditedAdminTx", testAuditedAdminTx},
+		{"AuditedWebhookTx", testAuditedWebhookTx},
+		{"Outbox", testOutbox},
+		{"OutboxClaim", testOutboxClaim},
+		{"OutboxRetries", testOutboxRetries},
+		{"Webhooks", testWebhooks},
+		{"RateLimits", testRateLimits},
+		{"LoginFailures", testLoginFailures},
+		{"LoginAttemptTxConcurrent", testLoginAttemptTxConcurrent},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, newStore(t))
+		})
+	}
+}
+
+// requireViolation checks err is the Postgres error with the given code on the given constraint
+func requireViolation(t *testing.T, err error, code pq.ErrorCode, constraint string) {
+	var pqErr *pq.Error
+	require.True(t, errors.As(err, &pqErr), "expected a *pq.Error, got %v", err)
+	require.Equal(t, code, pqErr.Code)
+	require.Equal(t, constraint, pqErr.Constraint)
+}
+
+const (
+	uniqueViolation     = pq.ErrorCode("23505")
+	foreignKeyViolation = pq.ErrorCode("23503")
+)
+
+func createUser(t *testing.T, store db.Store) db.User {
+	hashedPassword, err := utils.HashedPassword(utils.RandomString(6))
+	require.NoError(t, err)
+
+	user, err := store.CreateUserTx(context.Background(), db.CreateUserParams{
+		Username:       utils.RandomOwner(),
+		HashedPassword: hashedPassword,
+		FullName:       utils.RandomOwner(),
+		Email:          utils.RandomEmail(),
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func createAccount(t *testing.T, store db.Store, owner string, currency string, balance int64) db.Account {
+	account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    owner,
+		Balance:  balance,
+		Currency: currency,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func transfer(t *testing.T, store db.Store, from db.Account, to db.Account, amount int64) db.TransferTxResult {
+	result, err := store.TranserTx(context.Background(), db.TransferTxParams{
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        amount,
+	})
+	require.NoError(t, err)
+	return result
+}
+
+func testUsers(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	require.Equal(t, utils.DepositorRole, user.Role)
+	require.NotZero(t, user.CreatedAt)
+	require.NotZero(t, user.PasswordChangeAt)
+
+	got, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, got.Username)
+	require.Equal(t, user.HashedPassword, got.HashedPassword)
+	require.Equal(t, user.FullName, got.FullName)
+	require.Equal(t, user.Email, got.Email)
+	require.WithinDuration(t, user.CreatedAt, got.CreatedAt, 0)
+
+	_, err = store.CreateUserTx(ctx, db.CreateUserParams{
+		Username: user.Username,
+		FullName: user.FullName,
+		Email:    utils.RandomEmail(),
+	})
+	requireViolation(t, err, uniqueViolation, "users_pkey")
+
+	other := utils.RandomOwner()
+	_, err = store.CreateUserTx(ctx, db.CreateUserParams{
+		Username: other,
+		FullName: other,
+		Email:    user.Email,
+	})
+	requireViolation(t, err, uniqueViolation, "users_email_key")
+
+	// the failed transaction left nothing behind
+	_, err = store.GetUser(ctx, other)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	events, err := store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		ResourceType: sql.NullString{String: "user", Valid: true},
+		ResourceID:   sql.NullString{String: other, Valid: true},
+		Size:         10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	updated, err := store.UpdateUserRole(ctx, db.UpdateUserRoleParams{Role: utils.AdminRole, Username: user.Username})
+	require.NoError(t, err)
+	require.Equal(t, utils.AdminRole, updated.Role)
+
+	_, err = store.UpdateUserRole(ctx, db.UpdateUserRoleParams{Role: utils.AdminRole, Username: utils.RandomString(12)})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testAccounts(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	account, err := store.CreateAccountTx(ctx, db.CreateAccountParams{Owner: user.Username, Currency: "USD"})
+	require.NoError(t, err)
+	require.NotZero(t, account.ID)
+	require.Equal(t, user.Username, account.Owner)
+	require.Zero(t, account.Balance)
+	require.Equal(t, "USD", account.Currency)
+	require.False(t, account.Frozen)
+
+	got, err := store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance, got.Balance)
+	require.WithinDuration(t, account.CreatedAt, got.CreatedAt, 0)
+
+	_, err = store.CreateAccountTx(ctx, db.CreateAccountParams{Owner: user.Username, Currency: "USD"})
+	requireViolation(t, err, uniqueViolation, "owner_currency_key")
+
+	_, err = store.CreateAccountTx(ctx, db.CreateAccountParams{Owner: utils.RandomString(12), Currency: "USD"})
+	requireViolation(t, err, foreignKeyViolation, "accounts_owner_fkey")
+
+	_, err = store.GetAccount(ctx, missingID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	eur := createAccount(t, store, user.Username, "EUR", 0)
+	accounts, err := store.ListOwnerAccounts(ctx, db.ListOwnerAccountsParams{Owner: user.Username, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	require.Equal(t, account.ID, accounts[0].ID)
+	require.Equal(t, eur.ID, accounts[1].ID)
+
+	accounts, err = store.ListOwnerAccounts(ctx, db.ListOwnerAccountsParams{Owner: user.Username, Limit: 10, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	require.Equal(t, eur.ID, accounts[0].ID)
+
+	accounts, err = store.ListOwnerAccounts(ctx, db.ListOwnerAccountsParams{Owner: utils.RandomString(12), Limit: 10})
+	require.NoError(t, err)
+	require.NotNil(t, accounts)
+	require.Empty(t, accounts)
+
+	_, err = store.ListOwnerAccounts(ctx, db.ListOwnerAccountsParams{Owner: user.Username, Limit: -1})
+	require.Error(t, err)
+
+	added, err := store.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: account.ID, Amount: 25})
+	require.NoError(t, err)
+	require.Equal(t, int64(25), added.Balance)
+
+	updated, err := store.UpdateAccount(ctx, db.UpdateAccountParams{ID: account.ID, Balance: 7})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), updated.Balance)
+
+	_, err = store.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: missingID, Amount: 25})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	locked, err := store.GetAccountForUpdate(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), locked.Balance)
+
+	frozen, err := store.SetAccountFrozen(ctx, db.SetAccountFrozenParams{ID: account.ID, Frozen: true})
+	require.NoError(t, err)
+	require.True(t, frozen.Frozen)
+	require.Equal(t, int64(7), frozen.Balance)
+
+	got, err = store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.True(t, got.Frozen)
+
+	_, err = store.SetAccountFrozen(ctx, db.SetAccountFrozenParams{ID: missingID, Frozen: true})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testDeleteAccount(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	account1 := createAccount(t, store, user.Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	unused := createAccount(t, store, user.Username, "EUR", 0)
+
+	require.NoError(t, store.DeleteAccount(ctx, unused.ID))
+	_, err := store.GetAccount(ctx, unused.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.NoError(t, store.DeleteAccount(ctx, unused.ID))
+
+	result := transfer(t, store, account1, account2, 10)
+	err = store.DeleteAccount(ctx, account1.ID)
+	requireViolation(t, err, foreignKeyViolation, "entries_account_id_fkey")
+
+	err = store.DeleteTransfer(ctx, result.Transfer.ID)
+	requireViolation(t, err, foreignKeyViolation, "entries_transfer_id_fkey")
+
+	_, err = store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+}
+
+func testTransferTx(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	result := transfer(t, store, account1, account2, 10)
+
+	require.NotZero(t, result.Transfer.ID)
+	require.Equal(t, account1.ID, result.Transfer.FromAccountID)
+	require.Equal(t, account2.ID, result.Transfer.ToAccountID)
+	require.Equal(t, int64(10), result.Transfer.Amount)
+	require.Equal(t, int64(90), result.FromAccount.Balance)
+	require.Equal(t, int64(110), result.ToAccount.Balance)
+
+	require.Equal(t, account1.ID, result.FromEntry.AccountID)
+	require.Equal(t, int64(-10), result.FromEntry.Amount)
+	require.Equal(t, sql.NullInt64{Int64: result.Transfer.ID, Valid: true}, result.FromEntry.TransferID)
+	require.Nil(t, result.FromEntry.PrevHash)
+	require.Equal(t, db.EntryHash(nil, nil, account1.ID, -10, result.Transfer.ID, result.FromEntry.CreatedAt), result.FromEntry.Hash)
+	require.Equal(t, account2.ID, result.ToEntry.AccountID)
+	require.Equal(t, int64(10), result.ToEntry.Amount)
+
+	transfer, err := store.GetTransfer(ctx, result.Transfer.ID)
+	require.NoError(t, err)
+	require.Equal(t, result.Transfer.Amount, transfer.Amount)
+	require.WithinDuration(t, result.Transfer.CreatedAt, transfer.CreatedAt, 0)
+
+	entry, err := store.GetEntry(ctx, result.ToEntry.ID)
+	require.NoError(t, err)
+	require.Equal(t, result.ToEntry.Hash, entry.Hash)
+	require.WithinDuration(t, result.ToEntry.CreatedAt, entry.CreatedAt, 0)
+
+	for _, account := range []db.Account{result.FromAccount, result.ToAccount} {
+		got, err := store.GetAccount(ctx, account.ID)
+		require.NoError(t, err)
+		require.Equal(t, account.Balance, got.Balance)
+	}
+
+	events, err := store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		Action:     sql.NullString{String: db.AuditActionCreateTransfer, Valid: true},
+		ResourceID: sql.NullString{String: strconv.FormatInt(result.Transfer.ID, 10), Valid: true},
+		Size:       10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "transfer", events[0].ResourceType)
+	require.JSONEq(t, "null", string(events[0].Before))
+}
+
+func testTransferTxConcurrent(t *testing.T, store db.Store) {
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 1000)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 1000)
+
+	n := 10
+	amount := int64(10)
+	errs := make(chan error, n)
+	results := make(chan db.TransferTxResult, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			result, err := store.TranserTx(context.Background(), db.TransferTxParams{
+				FromAccountID: account1.ID,
+				ToAccountID:   account2.ID,
+				Amount:        amount,
+			})
+			errs <- err
+			results <- result
+		}()
+	}
+
+	// every transfer saw the balance left by the previous one
+	seen := make(map[int64]bool)
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+		result := <-results
+		k := (account1.Balance - result.FromAccount.Balance) / amount
+		require.True(t, k >= 1 && k <= int64(n))
+		require.False(t, seen[k])
+		seen[k] = true
+	}
+
+	requireBalance(t, store, account1.ID, account1.Balance-int64(n)*amount)
+	requireBalance(t, store, account2.ID, account2.Balance+int64(n)*amount)
+	requireValidLedger(t, store, account1.ID, int64(n))
+	requireValidLedger(t, store, account2.ID, int64(n))
+}
+
+func testTransferTxDeadlock(t *testing.T, store db.Store) {
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 1000)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 1000)
+
+	n := 20
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		from, to := account1, account2
+		if i%2 == 1 {
+			from, to = account2, account1
+		}
+		go func() {
+			_, err := store.TranserTx(ctx, db.TransferTxParams{
+				FromAccountID: from.ID,
+				ToAccountID:   to.ID,
+				Amount:        10,
+			})
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	requireBalance(t, store, account1.ID, account1.Balance)
+	requireBalance(t, store, account2.ID, account2.Balance)
+	requireValidLedger(t, store, account1.ID, int64(n))
+	requireValidLedger(t, store, account2.ID, int64(n))
+}
+
+func testTransferTxRollback(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	_, err := store.TranserTx(ctx, db.TransferTxParams{
+		FromAccountID: account.ID,
+		ToAccountID:   missingID,
+		Amount:        10,
+	})
+	requireViolation(t, err, foreignKeyViolation, "transfers_to_account_id_fkey")
+
+	_, err = store.TranserTx(ctx, db.TransferTxParams{
+		FromAccountID: missingID,
+		ToAccountID:   account.ID,
+		Amount:        10,
+	})
+	requireViolation(t, err, foreignKeyViolation, "transfers_from_account_id_fkey")
+
+	requireBalance(t, store, account.ID, account.Balance)
+	entries, err := store.ListAccountEntries(ctx, account.ID)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func testTransferTxFrozen(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	// either side being frozen rolls the transfer back
+	for _, frozen := range []db.Account{account1, account2} {
+		_, err := store.SetAccountFrozen(ctx, db.SetAccountFrozenParams{ID: frozen.ID, Frozen: true})
+		require.NoError(t, err)
+
+		_, err = store.TranserTx(ctx, db.TransferTxParams{
+			FromAccountID: account1.ID,
+			ToAccountID:   account2.ID,
+			Amount:        10,
+		})
+		var frozenErr *db.AccountFrozenError
+		require.ErrorAs(t, err, &frozenErr)
+		require.Equal(t, frozen.ID, frozenErr.AccountID)
+
+		_, err = store.SetAccountFrozen(ctx, db.SetAccountFrozenParams{ID: frozen.ID, Frozen: false})
+		require.NoError(t, err)
+	}
+
+	requireBalance(t, store, account1.ID, account1.Balance)
+	requireBalance(t, store, account2.ID, account2.Balance)
+	entries, err := store.ListAccountEntries(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func testTransferTxInsufficientFunds(t *testing.T, store db.Store) {
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 0)
+
+	// concurrent transfers see the balance left by each other, none of them overdraws
+	n := 15
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := store.TranserTx(context.Background(), db.TransferTxParams{
+				FromAccountID: account1.ID,
+				ToAccountID:   account2.ID,
+				Amount:        10,
+			})
+			errs <- err
+		}()
+	}
+
+	refused := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		var insufficient *db.InsufficientFundsError
+		if errors.As(err, &insufficient) {
+			require.Equal(t, account1.ID, insufficient.AccountID)
+			require.Zero(t, insufficient.Balance)
+			require.Equal(t, "USD", insufficient.Currency)
+			refused++
+			continue
+		}
+		require.NoError(t, err)
+	}
+	require.Equal(t, n-10, refused)
+
+	requireBalance(t, store, account1.ID, 0)
+	requireBalance(t, store, account2.ID, 100)
+	requireValidLedger(t, store, account1.ID, 10)
+}
+
+func testEntries(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	_, err := store.GetLastAccountEntry(ctx, account1.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = store.CreateEntry(ctx, db.CreateEntryParams{AccountID: missingID, Amount: 10})
+	requireViolation(t, err, foreignKeyViolation, "entries_account_id_fkey")
+
+	result1 := transfer(t, store, account1, account2, 10)
+	result2 := transfer(t, store, account2, account1, 30)
+	result3 := transfer(t, store, account1, account2, 5)
+
+	last, err := store.GetLastAccountEntry(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, result3.FromEntry.ID, last.ID)
+
+	entries, err := store.ListAccountEntries(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, []int64{result1.FromEntry.ID, result2.ToEntry.ID, result3.FromEntry.ID},
+		[]int64{entries[0].ID, entries[1].ID, entries[2].ID})
+	require.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	require.Equal(t, entries[1].Hash, entries[2].PrevHash)
+
+	rows, err := store.ListAccountEntriesAfter(ctx, db.ListAccountEntriesAfterParams{AccountID: account1.ID, Size: 10})
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, []int64{90, 120, 115}, []int64{rows[0].Balance, rows[1].Balance, rows[2].Balance})
+
+	rows, err = store.ListAccountEntriesAfter(ctx, db.ListAccountEntriesAfterParams{AccountID: account1.ID, AfterID: rows[0].ID, Size: 1})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, result2.ToEntry.ID, rows[0].ID)
+	require.Equal(t, int64(120), rows[0].Balance)
+
+	after, err := store.ListEntriesAfter(ctx, db.ListEntriesAfterParams{AfterID: result3.FromEntry.ID, Size: 1})
+	require.NoError(t, err)
+	require.Len(t, after, 1)
+	require.Equal(t, result3.ToEntry.ID, after[0].ID)
+
+	entry, err := store.CreateEntry(ctx, db.CreateEntryParams{AccountID: account2.ID, Amount: 10})
+	require.NoError(t, err)
+	require.False(t, entry.TransferID.Valid)
+	require.Nil(t, entry.Hash)
+
+	updated, err := store.UpdateEntry(ctx, db.UpdateEntryParams{ID: entry.ID, Amount: 20})
+	require.NoError(t, err)
+	require.Equal(t, int64(20), updated.Amount)
+
+	require.NoError(t, store.DeleteEntry(ctx, entry.ID))
+	_, err = store.GetEntry(ctx, entry.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.UpdateEntry(ctx, db.UpdateEntryParams{ID: entry.ID, Amount: 20})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testLedger(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	transfer(t, store, account1, account2, 10)
+	result := transfer(t, store, account1, account2, 10)
+	transfer(t, store, account1, account2, 10)
+	requireValidLedger(t, store, account1.ID, 3)
+
+	_, err := store.UpdateEntry(ctx, db.UpdateEntryParams{ID: result.FromEntry.ID, Amount: -1})
+	require.NoError(t, err)
+
+	verified, err := store.VerifyAccountLedger(ctx, account1.ID)
+	require.NoError(t, err)
+	require.False(t, verified.Valid)
+	require.Equal(t, int64(2), verified.EntriesChecked)
+	require.Equal(t, &db.BrokenLink{
+		AccountID: account1.ID,
+		EntryID:   result.FromEntry.ID,
+		Reason:    "hash does not match the entry content",
+	}, verified.BrokenLink)
+
+	verified, err = store.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.False(t, verified.Valid)
+
+	// restore the amount so later tests sharing the database see a valid ledger
+	_, err = store.UpdateEntry(ctx, db.UpdateEntryParams{ID: result.FromEntry.ID, Amount: result.FromEntry.Amount})
+	require.NoError(t, err)
+	requireValidLedger(t, store, account1.ID, 3)
+}
+
+func testLedgerAnchor(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	first := transfer(t, store, account1, account2, 10)
+	last := transfer(t, store, account1, account2, 10)
+	requireValidLedger(t, store, account1.ID, 2)
+
+	anchor, err := store.GetLedgerAnchor(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, first.FromEntry.ID, anchor.FirstEntryID)
+	require.Equal(t, last.FromEntry.ID, anchor.HeadEntryID)
+	require.Equal(t, last.FromEntry.Hash, anchor.HeadHash)
+
+	// past the first chained entry every entry must be chained
+	unchained, err := store.CreateEntry(ctx, db.CreateEntryParams{AccountID: account1.ID, Amount: 5})
+	require.NoError(t, err)
+	verified, err := store.VerifyAccountLedger(ctx, account1.ID)
+	require.NoError(t, err)
+	require.False(t, verified.Valid)
+	require.Equal(t, &db.BrokenLink{
+		AccountID: account1.ID,
+		EntryID:   unchained.ID,
+		Reason:    "entry is not chained",
+	}, verified.BrokenLink)
+	require.NoError(t, store.DeleteEntry(ctx, unchained.ID))
+	requireValidLedger(t, store, account1.ID, 2)
+
+	// removing the last entry leaves the chain short of its anchored head
+	require.NoError(t, store.DeleteEntry(ctx, last.FromEntry.ID))
+	verified, err = store.VerifyAccountLedger(ctx, account1.ID)
+	require.NoError(t, err)
+	require.False(t, verified.Valid)
+	require.Equal(t, &db.BrokenLink{
+		AccountID: account1.ID,
+		EntryID:   last.FromEntry.ID,
+		Reason:    "chain does not end at the anchored head",
+	}, verified.BrokenLink)
+
+	verified, err = store.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.False(t, verified.Valid)
+
+	// move the anchor back to the remaining head so later tests sharing the database see a valid ledger
+	anchor, err = store.AdvanceLedgerAnchor(ctx, db.AdvanceLedgerAnchorParams{
+		AccountID: account1.ID,
+		EntryID:   first.FromEntry.ID,
+		Hash:      first.FromEntry.Hash,
+	})
+	require.NoError(t, err)
+	require.Equal(t, first.FromEntry.ID, anchor.FirstEntryID)
+	requireValidLedger(t, store, account1.ID, 1)
+}
+
+func testImportJobTx(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	arg := db.CreateImportJobTxParams{
+		Owner:           account1.Owner,
+		MessageID:       utils.RandomString(16),
+		MessageName:     "pain.001.001.09",
+		InitiatingParty: utils.RandomOwner(),
+		Transactions: []db.CreateImportTransactionParams{
+			{PaymentInfoID: "PMT-1", EndToEndID: "E2E-1", FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: "USD"},
+			{PaymentInfoID: "PMT-1", EndToEndID: "E2E-2", FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 20, Currency: "USD"},
+		},
+	}
+	result, err := store.CreateImportJobTx(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.MessageID, result.Job.MessageID)
+	require.Equal(t, int64(2), result.Job.TxCount)
+	require.Equal(t, "PDNG", result.Job.Status)
+	require.False(t, result.Job.FinishedAt.Valid)
+	require.Len(t, result.Transactions, 2)
+	for i, importTx := range result.Transactions {
+		require.Equal(t, result.Job.ID, importTx.JobID)
+		require.Equal(t, arg.Transactions[i].EndToEndID, importTx.EndToEndID)
+		require.Equal(t, "PDNG", importTx.Status)
+		require.Empty(t, importTx.ReasonCode)
+		require.False(t, importTx.TransferID.Valid)
+	}
+
+	require.Equal(t, account1.Owner, result.Job.Owner)
+
+	// a message id is unique per owner
+	_, err = store.CreateImportJobTx(ctx, arg)
+	requireViolation(t, err, uniqueViolation, "import_jobs_owner_message_id_key")
+	other := arg
+	other.Owner = account2.Owner
+	otherResult, err := store.CreateImportJobTx(ctx, other)
+	require.NoError(t, err)
+	require.NotEqual(t, result.Job.ID, otherResult.Job.ID)
+	other.Owner = utils.RandomOwner()
+	_, err = store.CreateImportJobTx(ctx, other)
+	requireViolation(t, err, foreignKeyViolation, "import_jobs_owner_fkey")
+
+	job, err := store.GetImportJobByMessageID(ctx, db.GetImportJobByMessageIDParams{Owner: arg.Owner, MessageID: arg.MessageID})
+	require.NoError(t, err)
+	require.Equal(t, result.Job.ID, job.ID)
+	_, err = store.GetImportJobByMessageID(ctx, db.GetImportJobByMessageIDParams{Owner: arg.Owner, MessageID: utils.RandomString(16)})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	importTxs, err := store.ListImportTransactions(ctx, job.ID)
+	require.NoError(t, err)
+	require.Len(t, importTxs, 2)
+
+	_, err = store.UpdateImportTransaction(ctx, db.UpdateImportTransactionParams{
+		ID:         importTxs[0].ID,
+		Status:     "ACSC",
+		TransferID: sql.NullInt64{Int64: missingID, Valid: true},
+	})
+	requireViolation(t, err, foreignKeyViolation, "import_transactions_transfer_id_fkey")
+
+	transferred := transfer(t, store, account1, account2, 10)
+	importTx, err := store.UpdateImportTransaction(ctx, db.UpdateImportTransactionParams{
+		ID:         importTxs[0].ID,
+		Status:     "ACSC",
+		TransferID: sql.NullInt64{Int64: transferred.Transfer.ID, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ACSC", importTx.Status)
+
+	finishedAt := time.Now().Truncate(time.Microsecond)
+	job, err = store.UpdateImportJobStatus(ctx, db.UpdateImportJobStatusParams{
+		ID:         job.ID,
+		Status:     "ACSC",
+		FinishedAt: sql.NullTime{Time: finishedAt, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ACSC", job.Status)
+	require.WithinDuration(t, finishedAt, job.FinishedAt.Time, 0)
+
+	_, err = store.GetImportJob(ctx, missingID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testImportJobClaim(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+	account2 := createAccount(t, store, createUser(t, store).Username, "USD", 100)
+
+	createJob := func(leaseUntil time.Time) db.ImportJob {
+		result, err := store.CreateImportJobTx(ctx, db.CreateImportJobTxParams{
+			Owner:       account1.Owner,
+			MessageID:   utils.RandomString(16),
+			MessageName: "pain.001.001.09",
+			LeaseUntil:  leaseUntil,
+			Transactions: []db.CreateImportTransactionParams{
+				{PaymentInfoID: "PMT-1", EndToEndID: "E2E-1", FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: "USD"},
+			},
+		})
+		require.NoError(t, err)
+		return result.Job
+	}
+	claimedIDs := func(leaseUntil time.Time) map[int64]db.ImportJob {
+		jobs, err := store.ClaimStaleImportJobs(ctx, db.ClaimStaleImportJobsParams{LeaseUntil: leaseUntil, Size: 1000})
+		require.NoError(t, err)
+		claimed := make(map[int64]db.ImportJob, len(jobs))
+		for _, job := range jobs {
+			claimed[job.ID] = job
+		}
+		return claimed
+	}
+
+	// only the jobs whose claim expired are taken over
+	stale := createJob(time.Now().Add(-time.Second))
+	running := createJob(time.Now().Add(time.Minute))
+	leaseUntil := time.Now().Add(time.Minute)
+	claimed := claimedIDs(leaseUntil)
+	require.Contains(t, claimed, stale.ID)
+	require.NotContains(t, claimed, running.ID)
+	require.WithinDuration(t, leaseUntil, claimed[stale.ID].ClaimedUntil, time.Millisecond)
+	require.NotContains(t, claimedIDs(leaseUntil), stale.ID)
+
+	// the previous holder can't renew a claim that was taken over
+	_, err := store.RenewImportJobClaim(ctx, db.RenewImportJobClaimParams{
+		ID:           stale.ID,
+		ClaimedUntil: stale.ClaimedUntil,
+		LeaseUntil:   time.Now().Add(time.Minute),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	job, err := store.RenewImportJobClaim(ctx, db.RenewImportJobClaimParams{
+		ID:           stale.ID,
+		ClaimedUntil: claimed[stale.ID].ClaimedUntil,
+		LeaseUntil:   time.Now().Add(2 * time.Minute),
+	})
+	require.NoError(t, err)
+	require.True(t, job.ClaimedUntil.After(claimed[stale.ID].ClaimedUntil))
+
+	// finished jobs are never claimed
+	finished := createJob(time.Now().Add(-time.Second))
+	_, err = store.UpdateImportJobStatus(ctx, db.UpdateImportJobStatusParams{
+		ID:         finished.ID,
+		Status:     "ACSC",
+		FinishedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	require.NoError(t, err)
+	require.NotContains(t, claimedIDs(time.Now().Add(time.Minute)), finished.ID)
+}
+
+func testAuditEvents(t *testing.T, store db.Store) {
+	meta := db.AuditMeta{
+		Actor:     utils.RandomOwner(),
+		RequestID: utils.RandomString(16),
+		ClientIP:  "192.0.2.1",
+		UserAgent: "storetest",
+	}
+	ctx := db.WithAuditMeta(context.Background(), meta)
+
+	user := createUser(t, store)
+	account, err := store.CreateAccountTx(ctx, db.CreateAccountParams{Owner: user.Username, Currency: "TWD"})
+	require.NoError(t, err)
+
+	events, err := store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		RequestID: sql.NullString{String: meta.RequestID, Valid: true},
+		Size:      10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	e := events[0]
+	require.Equal(t, meta.Actor, e.Actor)
+	require.Equal(t, db.AuditActionCreateAccount, e.Action)
+	require.Equal(t, "account", e.ResourceType)
+	require.Equal(t, strconv.FormatInt(account.ID, 10), e.ResourceID)
+	require.Equal(t, meta.ClientIP, e.ClientIp)
+	require.Equal(t, meta.UserAgent, e.UserAgent)
+	require.JSONEq(t, "null", string(e.Before))
+
+	var after db.Account
+	require.NoError(t, json.Unmarshal(e.After, &after))
+	require.Equal(t, account.ID, after.ID)
+	require.Equal(t, account.Owner, after.Owner)
+
+	// users are recorded without their password hash
+	events, err = store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		ResourceType: sql.NullString{String: "user", Valid: true},
+		ResourceID:   sql.NullString{String: user.Username, Valid: true},
+		Size:         10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.NotContains(t, string(events[0].After), "hashed_password")
+	require.NotContains(t, string(events[0].After), user.HashedPassword)
+
+	events, err = store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		RequestID:   sql.NullString{String: meta.RequestID, Valid: true},
+		CreatedFrom: sql.NullTime{Time: e.CreatedAt.Add(time.Second), Valid: true},
+		Size:        10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	events, err = store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		RequestID: sql.NullString{String: meta.RequestID, Valid: true},
+		CreatedTo: sql.NullTime{Time: e.CreatedAt, Valid: true},
+		Size:      10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func testAuditedAdminTx(t *testing.T, store db.Store) {
+	ctx := db.WithAuditMeta(context.Background(), db.AuditMeta{UserAgent: "storetest"})
+	user := createUser(t, store)
+	account := createAccount(t, store, user.Username, "USD", 100)
+
+	updated, err := store.UpdateUserRoleTx(ctx, db.UpdateUserRoleParams{Role: utils.AdminRole, Username: user.Username})
+	require.NoError(t, err)
+	require.Equal(t, utils.AdminRole, updated.Role)
+	_, err = store.UpdateUserRoleTx(ctx, db.UpdateUserRoleParams{Role: utils.AdminRole, Username: utils.RandomString(12)})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	frozen, err := store.SetAccountFrozenTx(ctx, db.SetAccountFrozenParams{ID: account.ID, Frozen: true})
+	require.NoError(t, err)
+	require.True(t, frozen.Frozen)
+	_, err = store.SetAccountFrozenTx(ctx, db.SetAccountFrozenParams{ID: account.ID, Frozen: false})
+	require.NoError(t, err)
+	_, err = store.SetAccountFrozenTx(ctx, db.SetAccountFrozenParams{ID: missingID, Frozen: true})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	requireAuditEvent := func(action string, resourceType string, resourceID string) db.AuditEvent {
+		events, err := store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+			Action:       sql.NullString{String: action, Valid: true},
+			ResourceType: sql.NullString{String: resourceType, Valid: true},
+			ResourceID:   sql.NullString{String: resourceID, Valid: true},
+			Size:         10,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1, action)
+		require.Equal(t, "storetest", events[0].UserAgent)
+		return events[0]
+	}
+
+	e := requireAuditEvent(db.AuditActionUpdateUserRole, "user", user.Username)
+	var before, after db.AuditUser
+	require.NoError(t, json.Unmarshal(e.Before, &before))
+	require.NoError(t, json.Unmarshal(e.After, &after))
+	require.Equal(t, user.Role, before.Role)
+	require.Equal(t, utils.AdminRole, after.Role)
+
+	accountID := strconv.FormatInt(account.ID, 10)
+	e = requireAuditEvent(db.AuditActionFreezeAccount, "account", accountID)
+	var frozenBefore, frozenAfter db.Account
+	require.NoError(t, json.Unmarshal(e.Before, &frozenBefore))
+	require.NoError(t, json.Unmarshal(e.After, &frozenAfter))
+	require.False(t, frozenBefore.Frozen)
+	require.True(t, frozenAfter.Frozen)
+	requireAuditEvent(db.AuditActionUnfreezeAccount, "account", accountID)
+}
+
+func testAuditedWebhookTx(t *testing.T, store db.Store) {
+	ctx := db.WithAuditMeta(context.Background(), db.AuditMeta{Actor: utils.RandomOwner(), UserAgent: "storetest"})
+	user := createUser(t, store)
+
+	webhook, err := store.CreateWebhookTx(ctx, db.CreateWebhookParams{
+		Owner:      user.Username,
+		Url:        "https://example.com/hooks",
+		EventTypes: []string{event.TypeAccountOpened},
+		Secret:     utils.RandomString(32),
+	})
+	require.NoError(t, err)
+	_, err = store.CreateWebhookTx(ctx, db.CreateWebhookParams{Owner: utils.RandomString(12), Url: "https://example.com", EventTypes: []string{}, Secret: "s"})
+	requireViolation(t, err, foreignKeyViolation, "webhooks_owner_fkey")
+
+	webhookID := strconv.FormatInt(webhook.ID, 10)
+	requireAuditEvent := func(action string) db.AuditEvent {
+		events, err := store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+			Action:       sql.NullString{String: action, Valid: true},
+			ResourceType: sql.NullString{String: "webhook", Valid: true},
+			ResourceID:   sql.NullString{String: webhookID, Valid: true},
+			Size:         10,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1, action)
+		require.Equal(t, db.AuditMetaFrom(ctx).Actor, events[0].Actor)
+		// the signing secret never reaches the audit log
+		require.NotContains(t, string(events[0].Before), webhook.Secret)
+		require.NotContains(t, string(events[0].After), webhook.Secret)
+		return events[0]
+	}
+
+	e := requireAuditEvent(db.AuditActionCreateWebhook)
+	require.JSONEq(t, "null", string(e.Before))
+	var created db.AuditWebhook
+	require.NoError(t, json.Unmarshal(e.After, &created))
+	require.Equal(t, webhook.Url, created.Url)
+	require.Equal(t, webhook.EventTypes, created.EventTypes)
+
+	require.NoError(t, store.DeleteWebhookTx(ctx, webhook.ID))
+	_, err = store.GetWebhook(ctx, webhook.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	e = requireAuditEvent(db.AuditActionDeleteWebhook)
+	var deleted db.AuditWebhook
+	require.NoError(t, json.Unmarshal(e.Before, &deleted))
+	require.Equal(t, webhook.ID, deleted.ID)
+	require.JSONEq(t, "null", string(e.After))
+
+	// nothing is recorded for a webhook that doesn't exist
+	require.ErrorIs(t, store.DeleteWebhookTx(ctx, webhook.ID), sql.ErrNoRows)
+	requireAuditEvent(db.AuditActionDeleteWebhook)
+}
+
+func testOutbox(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	account, err := store.CreateAccountTx(ctx, db.CreateAccountParams{Owner: user.Username, Currency: "USD"})
+	require.NoError(t, err)
+	accountID := strconv.FormatInt(account.ID, 10)
+
+	// a failed event keeps the relay from publishing the next events of its aggregate
+	failing := true
+	var published []event.Envelope
+	publish := func(ctx context.Context, e event.Envelope) error {
+		if failing && e.AggregateID == accountID {
+			return errors.New("broker unavailable")
+		}
+		if e.AggregateID == accountID || e.AggregateID == user.Username {
+			published = append(published, e)
+		}
+		return nil
+	}
+
+	relayAll(t, store, publish)
+	require.Len(t, published, 1)
+	require.Equal(t, event.TypeUserCreated, published[0].Type)
+
+	pending, err := store.ListPendingOutboxEvents(ctx, 1000)
+	require.NoError(t, err)
+	var failed db.Outbox
+	for _, o := range pending {
+		if o.AggregateType == event.AggregateAccount && o.AggregateID == accountID {
+			failed = o
+		}
+	}
+	require.NotZero(t, failed.ID)
+	require.NotZero(t, failed.Attempts)
+	require.Equal(t, "broker unavailable", failed.LastError)
+
+	failing = false
+	relayAll(t, store, publish)
+	require.Len(t, published, 2)
+	require.Equal(t, event.TypeAccountOpened, published[1].Type)
+	require.Equal(t, failed.ID, published[1].ID)
+
+	payload, err := published[1].Decode()
+	require.NoError(t, err)
+	require.Equal(t, &event.AccountOpenedV1{AccountID: account.ID, Owner: user.Username, Currency: "USD"}, payload)
+
+	o, err := store.GetOutboxEvent(ctx, failed.ID)
+	require.NoError(t, err)
+	require.True(t, o.PublishedAt.Valid)
+	require.Equal(t, failed.Attempts+1, o.Attempts)
+	require.Empty(t, o.LastError)
+
+	locked, err := store.TryAdvisoryXactLock(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	deleted, err := store.DeletePublishedOutboxEvents(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, deleted, int64(2))
+	_, err = store.GetOutboxEvent(ctx, failed.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testOutboxClaim(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	relayAll(t, store, func(ctx context.Context, e event.Envelope) error { return nil })
+
+	// the batch is claimed and committed before publishing, so another relay skips it
+	// and the events can be read while they are published
+	account, err := store.CreateAccountTx(ctx, db.CreateAccountParams{Owner: user.Username, Currency: "USD"})
+	require.NoError(t, err)
+	var published []int64
+	result, err := store.RelayOutboxTx(ctx, db.RelayOutboxTxParams{
+		Limit:      100,
+		LeaseUntil: time.Now().Add(time.Minute),
+		Publish: func(ctx context.Context, e event.Envelope) error {
+			o, err := store.GetOutboxEvent(ctx, e.ID)
+			require.NoError(t, err)
+			require.True(t, o.ClaimedUntil.Valid)
+
+			other, err := store.RelayOutboxTx(ctx, db.RelayOutboxTxParams{Limit: 100, LeaseUntil: time.Now().Add(time.Minute)})
+			require.NoError(t, err)
+			require.False(t, other.Locked)
+
+			published = append(published, e.ID)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, result.Locked)
+	require.NotEmpty(t, published)
+
+	o, err := store.GetOutboxEvent(ctx, published[0])
+	require.NoError(t, err)
+	require.Equal(t, strconv.FormatInt(account.ID, 10), o.AggregateID)
+	require.True(t, o.PublishedAt.Valid)
+	require.False(t, o.ClaimedUntil.Valid)
+
+	// the claim of a relay that died is taken over once it expires
+	_, err = store.CreateAccountTx(ctx, db.CreateAccountParams{Owner: user.Username, Currency: "EUR"})
+	require.NoError(t, err)
+	claimed, err := store.ClaimPendingOutboxEvents(ctx, db.ClaimPendingOutboxEventsParams{ClaimedUntil: time.Now().Add(time.Minute), Size: 100})
+	require.NoError(t, err)
+	require.NotEmpty(t, claimed)
+	result, err = store.RelayOutboxTx(ctx, db.RelayOutboxTxParams{Limit: 100, LeaseUntil: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	require.False(t, result.Locked)
+
+	_, err = store.ClaimPendingOutboxEvents(ctx, db.ClaimPendingOutboxEventsParams{ClaimedUntil: time.Now().Add(-time.Second), Size: 100})
+	require.NoError(t, err)
+	published = nil
+	relayAll(t, store, func(ctx context.Context, e event.Envelope) error {
+		published = append(published, e.ID)
+		return nil
+	})
+	require.Contains(t, published, claimed[0].ID)
+}
+
+func testRateLimits(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	key := "test:ip:" + utils.RandomString(12)
+	// a token every 1000s, so the refill during the test stays far below one token
+	arg := db.TakeRateLimitTokenParams{Key: key, Burst: 2, Rate: 0.001}
+
+	for _, tokens := range []float64{1, 0} {
+		row, err := store.TakeRateLimitToken(ctx, arg)
+		require.NoError(t, err)
+		require.True(t, row.Allowed)
+		require.InDelta(t, tokens, row.Tokens, 0.01)
+	}
+	row, err := store.TakeRateLimitToken(ctx, arg)
+	require.NoError(t, err)
+	require.False(t, row.Allowed)
+	require.InDelta(t, 0, row.Tokens, 0.01)
+
+	// the buckets are apart
+	other := arg
+	other.Key = key + ":other"
+	row, err = store.TakeRateLimitToken(ctx, other)
+	require.NoError(t, err)
+	require.True(t, row.Allowed)
+
+	// a lower burst caps the tokens of a bucket right away
+	refilled := db.TakeRateLimitTokenParams{Key: other.Key, Burst: 1, Rate: 1000}
+	row, err = store.TakeRateLimitToken(ctx, refilled)
+	require.NoError(t, err)
+	require.True(t, row.Allowed)
+	require.Zero(t, row.Tokens)
+
+	deleted, err := store.DeleteIdleRateLimitBuckets(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, deleted, int64(2))
+
+	// a deleted bucket starts full again
+	row, err = store.TakeRateLimitToken(ctx, arg)
+	require.NoError(t, err)
+	require.True(t, row.Allowed)
+	require.InDelta(t, 1, row.Tokens, 0.01)
+}
+
+// lockAfter returns the wait of a key locked for an hour from its max-th failure on
+func lockAfter(max int32) func(failures int32) time.Duration {
+	return func(failures int32) time.Duration {
+		if failures >= max {
+			return time.Hour
+		}
+		return 0
+	}
+}
+
+func testLoginFailures(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := "user:" + utils.RandomOwner()
+	ip := "ip:" + utils.RandomOwner()
+	window := time.Now().Add(-time.Hour)
+
+	_, err := store.GetLoginFailure(ctx, user)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.ForgiveLoginFailure(ctx, db.ForgiveLoginFailureParams{Key: user, MaxFailures: 1})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// the failures come back in the order of the keys, which isn't the order the rows are locked in
+	arg := db.LoginAttemptTxParams{
+		Keys:        []db.LoginAttemptKey{{Key: user, Wait: lockAfter(2)}, {Key: ip, Wait: lockAfter(3)}},
+		WindowStart: window,
+	}
+	first, err := store.LoginAttemptTx(ctx, arg)
+	require.NoError(t, err)
+	require.Zero(t, first.Wait)
+	require.Len(t, first.Failures, 2)
+	require.Equal(t, user, first.Failures[0].Key)
+	require.Equal(t, ip, first.Failures[1].Key)
+	require.Equal(t, int32(1), first.Failures[0].Failures)
+	require.WithinDuration(t, time.Now(), first.Failures[0].WindowStartedAt, time.Minute)
+	require.False(t, first.Failures[0].LockedUntil.After(time.Now()))
+
+	// the second failure of user locks both keys
+	second, err := store.LoginAttemptTx(ctx, arg)
+	require.NoError(t, err)
+	require.Zero(t, second.Wait)
+	require.Equal(t, int32(2), second.Failures[0].Failures)
+	require.Equal(t, first.Failures[0].WindowStartedAt, second.Failures[0].WindowStartedAt)
+	require.WithinDuration(t, time.Now().Add(time.Hour), second.Failures[0].LockedUntil, time.Minute)
+	require.False(t, second.Failures[1].LockedUntil.After(time.Now()))
+
+	// a locked key makes the attempt wait without counting it
+	locked, err := store.LoginAttemptTx(ctx, arg)
+	require.NoError(t, err)
+	require.InDelta(t, time.Hour, locked.Wait, float64(time.Minute))
+	require.Nil(t, locked.Failures)
+	got, err := store.GetLoginFailure(ctx, ip)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), got.Failures)
+
+	// a locked key is not stale even once its window ended
+	_, err = store.DeleteStaleLoginFailures(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = store.GetLoginFailure(ctx, user)
+	require.NoError(t, err)
+
+	deleted, err := store.DeleteLoginFailure(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+	deleted, err = store.DeleteLoginFailure(ctx, user)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	// the failures of an ended window are forgotten
+	arg.WindowStart = time.Now().Add(time.Minute)
+	restarted, err := store.LoginAttemptTx(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), restarted.Failures[0].Failures)
+	require.Equal(t, int32(1), restarted.Failures[1].Failures)
+	third, err := store.LoginAttemptTx(ctx, db.LoginAttemptTxParams{Keys: arg.Keys[1:], WindowStart: window})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), third.Failures[0].Failures)
+	fourth, err := store.LoginAttemptTx(ctx, db.LoginAttemptTxParams{Keys: arg.Keys[1:], WindowStart: window})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), fourth.Failures[0].Failures)
+	require.True(t, fourth.Failures[0].LockedUntil.After(time.Now()))
+
+	// forgiving a failure unlocks the key once it's below the max
+	forgiven, err := store.ForgiveLoginFailure(ctx, db.ForgiveLoginFailureParams{Key: ip, MaxFailures: 2})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), forgiven.Failures)
+	require.True(t, forgiven.LockedUntil.After(time.Now()))
+	forgiven, err = store.ForgiveLoginFailure(ctx, db.ForgiveLoginFailureParams{Key: ip, MaxFailures: 2})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), forgiven.Failures)
+	require.False(t, forgiven.LockedUntil.After(time.Now()))
+
+	stale := "ip:" + utils.RandomOwner()
+	_, err = store.LoginAttemptTx(ctx, db.LoginAttemptTxParams{
+		Keys:        []db.LoginAttemptKey{{Key: stale, Wait: lockAfter(10)}},
+		WindowStart: window,
+	})
+	require.NoError(t, err)
+	deleted, err = store.DeleteStaleLoginFailures(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, deleted, int64(1))
+	_, err = store.GetLoginFailure(ctx, stale)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testLoginAttemptTxConcurrent(t *testing.T, store db.Store) {
+	arg := db.LoginAttemptTxParams{
+		Keys: []db.LoginAttemptKey{
+			{Key: "user:" + utils.RandomOwner(), Wait: lockAfter(3)},
+			{Key: "ip:" + utils.RandomOwner(), Wait: lockAfter(100)},
+		},
+		WindowStart: time.Now().Add(-time.Hour),
+	}
+
+	// parallel guesses are counted one at a time, the ones after the lock wait
+	n := 10
+	errs := make(chan error, n)
+	results := make(chan db.LoginAttemptTxResult, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			result, err := store.LoginAttemptTx(context.Background(), arg)
+			errs <- err
+			results <- result
+		}()
+	}
+
+	counted := make(map[int32]bool)
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+		result := <-results
+		if result.Wait > 0 {
+			continue
+		}
+		require.False(t, counted[result.Failures[0].Failures])
+		counted[result.Failures[0].Failures] = true
+	}
+	require.Len(t, counted, 3)
+
+	got, err := store.GetLoginFailure(context.Background(), arg.Keys[1].Key)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), got.Failures)
+}
+
+// relayAll runs the relay until a run publishes nothing
+func testOutboxRetries(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	createEvent := func(aggregateID string) db.Outbox {
+		o, err := store.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+			AggregateType: "test",
+			AggregateID:   aggregateID,
+			EventType:     "test.event",
+			EventVersion:  1,
+			Payload:       []byte(`{}`),
+		})
+		require.NoError(t, err)
+		require.Equal(t, db.OutboxStatusPending, o.Status)
+		return o
+	}
+	aggregate, other := utils.RandomString(12), utils.RandomString(12)
+	first, second := createEvent(aggregate), createEvent(aggregate)
+	unrelated := createEvent(other)
+
+	var published []int64
+	relay := func(backoff time.Duration) {
+		_, err := store.RelayOutboxTx(ctx, db.RelayOutboxTxParams{
+			Limit:      1000,
+			LeaseUntil: time.Now().Add(time.Minute),
+			Publish: func(ctx context.Context, e event.Envelope) error {
+				if e.ID == first.ID {
+					return errors.New("broker unavailable")
+				}
+				published = append(published, e.ID)
+				return nil
+			},
+			MaxAttempts: 3,
+			Backoff:     func(attempts int32) time.Duration { return backoff },
+		})
+		require.NoError(t, err)
+	}
+
+	// the failed event and the next one of its aggregate wait for the backoff, other aggregates go on
+	relay(time.Hour)
+	require.Contains(t, published, unrelated.ID)
+	o, err := store.GetOutboxEvent(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.OutboxStatusPending, o.Status)
+	require.Equal(t, int32(1), o.Attempts)
+	require.WithinDuration(t, time.Now().Add(time.Hour), o.NextAttemptAt, time.Minute)
+
+	relay(time.Hour)
+	require.NotContains(t, published, first.ID)
+	require.NotContains(t, published, second.ID)
+	o, err = store.GetOutboxEvent(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), o.Attempts)
+
+	// after MaxAttempts the event is dead-lettered and the rest of its aggregate is published
+	err = store.MarkOutboxEventFailed(ctx, db.MarkOutboxEventFailedParams{
+		ID:            first.ID,
+		Status:        db.OutboxStatusPending,
+		LastError:     "broker unavailable",
+		NextAttemptAt: time.Now().Add(-time.Second),
+	})
+	require.NoError(t, err)
+	relay(0)
+	o, err = store.GetOutboxEvent(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.OutboxStatusDead, o.Status)
+	require.Equal(t, int32(3), o.Attempts)
+	require.False(t, o.PublishedAt.Valid)
+
+	relay(0)
+	require.Contains(t, published, second.ID)
+	require.NotContains(t, published, first.ID)
+	o, err = store.GetOutboxEvent(ctx, second.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.OutboxStatusPublished, o.Status)
+
+	dead, err := store.ListDeadOutboxEvents(ctx, db.ListDeadOutboxEventsParams{Limit: 1000})
+	require.NoError(t, err)
+	var found bool
+	for _, o := range dead {
+		require.Equal(t, db.OutboxStatusDead, o.Status)
+		if o.ID == first.ID {
+			found = true
+			require.Equal(t, "broker unavailable", o.LastError)
+		}
+	}
+	require.True(t, found)
+
+	pending, err := store.ListPendingOutboxEvents(ctx, 1000)
+	require.NoError(t, err)
+	for _, o := range pending {
+		require.NotEqual(t, first.ID, o.ID)
+	}
+}
+
+func relayAll(t *testing.T, store db.Store, publish func(ctx context.Context, e event.Envelope) error) {
+	for {
+		result, err := store.RelayOutboxTx(context.Background(), db.RelayOutboxTxParams{
+			Limit:      100,
+			LeaseUntil: time.Now().Add(time.Minute),
+			Publish:    publish,
+		})
+		require.NoError(t, err)
+		require.True(t, result.Locked)
+		if result.Published == 0 {
+			return
+		}
+	}
+}
+
+func testWebhooks(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	all, err := store.CreateWebhook(ctx, db.CreateWebhookParams{
+		Owner:      user.Username,
+		Url:        "https://example.com/all",
+		EventTypes: []string{},
+		Secret:     utils.RandomString(32),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, all.EventTypes)
+	require.Empty(t, all.EventTypes)
+
+	transfers, err := store.CreateWebhook(ctx, db.CreateWebhookParams{
+		Owner:      user.Username,
+		Url:        "https://example.com/transfers",
+		EventTypes: []string{event.TypeTransferCreated},
+		Secret:     utils.RandomString(32),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{event.TypeTransferCreated}, transfers.EventTypes)
+
+	_, err = store.CreateWebhook(ctx, db.CreateWebhookParams{
+		Owner:      utils.RandomString(12),
+		Url:        "https://example.com",
+		EventTypes: []string{},
+	})
+	requireViolation(t, err, foreignKeyViolation, "webhooks_owner_fkey")
+
+	webhooks, err := store.ListWebhooks(ctx, user.Username)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+
+	webhooks, err = store.ListSubscribedWebhooks(ctx, db.ListSubscribedWebhooksParams{Owner: user.Username, EventType: event.TypeAccountOpened})
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.Equal(t, all.ID, webhooks[0].ID)
+
+	webhooks, err = store.ListSubscribedWebhooks(ctx, db.ListSubscribedWebhooksParams{Owner: user.Username, EventType: event.TypeTransferCreated})
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+
+	// deliveries of the same event are queued once per webhook, test events every time
+	arg := db.CreateWebhookDeliveryParams{
+		WebhookID: all.ID,
+		EventID:   sql.NullInt64{Int64: utils.RandomInt(1, 1000000), Valid: true},
+		EventType: event.TypeAccountOpened,
+		Payload:   []byte(`{"account_id": 1}`),
+	}
+	delivery, err := store.CreateWebhookDelivery(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, "pending", delivery.Status)
+	require.JSONEq(t, string(arg.Payload), string(delivery.Payload))
+	again, err := store.CreateWebhookDelivery(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, delivery.ID, again.ID)
+
+	arg.EventID = sql.NullInt64{}
+	test1, err := store.CreateWebhookDelivery(ctx, arg)
+	require.NoError(t, err)
+	test2, err := store.CreateWebhookDelivery(ctx, arg)
+	require.NoError(t, err)
+	require.NotEqual(t, test1.ID, test2.ID)
+
+	arg.WebhookID = missingID
+	_, err = store.CreateWebhookDelivery(ctx, arg)
+	requireViolation(t, err, foreignKeyViolation, "webhook_deliveries_webhook_id_fkey")
+
+	deliveries, err := store.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{WebhookID: all.ID, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, test2.ID, deliveries[0].ID)
+	require.Equal(t, test1.ID, deliveries[1].ID)
+
+	leaseUntil := time.Now().Add(time.Minute).Truncate(time.Microsecond)
+	claimed, err := store.ClaimDueWebhookDeliveries(ctx, db.ClaimDueWebhookDeliveriesParams{LeaseUntil: leaseUntil, Size: 1000})
+	require.NoError(t, err)
+	var found bool
+	for _, d := range claimed {
+		if d.ID == delivery.ID {
+			found = true
+			require.WithinDuration(t, leaseUntil, d.NextAttemptAt, 0)
+		}
+	}
+	require.True(t, found)
+
+	// leased deliveries are not claimed again until the lease ends
+	claimed, err = store.ClaimDueWebhookDeliveries(ctx, db.ClaimDueWebhookDeliveriesParams{LeaseUntil: leaseUntil, Size: 1000})
+	require.NoError(t, err)
+	for _, d := range claimed {
+		require.NotEqual(t, delivery.ID, d.ID)
+	}
+
+	deliveredAt := time.Now().Truncate(time.Microsecond)
+	delivery, err = store.UpdateWebhookDelivery(ctx, db.UpdateWebhookDeliveryParams{
+		ID:             delivery.ID,
+		Status:         "succeeded",
+		Attempts:       1,
+		NextAttemptAt:  deliveredAt,
+		LastStatusCode: 200,
+		DeliveredAt:    sql.NullTime{Time: deliveredAt, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "succeeded", delivery.Status)
+	require.Equal(t, int32(200), delivery.LastStatusCode)
+
+	attempt, err := store.CreateWebhookAttempt(ctx, db.CreateWebhookAttemptParams{DeliveryID: delivery.ID, StatusCode: 200, DurationMs: 12})
+	require.NoError(t, err)
+	attempts, err := store.ListWebhookAttempts(ctx, delivery.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	require.Equal(t, attempt.ID, attempts[0].ID)
+
+	// deleting a webhook deletes its deliveries and their attempts
+	deleted, err := store.DeleteWebhook(ctx, all.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+	deleted, err = store.DeleteWebhook(ctx, all.ID)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+	_, err = store.GetWebhook(ctx, all.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.GetWebhookDelivery(ctx, delivery.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	attempts, err = store.ListWebhookAttempts(ctx, delivery.ID)
+	require.NoError(t, err)
+	require.Empty(t, attempts)
+
+	_, err = store.CreateWebhookAttempt(ctx, db.CreateWebhookAttemptParams{DeliveryID: delivery.ID, StatusCode: 200})
+	requireViolation(t, err, foreignKeyViolation, "webhook_attempts_delivery_id_fkey")
+
+	_, err = store.GetWebhook(ctx, transfers.ID)
+	require.NoError(t, err)
+}
+
+func requireBalance(t *testing.T, store db.Store, accountID int64, balance int64) {
+	account, err := store.GetAccount(context.Background(), accountID)
+	require.NoError(t, err)
+	require.Equal(t, balance, account.Balance)
+}
+
+func requireValidLedger(t *testing.T, store db.Store, accountID int64, entries int64) {
+	verified, err := store.VerifyAccountLedger(context.Background(), accountID)
+	require.NoError(t, err)
+	require.True(t, verified.Valid, "broken link: %+v", verified.BrokenLink)
+	require.Equal(t, entries, verified.EntriesChecked)
+}
@@ -0,0 +1,7 @@
+// Package doc embeds the API documentation generated from the protos by `make proto`
+package doc
+
+import _ "embed"
+
+//go:embed swagger/simple_bank.swagger.json
+var SwaggerJSON []byte
@@ -0,0 +1,103 @@
+// Package event defines the domain events published to downstream systems.
+//
+// Every event travels in an Envelope, the shape of Data is identified by
+// Type and Version. A new version is added, rather than changing an existing
+// one, whenever a field is removed or its meaning changes.
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event types
+const (
+	TypeUserCreated     = "UserCreated"
+	TypeAccountOpened   = "AccountOpened"
+	TypeTransferCreated = "TransferCreated"
+)
+
+// Aggregate types
+const (
+	AggregateUser     = "user"
+	AggregateAccount  = "account"
+	AggregateTransfer = "transfer"
+)
+
+// Envelope is the JSON document delivered to publishers
+type Envelope struct {
+	// ID is the outbox id, consumers use it to drop duplicate deliveries
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	Version       int32           `json:"version"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Payload is implemented by the data of every event version
+type Payload interface {
+	EventType() string
+	EventVersion() int32
+}
+
+type UserCreatedV1 struct {
+	Username string `json:"username"`
+	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+}
+
+func (UserCreatedV1) EventType() string   { return TypeUserCreated }
+func (UserCreatedV1) EventVersion() int32 { return 1 }
+
+type AccountOpenedV1 struct {
+	AccountID int64  `json:"account_id"`
+	Owner     string `json:"owner"`
+	Currency  string `json:"currency"`
+	Balance   int64  `json:"balance"`
+}
+
+func (AccountOpenedV1) EventType() string   { return TypeAccountOpened }
+func (AccountOpenedV1) EventVersion() int32 { return 1 }
+
+type TransferCreatedV1 struct {
+	TransferID    int64  `json:"transfer_id"`
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+func (TransferCreatedV1) EventType() string   { return TypeTransferCreated }
+func (TransferCreatedV1) EventVersion() int32 { return 1 }
+
+// Decode unmarshals the data of the envelope into the payload type matching its type and version
+func (e Envelope) Decode() (Payload, error) {
+	var payload Payload
+	switch {
+	case e.Type == TypeUserCreated && e.Version == 1:
+		payload = &UserCreatedV1{}
+	case e.Type == TypeAccountOpened && e.Version == 1:
+		payload = &AccountOpenedV1{}
+	case e.Type == TypeTransferCreated && e.Version == 1:
+		payload = &TransferCreatedV1{}
+	default:
+		return nil, &UnknownEventError{Type: e.Type, Version: e.Version}
+	}
+
+	if err := json.Unmarshal(e.Data, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+type UnknownEventError struct {
+	Type    string
+	Version int32
+}
+
+func (e *UnknownEventError) Error() string {
+	return fmt.Sprintf("unknown event %s version %d", e.Type, e.Version)
+}
@@ -0,0 +1,52 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeDecode(t *testing.T) {
+	payload := TransferCreatedV1{
+		TransferID:    1,
+		FromAccountID: 2,
+		ToAccountID:   3,
+		Amount:        10,
+		Currency:      "USD",
+	}
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	envelope := Envelope{
+		ID:            1,
+		Type:          payload.EventType(),
+		Version:       payload.EventVersion(),
+		AggregateType: AggregateTransfer,
+		AggregateID:   "1",
+		OccurredAt:    time.Now(),
+		Data:          data,
+	}
+
+	// the envelope survives a trip through JSON untouched
+	raw, err := json.Marshal(envelope)
+	require.NoError(t, err)
+	var received Envelope
+	require.NoError(t, json.Unmarshal(raw, &received))
+
+	decoded, err := received.Decode()
+	require.NoError(t, err)
+	require.Equal(t, &payload, decoded)
+}
+
+func TestEnvelopeDecodeUnknown(t *testing.T) {
+	envelope := Envelope{Type: TypeTransferCreated, Version: 99, Data: json.RawMessage(`{}`)}
+
+	payload, err := envelope.Decode()
+	require.Nil(t, payload)
+
+	var unknownErr *UnknownEventError
+	require.ErrorAs(t, err, &unknownErr)
+	require.Equal(t, int32(99), unknownErr.Version)
+}
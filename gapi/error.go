@@ -0,0 +1,122 @@
+package gapi
+
+import (
+	"database/sql"
+	"errors"
+	"lesson/simple-bank/apierror"
+	"time"
+
+	"github.com/lib/pq"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain is the domain of the ErrorInfo details, their reason is an apierror code
+const errorDomain = "simple-bank"
+
+// statusError converts a store error to a gRPC status the way the gin handlers pick HTTP codes,
+// the status carries the first of the expected apierror codes the error stands for
+func statusError(err error, expected ...apierror.Code) error {
+	st := storeStatus(err)
+	if code := apierror.FromDB(err, expected...).Code; code != apierror.InternalError {
+		return withCode(code, st)
+	}
+	return st
+}
+
+func storeStatus(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return status.Error(codes.AlreadyExists, pqErr.Message)
+		case "foreign_key_violation":
+			return status.Error(codes.FailedPrecondition, pqErr.Message)
+		case "check_violation", "not_null_violation", "string_data_right_truncation":
+			return status.Error(codes.InvalidArgument, pqErr.Message)
+		case "serialization_failure", "deadlock_detected", "lock_not_available":
+			return status.Error(codes.Aborted, pqErr.Message)
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func fieldViolation(field string, err error) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: err.Error(),
+	}
+}
+
+// invalidArgumentError reports every invalid field of a request as BadRequest details
+func invalidArgumentError(violations []*errdetails.BadRequest_FieldViolation) error {
+	badRequest := &errdetails.BadRequest{FieldViolations: violations}
+	statusInvalid := status.New(codes.InvalidArgument, "invalid parameters")
+
+	statusDetails, err := statusInvalid.WithDetails(badRequest)
+	if err != nil {
+		return statusInvalid.Err()
+	}
+	return statusDetails.Err()
+}
+
+// retryLaterError is a ResourceExhausted status telling the caller how long to wait in RetryInfo details
+func retryLaterError(code apierror.Code, wait time.Duration, format string, args ...interface{}) error {
+	statusExhausted := status.Newf(codes.ResourceExhausted, format, args...)
+
+	statusDetails, err := statusExhausted.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)})
+	if err != nil {
+		return statusExhausted.Err()
+	}
+	return withCode(code, statusDetails.Err())
+}
+
+// withCode adds the apierror code of a status error as ErrorInfo details,
+// the gateway answers with the problem details of that code
+func withCode(code apierror.Code, err error) error {
+	st := status.Convert(err)
+	if errorInfo(st) != nil {
+		return err
+	}
+
+	statusDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: string(code), Domain: errorDomain})
+	if detailsErr != nil {
+		return err
+	}
+	return statusDetails.Err()
+}
+
+// errorCode returns the apierror code of a status, statuses without ErrorInfo details get the code
+// of their gRPC code
+func errorCode(st *status.Status) apierror.Code {
+	if info := errorInfo(st); info != nil {
+		return apierror.Code(info.GetReason())
+	}
+
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return apierror.InvalidRequest
+	case codes.Unauthenticated:
+		return apierror.Unauthenticated
+	case codes.PermissionDenied:
+		return apierror.PermissionDenied
+	case codes.ResourceExhausted:
+		return apierror.RateLimited
+	}
+	return apierror.InternalError
+}
+
+func errorInfo(st *status.Status) *errdetails.ErrorInfo {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == errorDomain {
+			return info
+		}
+	}
+	return nil
+}
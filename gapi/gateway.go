@@ -0,0 +1,114 @@
+package gapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/pb"
+	"math"
+	"net/http"
+	"net/textproto"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// NewGateway returns the JSON/REST facade of the gRPC service listening at grpcAddress,
+// the calls go through the gRPC server so they pass the same interceptors
+func NewGateway(ctx context.Context, grpcAddress string) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		// snake_case field names and zero values, like the JSON of the gin routes
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				UseProtoNames:   true,
+				EmitUnpopulated: true,
+			},
+			UnmarshalOptions: protojson.UnmarshalOptions{
+				DiscardUnknown: true,
+			},
+		}),
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithRoutingErrorHandler(routingErrorHandler),
+	)
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(gatewayTokenInterceptor),
+	}
+	if err := pb.RegisterSimpleBankHandlerFromEndpoint(ctx, mux, grpcAddress, opts); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// incomingHeaderMatcher forwards the request id on top of the default headers
+func incomingHeaderMatcher(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == textproto.CanonicalMIMEHeaderKey(requestIDHeaderKey) {
+		return requestIDHeaderKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher drops the request id header of the gRPC response,
+// the HTTP server in front of the gateway already sets it
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == requestIDHeaderKey {
+		return "", false
+	}
+	return fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, key), true
+}
+
+// routingErrorHandler answers unknown routes and methods like gin, with a plain text status,
+// no apierror code stands for them
+func routingErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	if httpStatus == http.StatusBadRequest {
+		errorHandler(ctx, mux, marshaler, w, r, status.Error(codes.InvalidArgument, "the request is malformed"))
+		return
+	}
+	http.Error(w, http.StatusText(httpStatus), httpStatus)
+}
+
+// errorHandler writes errors as the problem details of the gin routes, with the type and status
+// of the apierror code the status carries
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+
+	apiErr := &apierror.Error{Code: errorCode(st)}
+	// like apierror.Internal, internal errors don't show their message
+	if apiErr.Code != apierror.InternalError {
+		apiErr.Detail = st.Message()
+	}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.BadRequest:
+			apiErr.Detail = "some fields are invalid"
+			for _, violation := range detail.GetFieldViolations() {
+				apiErr.Fields = append(apiErr.Fields, apierror.FieldError{
+					Field:   violation.GetField(),
+					Message: violation.GetDescription(),
+				})
+			}
+		case *errdetails.RetryInfo:
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(detail.GetRetryDelay().AsDuration().Seconds()))))
+		}
+	}
+
+	body, err := json.Marshal(apiErr.Problem(r.URL.Path, r.Header.Get(requestIDHeaderKey)))
+	if err != nil {
+		http.Error(w, "failed to marshal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", apierror.ContentType)
+	w.WriteHeader(apiErr.Status())
+	w.Write(body)
+}
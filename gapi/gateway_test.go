@@ -0,0 +1,164 @@
+package gapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/utils"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// newTestGateway serves the service on a local port and returns the gateway in front of it
+func newTestGateway(t *testing.T) (http.Handler, *Server) {
+	config := config.NewSnapshot(config.Config{
+		SecreteKey:          utils.RandomString(32),
+		AccessTokenDuration: time.Minute,
+	})
+	server, err := NewServer(config, newFakeStore(), discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := server.NewGRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	gateway, err := NewGateway(ctx, listener.Addr().String())
+	require.NoError(t, err)
+	return gateway, server
+}
+
+type jsonBody map[string]interface{}
+
+func serveJSON(t *testing.T, gateway http.Handler, method string, url string, body interface{}, accessToken string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&reqBody).Encode(body))
+	}
+
+	req := httptest.NewRequest(method, url, &reqBody)
+	if accessToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	}
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, req)
+
+	var rsp map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &rsp)
+	return recorder, rsp
+}
+
+// requireProblem checks that the response is the problem details of code
+func requireProblem(t *testing.T, recorder *httptest.ResponseRecorder, rsp map[string]interface{}, code apierror.Code) {
+	require.Equal(t, code.Status(), recorder.Code)
+	require.Equal(t, apierror.ContentType, recorder.Header().Get("Content-Type"))
+	require.Equal(t, string(code), rsp["code"])
+	require.Equal(t, code.Type(), rsp["type"])
+	require.Equal(t, float64(code.Status()), rsp["status"])
+}
+
+func TestGatewayUsers(t *testing.T) {
+	gateway, _ := newTestGateway(t)
+	user := jsonBody{
+		"user_name": utils.RandomOwner(),
+		"password":  "secret",
+		"full_name": "Jane Doe",
+		"email":     utils.RandomEmail(),
+	}
+
+	// the response is the user itself with the field names of POST /users
+	recorder, rsp := serveJSON(t, gateway, http.MethodPost, "/v1/users", user, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, user["user_name"], rsp["user_name"])
+	require.Equal(t, user["email"], rsp["email"])
+	require.Contains(t, rsp, "create_at")
+	require.Contains(t, rsp, "password_change_at")
+
+	// errors are the problem details of the gin routes
+	recorder, rsp = serveJSON(t, gateway, http.MethodPost, "/v1/users", user, "")
+	requireProblem(t, recorder, rsp, apierror.DuplicateUsername)
+
+	recorder, rsp = serveJSON(t, gateway, http.MethodPost, "/v1/users", jsonBody{"user_name": "a b"}, "")
+	requireProblem(t, recorder, rsp, apierror.InvalidRequest)
+	require.Equal(t, "/v1/users", rsp["instance"])
+	require.Contains(t, rsp["errors"], map[string]interface{}{"field": "user_name", "message": "must contain only letters and digits"})
+
+	recorder, rsp = serveJSON(t, gateway, http.MethodPost, "/v1/users/login", jsonBody{"user_name": user["user_name"], "password": "secret"}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NotEmpty(t, rsp["access_token"])
+	require.Equal(t, user["user_name"], rsp["user"].(map[string]interface{})["user_name"])
+
+	recorder, rsp = serveJSON(t, gateway, http.MethodPost, "/v1/users/login", jsonBody{"user_name": user["user_name"], "password": "wrongpassword"}, "")
+	requireProblem(t, recorder, rsp, apierror.InvalidCredentials)
+}
+
+func TestGatewayAccounts(t *testing.T) {
+	gateway, server := newTestGateway(t)
+	username := utils.RandomOwner()
+	recorder, _ := serveJSON(t, gateway, http.MethodPost, "/v1/users", jsonBody{
+		"user_name": username,
+		"password":  "secret",
+		"full_name": "Jane Doe",
+		"email":     utils.RandomEmail(),
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	accessToken, _, err := server.tokenMaker.CreateToken(username, time.Minute)
+	require.NoError(t, err)
+
+	recorder, rsp := serveJSON(t, gateway, http.MethodPost, "/v1/accounts", jsonBody{"currency": "USD"}, "")
+	requireProblem(t, recorder, rsp, apierror.Unauthenticated)
+
+	recorder, rsp = serveJSON(t, gateway, http.MethodPost, "/v1/accounts", jsonBody{"currency": "USD"}, accessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, username, rsp["owner"])
+	// unlike the gin routes, protojson encodes int64 fields as strings
+	id := rsp["id"].(string)
+
+	recorder, rsp = serveJSON(t, gateway, http.MethodGet, "/v1/accounts/"+id, nil, accessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "USD", rsp["currency"])
+	require.Contains(t, rsp, "balance")
+
+	recorder, rsp = serveJSON(t, gateway, http.MethodGet, "/v1/accounts/99", nil, accessToken)
+	requireProblem(t, recorder, rsp, apierror.AccountNotFound)
+
+	recorder, _ = serveJSON(t, gateway, http.MethodGet, "/v1/unknown", nil, accessToken)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// like GET /accounts the list is a bare array
+	recorder, _ = serveJSON(t, gateway, http.MethodGet, "/v1/accounts?page_id=1&page_size=5", nil, accessToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var accounts []map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accounts))
+	require.Len(t, accounts, 1)
+}
+
+func TestClientIP(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}})
+
+	// a direct caller can't forge its address
+	md := metadata.Pairs(forwardedForHeaderKey, "198.51.100.1")
+	require.Equal(t, "192.0.2.1", clientIP(ctx, md))
+	md = metadata.Pairs(forwardedForHeaderKey, "198.51.100.1", gatewayTokenHeaderKey, "guess")
+	require.Equal(t, "192.0.2.1", clientIP(ctx, md))
+
+	// the gateway appends the address of its HTTP client to the hops sent by that client
+	md = metadata.Pairs(forwardedForHeaderKey, "198.51.100.1, 203.0.113.7", gatewayTokenHeaderKey, "guess", gatewayTokenHeaderKey, gatewayToken)
+	require.Equal(t, "203.0.113.7", clientIP(ctx, md))
+
+	require.Empty(t, clientIP(context.Background(), metadata.MD{}))
+}
@@ -0,0 +1,130 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/pb"
+	"lesson/simple-bank/token"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+	requestIDHeaderKey      = "x-request-id"
+	userAgentHeaderKey      = "user-agent"
+	// set by the gateway for calls coming from the REST facade
+	gatewayUserAgentHeaderKey = "grpcgateway-user-agent"
+	forwardedForHeaderKey     = "x-forwarded-for"
+	// carries gatewayToken on the calls of the gateway
+	gatewayTokenHeaderKey = "x-gateway-token"
+)
+
+// publicMethods can be called without a bearer token
+var publicMethods = map[string]bool{
+	pb.SimpleBank_CreateUser_FullMethodName: true,
+	pb.SimpleBank_LoginUser_FullMethodName:  true,
+}
+
+type payloadKey struct{}
+
+// metadataInterceptor attaches the audit metadata of the call and returns its request id in the header
+func metadataInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	meta := db.AuditMeta{
+		RequestID: firstValue(md, requestIDHeaderKey),
+		UserAgent: firstValue(md, gatewayUserAgentHeaderKey),
+		ClientIP:  clientIP(ctx, md),
+	}
+	if meta.RequestID == "" {
+		meta.RequestID = uuid.New().String()
+	}
+	if meta.UserAgent == "" {
+		meta.UserAgent = firstValue(md, userAgentHeaderKey)
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeaderKey, meta.RequestID))
+
+	return handler(db.WithAuditMeta(ctx, meta), req)
+}
+
+// clientIP returns the address of the caller. Only the gateway of this process is trusted to forward
+// the address of its HTTP client, as the last x-forwarded-for hop it appends, any other caller could forge it.
+func clientIP(ctx context.Context, md metadata.MD) string {
+	if fromGateway(md) {
+		if forwardedFor := md.Get(forwardedForHeaderKey); len(forwardedFor) > 0 {
+			hops := strings.Split(forwardedFor[len(forwardedFor)-1], ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// authInterceptor verifies the bearer token of every call but the public methods
+// and stores its payload in the context, the actor of audit events is set from it
+func (server *Server) authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	payload, err := server.authorizeUser(ctx)
+	if err != nil {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	meta := db.AuditMetaFrom(ctx)
+	meta.Actor = payload.Username
+	ctx = db.WithAuditMeta(ctx, meta)
+	return handler(context.WithValue(ctx, payloadKey{}, payload), req)
+}
+
+func (server *Server) authorizeUser(ctx context.Context) (*token.Payload, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorizationHeader := firstValue(md, authorizationHeaderKey)
+	if authorizationHeader == "" {
+		return nil, errors.New("authorization header is not provided")
+	}
+
+	fields := strings.Fields(authorizationHeader)
+	if len(fields) < 2 {
+		return nil, errors.New("invalid authorization header format")
+	}
+
+	authorizationType := strings.ToLower(fields[0])
+	if authorizationType != authorizationTypeBearer {
+		return nil, fmt.Errorf("unsupported authorization type %s", authorizationType)
+	}
+
+	return server.tokenMaker.VerifyToken(fields[1])
+}
+
+// authPayload returns the token payload stored by authInterceptor
+func authPayload(ctx context.Context) *token.Payload {
+	payload, _ := ctx.Value(payloadKey{}).(*token.Payload)
+	return payload
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
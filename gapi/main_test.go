@@ -0,0 +1,183 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/db/memstore"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/pb"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/utils"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeStore keeps users and accounts in memory for the calls used by the service,
+// the other db.Store methods, such as the login failures of the lockout, go to a memstore
+type fakeStore struct {
+	db.Store
+	mu        sync.Mutex
+	users     map[string]db.User
+	accounts  map[int64]db.Account
+	transfers []db.TransferTxParams
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		Store:    memstore.New(),
+		users:    make(map[string]db.User),
+		accounts: make(map[int64]db.Account),
+	}
+}
+
+func (store *fakeStore) CreateUserTx(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[arg.Username]; ok {
+		return db.User{}, &pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "users_pkey"`}
+	}
+	user := db.User{
+		Username:         arg.Username,
+		HashedPassword:   arg.HashedPassword,
+		FullName:         arg.FullName,
+		Email:            arg.Email,
+		PasswordChangeAt: time.Now(),
+		CreatedAt:        time.Now(),
+		Role:             utils.DepositorRole,
+	}
+	store.users[user.Username] = user
+	return user, nil
+}
+
+func (store *fakeStore) GetUser(ctx context.Context, username string) (db.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, ok := store.users[username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (store *fakeStore) CreateAccountTx(ctx context.Context, arg db.CreateAccountParams) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[arg.Owner]; !ok {
+		return db.Account{}, &pq.Error{Code: "23503", Message: `insert or update on table "accounts" violates foreign key constraint`}
+	}
+	account := db.Account{
+		ID:        int64(len(store.accounts) + 1),
+		Owner:     arg.Owner,
+		Balance:   arg.Balance,
+		Currency:  arg.Currency,
+		CreatedAt: time.Now(),
+	}
+	store.accounts[account.ID] = account
+	return account, nil
+}
+
+func (store *fakeStore) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	account, ok := store.accounts[id]
+	if !ok {
+		return db.Account{}, sql.ErrNoRows
+	}
+	return account, nil
+}
+
+func (store *fakeStore) ListOwnerAccounts(ctx context.Context, arg db.ListOwnerAccountsParams) ([]db.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	accounts := []db.Account{}
+	for id := int64(1); id <= int64(len(store.accounts)); id++ {
+		if store.accounts[id].Owner == arg.Owner {
+			accounts = append(accounts, store.accounts[id])
+		}
+	}
+	if int(arg.Offset) >= len(accounts) {
+		return []db.Account{}, nil
+	}
+	accounts = accounts[arg.Offset:]
+	if len(accounts) > int(arg.Limit) {
+		accounts = accounts[:arg.Limit]
+	}
+	return accounts, nil
+}
+
+func (store *fakeStore) TranserTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.transfers = append(store.transfers, arg)
+	from, to := store.accounts[arg.FromAccountID], store.accounts[arg.ToAccountID]
+	from.Balance -= arg.Amount
+	to.Balance += arg.Amount
+	store.accounts[from.ID], store.accounts[to.ID] = from, to
+
+	return db.TransferTxResult{
+		Transfer:    db.Transfer{ID: int64(len(store.transfers)), FromAccountID: from.ID, ToAccountID: to.ID, Amount: arg.Amount},
+		FromAccount: from,
+		ToAccount:   to,
+		FromEntry:   db.Entry{AccountID: from.ID, Amount: -arg.Amount},
+		ToEntry:     db.Entry{AccountID: to.ID, Amount: arg.Amount},
+	}, nil
+}
+
+// newTestClient serves the service over an in-memory bufconn listener
+func newTestClient(t *testing.T, store db.Store) (pb.SimpleBankClient, *Server) {
+	return newTestClientWithConfig(t, store, config.Config{})
+}
+
+// newTestClientWithConfig is newTestClient with settings, it sets their token key and duration
+func newTestClientWithConfig(t *testing.T, store db.Store, settings config.Config) (pb.SimpleBankClient, *Server) {
+	settings.SecreteKey = utils.RandomString(32)
+	settings.AccessTokenDuration = time.Minute
+	server, err := NewServer(config.NewSnapshot(settings), store, discardLogger(), ratelimit.NewMemoryStore())
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := server.NewGRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewSimpleBankClient(conn), server
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// withToken returns a context carrying a bearer token of username
+func withToken(t *testing.T, server *Server, username string) context.Context {
+	accessToken, _, err := server.tokenMaker.CreateToken(username, time.Minute)
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, fmt.Sprintf("Bearer %s", accessToken))
+}
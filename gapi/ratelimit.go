@@ -0,0 +1,47 @@
+package gapi
+
+import (
+	"context"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/pb"
+	"lesson/simple-bank/ratelimit"
+	"math"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// rateLimitGroups are the route groups of ratelimit the methods belong to,
+// they share the buckets of the gin routes of the group
+var rateLimitGroups = map[string]string{
+	pb.SimpleBank_CreateUser_FullMethodName:     ratelimit.GroupAuth,
+	pb.SimpleBank_LoginUser_FullMethodName:      ratelimit.GroupAuth,
+	pb.SimpleBank_CreateTransfer_FullMethodName: ratelimit.GroupTransfers,
+}
+
+// rateLimitInterceptor takes a token from the bucket of the call in the policy of its method group,
+// the calls of the gateway count for its HTTP client. It runs after authInterceptor, which names the user.
+func (server *Server) rateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	group, ok := rateLimitGroups[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	policy := server.config.Load().RateLimitPolicy(group)
+	if !policy.Enabled() {
+		return handler(ctx, req)
+	}
+
+	meta := db.AuditMetaFrom(ctx)
+	result, err := server.rateLimiter.Take(ctx, policy.BucketKey(group, meta.Actor, meta.ClientIP, info.FullMethod), policy)
+	if err != nil {
+		// an outage of the bucket store must not take the methods down with it
+		server.logger.ErrorContext(ctx, "can't take rate limit token", "group", group, "error", err)
+		return handler(ctx, req)
+	}
+	if !result.Allowed {
+		wait := time.Duration(math.Ceil(result.RetryAfter.Seconds())) * time.Second
+		return nil, retryLaterError(apierror.RateLimited, wait, "the %s rate limit is exceeded, retry in %s", group, wait)
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,86 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/pb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxPageSize = 10
+
+func (server *Server) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.CreateAccountResponse, error) {
+	if err := validateCurrency(req.GetCurrency()); err != nil {
+		return nil, invalidArgumentError([]*errdetails.BadRequest_FieldViolation{fieldViolation("currency", err)})
+	}
+
+	arg := db.CreateAccountParams{
+		Owner:    authPayload(ctx).Username,
+		Currency: req.GetCurrency(),
+	}
+	account, err := server.store.CreateAccountTx(ctx, arg)
+	if err != nil {
+		return nil, statusError(err, apierror.DuplicateAccount, apierror.OwnerNotFound)
+	}
+
+	return &pb.CreateAccountResponse{Account: convertAccount(account)}, nil
+}
+
+func (server *Server) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.GetAccountResponse, error) {
+	if err := validateID(req.GetId()); err != nil {
+		return nil, invalidArgumentError([]*errdetails.BadRequest_FieldViolation{fieldViolation("id", err)})
+	}
+
+	account, err := server.ownedAccount(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetAccountResponse{Account: convertAccount(account)}, nil
+}
+
+func (server *Server) ListAccounts(ctx context.Context, req *pb.ListAccountsRequest) (*pb.ListAccountsResponse, error) {
+	var violations []*errdetails.BadRequest_FieldViolation
+	if req.GetPageId() < 1 {
+		violations = append(violations, fieldViolation("page_id", errors.New("must be at least 1")))
+	}
+	if req.GetPageSize() < 1 || req.GetPageSize() > maxPageSize {
+		violations = append(violations, fieldViolation("page_size", errors.New("must be between 1 and 10")))
+	}
+	if violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	accounts, err := server.store.ListOwnerAccounts(ctx, db.ListOwnerAccountsParams{
+		Owner:  authPayload(ctx).Username,
+		Limit:  req.GetPageSize(),
+		Offset: (req.GetPageId() - 1) * req.GetPageSize(),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	rsp := &pb.ListAccountsResponse{Accounts: make([]*pb.Account, len(accounts))}
+	for i, account := range accounts {
+		rsp.Accounts[i] = convertAccount(account)
+	}
+	return rsp, nil
+}
+
+// ownedAccount loads an account of the authenticated user, others' accounts are reported as denied
+func (server *Server) ownedAccount(ctx context.Context, id int64) (db.Account, error) {
+	account, err := server.store.GetAccount(ctx, id)
+	if err != nil {
+		return account, statusError(err, apierror.AccountNotFound)
+	}
+
+	if account.Owner != authPayload(ctx).Username {
+		return account, status.Error(codes.PermissionDenied, "account doesn't belong to the authenticated user")
+	}
+	return account, nil
+}
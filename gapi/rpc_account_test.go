@@ -0,0 +1,87 @@
+package gapi
+
+import (
+	"context"
+	"lesson/simple-bank/pb"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func createTestUser(t *testing.T, client pb.SimpleBankClient) string {
+	req := randomCreateUserRequest()
+	_, err := client.CreateUser(context.Background(), req)
+	require.NoError(t, err)
+	return req.UserName
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	client, _ := newTestClient(t, newFakeStore())
+
+	_, err := client.GetAccount(context.Background(), &pb.GetAccountRequest{Id: 1})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, "Basic abc")
+	_, err = client.GetAccount(ctx, &pb.GetAccountRequest{Id: 1})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, "Bearer invalid")
+	_, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{PageId: 1, PageSize: 5})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestCreateAndGetAccount(t *testing.T) {
+	client, server := newTestClient(t, newFakeStore())
+	owner := createTestUser(t, client)
+	ctx := withToken(t, server, owner)
+
+	created, err := client.CreateAccount(ctx, &pb.CreateAccountRequest{Currency: "USD"})
+	require.NoError(t, err)
+	require.Equal(t, owner, created.Account.Owner)
+
+	rsp, err := client.GetAccount(ctx, &pb.GetAccountRequest{Id: created.Account.Id})
+	require.NoError(t, err)
+	require.Equal(t, created.Account.Id, rsp.Account.Id)
+	require.Equal(t, "USD", rsp.Account.Currency)
+
+	_, err = client.GetAccount(ctx, &pb.GetAccountRequest{Id: 99})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetAccount(withToken(t, server, createTestUser(t, client)), &pb.GetAccountRequest{Id: created.Account.Id})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.CreateAccount(ctx, &pb.CreateAccountRequest{Currency: "JPY"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the owner comes from the token, a token of a deleted user fails the foreign key
+	_, err = client.CreateAccount(withToken(t, server, "ghost"), &pb.CreateAccountRequest{Currency: "USD"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestListAccounts(t *testing.T) {
+	client, server := newTestClient(t, newFakeStore())
+	owner := createTestUser(t, client)
+	ctx := withToken(t, server, owner)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.CreateAccount(ctx, &pb.CreateAccountRequest{Currency: "EUR"})
+		require.NoError(t, err)
+	}
+	_, err := client.CreateAccount(withToken(t, server, createTestUser(t, client)), &pb.CreateAccountRequest{Currency: "EUR"})
+	require.NoError(t, err)
+
+	rsp, err := client.ListAccounts(ctx, &pb.ListAccountsRequest{PageId: 1, PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, rsp.Accounts, 2)
+
+	rsp, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{PageId: 2, PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, rsp.Accounts, 1)
+	require.Equal(t, owner, rsp.Accounts[0].Owner)
+
+	_, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{PageId: 0, PageSize: 20})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,118 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/metrics"
+	"lesson/simple-bank/pb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (server *Server) CreateTransfer(ctx context.Context, req *pb.CreateTransferRequest) (*pb.CreateTransferResponse, error) {
+	// fail counts the refused transfer under the apierror code the gin handler would answer with
+	fail := func(reason apierror.Code, err error) (*pb.CreateTransferResponse, error) {
+		metrics.TransferFailed(string(reason))
+		return nil, withCode(reason, err)
+	}
+
+	if violations := validateCreateTransferRequest(req); violations != nil {
+		return fail(apierror.InvalidRequest, invalidArgumentError(violations))
+	}
+
+	if current := server.config.Load(); !current.TransferAllowed(req.GetAmount()) {
+		return fail(apierror.TransferLimit, status.Errorf(codes.FailedPrecondition, "amount %d is above the limit of %d per transfer", req.GetAmount(), current.MaxTransferAmount))
+	}
+
+	fromAccount, err := server.ownedAccount(ctx, req.GetFromAccountId())
+	if err != nil {
+		return fail(accountFailureReason(err), err)
+	}
+	if reason, err := validTransferAccount(fromAccount, req.GetCurrency()); err != nil {
+		return fail(reason, err)
+	}
+
+	toAccount, err := server.store.GetAccount(ctx, req.GetToAccountId())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fail(apierror.AccountNotFound, status.Error(codes.NotFound, "destination account not found"))
+		}
+		return fail(apierror.InternalError, statusError(err))
+	}
+	if reason, err := validTransferAccount(toAccount, req.GetCurrency()); err != nil {
+		return fail(reason, err)
+	}
+
+	result, err := server.store.TranserTx(ctx, db.TransferTxParams{
+		FromAccountID: req.GetFromAccountId(),
+		ToAccountID:   req.GetToAccountId(),
+		Amount:        req.GetAmount(),
+	})
+	// the transaction checks the balance and checks again that the accounts aren't frozen
+	var frozen *db.AccountFrozenError
+	if errors.As(err, &frozen) {
+		return fail(apierror.AccountFrozen, status.Error(codes.FailedPrecondition, frozen.Error()))
+	}
+	var insufficient *db.InsufficientFundsError
+	if errors.As(err, &insufficient) {
+		return fail(apierror.InsufficientFunds, status.Error(codes.FailedPrecondition, insufficient.Error()))
+	}
+	if err != nil {
+		return fail(apierror.InternalError, statusError(err))
+	}
+	metrics.TransferCreated(result.FromAccount.Currency, result.Transfer.Amount)
+
+	return &pb.CreateTransferResponse{
+		Transfer:    convertTransfer(result.Transfer),
+		FromAccount: convertAccount(result.FromAccount),
+		ToAccount:   convertAccount(result.ToAccount),
+		FromEntry:   convertEntry(result.FromEntry),
+		ToEntry:     convertEntry(result.ToEntry),
+	}, nil
+}
+
+// accountFailureReason is the apierror code of an ownedAccount error
+func accountFailureReason(err error) apierror.Code {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return apierror.AccountNotFound
+	case codes.PermissionDenied:
+		return apierror.PermissionDenied
+	}
+	return apierror.InternalError
+}
+
+func validTransferAccount(account db.Account, currency string) (apierror.Code, error) {
+	if account.Currency != currency {
+		return apierror.CurrencyMismatch, status.Errorf(codes.FailedPrecondition, "account %d currency mismatch: %s vs %s", account.ID, account.Currency, currency)
+	}
+	if account.Frozen {
+		return apierror.AccountFrozen, status.Errorf(codes.FailedPrecondition, "account %d is frozen", account.ID)
+	}
+	return "", nil
+}
+
+func validateCreateTransferRequest(req *pb.CreateTransferRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := validateID(req.GetFromAccountId()); err != nil {
+		violations = append(violations, fieldViolation("from_account_id", err))
+	}
+	if err := validateID(req.GetToAccountId()); err != nil {
+		violations = append(violations, fieldViolation("to_account_id", err))
+	}
+	if req.GetFromAccountId() == req.GetToAccountId() {
+		violations = append(violations, fieldViolation("to_account_id", errors.New("must differ from from_account_id")))
+	}
+	if req.GetAmount() <= 0 {
+		violations = append(violations, fieldViolation("amount", fmt.Errorf("must be positive")))
+	}
+	if err := validateCurrency(req.GetCurrency()); err != nil {
+		violations = append(violations, fieldViolation("currency", err))
+	}
+	return violations
+}
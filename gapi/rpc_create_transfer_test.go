@@ -0,0 +1,131 @@
+package gapi
+
+import (
+	"context"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/pb"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateTransfer(t *testing.T) {
+	store := newFakeStore()
+	client, server := newTestClient(t, store)
+
+	owner1, owner2 := createTestUser(t, client), createTestUser(t, client)
+	ctx1, ctx2 := withToken(t, server, owner1), withToken(t, server, owner2)
+
+	account1, err := client.CreateAccount(ctx1, &pb.CreateAccountRequest{Currency: "USD"})
+	require.NoError(t, err)
+	account2, err := client.CreateAccount(ctx2, &pb.CreateAccountRequest{Currency: "USD"})
+	require.NoError(t, err)
+	account3, err := client.CreateAccount(ctx2, &pb.CreateAccountRequest{Currency: "EUR"})
+	require.NoError(t, err)
+
+	req := &pb.CreateTransferRequest{
+		FromAccountId: account1.Account.Id,
+		ToAccountId:   account2.Account.Id,
+		Amount:        10,
+		Currency:      "USD",
+	}
+
+	rsp, err := client.CreateTransfer(ctx1, req)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), rsp.Transfer.Amount)
+	require.Equal(t, int64(-10), rsp.FromEntry.Amount)
+	require.Equal(t, int64(10), rsp.ToEntry.Amount)
+	require.Len(t, store.transfers, 1)
+
+	// only the owner of the source account can move money out of it
+	_, err = client.CreateTransfer(ctx2, req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	req.ToAccountId = account3.Account.Id
+	_, err = client.CreateTransfer(ctx1, req)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	req.ToAccountId = account2.Account.Id
+	frozen := store.accounts[account2.Account.Id]
+	frozen.Frozen = true
+	store.accounts[frozen.ID] = frozen
+	_, err = client.CreateTransfer(ctx1, req)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	req.ToAccountId = 99
+	_, err = client.CreateTransfer(ctx1, req)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	req.ToAccountId, req.Amount = account1.Account.Id, -1
+	_, err = client.CreateTransfer(ctx1, req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	require.Len(t, store.transfers, 1)
+}
+
+func TestCreateTransferLimit(t *testing.T) {
+	store := newFakeStore()
+	client, server := newTestClientWithConfig(t, store, config.Config{MaxTransferAmount: 50})
+
+	owner1, owner2 := createTestUser(t, client), createTestUser(t, client)
+	ctx1 := withToken(t, server, owner1)
+	account1, err := client.CreateAccount(ctx1, &pb.CreateAccountRequest{Currency: "USD"})
+	require.NoError(t, err)
+	account2, err := client.CreateAccount(withToken(t, server, owner2), &pb.CreateAccountRequest{Currency: "USD"})
+	require.NoError(t, err)
+
+	req := &pb.CreateTransferRequest{
+		FromAccountId: account1.Account.Id,
+		ToAccountId:   account2.Account.Id,
+		Amount:        51,
+		Currency:      "USD",
+	}
+	_, err = client.CreateTransfer(ctx1, req)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Equal(t, apierror.TransferLimit, errorCode(status.Convert(err)))
+	require.Empty(t, store.transfers)
+
+	req.Amount = 50
+	_, err = client.CreateTransfer(ctx1, req)
+	require.NoError(t, err)
+	require.Len(t, store.transfers, 1)
+}
+
+// failingTransferStore fails TranserTx with err, like the checks the transaction makes on the locked rows
+type failingTransferStore struct {
+	*fakeStore
+	err error
+}
+
+func (store failingTransferStore) TranserTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	return db.TransferTxResult{}, store.err
+}
+
+func TestCreateTransferFailsInTx(t *testing.T) {
+	for _, txErr := range []error{
+		&db.AccountFrozenError{AccountID: 2},
+		&db.InsufficientFundsError{AccountID: 1, Balance: 5, Currency: "USD"},
+	} {
+		client, server := newTestClient(t, failingTransferStore{fakeStore: newFakeStore(), err: txErr})
+
+		owner1, owner2 := createTestUser(t, client), createTestUser(t, client)
+		ctx1 := withToken(t, server, owner1)
+		account1, err := client.CreateAccount(ctx1, &pb.CreateAccountRequest{Currency: "USD"})
+		require.NoError(t, err)
+		account2, err := client.CreateAccount(withToken(t, server, owner2), &pb.CreateAccountRequest{Currency: "USD"})
+		require.NoError(t, err)
+
+		_, err = client.CreateTransfer(ctx1, &pb.CreateTransferRequest{
+			FromAccountId: account1.Account.Id,
+			ToAccountId:   account2.Account.Id,
+			Amount:        10,
+			Currency:      "USD",
+		})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Equal(t, txErr.Error(), status.Convert(err).Message())
+	}
+}
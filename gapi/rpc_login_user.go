@@ -0,0 +1,76 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"lesson/simple-bank/apierror"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/lockout"
+	"lesson/simple-bank/pb"
+	"lesson/simple-bank/utils"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (server *Server) LoginUser(ctx context.Context, req *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
+	if violations := validateLoginUserRequest(req); violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	// the client IP is the peer address, or the one the in-process gateway saw
+	ip := db.AuditMetaFrom(ctx).ClientIP
+	attempt, wait, err := server.loginGuard.Begin(ctx, lockout.NewPolicy(server.config.Load()), req.GetUserName(), ip)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to count login attempt: %s", err)
+	}
+	if wait > 0 {
+		return nil, retryLaterError(apierror.LoginLocked, wait, "too many failed logins, retry in %s", wait.Round(time.Second))
+	}
+
+	// an unknown user fails like a wrong password, so the usernames can't be probed
+	user, err := server.store.GetUser(ctx, req.GetUserName())
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.CompareDummyPassword(req.GetPassword())
+	case err != nil:
+		return nil, statusError(err)
+	default:
+		err = utils.ComparePassword(user.HashedPassword, req.GetPassword())
+	}
+	if err != nil {
+		if err := attempt.Fail(ctx); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to record login failure: %s", err)
+		}
+		return nil, withCode(apierror.InvalidCredentials, status.Error(codes.Unauthenticated, "incorrect username or password"))
+	}
+
+	if err := attempt.Succeed(ctx); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to reset login failures: %s", err)
+	}
+
+	accessToken, payload, err := server.tokenMaker.CreateToken(user.Username, server.config.Load().AccessTokenDuration)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create access token: %s", err)
+	}
+
+	return &pb.LoginUserResponse{
+		User:                 convertUser(user),
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: timestamppb.New(payload.ExpiresAt),
+	}, nil
+}
+
+func validateLoginUserRequest(req *pb.LoginUserRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := validateUsername(req.GetUserName()); err != nil {
+		violations = append(violations, fieldViolation("user_name", err))
+	}
+	if err := validatePassword(req.GetPassword()); err != nil {
+		violations = append(violations, fieldViolation("password", err))
+	}
+	return violations
+}
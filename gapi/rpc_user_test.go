@@ -0,0 +1,134 @@
+package gapi
+
+import (
+	"context"
+	"lesson/simple-bank/apierror"
+	"lesson/simple-bank/config"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/pb"
+	"lesson/simple-bank/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func randomCreateUserRequest() *pb.CreateUserRequest {
+	return &pb.CreateUserRequest{
+		UserName: utils.RandomOwner(),
+		Password: utils.RandomString(8),
+		FullName: utils.RandomOwner(),
+		Email:    utils.RandomEmail(),
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	store := newFakeStore()
+	client, _ := newTestClient(t, store)
+	req := randomCreateUserRequest()
+
+	var header metadata.MD
+	rsp, err := client.CreateUser(context.Background(), req, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Equal(t, req.UserName, rsp.User.UserName)
+	require.Equal(t, req.Email, rsp.User.Email)
+	require.NotEmpty(t, header.Get(requestIDHeaderKey))
+	require.NoError(t, utils.ComparePassword(store.users[req.UserName].HashedPassword, req.Password))
+
+	_, err = client.CreateUser(context.Background(), req)
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestCreateUserInvalidArgument(t *testing.T) {
+	client, _ := newTestClient(t, newFakeStore())
+
+	_, err := client.CreateUser(context.Background(), &pb.CreateUserRequest{
+		UserName: "bad user",
+		Password: "123",
+		FullName: "Someone",
+		Email:    "not-an-email",
+	})
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+
+	require.Len(t, st.Details(), 1)
+	badRequest := st.Details()[0].(*errdetails.BadRequest)
+	var fields []string
+	for _, violation := range badRequest.FieldViolations {
+		fields = append(fields, violation.Field)
+	}
+	require.Equal(t, []string{"user_name", "password", "email"}, fields)
+}
+
+func TestLoginUser(t *testing.T) {
+	store := newFakeStore()
+	client, server := newTestClient(t, store)
+	req := randomCreateUserRequest()
+	_, err := client.CreateUser(context.Background(), req)
+	require.NoError(t, err)
+
+	rsp, err := client.LoginUser(context.Background(), &pb.LoginUserRequest{UserName: req.UserName, Password: req.Password})
+	require.NoError(t, err)
+	require.Equal(t, req.UserName, rsp.User.UserName)
+
+	payload, err := server.tokenMaker.VerifyToken(rsp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, req.UserName, payload.Username)
+	require.WithinDuration(t, payload.ExpiresAt, rsp.AccessTokenExpiresAt.AsTime(), 0)
+
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{UserName: req.UserName, Password: "wrongpassword"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// an unknown user fails like a wrong password
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{UserName: "nobody", Password: req.Password})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestLoginUserLocked(t *testing.T) {
+	store := newFakeStore()
+	client, _ := newTestClient(t, store)
+	req := randomCreateUserRequest()
+	_, err := client.CreateUser(context.Background(), req)
+	require.NoError(t, err)
+
+	_, err = store.LoginAttemptTx(context.Background(), db.LoginAttemptTxParams{
+		Keys:        []db.LoginAttemptKey{{Key: "user:" + req.UserName, Wait: func(int32) time.Duration { return time.Minute }}},
+		WindowStart: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	// even the right password is refused while locked
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{UserName: req.UserName, Password: req.Password})
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 2)
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.Equal(t, apierror.LoginLocked, errorCode(st))
+	require.InDelta(t, time.Minute, retryInfo.RetryDelay.AsDuration(), float64(time.Second))
+}
+
+func TestLoginUserRateLimited(t *testing.T) {
+	client, _ := newTestClientWithConfig(t, newFakeStore(), config.Config{RateLimitAuth: "ip:2/1m"})
+	req := randomCreateUserRequest()
+	_, err := client.CreateUser(context.Background(), req)
+	require.NoError(t, err)
+
+	// signing up took a token of the auth bucket too
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{UserName: req.UserName, Password: req.Password})
+	require.NoError(t, err)
+
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{UserName: req.UserName, Password: req.Password})
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 2)
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.Equal(t, apierror.RateLimited, errorCode(st))
+	require.Equal(t, 30*time.Second, retryInfo.RetryDelay.AsDuration())
+}
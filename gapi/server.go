@@ -0,0 +1,51 @@
+package gapi
+
+import (
+	"lesson/simple-bank/config"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/initial"
+	"lesson/simple-bank/lockout"
+	"lesson/simple-bank/pb"
+	"lesson/simple-bank/ratelimit"
+	"lesson/simple-bank/token"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// Server serves the SimpleBank gRPC service, it is the gRPC counterpart of api.Server
+type Server struct {
+	pb.UnimplementedSimpleBankServer
+	config     *config.Snapshot
+	store      db.Store
+	tokenMaker token.Maker
+	loginGuard *lockout.Guard
+	logger     *slog.Logger
+	// the rate limit buckets, shared with the HTTP server
+	rateLimiter ratelimit.Store
+}
+
+func NewServer(config *config.Snapshot, store db.Store, logger *slog.Logger, rateLimiter ratelimit.Store) (*Server, error) {
+	maker, err := initial.NewTokenMaker(config.Load(), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		config:      config,
+		store:       store,
+		tokenMaker:  maker,
+		loginGuard:  lockout.NewGuard(store),
+		logger:      logger,
+		rateLimiter: rateLimiter,
+	}, nil
+}
+
+// NewGRPCServer registers the service on a grpc.Server with the metadata, auth and rate limit interceptors
+func (server *Server) NewGRPCServer() *grpc.Server {
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(metadataInterceptor, server.authInterceptor, server.rateLimitInterceptor))
+	pb.RegisterSimpleBankServer(grpcServer, server)
+	reflection.Register(grpcServer)
+	return grpcServer
+}
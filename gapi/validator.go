@@ -0,0 +1,54 @@
+package gapi
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+)
+
+var isAlphanum = regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
+
+// supportedCurrencies mirrors the oneof binding of the gin handlers
+var supportedCurrencies = map[string]bool{"TWD": true, "USD": true, "EUR": true}
+
+func validateUsername(value string) error {
+	if !isAlphanum(value) {
+		return fmt.Errorf("must contain only letters and digits")
+	}
+	return nil
+}
+
+func validatePassword(value string) error {
+	if len(value) < 5 {
+		return fmt.Errorf("must contain at least 5 characters")
+	}
+	return nil
+}
+
+func validateFullName(value string) error {
+	if value == "" {
+		return fmt.Errorf("is required")
+	}
+	return nil
+}
+
+func validateEmail(value string) error {
+	if _, err := mail.ParseAddress(value); err != nil {
+		return fmt.Errorf("is not a valid email address")
+	}
+	return nil
+}
+
+func validateCurrency(value string) error {
+	if !supportedCurrencies[value] {
+		return fmt.Errorf("unsupported currency %q", value)
+	}
+	return nil
+}
+
+func validateID(value int64) error {
+	if value < 1 {
+		return fmt.Errorf("must be a positive id")
+	}
+	return nil
+}
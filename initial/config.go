@@ -1,26 +1,139 @@
 package initial
 
 import (
+	"errors"
 	"fmt"
 	"lesson/simple-bank/config"
+	"lesson/simple-bank/secret"
+	"net/url"
+	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// EnvName names the env variable selecting the config.<env>.env overrides, like development or production
+const EnvName = "APP_ENV"
+
+// defaults of the optional settings, so a deployment can leave them out of config.env
+var defaults = map[string]interface{}{
+	"DBMAXOPENCONNS":          25,
+	"DBMAXIDLECONNS":          25,
+	"DBCONNMAXLIFETIME":       30 * time.Minute,
+	"DBCONNMAXIDLETIME":       5 * time.Minute,
+	"SERVERREADTIMEOUT":       15 * time.Second,
+	"SERVERWRITETIMEOUT":      0,
+	"SERVERIDLETIMEOUT":       time.Minute,
+	"SHUTDOWNTIMEOUT":         30 * time.Second,
+	"ACCESSTOKENDURATION":     15 * time.Minute,
+	"OUTBOXPUBLISHER":         "log",
+	"OUTBOXRELAYINTERVAL":     time.Second,
+	"WEBHOOKTIMEOUT":          10 * time.Second,
+	"WEBHOOKWORKERINTERVAL":   5 * time.Second,
+	"STREAMHEARTBEATINTERVAL": 15 * time.Second,
+	"MIGRATEONSTARTUP":        false,
+	"SECRETSREFRESHINTERVAL":  time.Minute,
+	"TRACINGEXPORTER":         "none",
+	"TRACINGSAMPLERATIO":      1.0,
+	"LOGLEVEL":                "info",
+	"LOGFORMAT":               "json",
+	"RATELIMITSTORE":          "memory",
+	"RATELIMITAUTH":           "ip:10/1m",
+	"RATELIMITTRANSFERS":      "user:30/1m",
+	"LOGINFAILUREWINDOW":      15 * time.Minute,
+	"LOGINMAXFAILURES":        10,
+	"LOGINIPMAXFAILURES":      100,
+	"LOGINLOCKOUTDURATION":    15 * time.Minute,
+	"LOGINDELAYAFTER":         3,
+	"LOGINDELAY":              time.Second,
+}
+
+// LoadingConfig reads config.env in path, then the config.<APP_ENV>.env overrides and finally
+// the environment variables, which win over both files. A missing config.env is fine as long as
+// the environment sets the required fields. The secrets are resolved through secret.NewProvider
+// and the config is validated before it is returned.
 func LoadingConfig(path string) (config config.Config, err error) {
-	viper.SetConfigName("config") // name of config file (without extension)
-	viper.SetConfigType("env") // REQUIRED if the config file does not have the extension in the name
-	viper.AddConfigPath(path)               // optionally look for config in the working directory
-	viper.AutomaticEnv()
+	v, err := newViper(path)
+	if err != nil {
+		return
+	}
+
+	err = v.Unmarshal(&config)
+	if err != nil {
+		return config, fmt.Errorf("can't decode config: %w", err)
+	}
+
+	err = resolveSecrets(&config)
+	if err != nil {
+		return
+	}
+
+	err = config.Validate()
+	return
+}
+
+// resolveSecrets replaces the secrets of the config by the ones of the provider,
+// DBPASSWORD becomes the password of DBSOURCE
+func resolveSecrets(config *config.Config) error {
+	provider, err := secret.NewProvider(config.SecretsFile)
+	if err != nil {
+		return err
+	}
+
+	secrets := map[string]*string{
+		"SECRETEKEY": &config.SecreteKey,
+		"LEDGERKEY":  &config.LedgerKey,
+		"DBPASSWORD": &config.DbPassword,
+	}
+	for key, field := range secrets {
+		value, err := provider.Secret(key)
+		if errors.Is(err, secret.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("can't resolve %s: %w", key, err)
+		}
+		*field = value
+	}
+
+	if config.DbPassword != "" {
+		u, err := url.Parse(config.DbSource)
+		if err != nil || u.Scheme == "" {
+			return fmt.Errorf("DBPASSWORD needs DBSOURCE to be a URL")
+		}
+		u.User = url.UserPassword(u.User.Username(), config.DbPassword)
+		config.DbSource = u.String()
+	}
+	return nil
+}
+
+func newViper(path string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigType("env")
+	v.AddConfigPath(path)
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	v.SetConfigName("config")
+	err := v.ReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	if err != nil && !errors.As(err, &notFound) {
+		return nil, fmt.Errorf("can't read config.env: %w", err)
+	}
 
-	err = viper.ReadInConfig() // Find and read the config file
-	if err != nil { // Handle errors reading the config file
-		panic(fmt.Errorf("fatal error config file: %w", err))
+	if env := os.Getenv(EnvName); env != "" {
+		v.SetConfigName("config." + env)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("can't read config.%s.env: %w", env, err)
+		}
 	}
 
-	err = viper.Unmarshal(&config)
-	if err != nil { // Handle errors unmarshaling the config
-	    panic(fmt.Errorf("fatal error config file: %w", err))
+	// keys that are in neither file nor defaults are only read from the environment once bound
+	for _, key := range config.Keys() {
+		if err := v.BindEnv(key); err != nil {
+			return nil, err
+		}
 	}
-    return
-}
\ No newline at end of file
+	return v, nil
+}
@@ -0,0 +1,15 @@
+package initial
+
+import (
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/ratelimit"
+)
+
+// NewRateLimitStore returns the store of the rate limit buckets of RATELIMITSTORE,
+// postgres keeps them in the database of querier so all the instances share them
+func NewRateLimitStore(config config.Config, querier ratelimit.Querier) ratelimit.Store {
+	if config.RateLimitStore == "postgres" {
+		return ratelimit.NewPostgresStore(querier)
+	}
+	return ratelimit.NewMemoryStore()
+}
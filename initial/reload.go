@@ -0,0 +1,113 @@
+package initial
+
+import (
+	"context"
+	"lesson/simple-bank/config"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// ReloadEvent is the outcome of a config reload
+type ReloadEvent struct {
+	Time time.Time
+	// Changed are the keys of the applied changes
+	Changed []string
+	// Ignored are the keys of changes that need a restart
+	Ignored []string
+	// Before and After are the redacted values of the changed keys
+	Before map[string]string
+	After  map[string]string
+	// Err is why the reload was rejected
+	Err error
+}
+
+// Reloader loads the config files of path again and applies them to the snapshot
+type Reloader struct {
+	path     string
+	snapshot *config.Snapshot
+	record   func(ReloadEvent)
+	logger   *slog.Logger
+}
+
+// NewReloader returns a reloader of the snapshot, record is called with the reloads
+// that were rejected or changed anything
+func NewReloader(path string, snapshot *config.Snapshot, record func(ReloadEvent), logger *slog.Logger) *Reloader {
+	return &Reloader{
+		path:     path,
+		snapshot: snapshot,
+		record:   record,
+		logger:   logger,
+	}
+}
+
+// Reload reads the config like LoadingConfig and swaps its reloadable fields into the snapshot
+func (reloader *Reloader) Reload() ReloadEvent {
+	event := ReloadEvent{Time: time.Now()}
+
+	before := reloader.snapshot.Load().RedactedValues()
+	next, err := LoadingConfig(reloader.path)
+	if err == nil {
+		event.Changed, event.Ignored, err = reloader.snapshot.Reload(next)
+	}
+	event.Err = err
+	after := reloader.snapshot.Load().RedactedValues()
+
+	event.Before = make(map[string]string)
+	event.After = make(map[string]string)
+	for _, key := range event.Changed {
+		event.Before[key] = before[key]
+		event.After[key] = after[key]
+	}
+
+	switch {
+	case err != nil:
+		reloader.logger.Error("config reload rejected", "error", err)
+	case event.Changed != nil:
+		reloader.logger.Info("config reloaded", "changed", strings.Join(event.Changed, ", "))
+	}
+	if event.Ignored != nil {
+		reloader.logger.Warn("config changes need a restart", "ignored", strings.Join(event.Ignored, ", "))
+	}
+
+	if reloader.record != nil && (err != nil || event.Changed != nil || event.Ignored != nil) {
+		reloader.record(event)
+	}
+	return event
+}
+
+// Watch reloads the config whenever config.env changes or the process receives SIGHUP,
+// until ctx is done. Changes to config.<APP_ENV>.env are only picked up on SIGHUP.
+func (reloader *Reloader) Watch(ctx context.Context) {
+	v := viper.New()
+	v.SetConfigType("env")
+	v.SetConfigName("config")
+	v.AddConfigPath(reloader.path)
+	if err := v.ReadInConfig(); err == nil {
+		v.OnConfigChange(func(fsnotify.Event) {
+			if ctx.Err() == nil {
+				reloader.Reload()
+			}
+		})
+		v.WatchConfig()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			reloader.Reload()
+		}
+	}
+}
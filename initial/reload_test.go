@@ -0,0 +1,55 @@
+package initial
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lesson/simple-bank/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	t.Setenv(EnvName, "")
+	dir := writeConfig(t, map[string]string{"config.env": baseConfig})
+	current, err := LoadingConfig(dir)
+	require.NoError(t, err)
+	snapshot := config.NewSnapshot(current)
+
+	var recorded []ReloadEvent
+	reloader := NewReloader(dir, snapshot, func(event ReloadEvent) {
+		recorded = append(recorded, event)
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// nothing changed, nothing is recorded
+	event := reloader.Reload()
+	require.NoError(t, event.Err)
+	require.Empty(t, recorded)
+
+	update := func(content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.env"), []byte(content), 0o600))
+	}
+
+	update(baseConfig + "ACCESSTOKENDURATION=30m\nSERVERADDRESS=localhost:8081\n")
+	event = reloader.Reload()
+	require.NoError(t, event.Err)
+	require.Equal(t, []string{"ACCESSTOKENDURATION"}, event.Changed)
+	require.Equal(t, []string{"SERVERADDRESS"}, event.Ignored)
+	require.Equal(t, map[string]string{"ACCESSTOKENDURATION": "15m0s"}, event.Before)
+	require.Equal(t, map[string]string{"ACCESSTOKENDURATION": "30m0s"}, event.After)
+	require.Equal(t, 30*time.Minute, snapshot.Load().AccessTokenDuration)
+	require.Equal(t, "localhost:8080", snapshot.Load().ServerAddress)
+	require.Len(t, recorded, 1)
+
+	update(baseConfig + "ACCESSTOKENDURATION=-1m\n")
+	event = reloader.Reload()
+	require.Error(t, event.Err)
+	require.Empty(t, event.Changed)
+	require.Equal(t, 30*time.Minute, snapshot.Load().AccessTokenDuration)
+	require.Len(t, recorded, 2)
+	require.Equal(t, event.Err, recorded[1].Err)
+}
@@ -0,0 +1,25 @@
+package initial
+
+import (
+	"lesson/simple-bank/config"
+	"lesson/simple-bank/secret"
+	"lesson/simple-bank/token"
+	"log/slog"
+)
+
+// NewTokenMaker returns the token maker of the servers. With SECRETSREFRESHINTERVAL the key is read
+// through the secret provider again every interval, so a rotated key file is used without a restart.
+// The rotations are logged to logger.
+func NewTokenMaker(config config.Config, logger *slog.Logger) (token.Maker, error) {
+	if config.SecretsRefreshInterval <= 0 {
+		return token.NewJWTMaker(config.SecreteKey)
+	}
+
+	provider, err := secret.NewProvider(config.SecretsFile)
+	if err != nil {
+		return nil, err
+	}
+	// the key of the config files is the last resort
+	provider = secret.Chain{provider, secret.Static{"SECRETEKEY": config.SecreteKey}}
+	return token.NewRotatingJWTMaker(provider, "SECRETEKEY", config.SecretsRefreshInterval, config.AccessTokenDuration, logger)
+}
@@ -0,0 +1,190 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001."
+
+var (
+	ErrInvalidDocument = errors.New("invalid pain.001 document")
+
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	amountPattern   = regexp.MustCompile(`^[0-9]{1,18}(\.[0-9]{1,5})?$`)
+)
+
+// Pain001 is the subset of a CstmrCdtTrfInitn message needed to book transfers
+type Pain001 struct {
+	XMLName   xml.Name             `xml:"Document"`
+	Namespace string               `xml:"xmlns,attr"`
+	GrpHdr    GroupHeader          `xml:"CstmrCdtTrfInitn>GrpHdr"`
+	PmtInf    []PaymentInformation `xml:"CstmrCdtTrfInitn>PmtInf"`
+}
+
+type GroupHeader struct {
+	MsgId    string `xml:"MsgId"`
+	CreDtTm  string `xml:"CreDtTm"`
+	NbOfTxs  string `xml:"NbOfTxs"`
+	CtrlSum  string `xml:"CtrlSum"`
+	InitgPty string `xml:"InitgPty>Nm"`
+}
+
+type PaymentInformation struct {
+	PmtInfId  string                      `xml:"PmtInfId"`
+	DbtrAcct  string                      `xml:"DbtrAcct>Id>Othr>Id"`
+	CdtTrfTxs []CreditTransferTransaction `xml:"CdtTrfTxInf"`
+}
+
+type CreditTransferTransaction struct {
+	EndToEndId string           `xml:"PmtId>EndToEndId"`
+	InstdAmt   InstructedAmount `xml:"Amt>InstdAmt"`
+	CdtrAcct   string           `xml:"CdtrAcct>Id>Othr>Id"`
+}
+
+type InstructedAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Transaction is a single CdtTrfTxInf mapped onto our account ids
+type Transaction struct {
+	PaymentInfoID string
+	EndToEndID    string
+	FromAccountID int64
+	ToAccountID   int64
+	Amount        int64
+	Currency      string
+}
+
+// ParsePain001 decodes and validates a pain.001 file
+func ParsePain001(r io.Reader) (*Pain001, error) {
+	var doc Pain001
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	if err := doc.validate(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (doc *Pain001) validate() error {
+	if !strings.HasPrefix(doc.Namespace, pain001Namespace) {
+		return invalidf("unsupported namespace %q", doc.Namespace)
+	}
+	if strings.TrimSpace(doc.GrpHdr.MsgId) == "" {
+		return invalidf("GrpHdr/MsgId is required")
+	}
+	if len(doc.PmtInf) == 0 {
+		return invalidf("at least one PmtInf is required")
+	}
+
+	var count int64
+	var sum int64
+	for _, pmtInf := range doc.PmtInf {
+		if _, err := parseAccountID(pmtInf.DbtrAcct); err != nil {
+			return invalidf("PmtInf %q: DbtrAcct: %v", pmtInf.PmtInfId, err)
+		}
+		if len(pmtInf.CdtTrfTxs) == 0 {
+			return invalidf("PmtInf %q: at least one CdtTrfTxInf is required", pmtInf.PmtInfId)
+		}
+		for _, tx := range pmtInf.CdtTrfTxs {
+			if tx.EndToEndId == "" {
+				return invalidf("PmtInf %q: PmtId/EndToEndId is required", pmtInf.PmtInfId)
+			}
+			if _, err := parseAccountID(tx.CdtrAcct); err != nil {
+				return invalidf("transaction %q: CdtrAcct: %v", tx.EndToEndId, err)
+			}
+			if !currencyPattern.MatchString(tx.InstdAmt.Ccy) {
+				return invalidf("transaction %q: invalid currency %q", tx.EndToEndId, tx.InstdAmt.Ccy)
+			}
+			amount, err := parseAmount(tx.InstdAmt.Value)
+			if err != nil {
+				return invalidf("transaction %q: %v", tx.EndToEndId, err)
+			}
+			// amounts are positive, so the sum only overflows past MaxInt64
+			if amount > math.MaxInt64-sum {
+				return invalidf("transaction %q: the total amount overflows", tx.EndToEndId)
+			}
+			count++
+			sum += amount
+		}
+	}
+
+	nbOfTxs, err := strconv.ParseInt(doc.GrpHdr.NbOfTxs, 10, 64)
+	if err != nil || nbOfTxs != count {
+		return invalidf("GrpHdr/NbOfTxs %q does not match %d transactions", doc.GrpHdr.NbOfTxs, count)
+	}
+	if doc.GrpHdr.CtrlSum != "" {
+		ctrlSum, err := parseAmount(doc.GrpHdr.CtrlSum)
+		if err != nil || ctrlSum != sum {
+			return invalidf("GrpHdr/CtrlSum %q does not match total amount %d", doc.GrpHdr.CtrlSum, sum)
+		}
+	}
+	return nil
+}
+
+// Version returns the message definition of the document, such as pain.001.001.03
+func (doc *Pain001) Version() string {
+	return strings.TrimPrefix(doc.Namespace, "urn:iso:std:iso:20022:tech:xsd:")
+}
+
+// Transactions flattens every CdtTrfTxInf of the document in file order
+func (doc *Pain001) Transactions() []Transaction {
+	var txs []Transaction
+	for _, pmtInf := range doc.PmtInf {
+		fromAccountID, _ := parseAccountID(pmtInf.DbtrAcct)
+		for _, tx := range pmtInf.CdtTrfTxs {
+			toAccountID, _ := parseAccountID(tx.CdtrAcct)
+			amount, _ := parseAmount(tx.InstdAmt.Value)
+			txs = append(txs, Transaction{
+				PaymentInfoID: pmtInf.PmtInfId,
+				EndToEndID:    tx.EndToEndId,
+				FromAccountID: fromAccountID,
+				ToAccountID:   toAccountID,
+				Amount:        amount,
+				Currency:      tx.InstdAmt.Ccy,
+			})
+		}
+	}
+	return txs
+}
+
+// parseAccountID reads our numeric account id out of an Othr/Id element
+func parseAccountID(s string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%q is not a valid account id", s)
+	}
+	return id, nil
+}
+
+// parseAmount converts a decimal amount into our integer amount,
+// a fractional part is only accepted when it is zero
+func parseAmount(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if !amountPattern.MatchString(s) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	if strings.Trim(fraction, "0") != "" {
+		return 0, fmt.Errorf("amount %q must be a whole number", s)
+	}
+	amount, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidDocument, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,119 @@
+package iso20022
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pain001Document(nbOfTxs string, ctrlSum string, txs string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr>
+      <MsgId>MSG-0001</MsgId>
+      <CreDtTm>2023-02-01T10:00:00</CreDtTm>
+      <NbOfTxs>%s</NbOfTxs>
+      <CtrlSum>%s</CtrlSum>
+      <InitgPty><Nm>ACME Finance</Nm></InitgPty>
+    </GrpHdr>
+    <PmtInf>
+      <PmtInfId>PMT-1</PmtInfId>
+      <PmtMtd>TRF</PmtMtd>
+      <DbtrAcct><Id><Othr><Id>1</Id></Othr></Id></DbtrAcct>
+      %s
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`, nbOfTxs, ctrlSum, txs)
+}
+
+func creditTransfer(endToEndId string, ccy string, amount string, account string) string {
+	return fmt.Sprintf(`<CdtTrfTxInf>
+        <PmtId><EndToEndId>%s</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="%s">%s</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>%s</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>`, endToEndId, ccy, amount, account)
+}
+
+func TestParsePain001(t *testing.T) {
+	file := pain001Document("2", "30.00",
+		creditTransfer("E2E-1", "USD", "10", "2")+creditTransfer("E2E-2", "USD", "20.00", "3"))
+
+	doc, err := ParsePain001(strings.NewReader(file))
+	require.NoError(t, err)
+	require.Equal(t, "MSG-0001", doc.GrpHdr.MsgId)
+	require.Equal(t, "ACME Finance", doc.GrpHdr.InitgPty)
+	require.Equal(t, "pain.001.001.03", doc.Version())
+
+	txs := doc.Transactions()
+	require.Len(t, txs, 2)
+	require.Equal(t, Transaction{
+		PaymentInfoID: "PMT-1",
+		EndToEndID:    "E2E-1",
+		FromAccountID: 1,
+		ToAccountID:   2,
+		Amount:        10,
+		Currency:      "USD",
+	}, txs[0])
+	require.Equal(t, int64(3), txs[1].ToAccountID)
+	require.Equal(t, int64(20), txs[1].Amount)
+}
+
+func TestParsePain001Invalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		file string
+	}{
+		{
+			name: "MalformedXML",
+			file: "<Document>",
+		},
+		{
+			name: "WrongNamespace",
+			file: strings.Replace(pain001Document("1", "", creditTransfer("E2E-1", "USD", "10", "2")), "pain.001.001.03", "pain.008.001.02", 1),
+		},
+		{
+			name: "NbOfTxsMismatch",
+			file: pain001Document("2", "", creditTransfer("E2E-1", "USD", "10", "2")),
+		},
+		{
+			name: "CtrlSumMismatch",
+			file: pain001Document("1", "11", creditTransfer("E2E-1", "USD", "10", "2")),
+		},
+		{
+			name: "FractionalAmount",
+			file: pain001Document("1", "", creditTransfer("E2E-1", "USD", "10.50", "2")),
+		},
+		{
+			name: "NegativeAmount",
+			file: pain001Document("1", "", creditTransfer("E2E-1", "USD", "-10", "2")),
+		},
+		{
+			name: "TotalAmountOverflow",
+			file: pain001Document("10", "", strings.Repeat(creditTransfer("E2E-1", "USD", "999999999999999999", "2"), 10)),
+		},
+		{
+			name: "InvalidCurrency",
+			file: pain001Document("1", "", creditTransfer("E2E-1", "usd", "10", "2")),
+		},
+		{
+			name: "InvalidCreditorAccount",
+			file: pain001Document("1", "", creditTransfer("E2E-1", "USD", "10", "DE89370400440532013000")),
+		},
+		{
+			name: "MissingEndToEndId",
+			file: pain001Document("1", "", creditTransfer("", "USD", "10", "2")),
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := ParsePain001(strings.NewReader(tc.file))
+			require.ErrorIs(t, err, ErrInvalidDocument)
+			require.Nil(t, doc)
+		})
+	}
+}
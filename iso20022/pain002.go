@@ -0,0 +1,152 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+)
+
+const pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.03"
+
+// Transaction and group status codes (ExternalPaymentTransactionStatus1Code)
+const (
+	StatusAccepted          = "ACSC"
+	StatusPending           = "PDNG"
+	StatusRejected          = "RJCT"
+	StatusPartiallyAccepted = "PART"
+)
+
+// Status reason codes (ExternalStatusReason1Code)
+const (
+	ReasonIncorrectAccountNumber = "AC01"
+	ReasonBlockedAccount         = "AC06"
+	ReasonNotAllowedAmount       = "AM02"
+	ReasonNotAllowedCurrency     = "AM03"
+	ReasonInsufficientFunds      = "AM04"
+	ReasonDuplication            = "AM05"
+	ReasonNarrative              = "NARR"
+)
+
+// TxStatus is the outcome of a single imported transaction
+type TxStatus struct {
+	PaymentInfoID string
+	EndToEndID    string
+	Status        string
+	ReasonCode    string
+}
+
+// Pain002 is a CstmrPmtStsRpt message reporting the outcome of a pain.001 file
+type Pain002 struct {
+	XMLName   xml.Name         `xml:"Document"`
+	Namespace string           `xml:"xmlns,attr"`
+	Report    paymentStsReport `xml:"CstmrPmtStsRpt"`
+}
+
+type paymentStsReport struct {
+	GrpHdr            reportGroupHeader           `xml:"GrpHdr"`
+	OrgnlGrpInfAndSts originalGroupStatus         `xml:"OrgnlGrpInfAndSts"`
+	OrgnlPmtInfAndSts []originalPaymentInfoStatus `xml:"OrgnlPmtInfAndSts"`
+}
+
+type reportGroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type originalGroupStatus struct {
+	OrgnlMsgId   string `xml:"OrgnlMsgId"`
+	OrgnlMsgNmId string `xml:"OrgnlMsgNmId"`
+	OrgnlNbOfTxs string `xml:"OrgnlNbOfTxs"`
+	GrpSts       string `xml:"GrpSts,omitempty"`
+}
+
+type originalPaymentInfoStatus struct {
+	OrgnlPmtInfId string              `xml:"OrgnlPmtInfId"`
+	TxInfAndSts   []transactionStatus `xml:"TxInfAndSts"`
+}
+
+type transactionStatus struct {
+	OrgnlEndToEndId string        `xml:"OrgnlEndToEndId"`
+	TxSts           string        `xml:"TxSts"`
+	StsRsnInf       *statusReason `xml:"StsRsnInf,omitempty"`
+}
+
+type statusReason struct {
+	Cd string `xml:"Rsn>Cd"`
+}
+
+// NewPain002 builds the status report for the original message msgId,
+// transactions of the same payment information block are grouped together
+func NewPain002(msgId string, msgNmId string, txs []TxStatus, now time.Time) *Pain002 {
+	report := paymentStsReport{
+		GrpHdr: reportGroupHeader{
+			MsgId:   msgId + "-STS",
+			CreDtTm: now.UTC().Format("2006-01-02T15:04:05"),
+		},
+		OrgnlGrpInfAndSts: originalGroupStatus{
+			OrgnlMsgId:   msgId,
+			OrgnlMsgNmId: msgNmId,
+			OrgnlNbOfTxs: strconv.Itoa(len(txs)),
+			GrpSts:       GroupStatus(txs),
+		},
+	}
+
+	index := make(map[string]int)
+	for _, tx := range txs {
+		i, ok := index[tx.PaymentInfoID]
+		if !ok {
+			i = len(report.OrgnlPmtInfAndSts)
+			index[tx.PaymentInfoID] = i
+			report.OrgnlPmtInfAndSts = append(report.OrgnlPmtInfAndSts, originalPaymentInfoStatus{
+				OrgnlPmtInfId: tx.PaymentInfoID,
+			})
+		}
+
+		txSts := transactionStatus{
+			OrgnlEndToEndId: tx.EndToEndID,
+			TxSts:           tx.Status,
+		}
+		if tx.ReasonCode != "" {
+			txSts.StsRsnInf = &statusReason{Cd: tx.ReasonCode}
+		}
+		report.OrgnlPmtInfAndSts[i].TxInfAndSts = append(report.OrgnlPmtInfAndSts[i].TxInfAndSts, txSts)
+	}
+
+	return &Pain002{
+		Namespace: pain002Namespace,
+		Report:    report,
+	}
+}
+
+// Marshal encodes the report as an indented XML document
+func (doc *Pain002) Marshal() ([]byte, error) {
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// GroupStatus derives the overall status of a file from its transaction statuses
+func GroupStatus(txs []TxStatus) string {
+	var accepted, rejected int
+	for _, tx := range txs {
+		switch tx.Status {
+		case StatusAccepted:
+			accepted++
+		case StatusRejected:
+			rejected++
+		default:
+			return StatusPending
+		}
+	}
+
+	switch {
+	case rejected == 0:
+		return StatusAccepted
+	case accepted == 0:
+		return StatusRejected
+	default:
+		return StatusPartiallyAccepted
+	}
+}
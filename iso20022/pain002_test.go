@@ -0,0 +1,51 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPain002(t *testing.T) {
+	txs := []TxStatus{
+		{PaymentInfoID: "PMT-1", EndToEndID: "E2E-1", Status: StatusAccepted},
+		{PaymentInfoID: "PMT-1", EndToEndID: "E2E-2", Status: StatusRejected, ReasonCode: ReasonNotAllowedCurrency},
+		{PaymentInfoID: "PMT-2", EndToEndID: "E2E-3", Status: StatusAccepted},
+	}
+
+	out, err := NewPain002("MSG-0001", "pain.001.001.03", txs, time.Now()).Marshal()
+	require.NoError(t, err)
+
+	var doc Pain002
+	require.NoError(t, xml.Unmarshal(out, &doc))
+	require.Equal(t, pain002Namespace, doc.Namespace)
+
+	report := doc.Report
+	require.Equal(t, "MSG-0001", report.OrgnlGrpInfAndSts.OrgnlMsgId)
+	require.Equal(t, "pain.001.001.03", report.OrgnlGrpInfAndSts.OrgnlMsgNmId)
+	require.Equal(t, "3", report.OrgnlGrpInfAndSts.OrgnlNbOfTxs)
+	require.Equal(t, StatusPartiallyAccepted, report.OrgnlGrpInfAndSts.GrpSts)
+
+	require.Len(t, report.OrgnlPmtInfAndSts, 2)
+	require.Equal(t, "PMT-1", report.OrgnlPmtInfAndSts[0].OrgnlPmtInfId)
+	require.Len(t, report.OrgnlPmtInfAndSts[0].TxInfAndSts, 2)
+	require.Nil(t, report.OrgnlPmtInfAndSts[0].TxInfAndSts[0].StsRsnInf)
+
+	rejected := report.OrgnlPmtInfAndSts[0].TxInfAndSts[1]
+	require.Equal(t, "E2E-2", rejected.OrgnlEndToEndId)
+	require.Equal(t, StatusRejected, rejected.TxSts)
+	require.Equal(t, ReasonNotAllowedCurrency, rejected.StsRsnInf.Cd)
+}
+
+func TestGroupStatus(t *testing.T) {
+	accepted := TxStatus{Status: StatusAccepted}
+	rejected := TxStatus{Status: StatusRejected}
+	pending := TxStatus{Status: StatusPending}
+
+	require.Equal(t, StatusAccepted, GroupStatus([]TxStatus{accepted, accepted}))
+	require.Equal(t, StatusRejected, GroupStatus([]TxStatus{rejected, rejected}))
+	require.Equal(t, StatusPartiallyAccepted, GroupStatus([]TxStatus{accepted, rejected}))
+	require.Equal(t, StatusPending, GroupStatus([]TxStatus{accepted, pending}))
+}
@@ -0,0 +1,238 @@
+// Package lockout slows down and then refuses the logins of the usernames and client IPs with too many
+// recent failures, against password guessing and spraying. The failures are kept in the login_failures
+// table, so the instances of the server share them.
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"lesson/simple-bank/config"
+	db "lesson/simple-bank/db/sqlc"
+	"time"
+)
+
+// resource types of the lockout audit events
+const (
+	ResourceUser = "user"
+	ResourceIP   = "ip"
+)
+
+// maxDelayShift bounds the doublings of the delay, later failures wait Lockout anyway
+const maxDelayShift = 30
+
+// Policy tells how the failures within Window delay and lock the next logins
+type Policy struct {
+	Window time.Duration
+	// MaxFailures of a username and MaxIPFailures of a client IP lock it for Lockout, zero never locks
+	MaxFailures   int
+	MaxIPFailures int
+	Lockout       time.Duration
+	// from the DelayAfter-th failure of a username on, its next login waits Delay doubled with each further failure.
+	// A client IP isn't delayed, as the users behind a shared address would be too.
+	DelayAfter int
+	Delay      time.Duration
+}
+
+// NewPolicy returns the policy of the LOGIN* settings of config
+func NewPolicy(config config.Config) Policy {
+	return Policy{
+		Window:        config.LoginFailureWindow,
+		MaxFailures:   config.LoginMaxFailures,
+		MaxIPFailures: config.LoginIPMaxFailures,
+		Lockout:       config.LoginLockoutDuration,
+		DelayAfter:    config.LoginDelayAfter,
+		Delay:         config.LoginDelay,
+	}
+}
+
+// userWait returns how long the logins of a username wait after its failures, locked tells whether it's a lockout
+func (policy Policy) userWait(failures int) (wait time.Duration, locked bool) {
+	if policy.MaxFailures > 0 && failures >= policy.MaxFailures {
+		return policy.Lockout, true
+	}
+	if policy.DelayAfter <= 0 || policy.Delay <= 0 || failures < policy.DelayAfter {
+		return 0, false
+	}
+
+	shift := failures - policy.DelayAfter
+	if shift > maxDelayShift {
+		return policy.Lockout, false
+	}
+	wait = policy.Delay << shift
+	if wait > policy.Lockout {
+		wait = policy.Lockout
+	}
+	return wait, false
+}
+
+// ipWait is userWait for the failures of a client IP
+func (policy Policy) ipWait(failures int) (wait time.Duration, locked bool) {
+	if policy.MaxIPFailures > 0 && failures >= policy.MaxIPFailures {
+		return policy.Lockout, true
+	}
+	return 0, false
+}
+
+func userKey(username string) string {
+	return ResourceUser + ":" + username
+}
+
+func ipKey(ip string) string {
+	return ResourceIP + ":" + ip
+}
+
+// Guard tracks the failed logins
+type Guard struct {
+	store db.Store
+}
+
+func NewGuard(store db.Store) *Guard {
+	return &Guard{store: store}
+}
+
+// Attempt is a login counted by Begin, Fail or Succeed settle it once the password was compared
+type Attempt struct {
+	guard    *Guard
+	policy   Policy
+	username string
+	ip       string
+	// failures are the rows of the username and of the ip counting the attempt
+	failures []db.LoginFailure
+}
+
+// Begin counts the login of username from ip as a failure before its password is compared, so parallel
+// guesses can't all get through before the first of them locks the username, then returns how long
+// it has to wait. A login that has to wait isn't counted, it gets no attempt and must be refused.
+func (guard *Guard) Begin(ctx context.Context, policy Policy, username string, ip string) (*Attempt, time.Duration, error) {
+	keys := []db.LoginAttemptKey{{Key: userKey(username), Wait: waitOnly(policy.userWait)}}
+	if ip != "" {
+		keys = append(keys, db.LoginAttemptKey{Key: ipKey(ip), Wait: waitOnly(policy.ipWait)})
+	}
+
+	result, err := guard.store.LoginAttemptTx(ctx, db.LoginAttemptTxParams{
+		Keys:        keys,
+		WindowStart: time.Now().Add(-policy.Window),
+	})
+	if err != nil || result.Wait > 0 {
+		return nil, result.Wait, err
+	}
+	return &Attempt{guard: guard, policy: policy, username: username, ip: ip, failures: result.Failures}, 0, nil
+}
+
+func waitOnly(waitOf func(failures int) (time.Duration, bool)) func(failures int32) time.Duration {
+	return func(failures int32) time.Duration {
+		wait, _ := waitOf(int(failures))
+		return wait
+	}
+}
+
+// Fail keeps the attempt as a failure. The lockouts it started are recorded in the audit log.
+func (attempt *Attempt) Fail(ctx context.Context) error {
+	resources := []string{attempt.username, attempt.ip}
+	for i, failure := range attempt.failures {
+		resourceType := ResourceUser
+		if i > 0 {
+			resourceType = ResourceIP
+		}
+
+		// the failures after the lockout ended lock again, each lockout is recorded once
+		start := attempt.policy.lockoutStart(resourceType)
+		if start <= 0 || int(failure.Failures) != start {
+			continue
+		}
+		err := attempt.guard.audit(ctx, db.AuditActionLockLogin, resourceType, resources[i], nil, newAuditLock(failure))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockoutStart is the number of failures locking a resource
+func (policy Policy) lockoutStart(resourceType string) int {
+	if resourceType == ResourceIP {
+		return policy.MaxIPFailures
+	}
+	return policy.MaxFailures
+}
+
+// Succeed forgets the failures of the username and takes the attempt back from the client IP.
+// The other failures of the client IP are kept, otherwise a sprayer could clear them by logging
+// in to an account of their own.
+func (attempt *Attempt) Succeed(ctx context.Context) error {
+	_, err := attempt.guard.store.DeleteLoginFailure(ctx, userKey(attempt.username))
+	if err != nil || attempt.ip == "" {
+		return err
+	}
+
+	_, err = attempt.guard.store.ForgiveLoginFailure(ctx, db.ForgiveLoginFailureParams{
+		Key:         ipKey(attempt.ip),
+		MaxFailures: int32(attempt.policy.MaxIPFailures),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// pruned in between
+		return nil
+	}
+	return err
+}
+
+// Unlock forgets the failures and the lock of username, unlocked is false when it had none.
+// The unlock is recorded in the audit log.
+func (guard *Guard) Unlock(ctx context.Context, username string) (unlocked bool, err error) {
+	failure, err := guard.store.GetLoginFailure(ctx, userKey(username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := guard.store.DeleteLoginFailure(ctx, failure.Key)
+	if err != nil || deleted == 0 {
+		return false, err
+	}
+	return true, guard.audit(ctx, db.AuditActionUnlockLogin, ResourceUser, username, newAuditLock(failure), nil)
+}
+
+// Prune removes the failures outside of the window of policy whose lock ended
+func (guard *Guard) Prune(ctx context.Context, policy Policy) error {
+	_, err := guard.store.DeleteStaleLoginFailures(ctx, time.Now().Add(-policy.Window))
+	return err
+}
+
+// auditLock is the state of a lock kept in the audit log
+type auditLock struct {
+	Failures    int32     `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+func newAuditLock(failure db.LoginFailure) auditLock {
+	return auditLock{Failures: failure.Failures, LockedUntil: failure.LockedUntil}
+}
+
+func (guard *Guard) audit(ctx context.Context, action string, resourceType string, resourceID string, before interface{}, after interface{}) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	meta := db.AuditMetaFrom(ctx)
+	_, err = guard.store.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		Actor:        meta.Actor,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Before:       beforeJSON,
+		After:        afterJSON,
+		RequestID:    meta.RequestID,
+		ClientIp:     meta.ClientIP,
+		UserAgent:    meta.UserAgent,
+	})
+	return err
+}
@@ -0,0 +1,209 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"lesson/simple-bank/db/memstore"
+	db "lesson/simple-bank/db/sqlc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserWait(t *testing.T) {
+	policy := Policy{Window: time.Minute, MaxFailures: 6, Lockout: 5 * time.Second, DelayAfter: 3, Delay: time.Second}
+
+	testCases := []struct {
+		failures int
+		wait     time.Duration
+		locked   bool
+	}{
+		{1, 0, false},
+		{2, 0, false},
+		{3, time.Second, false},
+		{4, 2 * time.Second, false},
+		{5, 4 * time.Second, false},
+		{6, 5 * time.Second, true},
+		{100, 5 * time.Second, true},
+	}
+	for _, tc := range testCases {
+		wait, locked := policy.userWait(tc.failures)
+		require.Equal(t, tc.wait, wait, "failures %d", tc.failures)
+		require.Equal(t, tc.locked, locked, "failures %d", tc.failures)
+	}
+
+	// the delays are capped by the lockout, however many doublings
+	policy.MaxFailures = 0
+	wait, locked := policy.userWait(80)
+	require.Equal(t, policy.Lockout, wait)
+	require.False(t, locked)
+
+	policy.Delay = 0
+	wait, _ = policy.userWait(5)
+	require.Zero(t, wait)
+}
+
+func countAuditEvents(t *testing.T, store db.Store, action string, resourceType string, resourceID string) int {
+	events, err := store.ListAuditEvents(context.Background(), db.ListAuditEventsParams{
+		Action:       sql.NullString{String: action, Valid: true},
+		ResourceType: sql.NullString{String: resourceType, Valid: true},
+		ResourceID:   sql.NullString{String: resourceID, Valid: true},
+		Size:         10,
+	})
+	require.NoError(t, err)
+	return len(events)
+}
+
+// fail makes a login of username from ip that fails, it must not have to wait
+func fail(t *testing.T, guard *Guard, policy Policy, username string, ip string) {
+	attempt, wait, err := guard.Begin(context.Background(), policy, username, ip)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	require.NoError(t, attempt.Fail(context.Background()))
+}
+
+// begin starts a login of username from ip and returns how long it has to wait
+func begin(t *testing.T, guard *Guard, policy Policy, username string, ip string) (*Attempt, time.Duration) {
+	attempt, wait, err := guard.Begin(context.Background(), policy, username, ip)
+	require.NoError(t, err)
+	require.Equal(t, wait == 0, attempt != nil)
+	return attempt, wait
+}
+
+func TestGuardLocksUser(t *testing.T) {
+	store := memstore.New()
+	guard := NewGuard(store)
+	policy := Policy{Window: time.Minute, MaxFailures: 3, Lockout: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		fail(t, guard, policy, "alice", "192.0.2.1")
+	}
+
+	_, wait := begin(t, guard, policy, "alice", "192.0.2.2")
+	require.InDelta(t, time.Minute, wait, float64(time.Second))
+
+	// other users behind the same address can still log in
+	attempt, wait := begin(t, guard, policy, "bob", "192.0.2.1")
+	require.Zero(t, wait)
+	require.NoError(t, attempt.Succeed(context.Background()))
+
+	// the lockout is recorded once
+	require.Equal(t, 1, countAuditEvents(t, store, db.AuditActionLockLogin, ResourceUser, "alice"))
+}
+
+func TestGuardCountsBeforeCompare(t *testing.T) {
+	guard := NewGuard(memstore.New())
+	policy := Policy{Window: time.Minute, MaxFailures: 3, Lockout: time.Minute}
+
+	// guesses whose passwords are still being compared already count
+	for i := 0; i < 3; i++ {
+		_, wait := begin(t, guard, policy, "alice", "192.0.2.1")
+		require.Zero(t, wait)
+	}
+	_, wait := begin(t, guard, policy, "alice", "192.0.2.1")
+	require.InDelta(t, time.Minute, wait, float64(time.Second))
+}
+
+func TestGuardLocksIP(t *testing.T) {
+	store := memstore.New()
+	guard := NewGuard(store)
+	ctx := context.Background()
+	policy := Policy{Window: time.Minute, MaxFailures: 10, MaxIPFailures: 3, Lockout: time.Minute}
+
+	// a sprayer tries one password per user
+	for _, username := range []string{"alice", "bob"} {
+		fail(t, guard, policy, username, "192.0.2.1")
+	}
+
+	// a successful login takes its own attempt back, not the failures of the address
+	attempt, wait := begin(t, guard, policy, "dave", "192.0.2.1")
+	require.Zero(t, wait)
+	require.NoError(t, attempt.Succeed(ctx))
+	failure, err := store.GetLoginFailure(ctx, ipKey("192.0.2.1"))
+	require.NoError(t, err)
+	require.Equal(t, int32(2), failure.Failures)
+
+	fail(t, guard, policy, "carol", "192.0.2.1")
+	_, wait = begin(t, guard, policy, "dave", "192.0.2.1")
+	require.InDelta(t, time.Minute, wait, float64(time.Second))
+	require.Equal(t, 1, countAuditEvents(t, store, db.AuditActionLockLogin, ResourceIP, "192.0.2.1"))
+
+	_, wait = begin(t, guard, policy, "dave", "192.0.2.2")
+	require.Zero(t, wait)
+}
+
+func TestGuardSucceedUnlocksIP(t *testing.T) {
+	store := memstore.New()
+	guard := NewGuard(store)
+	policy := Policy{Window: time.Minute, MaxFailures: 10, MaxIPFailures: 2, Lockout: time.Minute}
+
+	// the attempt reaching the max locks the address until it turns out to be right
+	fail(t, guard, policy, "alice", "192.0.2.1")
+	attempt, wait := begin(t, guard, policy, "bob", "192.0.2.1")
+	require.Zero(t, wait)
+	require.NoError(t, attempt.Succeed(context.Background()))
+
+	_, wait = begin(t, guard, policy, "carol", "192.0.2.1")
+	require.Zero(t, wait)
+	require.Zero(t, countAuditEvents(t, store, db.AuditActionLockLogin, ResourceIP, "192.0.2.1"))
+}
+
+func TestGuardDelays(t *testing.T) {
+	guard := NewGuard(memstore.New())
+	policy := Policy{Window: time.Minute, Lockout: time.Minute, DelayAfter: 2, Delay: time.Second}
+
+	fail(t, guard, policy, "alice", "")
+	fail(t, guard, policy, "alice", "")
+	_, wait := begin(t, guard, policy, "alice", "")
+	require.InDelta(t, time.Second, wait, float64(100*time.Millisecond))
+
+	time.Sleep(wait)
+	attempt, wait := begin(t, guard, policy, "alice", "")
+	require.Zero(t, wait)
+	require.NoError(t, attempt.Succeed(context.Background()))
+
+	// the right password clears the delay
+	fail(t, guard, policy, "alice", "")
+	_, wait = begin(t, guard, policy, "alice", "")
+	require.Zero(t, wait)
+}
+
+func TestGuardUnlock(t *testing.T) {
+	store := memstore.New()
+	guard := NewGuard(store)
+	ctx := db.WithAuditMeta(context.Background(), db.AuditMeta{Actor: "admin"})
+	policy := Policy{Window: time.Minute, MaxFailures: 1, Lockout: time.Minute}
+
+	unlocked, err := guard.Unlock(ctx, "alice")
+	require.NoError(t, err)
+	require.False(t, unlocked)
+
+	fail(t, guard, policy, "alice", "")
+	unlocked, err = guard.Unlock(ctx, "alice")
+	require.NoError(t, err)
+	require.True(t, unlocked)
+
+	_, wait := begin(t, guard, policy, "alice", "")
+	require.Zero(t, wait)
+	require.Equal(t, 1, countAuditEvents(t, store, db.AuditActionUnlockLogin, ResourceUser, "alice"))
+}
+
+func TestGuardPrune(t *testing.T) {
+	store := memstore.New()
+	guard := NewGuard(store)
+	ctx := context.Background()
+
+	fail(t, guard, Policy{Window: time.Minute, Lockout: time.Minute}, "alice", "")
+	fail(t, guard, Policy{Window: time.Minute, MaxFailures: 1, Lockout: time.Minute}, "bob", "")
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, guard.Prune(ctx, Policy{Window: time.Millisecond}))
+
+	// the failures of alice left the window, bob is still locked
+	_, err := store.GetLoginFailure(ctx, userKey("alice"))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.GetLoginFailure(ctx, userKey("bob"))
+	require.NoError(t, err)
+}
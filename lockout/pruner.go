@@ -0,0 +1,39 @@
+package lockout
+
+import (
+	"context"
+	"lesson/simple-bank/config"
+	"log/slog"
+	"time"
+)
+
+// Pruner removes the failures outside of the window whose lock ended, they can't delay a login anymore
+type Pruner struct {
+	guard    *Guard
+	snapshot *config.Snapshot
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func NewPruner(guard *Guard, snapshot *config.Snapshot, interval time.Duration, logger *slog.Logger) *Pruner {
+	return &Pruner{guard: guard, snapshot: snapshot, interval: interval, logger: logger}
+}
+
+// Run prunes the failures every interval until ctx is canceled
+func (pruner *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruner.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		policy := NewPolicy(pruner.snapshot.Load())
+		if err := pruner.guard.Prune(ctx, policy); err != nil {
+			pruner.logger.ErrorContext(ctx, "can't prune login failures", "error", err)
+		}
+	}
+}
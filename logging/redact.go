@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are parts of the attribute keys whose values are never logged
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "email"}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// JWTs and PASETOs
+	tokenPattern  = regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+|v2\.local\.[A-Za-z0-9_-]+)`)
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+\S+`)
+	// the password of a URL such as a DSN
+	urlPasswordPattern = regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`)
+)
+
+// Redact is the ReplaceAttr of the handlers: the values of the keys naming a password, a token,
+// a secret or an email are dropped, and emails, tokens and URL passwords are masked in the other strings
+// and errors, the message included
+func Redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, RedactString(value.String()))
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, RedactString(err.Error()))
+		}
+	}
+	return attr
+}
+
+// RedactString masks the emails, the tokens and the URL passwords of s
+func RedactString(s string) string {
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}"+redacted+"@")
+	s = emailPattern.ReplaceAllString(s, redacted)
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	return tokenPattern.ReplaceAllString(s, redacted)
+}
@@ -0,0 +1,161 @@
+// Package metrics holds the Prometheus metrics of the server. They are registered with the default
+// registry and served by Handler, on a listener of its own so they aren't public. No label takes ids or other values chosen by clients, so the number
+// of series stays bounded: routes are templates, methods and reasons are fixed sets and currencies
+// are validated before a transfer is booked.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "simple_bank"
+
+// UnmatchedRoute is the route label of the requests that match no route
+const UnmatchedRoute = "unmatched"
+
+// outcomes of a db transaction
+const (
+	TxCommitted = "committed"
+	TxFailed    = "failed"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the HTTP requests by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	txDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "tx_duration_seconds",
+		Help:      "Duration of the db transactions by outcome, retries included.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"outcome"})
+
+	txRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "tx_retries_total",
+		Help:      "db transactions run again after a serialization failure or a deadlock.",
+	})
+
+	txRollbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "tx_rollbacks_total",
+		Help:      "db transactions rolled back.",
+	})
+
+	transfersCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_created_total",
+		Help:      "Transfers booked by currency.",
+	}, []string{"currency"})
+
+	transferVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_volume_total",
+		Help:      "Sum of the amounts of the transfers booked by currency, in the smallest unit of the currency.",
+	}, []string{"currency"})
+
+	transfersFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_failed_total",
+		Help:      "Transfer requests refused or failed by reason.",
+	}, []string{"reason"})
+)
+
+// Handler serves the metrics of the default registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve serves Handler at /metrics on listener until ctx is done
+func Serve(ctx context.Context, listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	stop := context.AfterFunc(ctx, func() { server.Close() })
+	defer stop()
+	err := server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// RegisterDBStats exports the stats of the connection pool as the go_sql_* metrics
+func RegisterDBStats(conn *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(conn, namespace))
+}
+
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// ObserveHTTPRequest records a request, route is the template the request matched
+func ObserveHTTPRequest(method string, route string, status int, duration time.Duration) {
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveTx records a db transaction with its outcome, TxCommitted or TxFailed
+func ObserveTx(outcome string, duration time.Duration) {
+	txDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+// TxRetried counts a db transaction run again
+func TxRetried() {
+	txRetries.Inc()
+}
+
+// TxRolledBack counts a db transaction rolled back
+func TxRolledBack() {
+	txRollbacks.Inc()
+}
+
+// TransferCreated counts a booked transfer and its amount
+func TransferCreated(currency string, amount int64) {
+	transfersCreated.WithLabelValues(currency).Inc()
+	transferVolume.WithLabelValues(currency).Add(float64(amount))
+}
+
+// TransferFailed counts a refused or failed transfer, reason is an apierror code
+func TransferFailed(reason string) {
+	transfersFailed.WithLabelValues(reason).Inc()
+}
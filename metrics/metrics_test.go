@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveHTTPRequest(t *testing.T) {
+	before := testutil.ToFloat64(httpRequests.WithLabelValues("OTHER", UnmatchedRoute, "404"))
+	ObserveHTTPRequest("BREW", "", http.StatusNotFound, time.Millisecond)
+	require.Equal(t, before+1, testutil.ToFloat64(httpRequests.WithLabelValues("OTHER", UnmatchedRoute, "404")))
+
+	ObserveHTTPRequest(http.MethodGet, "/accounts/:id", http.StatusOK, time.Millisecond)
+	require.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/accounts/:id", "200")))
+}
+
+func TestTransferCounters(t *testing.T) {
+	TransferCreated("USD", 10)
+	TransferCreated("USD", 15)
+	require.Equal(t, 2.0, testutil.ToFloat64(transfersCreated.WithLabelValues("USD")))
+	require.Equal(t, 25.0, testutil.ToFloat64(transferVolume.WithLabelValues("USD")))
+
+	TransferFailed("insufficient_funds")
+	require.Equal(t, 1.0, testutil.ToFloat64(transfersFailed.WithLabelValues("insufficient_funds")))
+}
+
+func TestTxMetrics(t *testing.T) {
+	TxRetried()
+	TxRolledBack()
+	ObserveTx(TxFailed, time.Second)
+	require.Equal(t, 1.0, testutil.ToFloat64(txRetries))
+	require.Equal(t, 1.0, testutil.ToFloat64(txRollbacks))
+	require.Equal(t, 1, testutil.CollectAndCount(txDuration))
+}
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, listener) }()
+
+	TransferCreated("USD", 10)
+	rsp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Contains(t, string(body), `simple_bank_transfers_created_total{currency="USD"}`)
+
+	rsp, err = http.Get("http://" + listener.Addr().String() + "/accounts")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	cancel()
+	require.NoError(t, <-served)
+}
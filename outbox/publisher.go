@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"lesson/simple-bank/event"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Publisher delivers outbox events to downstream systems,
+// an error leaves the event pending so it is retried by the next relay run
+type Publisher interface {
+	Publish(ctx context.Context, event event.Envelope) error
+}
+
+// LogPublisher writes every event to a logger
+type LogPublisher struct {
+	logger *slog.Logger
+}
+
+func NewLogPublisher(logger *slog.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (publisher *LogPublisher) Publish(ctx context.Context, event event.Envelope) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	publisher.logger.InfoContext(ctx, "outbox event", "event", json.RawMessage(data))
+	return nil
+}
+
+// WebhookPublisher posts every event as JSON to an HTTP endpoint
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookPublisher(url string, timeout time.Duration) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (publisher *WebhookPublisher) Publish(ctx context.Context, event event.Envelope) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, publisher.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", fmt.Sprint(event.ID))
+	req.Header.Set("X-Event-Type", event.Type)
+
+	rsp, err := publisher.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// MultiPublisher hands every event to each of its publishers in turn,
+// when one fails the event is retried for all of them so they must tolerate duplicates
+type MultiPublisher []Publisher
+
+func (publishers MultiPublisher) Publish(ctx context.Context, event event.Envelope) error {
+	for _, publisher := range publishers {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryPublisher keeps the published events in memory, it is meant for tests
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []event.Envelope
+	// Fail, when set, is called before an event is recorded and its error is returned
+	Fail func(event event.Envelope) error
+}
+
+func (publisher *MemoryPublisher) Publish(ctx context.Context, event event.Envelope) error {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	if publisher.Fail != nil {
+		if err := publisher.Fail(event); err != nil {
+			return err
+		}
+	}
+	publisher.events = append(publisher.events, event)
+	return nil
+}
+
+// Events returns a copy of the events published so far
+func (publisher *MemoryPublisher) Events() []event.Envelope {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	events := make([]event.Envelope, len(publisher.events))
+	copy(events, publisher.events)
+	return events
+}
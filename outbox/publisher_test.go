@@ -0,0 +1,77 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"lesson/simple-bank/event"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomEnvelope(id int64) event.Envelope {
+	return event.Envelope{
+		ID:            id,
+		Type:          event.TypeAccountOpened,
+		Version:       1,
+		AggregateType: event.AggregateAccount,
+		AggregateID:   "1",
+		OccurredAt:    time.Now().UTC(),
+		Data:          json.RawMessage(`{"account_id":1}`),
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	var received event.Envelope
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Equal(t, "7", r.Header.Get("X-Event-ID"))
+		require.Equal(t, event.TypeAccountOpened, r.Header.Get("X-Event-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	envelope := randomEnvelope(7)
+	publisher := NewWebhookPublisher(server.URL, time.Second)
+	require.NoError(t, publisher.Publish(context.Background(), envelope))
+	require.Equal(t, envelope.ID, received.ID)
+	require.JSONEq(t, string(envelope.Data), string(received.Data))
+}
+
+func TestWebhookPublisherErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	publisher := NewWebhookPublisher(server.URL, time.Second)
+	err := publisher.Publish(context.Background(), randomEnvelope(1))
+	require.EqualError(t, err, "webhook responded with status 503")
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	errDown := errors.New("down")
+	publisher := &MemoryPublisher{
+		Fail: func(e event.Envelope) error {
+			if e.ID == 2 {
+				return errDown
+			}
+			return nil
+		},
+	}
+
+	require.NoError(t, publisher.Publish(context.Background(), randomEnvelope(1)))
+	require.ErrorIs(t, publisher.Publish(context.Background(), randomEnvelope(2)), errDown)
+	require.NoError(t, publisher.Publish(context.Background(), randomEnvelope(3)))
+
+	events := publisher.Events()
+	require.Len(t, events, 2)
+	require.Equal(t, int64(1), events[0].ID)
+	require.Equal(t, int64(3), events[1].ID)
+}
@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"context"
+	db "lesson/simple-bank/db/sqlc"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultRetention   = 7 * 24 * time.Hour
+	defaultMaxAttempts = 10
+	defaultBaseBackoff = 10 * time.Second
+	defaultMaxBackoff  = time.Hour
+	// a claimed batch is hidden from other relays for this long, publishing stops when it expires
+	claimLease = 5 * time.Minute
+)
+
+// Relay moves events from the outbox table to a Publisher, retrying failed events with exponential backoff
+// until they are published or reach maxAttempts and are dead-lettered
+type Relay struct {
+	store       db.Store
+	publisher   Publisher
+	interval    time.Duration
+	batchSize   int32
+	retention   time.Duration
+	maxAttempts int32
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	logger      *slog.Logger
+}
+
+func NewRelay(store db.Store, publisher Publisher, interval time.Duration, logger *slog.Logger) *Relay {
+	return &Relay{
+		store:       store,
+		publisher:   publisher,
+		interval:    interval,
+		batchSize:   defaultBatchSize,
+		retention:   defaultRetention,
+		maxAttempts: defaultMaxAttempts,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		logger:      logger,
+	}
+}
+
+// backoff returns the delay before the next attempt once attempts have failed
+func (relay *Relay) backoff(attempts int32) time.Duration {
+	delay := relay.baseBackoff
+	for i := int32(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= relay.maxBackoff {
+			return relay.maxBackoff
+		}
+	}
+	return delay
+}
+
+// RelayOnce publishes one batch of pending events and removes delivered events past the retention
+func (relay *Relay) RelayOnce(ctx context.Context) (db.RelayOutboxTxResult, error) {
+	result, err := relay.store.RelayOutboxTx(ctx, db.RelayOutboxTxParams{
+		Limit:       relay.batchSize,
+		LeaseUntil:  time.Now().Add(claimLease),
+		Publish:     relay.publisher.Publish,
+		MaxAttempts: relay.maxAttempts,
+		Backoff:     relay.backoff,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	_, err = relay.store.DeletePublishedOutboxEvents(ctx, time.Now().Add(-relay.retention))
+	return result, err
+}
+
+// Run relays events every interval until ctx is canceled
+func (relay *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := relay.RelayOnce(ctx)
+		if err != nil {
+			relay.logger.ErrorContext(ctx, "can't relay outbox events", "error", err)
+		} else if result.Failed > 0 {
+			relay.logger.WarnContext(ctx, "some outbox events failed to publish", "published", result.Published, "failed", result.Failed)
+		}
+
+		// drain a backlog without waiting for the next tick
+		if err == nil && result.Published == int(relay.batchSize) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(nil, nil, time.Second, nil)
+	relay.baseBackoff = time.Second
+	relay.maxBackoff = 10 * time.Second
+
+	require.Equal(t, time.Second, relay.backoff(1))
+	require.Equal(t, 2*time.Second, relay.backoff(2))
+	require.Equal(t, 8*time.Second, relay.backoff(4))
+	require.Equal(t, 10*time.Second, relay.backoff(5))
+	require.Equal(t, 10*time.Second, relay.backoff(30))
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the buckets of a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a store without buckets
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]bucket),
+		now:     time.Now,
+	}
+}
+
+func (store *MemoryStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.now()
+	b, ok := store.buckets[key]
+	tokens := float64(policy.Limit)
+	if ok {
+		elapsed := math.Max(now.Sub(b.updated).Seconds(), 0)
+		tokens = math.Min(tokens, b.tokens+elapsed*policy.rate())
+	}
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	store.buckets[key] = bucket{tokens: tokens, updated: now}
+	return newResult(policy, tokens, allowed), nil
+}
+
+func (store *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for key, b := range store.buckets {
+		if b.updated.Before(before) {
+			delete(store.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	db "lesson/simple-bank/db/sqlc"
+)
+
+// Querier holds the queries of db.Querier used by PostgresStore
+type Querier interface {
+	TakeRateLimitToken(ctx context.Context, arg db.TakeRateLimitTokenParams) (db.TakeRateLimitTokenRow, error)
+	DeleteIdleRateLimitBuckets(ctx context.Context, updatedBefore time.Time) (int64, error)
+}
+
+// PostgresStore keeps the buckets in the rate_limit_buckets table, so the instances of the server share them
+type PostgresStore struct {
+	querier Querier
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore returns a store of the buckets of querier, usually a db.Store
+func NewPostgresStore(querier Querier) *PostgresStore {
+	return &PostgresStore{querier: querier}
+}
+
+func (store *PostgresStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	row, err := store.querier.TakeRateLimitToken(ctx, db.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(policy.Limit),
+		Rate:  policy.rate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(policy, row.Tokens, row.Allowed), nil
+}
+
+func (store *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	_, err := store.querier.DeleteIdleRateLimitBuckets(ctx, before)
+	return err
+}
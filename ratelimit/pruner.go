@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Pruner removes the buckets left alone for MaxPeriod, they are full again by then
+type Pruner struct {
+	store    Store
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func NewPruner(store Store, interval time.Duration, logger *slog.Logger) *Pruner {
+	return &Pruner{store: store, interval: interval, logger: logger}
+}
+
+// Run prunes the store every interval until ctx is canceled
+func (pruner *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruner.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := pruner.store.Prune(ctx, time.Now().Add(-MaxPeriod)); err != nil {
+			pruner.logger.ErrorContext(ctx, "can't prune rate limit buckets", "error", err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package ratelimit limits the requests of the clients with token buckets. The bucket of a policy holds up to
+// Limit tokens and is refilled with Limit tokens every Period, each request takes one token and is rejected
+// when none is left. The buckets are kept by a Store, in memory or in Postgres to share them between instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keys of a policy, the subject of its buckets
+const (
+	// KeyIP gives each client IP a bucket
+	KeyIP = "ip"
+	// KeyUser gives each authenticated user a bucket, the anonymous requests fall back to their IP
+	KeyUser = "user"
+	// KeyRoute shares a bucket between all the clients of a route
+	KeyRoute = "route"
+)
+
+// route groups sharing a policy, the HTTP routes and the gRPC methods of a group share their buckets
+const (
+	// creating users and logging in, which can be brute-forced
+	GroupAuth = "auth"
+	// booking transfers and imports
+	GroupTransfers = "transfers"
+)
+
+// MaxPeriod bounds the periods of the policies, a bucket untouched that long is full and can be forgotten
+const MaxPeriod = time.Hour
+
+// Policy is the token bucket of a route group
+type Policy struct {
+	Key    string
+	Limit  int
+	Period time.Duration
+}
+
+// ParsePolicy parses KEY:LIMIT/PERIOD, like ip:10/1m for 10 requests a minute per client IP.
+// An empty policy or off disables the limit.
+func ParsePolicy(s string) (Policy, error) {
+	if s == "" || s == "off" {
+		return Policy{}, nil
+	}
+
+	key, quota, ok := strings.Cut(s, ":")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit %q isn't KEY:LIMIT/PERIOD", s)
+	}
+	switch key {
+	case KeyIP, KeyUser, KeyRoute:
+	default:
+		return Policy{}, fmt.Errorf("rate limit key %q is unknown, want ip, user or route", key)
+	}
+
+	limit, period, ok := strings.Cut(quota, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit %q isn't KEY:LIMIT/PERIOD", s)
+	}
+	policy := Policy{Key: key}
+	var err error
+	policy.Limit, err = strconv.Atoi(limit)
+	if err != nil || policy.Limit <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %q needs a positive limit", s)
+	}
+	policy.Period, err = time.ParseDuration(period)
+	if err != nil || policy.Period <= 0 || policy.Period > MaxPeriod {
+		return Policy{}, fmt.Errorf("rate limit %q needs a period between 0 and %s", s, MaxPeriod)
+	}
+	return policy, nil
+}
+
+// Enabled tells whether the policy limits anything
+func (policy Policy) Enabled() bool {
+	return policy.Limit > 0
+}
+
+// BucketKey names the bucket of a request to group, the anonymous requests of a policy keyed by user use their IP
+func (policy Policy) BucketKey(group string, user string, ip string, route string) string {
+	switch policy.Key {
+	case KeyUser:
+		if user != "" {
+			return group + ":user:" + user
+		}
+	case KeyRoute:
+		return group + ":route:" + route
+	}
+	return group + ":ip:" + ip
+}
+
+func (policy Policy) String() string {
+	if !policy.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%s:%d/%s", policy.Key, policy.Limit, policy.Period)
+}
+
+// rate is the refill of the bucket in tokens per second
+func (policy Policy) rate() float64 {
+	return float64(policy.Limit) / policy.Period.Seconds()
+}
+
+// Result is the state of a bucket after a request took or failed to take a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the wait for the next token, zero when the request was allowed
+	RetryAfter time.Duration
+	// Reset is the wait for the bucket to be full again
+	Reset time.Duration
+}
+
+func newResult(policy Policy, tokens float64, allowed bool) Result {
+	rate := policy.rate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(policy.Limit) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(s, 0) * float64(time.Second))
+}
+
+// Store keeps the buckets
+type Store interface {
+	// Take refills the bucket of key as policy says and takes a token when one is left
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+	// Prune forgets the buckets untouched since before
+	Prune(ctx context.Context, before time.Time) error
+}
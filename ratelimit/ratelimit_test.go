@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lesson/simple-bank/db/memstore"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	testCases := []struct {
+		policy string
+		want   Policy
+		err    string
+	}{
+		{"ip:10/1m", Policy{Key: KeyIP, Limit: 10, Period: time.Minute}, ""},
+		{"user:5/30s", Policy{Key: KeyUser, Limit: 5, Period: 30 * time.Second}, ""},
+		{"route:100/1s", Policy{Key: KeyRoute, Limit: 100, Period: time.Second}, ""},
+		{"", Policy{}, ""},
+		{"off", Policy{}, ""},
+		{"10/1m", Policy{}, "isn't KEY:LIMIT/PERIOD"},
+		{"ip:10", Policy{}, "isn't KEY:LIMIT/PERIOD"},
+		{"account:10/1m", Policy{}, `key "account" is unknown`},
+		{"ip:0/1m", Policy{}, "needs a positive limit"},
+		{"ip:ten/1m", Policy{}, "needs a positive limit"},
+		{"ip:10/2h", Policy{}, "needs a period between 0 and 1h0m0s"},
+		{"ip:10/minute", Policy{}, "needs a period"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			policy, err := ParsePolicy(tc.policy)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, policy)
+			require.Equal(t, tc.want.Enabled(), policy.Enabled())
+		})
+	}
+
+	policy, err := ParsePolicy("ip:10/1m0s")
+	require.NoError(t, err)
+	require.Equal(t, "ip:10/1m0s", policy.String())
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	policy := Policy{Key: KeyIP, Limit: 2, Period: time.Minute}
+
+	result, err := store.Take(ctx, "a", policy)
+	require.NoError(t, err)
+	require.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second}, result)
+	result, err = store.Take(ctx, "a", policy)
+	require.NoError(t, err)
+	require.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute}, result)
+
+	// a token comes back every 30s
+	now = now.Add(10 * time.Second)
+	result, err = store.Take(ctx, "a", policy)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Zero(t, result.Remaining)
+	require.InDelta(t, 20*time.Second, result.RetryAfter, float64(time.Millisecond))
+
+	result, err = store.Take(ctx, "b", policy)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	now = now.Add(20 * time.Second)
+	result, err = store.Take(ctx, "a", policy)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	// the buckets never hold more than the limit
+	now = now.Add(time.Hour)
+	result, err = store.Take(ctx, "a", policy)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Remaining)
+
+	require.NoError(t, store.Prune(ctx, now))
+	require.Len(t, store.buckets, 1)
+	require.Contains(t, store.buckets, "a")
+}
+
+func TestPostgresStore(t *testing.T) {
+	store := NewPostgresStore(memstore.New())
+	ctx := context.Background()
+	policy := Policy{Key: KeyUser, Limit: 1, Period: time.Hour}
+
+	result, err := store.Take(ctx, "auth:user:alice", policy)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.Zero(t, result.Remaining)
+
+	result, err = store.Take(ctx, "auth:user:alice", policy)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.InDelta(t, time.Hour, result.RetryAfter, float64(time.Second))
+
+	require.NoError(t, store.Prune(ctx, time.Now().Add(time.Minute)))
+	result, err = store.Take(ctx, "auth:user:alice", policy)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+}
@@ -0,0 +1,115 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MasterKeySize is the size of the AES-256 master key
+const MasterKeySize = 32
+
+var errSealed = errors.New("can't open secrets file, wrong master key or corrupted file")
+
+// NewMasterKey returns a random master key in the encoding read by ParseMasterKey
+func NewMasterKey() (string, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseMasterKey decodes a base64 master key
+func ParseMasterKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != MasterKeySize {
+		return nil, fmt.Errorf("%s must be %d base64 encoded bytes", MasterKeyName, MasterKeySize)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts the secrets with AES-256-GCM, the result is the base64 of the nonce followed by the ciphertext
+func Seal(key []byte, secrets map[string]string) ([]byte, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// Open decrypts secrets encrypted by Seal
+func Open(key []byte, data []byte) (map[string]string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errSealed
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errSealed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errSealed
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, errSealed
+	}
+	return secrets, nil
+}
+
+// EncryptedFile reads secrets from a file sealed with the master key,
+// the file is read again on every call so a rotated file is picked up
+type EncryptedFile struct {
+	path string
+	key  []byte
+}
+
+func NewEncryptedFile(path string, key []byte) *EncryptedFile {
+	return &EncryptedFile{path: path, key: key}
+}
+
+func (file *EncryptedFile) Secret(name string) (string, error) {
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		return "", err
+	}
+
+	secrets, err := Open(file.key, data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", file.path, err)
+	}
+	return Static(secrets).Secret(name)
+}
@@ -0,0 +1,96 @@
+// Package secret resolves secrets like the token key or the db password from the environment,
+// mounted files or an encrypted file, so they don't have to sit in config.env
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by a provider that doesn't have the secret
+var ErrNotFound = errors.New("secret not found")
+
+// MasterKeyName names the master key of the encrypted secrets file,
+// it can only come from the environment or a mounted file
+const MasterKeyName = "SECRETSMASTERKEY"
+
+// Provider returns the current value of a secret, values may change when secrets are rotated
+type Provider interface {
+	Secret(name string) (string, error)
+}
+
+// Env reads the secret from the env variable of the same name
+type Env struct{}
+
+func (Env) Secret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// File reads the secret from the file named by the <name>_FILE env variable,
+// like the files docker and kubernetes mount, the file is read again on every call
+type File struct{}
+
+func (File) Secret(name string) (string, error) {
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok || path == "" {
+		return "", ErrNotFound
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("can't read %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Static serves fixed values, like the ones of config.env
+type Static map[string]string
+
+func (static Static) Secret(name string) (string, error) {
+	value, ok := static[name]
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Chain asks the providers in order and returns the first secret found
+type Chain []Provider
+
+func (chain Chain) Secret(name string) (string, error) {
+	for _, provider := range chain {
+		value, err := provider.Secret(name)
+		if !errors.Is(err, ErrNotFound) {
+			return value, err
+		}
+	}
+	return "", ErrNotFound
+}
+
+// NewProvider returns the provider used by the config: <name>_FILE first, then the encrypted
+// secrets file when path is set, then the env variables
+func NewProvider(path string) (Provider, error) {
+	if path == "" {
+		return Chain{File{}, Env{}}, nil
+	}
+
+	masterKey, err := Chain{File{}, Env{}}.Secret(MasterKeyName)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%s is required to open %s", MasterKeyName, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseMasterKey(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return Chain{File{}, NewEncryptedFile(path, key), Env{}}, nil
+}
@@ -0,0 +1,101 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvAndFile(t *testing.T) {
+	t.Setenv("TEST_SECRET", "from-env")
+	value, err := Env{}.Secret("TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "from-env", value)
+
+	_, err = File{}.Secret("TEST_SECRET")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+	t.Setenv("TEST_SECRET_FILE", path)
+	value, err = File{}.Secret("TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "from-file", value)
+
+	// a file is preferred over the env variable
+	value, err = Chain{File{}, Env{}}.Secret("TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "from-file", value)
+
+	t.Setenv("TEST_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, err = Chain{File{}, Env{}}.Secret("TEST_SECRET")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrNotFound)
+
+	_, err = Chain{File{}, Env{}, Static{"OTHER": "value"}}.Secret("UNKNOWN_SECRET")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSealOpen(t *testing.T) {
+	masterKey, err := NewMasterKey()
+	require.NoError(t, err)
+	key, err := ParseMasterKey(masterKey)
+	require.NoError(t, err)
+
+	secrets := map[string]string{"SECRETEKEY": "0123456789abcdef0123456789abcdef", "DBPASSWORD": "p@ss=word"}
+	data, err := Seal(key, secrets)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "p@ss=word")
+
+	opened, err := Open(key, data)
+	require.NoError(t, err)
+	require.Equal(t, secrets, opened)
+
+	otherKey, err := NewMasterKey()
+	require.NoError(t, err)
+	other, err := ParseMasterKey(otherKey)
+	require.NoError(t, err)
+	_, err = Open(other, data)
+	require.ErrorIs(t, err, errSealed)
+
+	_, err = Open(key, []byte("not base64!"))
+	require.ErrorIs(t, err, errSealed)
+
+	_, err = ParseMasterKey("c2hvcnQ=")
+	require.Error(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Setenv(MasterKeyName, "")
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+
+	_, err := NewProvider(path)
+	require.ErrorContains(t, err, MasterKeyName+" is required")
+
+	masterKey, err := NewMasterKey()
+	require.NoError(t, err)
+	t.Setenv(MasterKeyName, masterKey)
+	key, err := ParseMasterKey(masterKey)
+	require.NoError(t, err)
+
+	data, err := Seal(key, map[string]string{"TEST_SECRET": "sealed"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	provider, err := NewProvider(path)
+	require.NoError(t, err)
+	t.Setenv("TEST_SECRET", "from-env")
+	value, err := provider.Secret("TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "sealed", value)
+
+	// the file is read again, so a rotated secret is returned
+	data, err = Seal(key, map[string]string{"TEST_SECRET": "rotated"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	value, err = provider.Secret("TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "rotated", value)
+}
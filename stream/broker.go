@@ -0,0 +1,87 @@
+package stream
+
+import "sync"
+
+const defaultBufferSize = 64
+
+// Subscription receives the events of one account until it is closed,
+// C is closed when the subscriber falls behind or the broker loses events so the client must resume
+type Subscription struct {
+	C         <-chan AccountEvent
+	c         chan AccountEvent
+	accountID int64
+	closeOnce sync.Once
+}
+
+func (sub *Subscription) close() {
+	sub.closeOnce.Do(func() { close(sub.c) })
+}
+
+// Broker fans account events out to the subscriptions of the server instance
+type Broker struct {
+	mu   sync.Mutex
+	subs map[int64]map[*Subscription]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[int64]map[*Subscription]struct{})}
+}
+
+// Subscribe starts receiving the events of accountID
+func (broker *Broker) Subscribe(accountID int64) *Subscription {
+	c := make(chan AccountEvent, defaultBufferSize)
+	sub := &Subscription{C: c, c: c, accountID: accountID}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if broker.subs[accountID] == nil {
+		broker.subs[accountID] = make(map[*Subscription]struct{})
+	}
+	broker.subs[accountID][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes and closes the subscription, it is safe to call more than once
+func (broker *Broker) Unsubscribe(sub *Subscription) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	broker.remove(sub)
+}
+
+func (broker *Broker) remove(sub *Subscription) {
+	subs := broker.subs[sub.accountID]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(broker.subs, sub.accountID)
+	}
+	sub.close()
+}
+
+// Publish hands the event to every subscription of its account without blocking,
+// a subscription whose buffer is full is dropped
+func (broker *Broker) Publish(event AccountEvent) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for sub := range broker.subs[event.AccountID] {
+		select {
+		case sub.c <- event:
+		default:
+			broker.remove(sub)
+		}
+	}
+}
+
+// Reset drops every subscription, it is used when notifications may have been missed
+func (broker *Broker) Reset() {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for _, subs := range broker.subs {
+		for sub := range subs {
+			broker.remove(sub)
+		}
+	}
+}
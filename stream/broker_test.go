@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerPublish(t *testing.T) {
+	broker := NewBroker()
+	sub1 := broker.Subscribe(1)
+	sub2 := broker.Subscribe(1)
+	other := broker.Subscribe(2)
+
+	broker.Publish(AccountEvent{EntryID: 10, AccountID: 1, Amount: -5, Balance: 95})
+
+	for _, sub := range []*Subscription{sub1, sub2} {
+		event := <-sub.C
+		require.Equal(t, int64(10), event.EntryID)
+		require.Equal(t, int64(95), event.Balance)
+	}
+	require.Empty(t, other.C)
+
+	broker.Unsubscribe(sub1)
+	broker.Unsubscribe(sub1)
+	_, ok := <-sub1.C
+	require.False(t, ok)
+
+	broker.Publish(AccountEvent{EntryID: 11, AccountID: 1})
+	require.Equal(t, int64(11), (<-sub2.C).EntryID)
+}
+
+func TestBrokerDropsSlowSubscriber(t *testing.T) {
+	broker := NewBroker()
+	sub := broker.Subscribe(1)
+
+	for i := 0; i <= defaultBufferSize; i++ {
+		broker.Publish(AccountEvent{EntryID: int64(i + 1), AccountID: 1})
+	}
+
+	// the buffered events are still delivered, then the closed channel tells the client to resume
+	n := 0
+	for range sub.C {
+		n++
+	}
+	require.Equal(t, defaultBufferSize, n)
+	require.Empty(t, broker.subs)
+}
+
+func TestBrokerReset(t *testing.T) {
+	broker := NewBroker()
+	sub1 := broker.Subscribe(1)
+	sub2 := broker.Subscribe(2)
+
+	broker.Reset()
+
+	_, ok := <-sub1.C
+	require.False(t, ok)
+	_, ok = <-sub2.C
+	require.False(t, ok)
+	broker.Unsubscribe(sub1)
+}
+
+func TestListenerDispatch(t *testing.T) {
+	broker := NewBroker()
+	sub := broker.Subscribe(7)
+	listener := NewListener("", broker, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	listener.dispatch(`{"entry_id":3,"account_id":7,"amount":-10,"balance":90,"transfer_id":null,"created_at":"2024-01-02T03:04:05.123456+00:00"}`)
+	listener.dispatch(`not json`)
+
+	event := <-sub.C
+	require.Equal(t, int64(3), event.EntryID)
+	require.Equal(t, int64(-10), event.Amount)
+	require.Equal(t, int64(90), event.Balance)
+	require.Zero(t, event.TransferID)
+	require.Equal(t, 2024, event.CreatedAt.Year())
+	require.Empty(t, sub.C)
+}
@@ -0,0 +1,32 @@
+package stream
+
+import (
+	db "lesson/simple-bank/db/sqlc"
+	"time"
+)
+
+// Channel is the Postgres notification channel the entries trigger publishes to
+const Channel = "account_entries"
+
+// AccountEvent is one entry posted to an account together with the balance right after it,
+// its EntryID is the event id clients resume from
+type AccountEvent struct {
+	EntryID    int64     `json:"entry_id"`
+	AccountID  int64     `json:"account_id"`
+	Amount     int64     `json:"amount"`
+	Balance    int64     `json:"balance"`
+	TransferID int64     `json:"transfer_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewAccountEvent converts a row replayed from the entries table
+func NewAccountEvent(row db.ListAccountEntriesAfterRow) AccountEvent {
+	return AccountEvent{
+		EntryID:    row.ID,
+		AccountID:  row.AccountID,
+		Amount:     row.Amount,
+		Balance:    row.Balance,
+		TransferID: row.TransferID.Int64,
+		CreatedAt:  row.CreatedAt,
+	}
+}
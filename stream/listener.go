@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	// pq pings the connection when no notification arrived for this long
+	pingInterval = 90 * time.Second
+)
+
+// Listener feeds the broker with the notifications sent by the entries trigger,
+// every server instance runs one so events reach clients connected to any of them
+type Listener struct {
+	dataSource string
+	broker     *Broker
+	logger     *slog.Logger
+}
+
+func NewListener(dataSource string, broker *Broker, logger *slog.Logger) *Listener {
+	return &Listener{dataSource: dataSource, broker: broker, logger: logger}
+}
+
+// Run listens until ctx is canceled
+func (listener *Listener) Run(ctx context.Context) error {
+	pqListener := pq.NewListener(listener.dataSource, minReconnectInterval, maxReconnectInterval,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				listener.logger.WarnContext(ctx, "stream listener connection failed", "error", err)
+			}
+		})
+	defer pqListener.Close()
+
+	if err := pqListener.Listen(Channel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-pqListener.Notify:
+			if n == nil {
+				// the connection was re-established and notifications may have been lost,
+				// clients reconnect and replay from their last event id
+				listener.broker.Reset()
+				continue
+			}
+			listener.dispatch(n.Extra)
+		case <-time.After(pingInterval):
+			if err := pqListener.Ping(); err != nil {
+				listener.logger.WarnContext(ctx, "can't ping stream listener", "error", err)
+			}
+		}
+	}
+}
+
+func (listener *Listener) dispatch(payload string) {
+	var event AccountEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		listener.logger.Error("invalid account event notification", "payload", payload, "error", err)
+		return
+	}
+	listener.broker.Publish(event)
+}
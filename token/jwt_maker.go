@@ -2,6 +2,7 @@ package token
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -11,7 +12,13 @@ type JwtMaker struct {
 	secreteKey string
 }
 
+// MinSecreteKeySize is the shortest key accepted for signing HS256 tokens
+const MinSecreteKeySize = 32
+
 func NewJWTMaker(secreteKey string) (Maker, error) {
+	if len(secreteKey) < MinSecreteKeySize {
+		return nil, fmt.Errorf("invalid key size: must be at least %d characters", MinSecreteKeySize)
+	}
 	return &JwtMaker{secreteKey: secreteKey}, nil
 }
 
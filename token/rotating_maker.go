@@ -0,0 +1,112 @@
+package token
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"lesson/simple-bank/secret"
+)
+
+// RotatingJWTMaker signs tokens with the current key of a secret provider and reads the key again
+// once refresh has passed, so a rotated key is used without a restart. The previous key is accepted
+// for grace after the rotation, the access token duration, and only for tokens issued before the rotation,
+// so a leaked key that was rotated out can't mint new tokens
+type RotatingJWTMaker struct {
+	provider secret.Provider
+	name     string
+	refresh  time.Duration
+	grace    time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu        sync.Mutex
+	key       string
+	current   Maker
+	previous  Maker
+	readAt    time.Time
+	rotatedAt time.Time
+}
+
+func NewRotatingJWTMaker(provider secret.Provider, name string, refresh time.Duration, grace time.Duration, logger *slog.Logger) (Maker, error) {
+	maker := &RotatingJWTMaker{
+		provider: provider,
+		name:     name,
+		refresh:  refresh,
+		grace:    grace,
+		logger:   logger,
+		now:      time.Now,
+	}
+	if _, _, _, err := maker.makers(); err != nil {
+		return nil, err
+	}
+	return maker, nil
+}
+
+// makers returns the makers of the current and the previous key with the time of the rotation,
+// a key that can't be read or is invalid is logged and the last good one is kept
+func (maker *RotatingJWTMaker) makers() (current Maker, previous Maker, rotatedAt time.Time, err error) {
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+
+	now := maker.now()
+	// the tokens of the previous key have all expired
+	if maker.previous != nil && now.Sub(maker.rotatedAt) >= maker.grace {
+		maker.previous = nil
+	}
+	if maker.current != nil && now.Sub(maker.readAt) < maker.refresh {
+		return maker.current, maker.previous, maker.rotatedAt, nil
+	}
+	maker.readAt = now
+
+	key, err := maker.provider.Secret(maker.name)
+	if err == nil && key != maker.key {
+		var next Maker
+		next, err = NewJWTMaker(key)
+		if err == nil {
+			if maker.current != nil {
+				maker.logger.Info("token key rotated", "key", maker.name)
+			}
+			maker.key, maker.previous, maker.current = key, maker.current, next
+			maker.rotatedAt = now
+		}
+	}
+	if err != nil {
+		if maker.current == nil {
+			return nil, nil, time.Time{}, err
+		}
+		maker.logger.Warn("can't read token key, keeping the current one", "key", maker.name, "error", err)
+	}
+	return maker.current, maker.previous, maker.rotatedAt, nil
+}
+
+func (maker *RotatingJWTMaker) CreateToken(username string, duration time.Duration) (string, *Payload, error) {
+	current, _, _, err := maker.makers()
+	if err != nil {
+		return "", nil, err
+	}
+	return current.CreateToken(username, duration)
+}
+
+func (maker *RotatingJWTMaker) VerifyToken(token string) (*Payload, error) {
+	current, previous, rotatedAt, err := maker.makers()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := current.VerifyToken(token)
+	if !errors.Is(err, ErrInvalidToken) || previous == nil {
+		return payload, err
+	}
+
+	payload, err = previous.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// the previous key only vouches for the tokens it signed while it was current
+	if !payload.IssuedAt.Before(rotatedAt) {
+		return nil, ErrInvalidToken
+	}
+	return payload, nil
+}
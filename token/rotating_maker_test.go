@@ -0,0 +1,113 @@
+package token
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"lesson/simple-bank/secret"
+	"lesson/simple-bank/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingJWTMaker(t *testing.T) {
+	keys := secret.Static{"KEY": utils.RandomString(32)}
+	maker, err := NewRotatingJWTMaker(keys, "KEY", 0, time.Hour, discardLogger())
+	require.NoError(t, err)
+
+	oldToken, _, err := maker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	keys["KEY"] = utils.RandomString(32)
+	newToken, _, err := maker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	// the new token is signed with the rotated key
+	rotated, err := NewJWTMaker(keys["KEY"])
+	require.NoError(t, err)
+	_, err = rotated.VerifyToken(newToken)
+	require.NoError(t, err)
+
+	// the tokens of the previous key stay valid
+	_, err = maker.VerifyToken(oldToken)
+	require.NoError(t, err)
+	_, err = maker.VerifyToken(newToken)
+	require.NoError(t, err)
+
+	// an invalid key is ignored
+	keys["KEY"] = "short"
+	_, err = maker.VerifyToken(newToken)
+	require.NoError(t, err)
+
+	// only the last two keys are accepted
+	keys["KEY"] = utils.RandomString(32)
+	_, err = maker.VerifyToken(newToken)
+	require.NoError(t, err)
+	keys["KEY"] = utils.RandomString(32)
+	_, err = maker.VerifyToken(oldToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRotatingJWTMakerRefresh(t *testing.T) {
+	keys := secret.Static{"KEY": utils.RandomString(32)}
+	maker, err := NewRotatingJWTMaker(keys, "KEY", time.Hour, time.Hour, discardLogger())
+	require.NoError(t, err)
+
+	token, _, err := maker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	// the key isn't read again before the refresh interval
+	keys["KEY"] = utils.RandomString(32)
+	current, err := NewJWTMaker(keys["KEY"])
+	require.NoError(t, err)
+	token2, _, err := maker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+	_, err = current.VerifyToken(token2)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = maker.VerifyToken(token)
+	require.NoError(t, err)
+
+	_, err = NewRotatingJWTMaker(secret.Static{}, "KEY", time.Hour, time.Hour, discardLogger())
+	require.ErrorIs(t, err, secret.ErrNotFound)
+	_, err = NewRotatingJWTMaker(secret.Static{"KEY": "short"}, "KEY", time.Hour, time.Hour, discardLogger())
+	require.Error(t, err)
+}
+
+func TestRotatingJWTMakerGrace(t *testing.T) {
+	oldKey := utils.RandomString(32)
+	keys := secret.Static{"KEY": oldKey}
+	maker, err := NewRotatingJWTMaker(keys, "KEY", 0, time.Minute, discardLogger())
+	require.NoError(t, err)
+	var elapsed time.Duration
+	maker.(*RotatingJWTMaker).now = func() time.Time { return time.Now().Add(elapsed) }
+
+	oldToken, _, err := maker.CreateToken(utils.RandomOwner(), time.Hour)
+	require.NoError(t, err)
+
+	keys["KEY"] = utils.RandomString(32)
+	_, err = maker.VerifyToken(oldToken)
+	require.NoError(t, err)
+
+	// the old key can't sign tokens once it is rotated out
+	leaked, err := NewJWTMaker(oldKey)
+	require.NoError(t, err)
+	forged, _, err := leaked.CreateToken(utils.RandomOwner(), time.Hour)
+	require.NoError(t, err)
+	_, err = maker.VerifyToken(forged)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// nor be used at all past the access token duration
+	elapsed = time.Minute
+	_, err = maker.VerifyToken(oldToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	forged, _, err = leaked.CreateToken(utils.RandomOwner(), time.Hour)
+	require.NoError(t, err)
+	_, err = maker.VerifyToken(forged)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
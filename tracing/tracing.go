@@ -0,0 +1,71 @@
+// Package tracing sets up the OpenTelemetry tracer provider of the server. The spans are started
+// by the gin middleware of the api package and by the store for the transactions and the queries,
+// the W3C trace context of the inbound requests is their parent.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"lesson/simple-bank/buildinfo"
+	"lesson/simple-bank/config"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ServiceName names the service of the spans
+const ServiceName = "simple-bank"
+
+// exporters of TRACINGEXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// stdout is where the stdout exporter writes, tests replace it
+var stdout io.Writer = os.Stdout
+
+// Setup installs the W3C trace context propagator and, unless the exporter is none, a tracer provider
+// exporting to stdout or to an OTLP/HTTP collector. shutdown flushes the pending spans.
+func Setup(ctx context.Context, config config.Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch config.TracingExporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case ExporterOTLP:
+		// without an endpoint the exporter reads the OTEL_EXPORTER_OTLP_* env variables
+		var options []otlptracehttp.Option
+		if config.TracingOTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.TracingOTLPEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.TracingExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't create %s exporter: %w", config.TracingExporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TracingSampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", ServiceName),
+			attribute.String("service.version", buildinfo.Get().Commit),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"lesson/simple-bank/config"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetupStdout(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	shutdown, err := Setup(context.Background(), config.Config{TracingExporter: ExporterStdout, TracingSampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "transfer")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+	require.Contains(t, buf.String(), `"Name":"transfer"`)
+	require.Contains(t, buf.String(), ServiceName)
+}
+
+func TestSetupPropagation(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Config{TracingExporter: ExporterNone})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	// the W3C trace context is propagated even without an exporter
+	carrier := propagation.HeaderCarrier{}
+	carrier.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+
+	injected := propagation.HeaderCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, injected)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", injected.Get("traceparent"))
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), config.Config{TracingExporter: "zipkin"})
+	require.ErrorContains(t, err, `unknown tracing exporter "zipkin"`)
+}
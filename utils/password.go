@@ -1,6 +1,10 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func HashedPassword(passwd string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost)
@@ -12,4 +16,16 @@ func HashedPassword(passwd string) (string, error) {
 
 func ComparePassword(hashedPassword string, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
\ No newline at end of file
+}
+
+// dummyHash is a hash of the cost of the real ones that no password is compared successfully against
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(RandomString(32)), bcrypt.DefaultCost)
+	return hash
+})
+
+// CompareDummyPassword takes as long as ComparePassword, the logins of unknown users call it
+// so the response time doesn't tell whether a username exists
+func CompareDummyPassword(password string) {
+	bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashedPassword(t *testing.T) {
@@ -19,4 +20,16 @@ func TestHashedPassword(t *testing.T) {
 	passwd2 := RandomString(6)
 	err = ComparePassword(passwd2, passwd)
 	require.Error(t, err)
-}
\ No newline at end of file
+}
+func TestCompareDummyPassword(t *testing.T) {
+	// the dummy hash costs as much as the hashes of the users
+	hashedPd, err := HashedPassword(RandomString(6))
+	require.NoError(t, err)
+	userCost, err := bcrypt.Cost([]byte(hashedPd))
+	require.NoError(t, err)
+	dummyCost, err := bcrypt.Cost(dummyHash())
+	require.NoError(t, err)
+	require.Equal(t, userCost, dummyCost)
+
+	CompareDummyPassword(RandomString(6))
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/event"
+)
+
+// Dispatcher turns domain events into pending deliveries for the endpoints of the users they concern.
+// It is an outbox.Publisher, so it runs for every event relayed from the outbox.
+type Dispatcher struct {
+	store db.Store
+}
+
+func NewDispatcher(store db.Store) *Dispatcher {
+	return &Dispatcher{store: store}
+}
+
+// Publish creates one delivery per subscribed endpoint, a redelivered event doesn't create duplicates
+func (dispatcher *Dispatcher) Publish(ctx context.Context, e event.Envelope) error {
+	owners, err := dispatcher.owners(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	for _, owner := range owners {
+		webhooks, err := dispatcher.store.ListSubscribedWebhooks(ctx, db.ListSubscribedWebhooksParams{
+			Owner:     owner,
+			EventType: e.Type,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, webhook := range webhooks {
+			_, err = dispatcher.store.CreateWebhookDelivery(ctx, db.CreateWebhookDeliveryParams{
+				WebhookID: webhook.ID,
+				EventID:   sql.NullInt64{Int64: e.ID, Valid: true},
+				EventType: e.Type,
+				Payload:   body,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// owners returns the users notified of an event, for a transfer both account owners
+func (dispatcher *Dispatcher) owners(ctx context.Context, e event.Envelope) ([]string, error) {
+	payload, err := e.Decode()
+	if err != nil {
+		// events this version doesn't know about have no subscribers
+		return nil, nil
+	}
+
+	switch payload := payload.(type) {
+	case *event.UserCreatedV1:
+		return []string{payload.Username}, nil
+	case *event.AccountOpenedV1:
+		return []string{payload.Owner}, nil
+	case *event.TransferCreatedV1:
+		var owners []string
+		for _, accountID := range []int64{payload.FromAccountID, payload.ToAccountID} {
+			account, err := dispatcher.store.GetAccount(ctx, accountID)
+			if err != nil {
+				return nil, err
+			}
+			if len(owners) == 0 || owners[0] != account.Owner {
+				owners = append(owners, account.Owner)
+			}
+		}
+		return owners, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	db "lesson/simple-bank/db/sqlc"
+	"lesson/simple-bank/event"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcherTransferCreated(t *testing.T) {
+	store := newFakeStore()
+	store.accounts[1] = db.Account{ID: 1, Owner: "customer", Currency: "USD"}
+	store.accounts[2] = db.Account{ID: 2, Owner: "merchant", Currency: "USD"}
+	store.webhooks[1] = db.Webhook{ID: 1, Owner: "merchant", EventTypes: []string{event.TypeTransferCreated}}
+	store.webhooks[2] = db.Webhook{ID: 2, Owner: "merchant", EventTypes: []string{event.TypeAccountOpened}}
+	store.webhooks[3] = db.Webhook{ID: 3, Owner: "other", EventTypes: []string{}}
+
+	data, err := json.Marshal(event.TransferCreatedV1{TransferID: 9, FromAccountID: 1, ToAccountID: 2, Amount: 10, Currency: "USD"})
+	require.NoError(t, err)
+	e := event.Envelope{
+		ID:            42,
+		Type:          event.TypeTransferCreated,
+		Version:       1,
+		AggregateType: event.AggregateTransfer,
+		AggregateID:   "9",
+		OccurredAt:    time.Now(),
+		Data:          data,
+	}
+
+	require.NoError(t, NewDispatcher(store).Publish(context.Background(), e))
+
+	// only the merchant endpoint subscribed to transfers gets a delivery
+	require.Len(t, store.deliveries, 1)
+	delivery := store.deliveries[0]
+	require.Equal(t, int64(1), delivery.WebhookID)
+	require.Equal(t, int64(42), delivery.EventID.Int64)
+	require.Equal(t, event.TypeTransferCreated, delivery.EventType)
+
+	var sent event.Envelope
+	require.NoError(t, json.Unmarshal(delivery.Payload, &sent))
+	require.Equal(t, e.ID, sent.ID)
+	require.JSONEq(t, string(data), string(sent.Data))
+}
+
+func TestDispatcherUnknownEvent(t *testing.T) {
+	store := newFakeStore()
+	store.webhooks[1] = db.Webhook{ID: 1, Owner: "merchant", EventTypes: []string{}}
+
+	e := event.Envelope{ID: 1, Type: "SomethingNew", Version: 1, Data: json.RawMessage(`{}`)}
+	require.NoError(t, NewDispatcher(store).Publish(context.Background(), e))
+	require.Empty(t, store.deliveries)
+}
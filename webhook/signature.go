@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries "t=<unix seconds>,v1=<hex hmac>" where the hmac-sha256
+// is computed with the endpoint secret over "<unix seconds>.<body>"
+const SignatureHeader = "X-Webhook-Signature"
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// NewSecret generates the shared secret of a new endpoint
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value of body sent at timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, computeMAC(secret, t, body))
+}
+
+// VerifySignature checks a signature header the way a receiver does,
+// the timestamp must be within tolerance of now to stop replays
+func VerifySignature(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t, mac string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			mac = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || mac == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(mac), []byte(computeMAC(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+
+	diff := now.Sub(time.Unix(unix, 0))
+	if diff > tolerance || diff < -tolerance {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+func computeMAC(secret string, t string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
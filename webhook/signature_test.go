@@ -0,0 +1,25 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, "whsec_"))
+
+	body := []byte(`{"type":"TransferCreated"}`)
+	now := time.Now()
+	header := Sign(secret, now, body)
+
+	require.NoError(t, VerifySignature(secret, header, body, time.Minute, now))
+	require.ErrorIs(t, VerifySignature(secret, header, []byte(`{}`), time.Minute, now), ErrInvalidSignature)
+	require.ErrorIs(t, VerifySignature("other", header, body, time.Minute, now), ErrInvalidSignature)
+	require.ErrorIs(t, VerifySignature(secret, header, body, time.Minute, now.Add(2*time.Minute)), ErrExpiredSignature)
+	require.ErrorIs(t, VerifySignature(secret, "v1=abc", body, time.Minute, now), ErrInvalidSignature)
+}
@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"encoding/json"
+	"lesson/simple-bank/event"
+	"strconv"
+	"time"
+)
+
+// TestEventType is the event type of the deliveries made by the "send test event" API
+const TestEventType = "WebhookTest"
+
+type testEventData struct {
+	WebhookID int64  `json:"webhook_id"`
+	Message   string `json:"message"`
+}
+
+// NewTestPayload builds the body of a test delivery, it has the same envelope as the domain events
+func NewTestPayload(webhookID int64, now time.Time) ([]byte, error) {
+	data, err := json.Marshal(testEventData{
+		WebhookID: webhookID,
+		Message:   "this is a test event",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(event.Envelope{
+		Type:          TestEventType,
+		Version:       1,
+		AggregateType: "webhook",
+		AggregateID:   strconv.FormatInt(webhookID, 10),
+		OccurredAt:    now,
+		Data:          data,
+	})
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// blockedHosts are names that resolve to internal addresses on most hosts and cloud providers
+var blockedHosts = []string{"localhost", "metadata.google.internal"}
+
+// sharedAddressSpace is the carrier-grade NAT range, it isn't reachable from the internet either
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// CheckURL validates the URL of a webhook endpoint, it must be https and must not point at a
+// loopback, private or link-local address, the cloud metadata endpoints included.
+// Host names are checked again when the worker dials them, since they may resolve to anything
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return errors.New("must be an https URL")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return errors.New("must have a host")
+	}
+	for _, blocked := range blockedHosts {
+		if host == blocked || strings.HasSuffix(host, "."+blocked) {
+			return fmt.Errorf("must not point at %s", blocked)
+		}
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(addr)
+	}
+	return nil
+}
+
+// checkAddr rejects the addresses a webhook must not reach
+func checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	switch {
+	case addr.IsLoopback():
+		return errors.New("must not point at a loopback address")
+	case addr.IsPrivate(), sharedAddressSpace.Contains(addr):
+		return errors.New("must not point at a private address")
+	case addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast():
+		return errors.New("must not point at a link-local address")
+	case addr.IsUnspecified(), addr.IsMulticast():
+		return errors.New("must point at a unicast address")
+	}
+	return nil
+}
+
+// dialControl runs after a host name is resolved and before connecting, so it also catches
+// public names that resolve to internal addresses
+func dialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if err := checkAddr(addrPort.Addr()); err != nil {
+		return fmt.Errorf("refusing to dial %s: %w", address, err)
+	}
+	return nil
+}
+
+// newClient returns a client that only talks https to public addresses, redirects included
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: dialControl,
+	}
+	transport := &http.Transport{
+		// no proxy, the dial checks must apply to the endpoint itself
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return CheckURL(req.URL.String())
+		},
+	}
+}
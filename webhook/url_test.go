@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckURL(t *testing.T) {
+	testCases := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://merchant.example.com/hooks", true},
+		{"https://93.184.216.34:8443/hooks", true},
+		{"http://merchant.example.com/hooks", false},
+		{"ftp://merchant.example.com/hooks", false},
+		{"https:///hooks", false},
+		{"https://localhost/hooks", false},
+		{"https://api.localhost./hooks", false},
+		{"https://metadata.google.internal/computeMetadata/v1", false},
+		{"https://127.0.0.1/hooks", false},
+		{"https://[::1]/hooks", false},
+		{"https://[::ffff:127.0.0.1]/hooks", false},
+		{"https://10.0.0.8/hooks", false},
+		{"https://172.16.4.2/hooks", false},
+		{"https://192.168.1.10/hooks", false},
+		{"https://100.64.0.1/hooks", false},
+		{"https://[fd00::1]/hooks", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://[fe80::1]/hooks", false},
+		{"https://0.0.0.0/hooks", false},
+	}
+
+	for _, tc := range testCases {
+		err := CheckURL(tc.url)
+		if tc.ok {
+			require.NoError(t, err, tc.url)
+		} else {
+			require.Error(t, err, tc.url)
+		}
+	}
+}
+
+func TestWorkerDeliverRefusesInternalAddress(t *testing.T) {
+	store := newFakeStore()
+	r := newReceiver(t, http.StatusNoContent)
+	_, delivery := setupWebhook(t, store, r.URL)
+
+	// the default client dials the receiver on 127.0.0.1
+	delivery, err := NewWorker(store, time.Second, time.Second, discardLogger()).Deliver(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, delivery.Status)
+	require.Contains(t, delivery.LastError, "must not point at a loopback address")
+	require.Empty(t, r.requests)
+}
+
+func TestWorkerDeliverRefusesPlainHTTP(t *testing.T) {
+	store := newFakeStore()
+	r := newReceiver(t, http.StatusNoContent)
+	_, delivery := setupWebhook(t, store, "http://merchant.example.com/hooks")
+
+	delivery, err := newTestWorker(store, r).Deliver(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, delivery.Status)
+	require.Equal(t, "the endpoint must be an https URL", delivery.LastError)
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	db "lesson/simple-bank/db/sqlc"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+const (
+	defaultBatchSize   = 20
+	defaultMaxAttempts = 8
+	defaultBaseBackoff = 10 * time.Second
+	defaultMaxBackoff  = time.Hour
+	// a claimed delivery is hidden from other workers for this long
+	claimLease = time.Minute
+)
+
+// Worker sends pending deliveries, retrying failed ones with exponential backoff
+// until they succeed or reach MaxAttempts and are dead-lettered
+type Worker struct {
+	store       db.Store
+	client      *http.Client
+	interval    time.Duration
+	logger      *slog.Logger
+	BatchSize   int32
+	MaxAttempts int32
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func NewWorker(store db.Store, timeout time.Duration, interval time.Duration, logger *slog.Logger) *Worker {
+	return &Worker{
+		store:       store,
+		client:      newClient(timeout),
+		interval:    interval,
+		logger:      logger,
+		BatchSize:   defaultBatchSize,
+		MaxAttempts: defaultMaxAttempts,
+		BaseBackoff: defaultBaseBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+	}
+}
+
+// Backoff returns the delay before the next attempt once attempts have failed
+func (worker *Worker) Backoff(attempts int32) time.Duration {
+	delay := worker.BaseBackoff
+	for i := int32(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= worker.MaxBackoff {
+			return worker.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Deliver makes one attempt to send the delivery, records it and schedules the next one on failure
+func (worker *Worker) Deliver(ctx context.Context, delivery db.WebhookDelivery) (db.WebhookDelivery, error) {
+	webhook, err := worker.store.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return delivery, err
+	}
+
+	start := time.Now()
+	statusCode, sendErr := worker.send(ctx, webhook, delivery)
+	duration := time.Since(start)
+
+	var errMessage string
+	if sendErr != nil {
+		errMessage = sendErr.Error()
+	}
+	_, err = worker.store.CreateWebhookAttempt(ctx, db.CreateWebhookAttemptParams{
+		DeliveryID: delivery.ID,
+		StatusCode: int32(statusCode),
+		Error:      errMessage,
+		DurationMs: duration.Milliseconds(),
+	})
+	if err != nil {
+		return delivery, err
+	}
+
+	arg := db.UpdateWebhookDeliveryParams{
+		ID:             delivery.ID,
+		Status:         StatusPending,
+		Attempts:       delivery.Attempts + 1,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastStatusCode: int32(statusCode),
+		LastError:      errMessage,
+	}
+	switch {
+	case sendErr == nil:
+		arg.Status = StatusSucceeded
+		arg.DeliveredAt = sql.NullTime{Time: time.Now(), Valid: true}
+	case arg.Attempts >= worker.MaxAttempts:
+		arg.Status = StatusDead
+	default:
+		arg.NextAttemptAt = time.Now().Add(worker.Backoff(arg.Attempts))
+	}
+	return worker.store.UpdateWebhookDelivery(ctx, arg)
+}
+
+// send posts the signed payload and returns the response status code, 0 when there was no response
+func (worker *Worker) send(ctx context.Context, webhook db.Webhook, delivery db.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	// endpoints registered before https was required don't get the payload in the clear
+	if req.URL.Scheme != "https" {
+		return 0, errors.New("the endpoint must be an https URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now(), delivery.Payload))
+
+	rsp, err := worker.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(rsp.Body, 64<<10))
+
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return rsp.StatusCode, fmt.Errorf("endpoint responded with status %d", rsp.StatusCode)
+	}
+	return rsp.StatusCode, nil
+}
+
+// RunOnce claims a batch of due deliveries and attempts each of them
+func (worker *Worker) RunOnce(ctx context.Context) (int, error) {
+	deliveries, err := worker.store.ClaimDueWebhookDeliveries(ctx, db.ClaimDueWebhookDeliveriesParams{
+		LeaseUntil: time.Now().Add(claimLease),
+		Size:       worker.BatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		if _, err := worker.Deliver(ctx, delivery); err != nil {
+			worker.logger.ErrorContext(ctx, "can't deliver webhook", "delivery_id", delivery.ID, "error", err)
+		}
+	}
+	return len(deliveries), nil
+}
+
+// Run delivers due webhooks every interval until ctx is canceled
+func (worker *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := worker.RunOnce(ctx)
+		if err != nil {
+			worker.logger.ErrorContext(ctx, "can't claim webhook deliveries", "error", err)
+		}
+
+		// drain a backlog without waiting for the next tick
+		if err == nil && n == int(worker.BatchSize) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	db "lesson/simple-bank/db/sqlc"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore implements the queries used by the worker and the dispatcher in memory,
+// calling any other db.Store method panics on the nil embedded interface
+type fakeStore struct {
+	db.Store
+	mu         sync.Mutex
+	webhooks   map[int64]db.Webhook
+	accounts   map[int64]db.Account
+	deliveries []db.WebhookDelivery
+	attempts   []db.WebhookAttempt
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		webhooks: make(map[int64]db.Webhook),
+		accounts: make(map[int64]db.Account),
+	}
+}
+
+func (store *fakeStore) GetWebhook(ctx context.Context, id int64) (db.Webhook, error) {
+	return store.webhooks[id], nil
+}
+
+func (store *fakeStore) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	return store.accounts[id], nil
+}
+
+func (store *fakeStore) ListSubscribedWebhooks(ctx context.Context, arg db.ListSubscribedWebhooksParams) ([]db.Webhook, error) {
+	var hooks []db.Webhook
+	for id := int64(1); id <= int64(len(store.webhooks)); id++ {
+		hook := store.webhooks[id]
+		if hook.Owner != arg.Owner {
+			continue
+		}
+		subscribed := len(hook.EventTypes) == 0
+		for _, eventType := range hook.EventTypes {
+			subscribed = subscribed || eventType == arg.EventType
+		}
+		if subscribed {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+func (store *fakeStore) CreateWebhookDelivery(ctx context.Context, arg db.CreateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delivery := db.WebhookDelivery{
+		ID:            int64(len(store.deliveries) + 1),
+		WebhookID:     arg.WebhookID,
+		EventID:       arg.EventID,
+		EventType:     arg.EventType,
+		Payload:       arg.Payload,
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	store.deliveries = append(store.deliveries, delivery)
+	return delivery, nil
+}
+
+func (store *fakeStore) CreateWebhookAttempt(ctx context.Context, arg db.CreateWebhookAttemptParams) (db.WebhookAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	attempt := db.WebhookAttempt{
+		ID:         int64(len(store.attempts) + 1),
+		DeliveryID: arg.DeliveryID,
+		StatusCode: arg.StatusCode,
+		Error:      arg.Error,
+		DurationMs: arg.DurationMs,
+	}
+	store.attempts = append(store.attempts, attempt)
+	return attempt, nil
+}
+
+func (store *fakeStore) UpdateWebhookDelivery(ctx context.Context, arg db.UpdateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delivery := &store.deliveries[arg.ID-1]
+	delivery.Status = arg.Status
+	delivery.Attempts = arg.Attempts
+	delivery.NextAttemptAt = arg.NextAttemptAt
+	delivery.LastStatusCode = arg.LastStatusCode
+	delivery.LastError = arg.LastError
+	delivery.DeliveredAt = arg.DeliveredAt
+	return *delivery, nil
+}
+
+// receiver is the httptest stand-in of a merchant endpoint
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// newTestWorker returns a worker that trusts the receiver, the default client refuses its loopback address
+func newTestWorker(store *fakeStore, r *receiver) *Worker {
+	worker := NewWorker(store, time.Second, time.Second, discardLogger())
+	worker.client = r.Client()
+	worker.client.Timeout = time.Second
+	return worker
+}
+
+func setupWebhook(t *testing.T, store *fakeStore, url string) (db.Webhook, db.WebhookDelivery) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+
+	hook := db.Webhook{ID: 1, Owner: "merchant", Url: url, Secret: secret}
+	store.webhooks[hook.ID] = hook
+
+	body, err := NewTestPayload(hook.ID, time.Now())
+	require.NoError(t, err)
+	delivery, err := store.CreateWebhookDelivery(context.Background(), db.CreateWebhookDeliveryParams{
+		WebhookID: hook.ID,
+		EventType: TestEventType,
+		Payload:   body,
+	})
+	require.NoError(t, err)
+	return hook, delivery
+}
+
+func TestWorkerDeliver(t *testing.T) {
+	store := newFakeStore()
+	r := newReceiver(t, http.StatusNoContent)
+	hook, delivery := setupWebhook(t, store, r.URL)
+
+	worker := newTestWorker(store, r)
+	delivery, err := worker.Deliver(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, StatusSucceeded, delivery.Status)
+	require.Equal(t, int32(1), delivery.Attempts)
+	require.Equal(t, int32(http.StatusNoContent), delivery.LastStatusCode)
+	require.True(t, delivery.DeliveredAt.Valid)
+
+	require.Len(t, r.requests, 1)
+	req := r.requests[0]
+	require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	require.Equal(t, TestEventType, req.Header.Get("X-Webhook-Event"))
+	require.Equal(t, strconv.FormatInt(delivery.ID, 10), req.Header.Get("X-Webhook-Delivery"))
+	require.NoError(t, VerifySignature(hook.Secret, req.Header.Get(SignatureHeader), r.bodies[0], time.Minute, time.Now()))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(r.bodies[0], &body))
+	require.Equal(t, TestEventType, body["type"])
+
+	require.Len(t, store.attempts, 1)
+	require.Equal(t, int32(http.StatusNoContent), store.attempts[0].StatusCode)
+	require.Empty(t, store.attempts[0].Error)
+}
+
+func TestWorkerDeliverRetryThenDeadLetter(t *testing.T) {
+	store := newFakeStore()
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+	_, delivery := setupWebhook(t, store, r.URL)
+
+	worker := newTestWorker(store, r)
+	worker.MaxAttempts = 3
+
+	delivery, err := worker.Deliver(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, delivery.Status)
+	require.Equal(t, int32(http.StatusInternalServerError), delivery.LastStatusCode)
+	require.Equal(t, "endpoint responded with status 500", delivery.LastError)
+	require.WithinDuration(t, time.Now().Add(worker.Backoff(1)), delivery.NextAttemptAt, time.Second)
+
+	delivery, err = worker.Deliver(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, delivery.Status)
+	require.WithinDuration(t, time.Now().Add(worker.Backoff(2)), delivery.NextAttemptAt, time.Second)
+
+	delivery, err = worker.Deliver(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, StatusDead, delivery.Status)
+	require.Equal(t, int32(3), delivery.Attempts)
+	require.False(t, delivery.DeliveredAt.Valid)
+
+	require.Len(t, store.attempts, 3)
+	require.Equal(t, int32(http.StatusBadGateway), store.attempts[1].StatusCode)
+}
+
+func TestWorkerDeliverUnreachable(t *testing.T) {
+	store := newFakeStore()
+	r := newReceiver(t)
+	_, delivery := setupWebhook(t, store, r.URL)
+	r.Close()
+
+	delivery, err := newTestWorker(store, r).Deliver(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, delivery.Status)
+	require.Equal(t, int32(0), delivery.LastStatusCode)
+	require.NotEmpty(t, delivery.LastError)
+}
+
+func TestWorkerBackoff(t *testing.T) {
+	worker := NewWorker(newFakeStore(), time.Second, time.Second, discardLogger())
+	worker.BaseBackoff = time.Second
+	worker.MaxBackoff = 10 * time.Second
+
+	require.Equal(t, time.Second, worker.Backoff(1))
+	require.Equal(t, 2*time.Second, worker.Backoff(2))
+	require.Equal(t, 8*time.Second, worker.Backoff(4))
+	require.Equal(t, 10*time.Second, worker.Backoff(5))
+	require.Equal(t, 10*time.Second, worker.Backoff(30))
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}